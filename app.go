@@ -0,0 +1,155 @@
+package manifestgo
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/dbyington/manifestgo/internal/bundle"
+)
+
+var ErrNoAppInImage = bundle.ErrNoApp
+
+// appReader returns the metadata of the app in a container, such as a disk image or zip archive, read from r.
+type appReader func(r io.ReaderAt, size int64, opts bundle.ReadOptions) (*bundle.App, error)
+
+// readApp reads a container of an app like ReadFromURL reads a package: it is hashed in chunks while the metadata is
+// taken from the Info.plist of the app by read. container names the kind of container in errors and traces.
+func (p *Package) readApp(container string, read appReader) (err error) {
+	if p.reader == nil {
+		return errors.New("no hasher")
+	}
+
+	ctx, span := p.startSpan(context.Background(), SpanReadFromURL)
+	span.SetAttribute("url", p.reader.URL())
+	span.SetAttribute("container", container)
+	defer func() {
+		err = sourceDriftError(err)
+		span.End(err)
+	}()
+
+	if r, ok := p.reader.(hashProgressReporter); ok && p.progress != nil {
+		r.SetHashProgress(func(done, total int) {
+			p.reportProgress(Progress{Stage: StageHashing, Chunk: done, Chunks: total})
+		})
+	}
+
+	var (
+		hashes  []hash.Hash
+		lengths []int64
+		hashErr error
+	)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, span := p.startSpan(ctx, SpanHash)
+		span.SetAttribute("chunk_size", p.hashChunkSize)
+		hashes, lengths, hashErr = p.hashChunks()
+		span.SetAttribute("chunks", len(hashes))
+		span.SetAttribute("reused_chunks", p.reusedChunks)
+		span.End(hashErr)
+	}()
+
+	size := p.reader.Length()
+	if p.hashChunkSize < size {
+		size = p.hashChunkSize
+	}
+
+	p.Size = size
+	p.URL = p.reader.URL()
+	p.Etag = p.reader.Etag()
+	p.ContentLength = p.reader.Length()
+
+	_, parseSpan := p.startSpan(ctx, SpanParseMetadata)
+	err = p.fillFromApp(container, read, p.reader, p.reader.Length())
+	parseSpan.End(err)
+	// The hash is waited for even on error, rather than left reading a reader the caller may close.
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	if hashErr != nil {
+		return hashErr
+	}
+	p.Hashes = append(p.Hashes, hashes...)
+	p.chunkLengths = lengths
+	p.checkFileDigest()
+
+	return nil
+}
+
+// readAppFile reads the container of an app in the file name like readApp, hashing it whole like ReadPkgFile.
+func readAppFile(name, container string, read appReader, opts []Option) (*Package, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fstat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	shaSum, err := Sha256SumReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Package{
+		Hashes:        []hash.Hash{shaSum},
+		Size:          fstat.Size(),
+		ContentLength: fstat.Size(),
+		hashType:      sha256.Size,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if err := p.fillFromApp(container, read, f, fstat.Size()); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// fillFromApp sets the metadata not already set from the app in the container read from r. When the app cannot be
+// read, it is only warned about if a bundle identifier was given.
+func (p *Package) fillFromApp(container string, read appReader, r io.ReaderAt, size int64) error {
+	app, err := read(r, size, bundle.ReadOptions{Icon: p.readIcon})
+	if err != nil {
+		if p.metadata.BundleIdentifier == "" {
+			return fmt.Errorf("reading the app in the %s: %w", container, err)
+		}
+		p.warn(WarningMetadataFallback, "cannot read the app in the %s, using the given metadata: %s", container, err)
+		return nil
+	}
+
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&p.metadata.BundleIdentifier, app.BundleIdentifier},
+		{&p.metadata.BundleVersion, app.BundleVersion()},
+		{&p.metadata.Title, app.Title()},
+		{&p.metadata.MinimumOSVersion, app.MinimumSystemVersion},
+	} {
+		if *f.dst == "" {
+			*f.dst = f.src
+		}
+	}
+	if p.metadata.BundleIdentifier == "" {
+		p.warn(WarningMetadataFallback, "%s has no CFBundleIdentifier", app.Name)
+	}
+	if p.readIcon {
+		p.setIcon(app)
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package manifestgo
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/groob/plist"
+)
+
+// AsASCIIPlist returns m as an old-style ASCII (OpenStep) property list, indented by indent spaces or on one line if
+// indent is 0. See MarshalASCIIPlist.
+func (m *Manifest) AsASCIIPlist(indent int) ([]byte, error) {
+	return MarshalASCIIPlist(m, indent)
+}
+
+// MarshalASCIIPlist returns v, anything plist.Marshal accepts, as an old-style ASCII (OpenStep) property list. The
+// format only has strings, arrays, dictionaries and data, so numbers and dates are written as strings and booleans as
+// YES or NO. Dictionary keys are sorted.
+func MarshalASCIIPlist(v interface{}, indent int) ([]byte, error) {
+	b, err := plist.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic interface{}
+	if err := plist.Unmarshal(b, &generic); err != nil {
+		return nil, err
+	}
+
+	w := &asciiPlistWriter{indent: strings.Repeat(" ", indent)}
+	if err := w.write(generic, 0); err != nil {
+		return nil, err
+	}
+
+	return w.buf.Bytes(), nil
+}
+
+type asciiPlistWriter struct {
+	buf    bytes.Buffer
+	indent string
+}
+
+func (w *asciiPlistWriter) write(v interface{}, depth int) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		w.buf.WriteString("{")
+		for _, k := range keys {
+			w.newline(depth + 1)
+			w.writeString(k)
+			w.buf.WriteString(" = ")
+			if err := w.write(v[k], depth+1); err != nil {
+				return err
+			}
+			w.buf.WriteString(";")
+		}
+		if len(keys) > 0 {
+			w.newline(depth)
+		}
+		w.buf.WriteString("}")
+	case []interface{}:
+		w.buf.WriteString("(")
+		for i, e := range v {
+			if i > 0 {
+				w.buf.WriteString(",")
+			}
+			w.newline(depth + 1)
+			if err := w.write(e, depth+1); err != nil {
+				return err
+			}
+		}
+		if len(v) > 0 {
+			w.newline(depth)
+		}
+		w.buf.WriteString(")")
+	case string:
+		w.writeString(v)
+	case []byte:
+		fmt.Fprintf(&w.buf, "<%x>", v)
+	case bool:
+		if v {
+			w.buf.WriteString("YES")
+		} else {
+			w.buf.WriteString("NO")
+		}
+	case int64:
+		w.buf.WriteString(strconv.FormatInt(v, 10))
+	case uint64:
+		w.buf.WriteString(strconv.FormatUint(v, 10))
+	case float32:
+		w.writeString(strconv.FormatFloat(float64(v), 'g', -1, 32))
+	case float64:
+		w.writeString(strconv.FormatFloat(v, 'g', -1, 64))
+	case time.Time:
+		w.writeString(v.UTC().Format("2006-01-02 15:04:05 -0700"))
+	default:
+		return fmt.Errorf("manifestgo: cannot write %T to an ASCII plist", v)
+	}
+
+	return nil
+}
+
+// newline starts a new line indented depth times, or separates values by a space when not indenting.
+func (w *asciiPlistWriter) newline(depth int) {
+	if w.indent == "" {
+		w.buf.WriteString(" ")
+		return
+	}
+
+	w.buf.WriteString("\n")
+	w.buf.WriteString(strings.Repeat(w.indent, depth))
+}
+
+// writeString writes s unquoted if it only has the characters an unquoted string may, and quoted otherwise.
+func (w *asciiPlistWriter) writeString(s string) {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool { return !isUnquotedRune(r) }) < 0 {
+		w.buf.WriteString(s)
+		return
+	}
+
+	w.buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			w.buf.WriteByte('\\')
+			w.buf.WriteRune(r)
+		case r == '\n':
+			w.buf.WriteString(`\n`)
+		case r == '\t':
+			w.buf.WriteString(`\t`)
+		case r == '\r':
+			w.buf.WriteString(`\r`)
+		case r < 0x20 || r > 0x7e:
+			// Anything outside printable ASCII is written as UTF-16 escapes.
+			for _, u := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&w.buf, `\U%04x`, u)
+			}
+		default:
+			w.buf.WriteRune(r)
+		}
+	}
+	w.buf.WriteByte('"')
+}
+
+func isUnquotedRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_$+/:.-", r)
+}
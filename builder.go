@@ -0,0 +1,147 @@
+package manifestgo
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ManifestBuilder assembles a manifest with an item for each package added. It is safe to add packages from several
+// goroutines at once.
+type ManifestBuilder struct {
+	mu      sync.Mutex
+	items   map[itemKey]*Item
+	order   ItemOrder
+	include []string
+	exclude []string
+	primary string
+}
+
+// BuilderOption configures a ManifestBuilder created by NewManifestBuilder.
+type BuilderOption func(*ManifestBuilder)
+
+// WithItemOrder sets the order of the items Build returns, ByBundleIdentifier is used otherwise.
+func WithItemOrder(less ItemOrder) BuilderOption {
+	return func(b *ManifestBuilder) {
+		b.order = less
+	}
+}
+
+// WithItemFilter keeps only the items whose bundle identifier matches the include and exclude patterns, see
+// Manifest.SelectItems.
+func WithItemFilter(include, exclude []string) BuilderOption {
+	return func(b *ManifestBuilder) {
+		b.include = include
+		b.exclude = exclude
+	}
+}
+
+// WithPrimaryItem puts the item with the bundle identifier first whatever the order, see Manifest.SetPrimary.
+func WithPrimaryItem(bundleID string) BuilderOption {
+	return func(b *ManifestBuilder) {
+		b.primary = bundleID
+	}
+}
+
+// itemKey identifies the items a ManifestBuilder keeps only one of.
+type itemKey struct {
+	bundleID string
+	version  string
+}
+
+func NewManifestBuilder(opts ...BuilderOption) *ManifestBuilder {
+	b := &ManifestBuilder{items: make(map[itemKey]*Item)}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+// Add builds the item of p and adds it to the manifest. Of the packages with the same bundle identifier and version,
+// only the one whose URL sorts first is kept, whatever order they were added in.
+func (b *ManifestBuilder) Add(p *Package) error {
+	m, err := BuildPackageManifest(p)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range m.ManifestItems {
+		b.AddItem(item)
+	}
+
+	return nil
+}
+
+// AddItem adds an item built elsewhere, as Add does the item of a package.
+func (b *ManifestBuilder) AddItem(item *Item) {
+	var k itemKey
+	if item.Metadata != nil {
+		k = itemKey{item.Metadata.BundleIdentifier, item.Metadata.BundleVersion}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if prev, ok := b.items[k]; ok && itemURL(prev) <= itemURL(item) {
+		return
+	}
+	b.items[k] = item
+}
+
+// Len returns the number of items in the manifest.
+func (b *ManifestBuilder) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.items)
+}
+
+// Build returns the manifest of the packages added so far. Its items are those selected by WithItemFilter, sorted by
+// bundle identifier then version, or by WithItemOrder, with any WithPrimaryItem first, so the same packages always
+// give the same manifest.
+func (b *ManifestBuilder) Build() (*Manifest, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.items) == 0 {
+		return nil, errors.New("manifestgo: no packages added")
+	}
+
+	keys := make([]itemKey, 0, len(b.items))
+	for k := range b.items {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return ByBundleIdentifier(b.items[keys[i]], b.items[keys[j]])
+	})
+
+	m := &Manifest{ManifestItems: make([]*Item, len(keys))}
+	for i, k := range keys {
+		m.ManifestItems[i] = b.items[k]
+	}
+
+	if len(b.include) > 0 || len(b.exclude) > 0 {
+		if err := m.SelectItems(b.include, b.exclude); err != nil {
+			return nil, err
+		}
+	}
+	if b.order != nil {
+		m.SortItems(b.order)
+	}
+	if b.primary != "" {
+		if err := m.SetPrimary(b.primary); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func itemURL(item *Item) string {
+	if len(item.Assets) == 0 {
+		return ""
+	}
+
+	return item.Assets[0].URL
+}
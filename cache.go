@@ -0,0 +1,322 @@
+package manifestgo
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	xar "github.com/dbyington/manifestgo/goxar"
+)
+
+// Cache stores what was read from a package so a package that has not changed does not need to be read again.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Put(key string, b []byte) error
+}
+
+// DirCache is a Cache keeping each entry in a file in a directory.
+type DirCache struct {
+	dir string
+}
+
+// NewDirCache returns a DirCache using dir, creating it if needed.
+func NewDirCache(dir string) (*DirCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &DirCache{dir: dir}, nil
+}
+
+func (c *DirCache) Get(key string) ([]byte, bool) {
+	b, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	return b, true
+}
+
+func (c *DirCache) Put(key string, b []byte) error {
+	// Write to a temporary file first so a concurrent reader never sees a partial entry.
+	f, err := ioutil.TempFile(c.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), c.path(key))
+}
+
+func (c *DirCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// cacheEntry is the cached form of a Package.
+type cacheEntry struct {
+	URL           string   `json:"url"`
+	Etag          string   `json:"etag"`
+	ContentLength int64    `json:"content_length"`
+	Size          int64    `json:"size"`
+	HashType      uint     `json:"hash_type"`
+	HashChunkSize int64    `json:"hash_chunk_size"`
+	Hashes        []string `json:"hashes"`
+	FileSHA256    string   `json:"file_sha256,omitempty"`
+	StapledTicket bool     `json:"stapled_ticket,omitempty"`
+
+	Choice         Choice   `json:"choice"`
+	Choices        []Choice `json:"choices,omitempty"`
+	ChoicesOutline []Line   `json:"choices_outline,omitempty"`
+	PkgInfo        PkgInfo  `json:"pkg_info"`
+	PkgRef         []PkgRef `json:"pkg_ref"`
+	Title          string   `json:"title"`
+	Options        Options  `json:"options"`
+	Product        Product  `json:"product"`
+
+	Source    sourceFile       `json:"source"`
+	Signature *cachedSignature `json:"signature,omitempty"`
+
+	AllowedOSVersions       []OSVersion `json:"allowed_os_versions,omitempty"`
+	VolumeAllowedOSVersions []OSVersion `json:"volume_allowed_os_versions,omitempty"`
+
+	SignatureValid bool      `json:"signature_valid"`
+	SignatureError string    `json:"signature_error,omitempty"`
+	Warnings       []Warning `json:"warnings,omitempty"`
+	Recovered      bool      `json:"recovered,omitempty"`
+
+	MetadataChecksums []MetadataChecksum  `json:"metadata_checksums,omitempty"`
+	Scripts           DistributionScripts `json:"scripts"`
+
+	PayloadRead bool         `json:"payload_read,omitempty"`
+	Executables []Executable `json:"executables,omitempty"`
+}
+
+type cachedSignature struct {
+	Style        string                  `json:"style"`
+	Algorithm    x509.SignatureAlgorithm `json:"algorithm"`
+	Certificates [][]byte                `json:"certificates"`
+	CreationTime time.Time               `json:"creation_time"`
+	Error        string                  `json:"error,omitempty"`
+}
+
+// cacheKey identifies a package by its URL and Etag, and the hashing used, as a change to any of these makes a cached
+// entry stale.
+func cacheKey(url, etag string, hashType uint, chunkSize int64) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d\x00%d", url, etag, hashType, chunkSize)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (p *Package) cacheKey() string {
+	key := cacheKey(p.reader.URL(), p.reader.Etag(), p.hashType, p.hashChunkSize)
+	// The signature of a package verified against other roots may be valid or not where the cached one was not.
+	if p.rootsID != "" {
+		sum := sha256.Sum256([]byte(key + "\x00" + p.rootsID))
+		key = hex.EncodeToString(sum[:])
+	}
+
+	return key
+}
+
+// cacheable reports whether the package can be read from and written to its Cache, which it cannot without an Etag or
+// when it is verified against roots WithRoots could not identify.
+func (p *Package) cacheable() bool {
+	return p.cache != nil && p.reader.Etag() != "" && (p.roots == nil || p.rootsID != "")
+}
+
+// loadFromCache fills the package from its cache entry, returning false if there is none.
+func (p *Package) loadFromCache() bool {
+	if !p.cacheable() {
+		return false
+	}
+
+	b, ok := p.cache.Get(p.cacheKey())
+	if !ok {
+		return false
+	}
+
+	var e cacheEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return false
+	}
+
+	// An entry read leniently would not have been read at all otherwise.
+	if e.Recovered && !p.lenient {
+		return false
+	}
+	if p.readPayload && !e.PayloadRead {
+		return false
+	}
+
+	hashes := make([]hash.Hash, len(e.Hashes))
+	for i, s := range e.Hashes {
+		sum, err := hex.DecodeString(s)
+		if err != nil {
+			return false
+		}
+		hashes[i] = cachedHash(sum)
+	}
+
+	var fileSum []byte
+	if e.FileSHA256 != "" {
+		var err error
+		if fileSum, err = hex.DecodeString(e.FileSHA256); err != nil {
+			return false
+		}
+	}
+
+	var sig *xar.SignatureInfo
+	if e.Signature != nil {
+		sig = &xar.SignatureInfo{
+			Style:        e.Signature.Style,
+			Algorithm:    e.Signature.Algorithm,
+			CreationTime: e.Signature.CreationTime,
+		}
+		for _, der := range e.Signature.Certificates {
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return false
+			}
+			sig.Certificates = append(sig.Certificates, cert)
+		}
+		if e.Signature.Error != "" {
+			sig.Error = errors.New(e.Signature.Error)
+		}
+	}
+
+	p.URL = e.URL
+	p.Etag = e.Etag
+	p.ContentLength = e.ContentLength
+	p.Size = e.Size
+	p.Hashes = hashes
+	p.fileSum = fileSum
+	p.Choice = e.Choice
+	p.Choices = e.Choices
+	p.ChoicesOutline = e.ChoicesOutline
+	p.PkgInfo = e.PkgInfo
+	p.PkgRef = e.PkgRef
+	p.Title = e.Title
+	p.Options = e.Options
+	p.Product = e.Product
+	p.AllowedOSVersions = e.AllowedOSVersions
+	p.VolumeAllowedOSVersions = e.VolumeAllowedOSVersions
+	p.source = e.Source
+	p.signature = sig
+	p.signatureValid = e.SignatureValid
+	p.stapledTicket = e.StapledTicket
+	p.warnings = e.Warnings
+	p.recovered = e.Recovered
+	p.metadataChecksums = e.MetadataChecksums
+	p.scripts = e.Scripts
+	p.executables = e.Executables
+	p.signatureErr = nil
+	if e.SignatureError != "" {
+		p.signatureErr = errors.New(e.SignatureError)
+		if e.SignatureError == xar.ErrNotSigned.Error() {
+			p.signatureErr = xar.ErrNotSigned
+		}
+	}
+
+	return true
+}
+
+func (p *Package) storeInCache() error {
+	if !p.cacheable() {
+		return nil
+	}
+
+	e := cacheEntry{
+		URL:            p.URL,
+		Etag:           p.Etag,
+		ContentLength:  p.ContentLength,
+		Size:           p.Size,
+		HashType:       p.hashType,
+		HashChunkSize:  p.hashChunkSize,
+		Hashes:         p.GetHashStrings(),
+		FileSHA256:     p.FullSHA256(),
+		StapledTicket:  p.stapledTicket,
+		Choice:         p.Choice,
+		Choices:        p.Choices,
+		ChoicesOutline: p.ChoicesOutline,
+		PkgInfo:        p.PkgInfo,
+		PkgRef:         p.PkgRef,
+		Title:          p.Title,
+		Options:        p.Options,
+		Product:        p.Product,
+		Source:         p.source,
+
+		AllowedOSVersions:       p.AllowedOSVersions,
+		VolumeAllowedOSVersions: p.VolumeAllowedOSVersions,
+
+		SignatureValid: p.signatureValid,
+		Warnings:       p.warnings,
+		Recovered:      p.recovered,
+
+		MetadataChecksums: p.metadataChecksums,
+		Scripts:           p.scripts,
+
+		PayloadRead: p.readPayload,
+		Executables: p.executables,
+	}
+	if p.signatureErr != nil {
+		e.SignatureError = p.signatureErr.Error()
+	}
+	if sig := p.signature; sig != nil {
+		e.Signature = &cachedSignature{
+			Style:        sig.Style,
+			Algorithm:    sig.Algorithm,
+			CreationTime: sig.CreationTime,
+		}
+		for _, c := range sig.Certificates {
+			e.Signature.Certificates = append(e.Signature.Certificates, c.Raw)
+		}
+		if sig.Error != nil {
+			e.Signature.Error = sig.Error.Error()
+		}
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return p.cache.Put(p.cacheKey(), b)
+}
+
+// cachedHash is a completed digest restored from a Cache. It cannot be written to.
+type cachedHash []byte
+
+func (h cachedHash) Write(p []byte) (int, error) {
+	return 0, errors.New("manifestgo: cached hash is read only")
+}
+
+func (h cachedHash) Sum(b []byte) []byte {
+	return append(b, h...)
+}
+
+func (h cachedHash) Reset() {}
+
+func (h cachedHash) Size() int {
+	return len(h)
+}
+
+func (h cachedHash) BlockSize() int {
+	return sha256.BlockSize
+}
@@ -0,0 +1,150 @@
+package manifestgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/groob/plist"
+)
+
+var ErrProductNotFound = errors.New("manifestgo: product not found in catalog")
+
+// Catalog is an Apple software update catalog (sucatalog).
+type Catalog struct {
+	CatalogVersion int                        `plist:"CatalogVersion"`
+	IndexDate      time.Time                  `plist:"IndexDate"`
+	Products       map[string]*CatalogProduct `plist:"Products"`
+}
+
+// CatalogProduct is a product of a Catalog, such as Safari or Rosetta, installed from one or more packages.
+type CatalogProduct struct {
+	ID                string            `plist:"-"`
+	PostDate          time.Time         `plist:"PostDate"`
+	ServerMetadataURL string            `plist:"ServerMetadataURL"`
+	Distributions     map[string]string `plist:"Distributions"`
+	Packages          []CatalogPackage  `plist:"Packages"`
+
+	// Title and Version come from the server metadata of the product, when it has one.
+	Title   string `plist:"-"`
+	Version string `plist:"-"`
+}
+
+// CatalogPackage is a package of a CatalogProduct.
+type CatalogPackage struct {
+	URL         string `plist:"URL"`
+	Size        int64  `plist:"Size"`
+	Digest      string `plist:"Digest"`
+	MetadataURL string `plist:"MetadataURL"`
+}
+
+// catalogMetadata is the server metadata (.smd) of a product.
+type catalogMetadata struct {
+	Version      string `plist:"CFBundleShortVersionString"`
+	Localization map[string]struct {
+		Title string `plist:"title"`
+	} `plist:"localization"`
+}
+
+// ParseCatalog parses the plist of an Apple software update catalog.
+func ParseCatalog(b []byte) (*Catalog, error) {
+	var c Catalog
+	if err := plist.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("manifestgo: parsing catalog: %w", err)
+	}
+
+	for id, p := range c.Products {
+		if p != nil {
+			p.ID = id
+		}
+	}
+
+	return &c, nil
+}
+
+// Product returns the product with the id, or ErrProductNotFound.
+func (c *Catalog) Product(id string) (*CatalogProduct, error) {
+	p, ok := c.Products[id]
+	if !ok || p == nil {
+		return nil, fmt.Errorf("%w: %s", ErrProductNotFound, id)
+	}
+
+	return p, nil
+}
+
+// PackageURLs returns the URLs of the packages of the product, in the order they are listed.
+func (p *CatalogProduct) PackageURLs() []string {
+	urls := make([]string, 0, len(p.Packages))
+	for _, pkg := range p.Packages {
+		urls = append(urls, pkg.URL)
+	}
+
+	return urls
+}
+
+// FetchCatalogProduct downloads the catalog at catalogURL and returns the product with the id, with its title and
+// version filled from the server metadata of the product. http.DefaultClient is used if client is nil.
+func FetchCatalogProduct(ctx context.Context, client *http.Client, catalogURL, productID string) (*CatalogProduct, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	b, err := fetch(ctx, client, catalogURL)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := ParseCatalog(b)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := c.Product(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.ServerMetadataURL == "" {
+		return p, nil
+	}
+
+	b, err = fetch(ctx, client, p.ServerMetadataURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var md catalogMetadata
+	if err := plist.Unmarshal(b, &md); err != nil {
+		return nil, fmt.Errorf("manifestgo: parsing product metadata: %w", err)
+	}
+	p.Version = md.Version
+	if l, ok := md.Localization["English"]; ok {
+		p.Title = l.Title
+	} else if l, ok := md.Localization["en"]; ok {
+		p.Title = l.Title
+	}
+
+	return p, nil
+}
+
+func fetch(ctx context.Context, client *http.Client, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("manifestgo: fetching %s: %s", u, res.Status)
+	}
+
+	return ioutil.ReadAll(res.Body)
+}
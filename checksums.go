@@ -0,0 +1,56 @@
+package manifestgo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// fileDigester is implemented by a PackageReader that hashes the whole package as it hashes its chunks, as httpio and
+// a Spool do.
+type fileDigester interface {
+	FileDigest() []byte
+}
+
+// Checksum is the SHA-256 of a package as a file, a line of a SHA256SUMS file.
+type Checksum struct {
+	// Name is the file name of the package.
+	Name string
+	// SHA256 is the hex digest of the package.
+	SHA256 string
+}
+
+// FullSHA256 returns the hex SHA-256 of the whole package, for audit logs, advisories and checksums verifying the
+// download outside MDM, whatever hash its chunks were hashed with. It is "" when the package was not hashed whole:
+// when chunks were reused from WithPreviousAsset without its SHA-256, warned about with WarningNoFileDigest and avoided
+// with WithFileDigest, or its reader does not hash the whole package alongside the chunks.
+func (p *Package) FullSHA256() string {
+	if p.fileSum != nil {
+		return hex.EncodeToString(p.fileSum)
+	}
+	// A single SHA-256 chunk covering the package is the digest of the whole file.
+	if len(p.Hashes) == 1 && p.hashType == sha256.Size && (p.hashChunkSize <= 0 || p.hashChunkSize >= p.ContentLength) {
+		return hex.EncodeToString(p.Hashes[0].Sum(nil))
+	}
+
+	return ""
+}
+
+// FileSHA256 returns the hex SHA-256 of the whole package.
+//
+// Deprecated: use FullSHA256.
+func (p *Package) FileSHA256() string {
+	return p.FullSHA256()
+}
+
+// SHA256Sums returns the checksums in the format of sha256sum and the SHA256SUMS files of many distributions, which
+// sha256sum -c verifies. The content can be signed with gpg --clearsign or --detach-sign.
+func SHA256Sums(sums []Checksum) []byte {
+	var b bytes.Buffer
+	for _, s := range sums {
+		fmt.Fprintf(&b, "%s  %s\n", s.SHA256, s.Name)
+	}
+
+	return b.Bytes()
+}
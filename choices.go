@@ -0,0 +1,67 @@
+package manifestgo
+
+// ChoiceNode is a choice of a Distribution in its choices-outline, with the choices nested under it.
+type ChoiceNode struct {
+	Choice   Choice       `json:"choice"`
+	Children []ChoiceNode `json:"children,omitempty"`
+}
+
+// ChoiceOutline returns the choices of the Distribution in the tree of its choices-outline, showing which component
+// packages are optional and how they are grouped, as in Microsoft Office. A line naming a choice the Distribution does
+// not define has a Choice with only its ID. It returns nil for a component package or a Distribution with no outline.
+func (p *Package) ChoiceOutline() []ChoiceNode {
+	if p == nil || len(p.ChoicesOutline) == 0 {
+		return nil
+	}
+
+	choices := make(map[string]Choice, len(p.Choices))
+	for _, c := range p.Choices {
+		if _, ok := choices[c.ID]; !ok {
+			choices[c.ID] = c
+		}
+	}
+
+	return choiceNodes(p.ChoicesOutline, choices)
+}
+
+func choiceNodes(lines []Line, choices map[string]Choice) []ChoiceNode {
+	nodes := make([]ChoiceNode, len(lines))
+	for i, l := range lines {
+		c, ok := choices[l.Choice]
+		if !ok {
+			c = Choice{ID: l.Choice}
+		}
+		nodes[i] = ChoiceNode{Choice: c}
+		if len(l.Lines) > 0 {
+			nodes[i].Children = choiceNodes(l.Lines, choices)
+		}
+	}
+
+	return nodes
+}
+
+// mergeChoices merges choices into one as decoding them into a single Choice does: the attributes of later choices
+// replace those of earlier ones and the pkg-refs of all of them are kept.
+func mergeChoices(choices []Choice) Choice {
+	var m Choice
+	for _, c := range choices {
+		mergeAttr(&m.ID, c.ID)
+		mergeAttr(&m.Title, c.Title)
+		mergeAttr(&m.Description, c.Description)
+		mergeAttr(&m.Visible, c.Visible)
+		mergeAttr(&m.Enabled, c.Enabled)
+		mergeAttr(&m.Selected, c.Selected)
+		mergeAttr(&m.StartVisible, c.StartVisible)
+		mergeAttr(&m.StartEnabled, c.StartEnabled)
+		mergeAttr(&m.StartSelected, c.StartSelected)
+		m.PkgRef = append(m.PkgRef, c.PkgRef...)
+	}
+
+	return m
+}
+
+func mergeAttr(dst *string, src string) {
+	if src != "" {
+		*dst = src
+	}
+}
@@ -0,0 +1,116 @@
+package manifestgo
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/dbyington/manifestgo/httpio"
+)
+
+// MaxManifestChunks is the most chunk hashes RecommendChunkSize lets a manifest carry. At around 80 bytes per sha256
+// entry it keeps the hashes of an embedded manifest near 40 KB, well inside the size MDM servers and devices accept
+// for a command.
+const MaxManifestChunks = 500
+
+// chunkSizeStep is the multiple recommended chunk sizes are rounded up to.
+const chunkSizeStep = 1024 * 1024
+
+var (
+	ErrInvalidChunkSize = errors.New("manifestgo: chunk size must be positive")
+	ErrTooManyChunks    = errors.New("manifestgo: chunk size gives more chunks than a manifest should carry")
+)
+
+// RecommendChunkSize returns the chunk size to hash a package of contentLength bytes with: httpio.DefaultHashChunkSize,
+// or a larger multiple of 1 MiB when that would give more than MaxManifestChunks chunks.
+func RecommendChunkSize(contentLength int64) int64 {
+	size := int64(httpio.DefaultHashChunkSize)
+	if contentLength <= size*MaxManifestChunks {
+		return size
+	}
+
+	size = (contentLength + MaxManifestChunks - 1) / MaxManifestChunks
+	return (size + chunkSizeStep - 1) / chunkSizeStep * chunkSizeStep
+}
+
+// ValidateChunkSize returns ErrInvalidChunkSize if chunkSize is not positive, and ErrTooManyChunks if a package of
+// contentLength bytes would have more than MaxManifestChunks chunks of it.
+func ValidateChunkSize(contentLength, chunkSize int64) error {
+	if chunkSize <= 0 {
+		return ErrInvalidChunkSize
+	}
+
+	if chunks := (contentLength + chunkSize - 1) / chunkSize; chunks > MaxManifestChunks {
+		min := (contentLength + MaxManifestChunks - 1) / MaxManifestChunks
+		return fmt.Errorf("%w: %d chunks of %d bytes, use at least %d bytes", ErrTooManyChunks, chunks, chunkSize, min)
+	}
+
+	return nil
+}
+
+// ChunkHash is the digest of one chunk of a package.
+type ChunkHash struct {
+	Index  int   `json:"index"`
+	Offset int64 `json:"offset"`
+	// Length is the number of bytes hashed, the chunk size for every chunk but the last.
+	Length    int64  `json:"length"`
+	Digest    string `json:"digest"`
+	Algorithm string `json:"algorithm"`
+}
+
+// ChunkHashes returns the digest of each chunk of the package in order, with where the chunk lies in the file. The
+// lengths are those the reader hashed when it records them, as httpio does, and are derived from the content length
+// otherwise. A package read from a file has a single chunk covering all of it.
+func (p *Package) ChunkHashes() []ChunkHash {
+	if p == nil {
+		return nil
+	}
+
+	chunkSize := p.chunkSize()
+	if len(p.Hashes) == 1 {
+		chunkSize = p.ContentLength
+	}
+
+	chunks := make([]ChunkHash, 0, len(p.Hashes))
+	for i, h := range p.Hashes {
+		if h == nil {
+			return nil
+		}
+
+		offset := int64(i) * chunkSize
+		length := chunkSize
+		if rest := p.ContentLength - offset; rest < length {
+			length = rest
+		}
+		if len(p.chunkLengths) == len(p.Hashes) {
+			length = p.chunkLengths[i]
+		}
+
+		chunks = append(chunks, ChunkHash{
+			Index:     i,
+			Offset:    offset,
+			Length:    length,
+			Digest:    hex.EncodeToString(h.Sum(nil)),
+			Algorithm: p.hashAlgorithm(),
+		})
+	}
+
+	return chunks
+}
+
+// chunkSize returns the size of the chunks the package was hashed in, its whole length for a package hashed in one
+// piece.
+func (p *Package) chunkSize() int64 {
+	if p.hashChunkSize > 0 {
+		return p.hashChunkSize
+	}
+	return p.ContentLength
+}
+
+// hashAlgorithm names the hash of the chunks, md5 or sha256.
+func (p *Package) hashAlgorithm() string {
+	if HashScheme(p.hashType) == HashMD5 {
+		return "md5"
+	}
+	return "sha256"
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/subtle"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// authMiddleware requires one of keys, given as a bearer token or in an X-API-Key header, on every request but the
+// health checks, and limits each key, or each client address when there are no keys, with limiter.
+func authMiddleware(next http.Handler, keys []string, limiter *rateLimiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client := clientAddr(r)
+		if len(keys) > 0 {
+			key := requestKey(r)
+			if !validKey(key, keys) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeJSONError(w, http.StatusUnauthorized, "missing or invalid API key")
+				return
+			}
+			client = key
+		}
+
+		if wait, ok := limiter.allow(client); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestKey returns the X-API-Key header of r or, without one, its bearer token.
+func requestKey(r *http.Request) string {
+	if k := r.Header.Get("X-API-Key"); k != "" {
+		return k
+	}
+
+	const prefix = "Bearer "
+	if h := r.Header.Get("Authorization"); len(h) > len(prefix) && strings.EqualFold(h[:len(prefix)], prefix) {
+		return h[len(prefix):]
+	}
+
+	return ""
+}
+
+// validKey compares key to every one of keys in constant time.
+func validKey(key string, keys []string) bool {
+	if key == "" {
+		return false
+	}
+
+	var ok int
+	for _, k := range keys {
+		ok |= subtle.ConstantTimeCompare([]byte(key), []byte(k))
+	}
+
+	return ok == 1
+}
+
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// rateLimiter is a token bucket per client.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	// now returns the current time, for buckets to refill by.
+	now func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter of perSecond requests per client with bursts of up to burst. A perSecond of 0
+// disables rate limiting.
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{rate: perSecond, burst: float64(burst), buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// allow takes a token from the bucket of client, returning how long until one is available when there is none.
+func (l *rateLimiter) allow(client string) (time.Duration, bool) {
+	if l.rate <= 0 {
+		return 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[client]
+	if !ok {
+		// Drop the buckets that have refilled, they are the same as new ones.
+		for c, old := range l.buckets {
+			if now.Sub(old.last).Seconds()*l.rate+old.tokens >= l.burst {
+				delete(l.buckets, c)
+			}
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), false
+	}
+	b.tokens--
+
+	return 0, true
+}
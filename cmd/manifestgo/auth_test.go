@@ -0,0 +1,213 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testKeys = []string{"key-one", "key-two"}
+
+// testLimiter returns a limiter of perMinute requests with bursts of burst, and a function advancing its clock.
+func testLimiter(perMinute float64, burst int) (*rateLimiter, func(time.Duration)) {
+	l := newRateLimiter(perMinute/60, burst)
+	clock := time.Date(2021, time.June, 1, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return clock }
+	return l, func(d time.Duration) { clock = clock.Add(d) }
+}
+
+// serveAuth sends a GET for path from remote through the middleware, with the headers given in pairs.
+func serveAuth(h http.Handler, path, remote string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remote
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		keys []string
+		want bool
+	}{
+		{"first key", "key-one", testKeys, true},
+		{"second key", "key-two", testKeys, true},
+		{"prefix", "key-on", testKeys, false},
+		{"longer", "key-one1", testKeys, false},
+		{"case", "KEY-ONE", testKeys, false},
+		{"empty", "", testKeys, false},
+		{"empty key configured", "", []string{""}, false},
+		{"no keys", "key-one", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validKey(tt.key, tt.keys); got != tt.want {
+				t.Errorf("validKey(%q) = %t, want %t", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		want    string
+	}{
+		{"none", nil, ""},
+		{"api key", []string{"X-API-Key", "key-one"}, "key-one"},
+		{"bearer", []string{"Authorization", "Bearer key-one"}, "key-one"},
+		{"bearer case", []string{"Authorization", "bearer key-one"}, "key-one"},
+		{"bearer without token", []string{"Authorization", "Bearer "}, ""},
+		{"basic", []string{"Authorization", "Basic a2V5LW9uZQ=="}, ""},
+		{"both", []string{"Authorization", "Bearer key-two", "X-API-Key", "key-one"}, "key-one"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+			for i := 0; i+1 < len(tt.headers); i += 2 {
+				req.Header.Set(tt.headers[i], tt.headers[i+1])
+			}
+			if got := requestKey(req); got != tt.want {
+				t.Errorf("got key %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	h := authMiddleware(okHandler, testKeys, newRateLimiter(0, 0))
+
+	tests := []struct {
+		name    string
+		path    string
+		headers []string
+		want    int
+	}{
+		{"no key", "/jobs", nil, http.StatusUnauthorized},
+		{"invalid key", "/jobs", []string{"X-API-Key", "key-three"}, http.StatusUnauthorized},
+		{"api key", "/jobs", []string{"X-API-Key", "key-one"}, http.StatusOK},
+		{"bearer", "/jobs", []string{"Authorization", "Bearer key-two"}, http.StatusOK},
+		{"api key over invalid bearer", "/jobs", []string{"X-API-Key", "key-one", "Authorization", "Bearer key-three"}, http.StatusOK},
+		{"invalid api key over bearer", "/jobs", []string{"X-API-Key", "key-three", "Authorization", "Bearer key-one"}, http.StatusUnauthorized},
+		{"healthz", "/healthz", nil, http.StatusOK},
+		{"readyz", "/readyz", nil, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveAuth(h, tt.path, "192.0.2.1:1234", tt.headers...)
+			if w.Code != tt.want {
+				t.Fatalf("got status %d, want %d", w.Code, tt.want)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); (got == "Bearer") != (tt.want == http.StatusUnauthorized) {
+				t.Errorf("got WWW-Authenticate %q with status %d", got, w.Code)
+			}
+		})
+	}
+
+	if w := serveAuth(authMiddleware(okHandler, nil, newRateLimiter(0, 0)), "/jobs", "192.0.2.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("without keys: got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestAuthMiddlewareRateLimit(t *testing.T) {
+	// One request a second, in bursts of two.
+	l, advance := testLimiter(60, 2)
+	h := authMiddleware(okHandler, testKeys, l)
+
+	check := func(key string, want int, wantRetry string) {
+		t.Helper()
+		w := serveAuth(h, "/jobs", "192.0.2.1:1234", "X-API-Key", key)
+		if w.Code != want {
+			t.Fatalf("got status %d, want %d", w.Code, want)
+		}
+		if got := w.Header().Get("Retry-After"); got != wantRetry {
+			t.Errorf("got Retry-After %q, want %q", got, wantRetry)
+		}
+	}
+
+	check("key-one", http.StatusOK, "")
+	check("key-one", http.StatusOK, "")
+	check("key-one", http.StatusTooManyRequests, "1")
+	// Each key has its own bucket, whatever address it is sent from.
+	check("key-two", http.StatusOK, "")
+
+	advance(200 * time.Millisecond)
+	check("key-one", http.StatusTooManyRequests, "1")
+	advance(800 * time.Millisecond)
+	check("key-one", http.StatusOK, "")
+	check("key-one", http.StatusTooManyRequests, "1")
+
+	if w := serveAuth(h, "/healthz", "192.0.2.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("healthz: got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestAuthMiddlewareRateLimitAddress(t *testing.T) {
+	// One request every ten seconds, without bursts.
+	l, _ := testLimiter(6, 0)
+	h := authMiddleware(okHandler, nil, l)
+
+	if w := serveAuth(h, "/jobs", "192.0.2.1:1234"); w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+	// Another connection from the same address shares its bucket.
+	w := serveAuth(h, "/jobs", "192.0.2.1:5678")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "10" {
+		t.Errorf("got status %d and Retry-After %q, want %d and 10", w.Code, w.Header().Get("Retry-After"), http.StatusTooManyRequests)
+	}
+	if w := serveAuth(h, "/jobs", "192.0.2.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("another address: got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	l, advance := testLimiter(60, 3)
+
+	l.allow("a")
+	advance(time.Second)
+	l.allow("b")
+	l.allow("b")
+	l.allow("b")
+
+	// a has refilled, b has one of its three tokens back.
+	advance(time.Second)
+	l.allow("c")
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("the refilled bucket of a was kept")
+	}
+	if _, ok := l.buckets["b"]; !ok {
+		t.Error("the bucket of b was dropped before it refilled")
+	}
+
+	// b is not reset by pruning.
+	if _, ok := l.allow("b"); !ok {
+		t.Fatal("b was refused a token it had")
+	}
+	if wait, ok := l.allow("b"); ok || wait != time.Second {
+		t.Errorf("got %v, %t, want b to wait a second", wait, ok)
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	l, _ := testLimiter(0, 1)
+	for i := 0; i < 100; i++ {
+		if _, ok := l.allow("a"); !ok {
+			t.Fatalf("request %d was refused", i)
+		}
+	}
+	if len(l.buckets) != 0 {
+		t.Errorf("got %d buckets, want none", len(l.buckets))
+	}
+}
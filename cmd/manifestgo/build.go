@@ -0,0 +1,1119 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dbyington/manifestgo"
+	"github.com/dbyington/manifestgo/httpio"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var buildCmd = &cobra.Command{
+	Use:   "build [pkg...]",
+	Short: "Build manifests for one or more pkg files",
+	Long: `Build reads each pkg given as an argument, or listed in the --batch file, and writes its manifest.
+Inputs may be local files or http(s) URLs; URLs are read with range requests and hashed in chunks.
+
+With a single input and no --output-dir the manifest is written to stdout. Batch runs
+continue past failed packages and exit non-zero once every input has been attempted.
+
+Manifests in --output-dir are named after the file name of their input. Inputs of the same file
+name, such as https://a.example.com/App.pkg and https://b.example.com/App.pkg, have a short hash
+of the input added, as in App-a95524fa.json.`,
+	RunE: runBuild,
+}
+
+func init() {
+	rootCmd.AddCommand(buildCmd)
+
+	addPackageFlags(buildCmd)
+	buildCmd.Flags().String("batch", "", "file listing the packages to build, one per line")
+	buildCmd.Flags().String("format", "json", "manifest output format: json, plist, ascii-plist (an old-style OpenStep plist), munki (a Munki pkginfo), mobileconfig (a configuration profile), or cyclonedx or spdx (an SBOM component of the package)")
+	buildCmd.Flags().Int("indent", 2, "number of spaces to indent the output with, 0 for compact")
+	buildCmd.Flags().Bool("canonical", false, "write json manifests in canonical form: compact with sorted keys")
+	addJSONFlags(buildCmd)
+	buildCmd.Flags().String("manifest-base-url", "", "https URL the written manifests will be served from, prints the itms-services link of each")
+	buildCmd.Flags().Bool("qr", false, "also write the itms-services link of each manifest as a QR code PNG beside it, for scanning onto test devices; needs --manifest-base-url")
+	buildCmd.Flags().Int("qr-scale", 8, "pixels per QR code module")
+	buildCmd.Flags().String("output-dir", "", "directory to write manifests to instead of stdout")
+	buildCmd.Flags().String("report", "", "write a CSV report of the build to this file, a .tsv extension writes tab separated values")
+	buildCmd.Flags().String("inventory", "", "write an inventory table of the packages built, their bundle id, version, signer, size, URL and SHA-256, to this file as CSV, or JSON lines with a .jsonl or .ndjson extension")
+	buildCmd.Flags().String("profile-identifier", "", "identifier of the mobileconfig, the bundle id with a .manifest suffix by default")
+	buildCmd.Flags().String("profile-organization", "", "organization of the mobileconfig")
+	buildCmd.Flags().String("profile-manifest-url", "", "https URL the manifest is hosted at, adds it and a web clip installing it to the mobileconfig")
+	buildCmd.Flags().String("profile-sign-cert", "", "PEM certificates, leaf first, to sign the mobileconfig with")
+	buildCmd.Flags().String("profile-sign-key", "", "PEM private key to sign the mobileconfig with")
+	buildCmd.Flags().String("sucatalog", "", "URL of an Apple software update catalog to build the packages of --product from")
+	buildCmd.Flags().String("product", "", "id of the product in --sucatalog to build")
+	buildCmd.Flags().String("webhook", "", "URL to POST a JSON event to after each package is built")
+	buildCmd.Flags().String("exec", "", "shell command to run after each manifest is written to --output-dir, with {} replaced by its path, such as 'aws s3 cp {} s3://manifests/'")
+	buildCmd.Flags().String("sha256sums", "", "also write the SHA-256 of each package to this file in the format of sha256sum, for verifying downloads outside MDM")
+	buildCmd.Flags().String("sha256sums-sign-key", "", "gpg key to sign --sha256sums with, writing a detached signature beside it with an .asc extension")
+	buildCmd.Flags().String("icon-dest", "", "where to upload the icon of the app of a .dmg or .zip as a PNG named after its bundle id, made its display-image asset: an s3:// or gs:// URL, an http(s) URL to PUT it to, or a local directory")
+	buildCmd.Flags().String("icon-url", "", "URL the icons of --icon-dest are served from, the file name is appended to it")
+	buildCmd.Flags().StringArrayVar(&plugins, "plugin", nil, "command run on each manifest before it is written, reading the package and manifest as JSON on stdin and writing nothing or {\"manifest\": ...} to replace it, such as ./to-confluence.sh; may be repeated")
+	buildCmd.Flags().Bool("schema", false, "print the JSON Schema of the json manifest format and exit")
+	buildCmd.Flags().String("content-store", "", "directory keeping each built manifest under the SHA-256 of its package, reporting a package already built from another URL")
+	buildCmd.Flags().Bool("estimate", false, "print how many bytes building each package would read, and roughly how long it would take from a short sample read, without building it")
+	addSelectFlags(buildCmd, false)
+}
+
+// httpHeaders holds the --header flags. It is not read through viper, which does not support string array flags.
+var httpHeaders []string
+
+// shareMounts holds the --share-mount flags, not read through viper for the same reason as httpHeaders.
+var shareMounts []string
+
+// dialPolicy restricts the hosts and addresses packages are fetched from, set by serve from --allow-host and
+// --deny-private.
+var dialPolicy *httpio.DialPolicy
+
+// addPackageFlags adds the flags controlling how a package is read to cmd.
+func addPackageFlags(cmd *cobra.Command) {
+	addReadFlags(cmd)
+	cmd.Flags().String("base-url", "", "URL the packages will be served from, the pkg file name is appended to it; the URL of the package itself when reading - (stdin)")
+	cmd.Flags().String("cache-dir", "", "directory caching hashes and metadata of URLs, keyed by URL and Etag")
+	cmd.Flags().Bool("auto-chunksize", false, "pick the chunk size from the length of each URL, keeping the manifest small enough for MDM commands")
+	cmd.Flags().StringSlice("title-strategy", []string{"distribution", "bundle-path", "identifier"}, "where to take the title from, the first giving one is used: distribution, bundle-path or identifier")
+	cmd.Flags().String("minimum-os-plist-key", "", "also write the minimum macOS version to plist manifests under this metadata key, such as minimum-system-version")
+	cmd.Flags().Bool("skip-parse", false, "only hash the input, without reading it as a xar archive or a .dmg disk image, for a file distributed as-is; needs --bundle-id")
+	cmd.Flags().String("bundle-id", "", "bundle identifier of the manifest, in place of that of the package")
+	cmd.Flags().String("bundle-version", "", "bundle version of the manifest, in place of that of the package")
+	cmd.Flags().String("title", "", "title of the manifest, in place of that of the package")
+	cmd.Flags().StringToString("metadata-extra", nil, "extra key=value pairs to add to the metadata of each manifest, such as category=productivity")
+	cmd.Flags().String("primary-ref", "", "id of the pkg-ref of a Distribution the bundle identifier and version are taken from, in place of the one its choice or order selects")
+	cmd.Flags().Bool("strict", false, "fail on any warning about a package, such as a missing title or an ambiguous primary pkg-ref")
+	cmd.Flags().Bool("require-valid-signature", false, "fail unless a package has a signature that verifies against the system roots")
+	cmd.Flags().Bool("require-developer-id", false, "fail unless a package is validly signed with a Developer ID Installer certificate")
+	cmd.Flags().String("require-team-id", "", "fail unless a package is validly signed by the Apple developer team with this id, such as ABCDE12345")
+	cmd.Flags().Bool("require-notarization", false, "fail unless a package has a stapled notarization ticket")
+	cmd.Flags().Bool("disallow-expired", false, "fail if a certificate that signed a package has expired")
+	cmd.Flags().String("trusted-roots", "", "PEM file of root certificates trusted to sign packages besides the system roots, such as the CA of an organization re-signing vendor packages")
+	cmd.Flags().Bool("trusted-roots-only", false, "trust only the --trusted-roots, not the system roots")
+	cmd.Flags().Bool("payload-archs", false, "also read the payloads of a pkg for the architectures of the executables it installs, used in the report when the Distribution has no hostArchitectures; reads the whole package again")
+	cmd.Flags().Bool("check-drift", false, "ask again for the Etag and length of a URL before building its manifest, failing if the package changed while it was read")
+	cmd.Flags().Bool("retry-on-drift", false, "build a URL again, once, when --check-drift finds it changed while it was read; implies --check-drift")
+	cmd.Flags().Bool("progress", false, "report the progress of reading each URL on stderr")
+	cmd.Flags().Bool("trace", false, "write the time spent fetching the TOC, hashing, parsing and building each URL to stderr")
+	cmd.Flags().String("previous-manifest", "", "manifest of the previous version of a URL, whose chunk digests are reused where it is unchanged and compared to report the chunks that changed")
+	cmd.Flags().String("previous-etag", "", "Etag of the previous version of a URL, all chunk digests of --previous-manifest are reused while it is unchanged")
+	cmd.Flags().Int64("unchanged-before", 0, "number of leading bytes of a URL known to be unchanged since --previous-manifest, such as its previous length for a package only appended to")
+}
+
+// addReadFlags adds the flags controlling how a URL or file is opened and hashed to cmd, those a command reading a
+// package without building its manifest needs.
+func addReadFlags(cmd *cobra.Command) {
+	cmd.Flags().Int64("chunksize", httpio.DefaultHashChunkSize, "size of each hashed chunk when reading a URL")
+	cmd.Flags().Bool("exact-chunks", false, "fail unless the body of a URL is exactly its Content-Length, so the final chunk hashes exactly the remaining bytes")
+	cmd.Flags().String("hash", "sha256", "hash used for the chunks of a URL: md5 or sha256")
+	cmd.Flags().Bool("lenient", false, "recover from irregularities in a package, such as duplicate ids or missing checksums, reporting them as warnings")
+	cmd.Flags().Bool("spool-fallback", false, "download a URL whose server does not support range requests to a temporary file and read it from there")
+	cmd.Flags().String("spool-dir", "", "directory for the temporary files of --spool-fallback and stdin, the system temp directory by default")
+	cmd.Flags().Int64("spool-max-size", 0, "largest package, in bytes, spooled to a temporary file, 0 for no limit")
+	cmd.Flags().Bool("spool-tmpfile", false, "make spool files with O_TMPFILE on Linux, so the kernel frees them even if manifestgo is killed")
+	cmd.Flags().Duration("timeout", 0, "how long building each package may take before it is cancelled, such as 10m, so a hung download does not stall a batch; 0 for no limit")
+	cmd.Flags().StringArrayVar(&shareMounts, "share-mount", nil, "where an smb:// or nfs:// share is mounted as \"URL=directory\", such as smb://files.example.com/pkgs=/mnt/pkgs, for a mount the system does not list; may be repeated")
+	addAuthFlags(cmd)
+}
+
+// addAuthFlags adds the flags authenticating requests to a URL to cmd, see httpAuthOptions.
+func addAuthFlags(cmd *cobra.Command) {
+	cmd.Flags().String("username", "", "username to authenticate to the server of a URL with")
+	cmd.Flags().String("password", "", "password to authenticate to the server of a URL with, prefer MANIFESTGO_PASSWORD")
+	cmd.Flags().String("bearer-token", "", "bearer token to authenticate to the server of a URL with, prefer MANIFESTGO_BEARER_TOKEN")
+	cmd.Flags().StringArrayVar(&httpHeaders, "header", nil, "extra header for requests to a URL as \"Name: value\", may be repeated")
+	cmd.Flags().String("unix-socket", "", "Unix socket to send requests for a URL over, for an artifact service listening on one")
+	cmd.Flags().String("proxy", "", "http, https or socks5 URL of the proxy to send requests for a URL through, in place of HTTPS_PROXY")
+	cmd.Flags().Int64("expected-rate", 0, "bytes per second a URL is expected to download at, failing before reading it when its presigned signature expires sooner")
+	cmd.Flags().String("url-refresh-command", "", "shell command printing a new URL for an expiring presigned URL, given as $1, run when it is about to expire mid-build")
+}
+
+func runBuild(cmd *cobra.Command, args []string) error {
+	if viper.GetBool("schema") {
+		_, err := os.Stdout.Write(manifestgo.ManifestJSONSchema())
+		return err
+	}
+
+	if naming, err := manifestgo.ParseFieldNaming(viper.GetString("json-naming")); err != nil {
+		return err
+	} else if naming != manifestgo.FieldNamingDefault && viper.GetBool("canonical") {
+		return errors.New("--canonical writes the default field names, it cannot be used with --json-naming")
+	}
+
+	inputs, err := buildInputs(args, viper.GetString("batch"))
+	if err != nil {
+		return err
+	}
+
+	catalog, product := viper.GetString("sucatalog"), viper.GetString("product")
+	if (catalog == "") != (product == "") {
+		return errors.New("--sucatalog and --product must be used together")
+	}
+	if catalog != "" {
+		cp, err := manifestgo.FetchCatalogProduct(cmd.Context(), nil, catalog, product)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s %s, %d packages\n", cp.ID, cp.Title, cp.Version, len(cp.Packages))
+		inputs = append(inputs, cp.PackageURLs()...)
+	}
+
+	if len(inputs) == 0 {
+		return errors.New("no packages to build")
+	}
+	if viper.GetBool("estimate") {
+		return estimateInputs(cmd.Context(), inputs)
+	}
+
+	outDir := viper.GetString("output-dir")
+	if len(inputs) > 1 && outDir == "" {
+		return errors.New("--output-dir is required when building more than one package")
+	}
+	if viper.GetString("manifest-base-url") != "" && outDir == "" {
+		return errors.New("--output-dir is required with --manifest-base-url")
+	}
+	if viper.GetBool("qr") && viper.GetString("manifest-base-url") == "" {
+		return errors.New("--manifest-base-url is required with --qr")
+	}
+	if viper.GetString("exec") != "" && outDir == "" {
+		return errors.New("--output-dir is required with --exec")
+	}
+
+	if outDir != "" {
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			return err
+		}
+	}
+	stems := outputStems(inputs)
+
+	var report *reportWriter
+	if name := viper.GetString("report"); name != "" {
+		if report, err = newReportWriter(name); err != nil {
+			return err
+		}
+		defer report.Close()
+	}
+
+	var (
+		inventoryFile *os.File
+		inventory     *manifestgo.InventoryWriter
+	)
+	if name := viper.GetString("inventory"); name != "" {
+		if inventoryFile, inventory, err = newInventoryFile(name); err != nil {
+			return err
+		}
+		defer inventoryFile.Close()
+	}
+
+	webhook := viper.GetString("webhook")
+	sumsFile := viper.GetString("sha256sums")
+	if viper.GetString("sha256sums-sign-key") != "" && sumsFile == "" {
+		return errors.New("--sha256sums is required with --sha256sums-sign-key")
+	}
+
+	var store *manifestgo.ContentStore
+	if dir := viper.GetString("content-store"); dir != "" {
+		c, err := manifestgo.NewDirCache(dir)
+		if err != nil {
+			return err
+		}
+		store = manifestgo.NewContentStore(c)
+	}
+
+	var (
+		failed int
+		sums   []manifestgo.Checksum
+	)
+	for _, input := range inputs {
+		start := time.Now()
+		ctx, cancel := buildContext(cmd.Context())
+		var file, manifestURL string
+		p, m, err := buildManifest(ctx, input)
+		if errors.Is(err, manifestgo.ErrNoItemsSelected) {
+			fmt.Fprintf(os.Stderr, "%s: skipped, %s is not selected by --include and --exclude\n", input, p.GetBundleIdentifier())
+			cancel()
+			continue
+		}
+		if err == nil && viper.GetString("icon-dest") != "" {
+			err = publishIcon(ctx, input, p, m)
+		}
+		if err == nil && len(plugins) > 0 {
+			m, err = runPlugins(ctx, input, p, m)
+		}
+		if err == nil {
+			file, manifestURL, err = writeManifest(p, m, input, outDir, stems[input])
+		}
+		if err == nil && file != "" && viper.GetString("exec") != "" {
+			err = runExec(ctx, viper.GetString("exec"), input, file, manifestURL, p)
+		}
+		if err == nil && sumsFile != "" {
+			if sum, ok := packageChecksum(input, p); ok {
+				sums = append(sums, sum)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: warning: not in %s, the package was only hashed in chunks\n", input, sumsFile)
+			}
+		}
+		if err == nil && store != nil {
+			err = storeContent(store, input, p, m)
+		}
+		if err == nil && inventory != nil {
+			err = inventory.Write(p)
+		}
+
+		err = timeoutError(ctx, err)
+		cancel()
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s: %s\n", input, err)
+			if d := manifestgo.Diagnose(err); d != nil {
+				fmt.Fprintf(os.Stderr, "  %s\n", d)
+			}
+		}
+
+		row := newReportRow(input, p, m, err, time.Since(start))
+		if report != nil {
+			if rErr := report.Write(row); rErr != nil {
+				return rErr
+			}
+		}
+
+		// A failed webhook is reported but does not fail the build.
+		if webhook != "" {
+			if wErr := postWebhook(cmd.Context(), webhook, newWebhookEvent(row, manifestURL)); wErr != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", input, wErr)
+			}
+		}
+	}
+
+	if report != nil {
+		if err := report.Close(); err != nil {
+			return err
+		}
+	}
+
+	if inventoryFile != nil {
+		if err := inventoryFile.Close(); err != nil {
+			return err
+		}
+	}
+
+	if sumsFile != "" {
+		if err := writeSHA256Sums(cmd.Context(), sumsFile, sums); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d packages failed", failed, len(inputs))
+	}
+
+	return nil
+}
+
+// buildInputs combines the command arguments with the entries of the batch file, skipping blank lines and # comments.
+func buildInputs(args []string, batch string) ([]string, error) {
+	inputs := append([]string{}, args...)
+	if batch == "" {
+		return inputs, nil
+	}
+
+	f, err := os.Open(batch)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		inputs = append(inputs, line)
+	}
+
+	return inputs, s.Err()
+}
+
+// buildManifest reads input and builds its manifest, once more with --retry-on-drift if it changed while it was read.
+func buildManifest(ctx context.Context, input string) (*manifestgo.Package, *manifestgo.Manifest, error) {
+	p, m, err := buildManifestOnce(ctx, input)
+	if errors.Is(err, manifestgo.ErrSourceDrift) && viper.GetBool("retry-on-drift") {
+		fmt.Fprintf(os.Stderr, "%s: %s, building it again\n", input, err)
+		p, m, err = buildManifestOnce(ctx, input)
+	}
+
+	return p, m, err
+}
+
+// buildContext returns ctx for building a single package, cancelled after the --timeout if one is set.
+func buildContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d := viper.GetDuration("timeout"); d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// timeoutError returns err saying the build timed out when ctx, from buildContext, reached its --timeout.
+func timeoutError(ctx context.Context, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s: %w", viper.GetDuration("timeout"), err)
+	}
+
+	return err
+}
+
+func buildManifestOnce(ctx context.Context, input string) (*manifestgo.Package, *manifestgo.Manifest, error) {
+	p, err := readInput(ctx, input)
+	if err != nil {
+		return p, nil, err
+	}
+
+	m, err := packageManifest(input, p)
+	return p, m, err
+}
+
+// readInput reads the package of input, a file, a URL of a scheme with a registered reader or - for stdin, with the
+// package flags.
+func readInput(ctx context.Context, input string) (*manifestgo.Package, error) {
+	switch {
+	case input == "-":
+		return readSpooled(ctx, os.Stdin, viper.GetString("base-url"), "", nil)
+	case hasReader(input):
+		return readURL(ctx, input, nil)
+	}
+
+	return readFile(input)
+}
+
+// packageManifest builds the manifest of the package read from input with the manifest flags, after reporting its
+// warnings.
+func packageManifest(input string, p *manifestgo.Package) (*manifestgo.Manifest, error) {
+	for _, w := range p.Warnings() {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", input, w)
+	}
+	if err := checkStrict(p); err != nil {
+		return nil, err
+	}
+	if err := p.CheckPolicy(signaturePolicy()); err != nil {
+		return nil, err
+	}
+
+	m, err := p.BuildManifest()
+	if err != nil {
+		return nil, err
+	}
+	if err := selectItems(m); err != nil {
+		return nil, err
+	}
+	if key := viper.GetString("minimum-os-plist-key"); key != "" {
+		for _, item := range m.ManifestItems {
+			item.Metadata.MinimumOSPlistKey = key
+		}
+	}
+	if extra := viper.GetStringMapString("metadata-extra"); len(extra) > 0 {
+		for _, item := range m.ManifestItems {
+			if item.Metadata.Extra == nil {
+				item.Metadata.Extra = make(map[string]interface{}, len(extra))
+			}
+			for k, v := range extra {
+				item.Metadata.Extra[k] = v
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// titleStrategies returns the --title-strategy strategies.
+func titleStrategies() ([]manifestgo.TitleStrategy, error) {
+	var strategies []manifestgo.TitleStrategy
+	for _, name := range viper.GetStringSlice("title-strategy") {
+		switch name {
+		case "distribution":
+			strategies = append(strategies, manifestgo.TitleFromDistribution)
+		case "bundle-path":
+			strategies = append(strategies, manifestgo.TitleFromBundlePath)
+		case "identifier":
+			strategies = append(strategies, manifestgo.TitleFromIdentifier)
+		default:
+			return nil, fmt.Errorf("unsupported title strategy: %s", name)
+		}
+	}
+
+	return strategies, nil
+}
+
+// checkStrict returns an error for the first warning about p when --strict is set.
+func checkStrict(p *manifestgo.Package) error {
+	ws := p.Warnings()
+	if !viper.GetBool("strict") || len(ws) == 0 {
+		return nil
+	}
+
+	if len(ws) > 1 {
+		return fmt.Errorf("--strict: %s, and %d more warnings", ws[0], len(ws)-1)
+	}
+	return fmt.Errorf("--strict: %s", ws[0])
+}
+
+// pkgRefOptions returns the option choosing the --primary-ref, none when it is not set.
+func pkgRefOptions() []manifestgo.Option {
+	if id := viper.GetString("primary-ref"); id != "" {
+		return []manifestgo.Option{manifestgo.WithPrimaryPkgRef(id)}
+	}
+
+	return nil
+}
+
+// trustOptions returns the option verifying signatures against the --trusted-roots, none to use the system roots.
+func trustOptions() ([]manifestgo.Option, error) {
+	name := viper.GetString("trusted-roots")
+	if name == "" {
+		if viper.GetBool("trusted-roots-only") {
+			return nil, errors.New("--trusted-roots is required with --trusted-roots-only")
+		}
+		return nil, nil
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !viper.GetBool("trusted-roots-only") {
+		// Without a system pool, as on some platforms, only the given roots are trusted.
+		if sys, err := x509.SystemCertPool(); err == nil {
+			roots = sys
+		}
+	}
+
+	// The certificates are kept, as well as added to the pool, to identify the roots cached packages were verified
+	// against.
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		if block, b = pem.Decode(b); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" || len(block.Headers) != 0 {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		roots.AddCert(c)
+		certs = append(certs, c)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("--trusted-roots: no certificates in %s", name)
+	}
+
+	return []manifestgo.Option{manifestgo.WithRoots(roots, certs...)}, nil
+}
+
+// signaturePolicy returns the signature policy of the --require flags.
+func signaturePolicy() manifestgo.SignaturePolicy {
+	return manifestgo.SignaturePolicy{
+		RequireValidSignature: viper.GetBool("require-valid-signature"),
+		RequireDeveloperID:    viper.GetBool("require-developer-id"),
+		RequireTeamID:         viper.GetString("require-team-id"),
+		RequireNotarization:   viper.GetBool("require-notarization"),
+		DisallowExpired:       viper.GetBool("disallow-expired"),
+	}
+}
+
+func readFile(name string) (*manifestgo.Package, error) {
+	read := manifestgo.ReadPkgFile
+	if viper.GetBool("lenient") {
+		read = manifestgo.ReadPkgFileLenient
+	}
+
+	strategies, err := titleStrategies()
+	if err != nil {
+		return nil, err
+	}
+	md, err := metadataFlags()
+	if err != nil {
+		return nil, err
+	}
+	opts, err := trustOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, pkgRefOptions()...)
+	switch {
+	case viper.GetBool("skip-parse"):
+		read = func(name string, _ ...manifestgo.Option) (*manifestgo.Package, error) {
+			return manifestgo.HashFile(name)
+		}
+	case isDMG(name):
+		read = manifestgo.ReadDMGFile
+		opts = append(append(opts, iconOptions()...), manifestgo.WithMetadata(md))
+	case isZip(name):
+		read = manifestgo.ReadZipFile
+		opts = append(append(opts, iconOptions()...), manifestgo.WithMetadata(md))
+	}
+
+	p, err := read(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.SetTitleStrategy(strategies...)
+	p.SetMetadata(md)
+
+	if base := viper.GetString("base-url"); base != "" {
+		p.URL = strings.TrimSuffix(base, "/") + "/" + url.PathEscape(filepath.Base(name))
+	}
+
+	return p, nil
+}
+
+// readURL reads the package at u with the reader registered for its scheme, reporting progress to fn, or to stderr
+// with --progress when fn is nil.
+func readURL(ctx context.Context, u string, fn manifestgo.ProgressFunc) (*manifestgo.Package, error) {
+	hashScheme, chunkSize, err := hashFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	r, httpOpts, err := openURL(ctx, u, chunkSize)
+	if errors.Is(err, httpio.ErrRangeNotSupported) && viper.GetBool("spool-fallback") {
+		opts := append([]httpio.Option{httpio.WithContext(ctx), httpio.WithURL(u), httpio.WithHashChunkSize(chunkSize)}, httpOpts...)
+		return readSpooledURL(ctx, u, opts, fn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	return readPackage(r, hashScheme, chunkSize, fn)
+}
+
+// openURL opens the package at u with the reader registered for its scheme and the package flags, returning the
+// httpio options it was given too. The caller closes the reader if it is an io.Closer.
+func openURL(ctx context.Context, u string, chunkSize int64) (manifestgo.PackageReader, []httpio.Option, error) {
+	var httpOpts []httpio.Option
+	if viper.GetBool("exact-chunks") {
+		httpOpts = append(httpOpts, httpio.WithExactChunks())
+	}
+	authOpts, err := httpAuthOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+	httpOpts = append(httpOpts, authOpts...)
+
+	if err := registerShareMounts(); err != nil {
+		return nil, nil, err
+	}
+	r, err := manifestgo.OpenReader(ctx, u, manifestgo.ReaderOptions{
+		HashChunkSize: chunkSize,
+		HTTPOptions:   httpOpts,
+		Username:      viper.GetString("username"),
+		Password:      viper.GetString("password"),
+	})
+
+	return r, httpOpts, err
+}
+
+// registerShareMounts reads smb and nfs URLs through the --share-mount mounts, as well as those the system lists.
+func registerShareMounts() error {
+	if len(shareMounts) == 0 {
+		return nil
+	}
+
+	mounts := make([]manifestgo.ShareMount, 0, len(shareMounts))
+	for _, m := range shareMounts {
+		i := strings.Index(m, "=")
+		if i < 1 {
+			return fmt.Errorf("invalid --share-mount, expected \"URL=directory\": %s", m)
+		}
+		mounts = append(mounts, manifestgo.ShareMount{URL: m[:i], Dir: m[i+1:]})
+	}
+	f := manifestgo.ShareReader(mounts)
+	manifestgo.RegisterReader("smb", f)
+	manifestgo.RegisterReader("nfs", f)
+
+	return nil
+}
+
+// readSpooledURL downloads u to a spool file and reads the package from there, for a server without range requests.
+func readSpooledURL(ctx context.Context, u string, opts []httpio.Option, fn manifestgo.ProgressFunc) (*manifestgo.Package, error) {
+	res, err := httpio.Fetch(opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if max := viper.GetInt64("spool-max-size"); max > 0 && res.ContentLength > max {
+		return nil, fmt.Errorf("%w of %d bytes", manifestgo.ErrSpoolTooLarge, max)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: server does not support range requests, downloading it\n", u)
+	return readSpooled(ctx, res.Body, u, res.Header.Get("Etag"), fn)
+}
+
+// readSpooled copies the package read from r to a spool file and reads it from there.
+func readSpooled(ctx context.Context, r io.Reader, u, etag string, fn manifestgo.ProgressFunc) (*manifestgo.Package, error) {
+	hashScheme, chunkSize, err := hashFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := manifestgo.NewSpool(ctx, r, manifestgo.SpoolOptions{
+		Dir:           viper.GetString("spool-dir"),
+		MaxSize:       viper.GetInt64("spool-max-size"),
+		Tmpfile:       viper.GetBool("spool-tmpfile"),
+		URL:           u,
+		Etag:          etag,
+		HashChunkSize: chunkSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	return readPackage(s, hashScheme, chunkSize, fn)
+}
+
+// chunkedReader is a PackageReader whose chunk size can be changed once its length is known.
+type chunkedReader interface {
+	manifestgo.PackageReader
+	SetHashChunkSize(int64)
+}
+
+// readPackage reads the package from r with the package flags.
+func readPackage(r manifestgo.PackageReader, hashScheme manifestgo.HashScheme, chunkSize int64, fn manifestgo.ProgressFunc) (*manifestgo.Package, error) {
+	u := r.URL()
+	p, prev, err := newPackage(r, hashScheme, chunkSize, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	read := p.ReadFromURL
+	switch {
+	case viper.GetBool("skip-parse"):
+		read = p.HashOnly
+	case isDMG(u):
+		read = p.ReadDMG
+	case isZip(u):
+		read = p.ReadZip
+	}
+	if err := read(); err != nil {
+		return nil, err
+	}
+	if prev != nil {
+		reportChangedChunks(u, p, prev)
+	}
+
+	return p, nil
+}
+
+// newPackage returns the package of r configured with the package flags, not yet read, and the asset of its
+// --previous-manifest if there is one. --auto-chunksize only applies to a reader whose chunk size can be changed.
+func newPackage(r manifestgo.PackageReader, hashScheme manifestgo.HashScheme, chunkSize int64, fn manifestgo.ProgressFunc) (*manifestgo.Package, *manifestgo.Asset, error) {
+	u := r.URL()
+	cr, chunked := r.(chunkedReader)
+	if viper.GetBool("auto-chunksize") && chunked {
+		chunkSize = manifestgo.RecommendChunkSize(r.Length())
+		cr.SetHashChunkSize(chunkSize)
+	} else if err := manifestgo.ValidateChunkSize(r.Length(), chunkSize); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", u, err)
+	}
+
+	strategies, err := titleStrategies()
+	if err != nil {
+		return nil, nil, err
+	}
+	md, err := metadataFlags()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pkgOpts := []manifestgo.Option{
+		manifestgo.WithHashScheme(hashScheme),
+		manifestgo.WithChunkSize(chunkSize),
+		manifestgo.WithTitleStrategy(strategies...),
+		manifestgo.WithMetadata(md),
+	}
+	pkgOpts = append(pkgOpts, iconOptions()...)
+	trustOpts, err := trustOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+	pkgOpts = append(pkgOpts, trustOpts...)
+	pkgOpts = append(pkgOpts, pkgRefOptions()...)
+	if dir := viper.GetString("cache-dir"); dir != "" {
+		c, err := manifestgo.NewDirCache(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		pkgOpts = append(pkgOpts, manifestgo.WithCache(c))
+	}
+	if viper.GetBool("trace") {
+		pkgOpts = append(pkgOpts, manifestgo.WithTracer(&logTracer{w: os.Stderr, prefix: u}))
+	}
+	if viper.GetBool("payload-archs") {
+		pkgOpts = append(pkgOpts, manifestgo.WithPayloadArchitectures())
+	}
+	if viper.GetBool("check-drift") || viper.GetBool("retry-on-drift") {
+		pkgOpts = append(pkgOpts, manifestgo.WithDriftCheck())
+	}
+	prev, err := previousAsset(u)
+	if err != nil {
+		return nil, nil, err
+	}
+	if prev != nil {
+		pkgOpts = append(pkgOpts, manifestgo.WithPreviousAsset(prev, viper.GetString("previous-etag")))
+		if needsFileDigest() {
+			pkgOpts = append(pkgOpts, manifestgo.WithFileDigest())
+		}
+		if n := viper.GetInt64("unchanged-before"); n > 0 {
+			pkgOpts = append(pkgOpts, manifestgo.WithPartialOverwrite(manifestgo.UnchangedBefore(n)))
+		}
+	}
+
+	p := manifestgo.New(r, pkgOpts...)
+
+	p.SetLenient(viper.GetBool("lenient"))
+
+	if fn == nil && viper.GetBool("progress") {
+		fn = func(pr manifestgo.Progress) {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", u, pr)
+		}
+	}
+	if fn != nil {
+		p.SetProgress(fn)
+	}
+
+	return p, prev, nil
+}
+
+// needsFileDigest reports whether an output asked for needs the SHA-256 of the whole package, so chunks of
+// --previous-manifest are only reused when they leave it known.
+func needsFileDigest() bool {
+	switch viper.GetString("format") {
+	case "munki", "cyclonedx", "spdx":
+		return true
+	}
+
+	return viper.GetString("sha256sums") != "" || viper.GetString("content-store") != "" || viper.GetString("inventory") != ""
+}
+
+// previousAsset returns the asset of u in the --previous-manifest, the one with its URL or file name, or the only
+// asset of the manifest. It returns nil without --previous-manifest.
+func previousAsset(u string) (*manifestgo.Asset, error) {
+	name := viper.GetString("previous-manifest")
+	if name == "" {
+		return nil, nil
+	}
+	m, _, err := readManifestFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var assets []*manifestgo.Asset
+	for _, item := range m.ManifestItems {
+		for _, a := range item.Assets {
+			if a.Kind == manifestgo.AssetKindSoftwarePackage {
+				assets = append(assets, a)
+			}
+		}
+	}
+	for _, a := range assets {
+		if a.URL == u || inputName(a.URL) == inputName(u) {
+			return a, nil
+		}
+	}
+	if len(assets) == 1 {
+		return assets[0], nil
+	}
+
+	return nil, fmt.Errorf("%s: no asset of %s in --previous-manifest", name, inputName(u))
+}
+
+// reportChangedChunks writes the chunks of p that differ from the previous asset to stderr.
+func reportChangedChunks(u string, p *manifestgo.Package, prev *manifestgo.Asset) {
+	ranges, err := p.DiffChunks(prev)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", u, err)
+		return
+	}
+
+	var changed int
+	for _, r := range ranges {
+		changed += r.Last - r.First + 1
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d of %d chunks changed, %d reused from --previous-manifest\n", u, changed, len(p.Hashes), p.ReusedChunks())
+	for _, r := range ranges {
+		fmt.Fprintf(os.Stderr, "%s:   %s\n", u, r)
+	}
+}
+
+// metadataFlags returns the metadata given by --bundle-id, --bundle-version and --title, which --skip-parse needs as
+// nothing is read from the package.
+func metadataFlags() (manifestgo.Metadata, error) {
+	md := manifestgo.Metadata{
+		BundleIdentifier: viper.GetString("bundle-id"),
+		BundleVersion:    viper.GetString("bundle-version"),
+		Title:            viper.GetString("title"),
+	}
+	if viper.GetBool("skip-parse") && md.BundleIdentifier == "" {
+		return md, errors.New("--skip-parse needs --bundle-id, nothing is read from the package")
+	}
+
+	return md, nil
+}
+
+// hashFlags returns the --hash and --chunksize.
+func hashFlags() (manifestgo.HashScheme, int64, error) {
+	var hashScheme manifestgo.HashScheme
+	switch h := viper.GetString("hash"); h {
+	case "md5":
+		hashScheme = manifestgo.HashMD5
+	case "sha256":
+		hashScheme = manifestgo.HashSHA256
+	default:
+		return 0, 0, fmt.Errorf("unsupported hash: %s", h)
+	}
+
+	chunkSize := viper.GetInt64("chunksize")
+	if chunkSize <= 0 {
+		return 0, 0, manifestgo.ErrInvalidChunkSize
+	}
+
+	return hashScheme, chunkSize, nil
+}
+
+func httpAuthOptions() ([]httpio.Option, error) {
+	var opts []httpio.Option
+	for _, h := range httpHeaders {
+		i := strings.Index(h, ":")
+		if i < 1 {
+			return nil, fmt.Errorf("invalid header, expected \"Name: value\": %s", h)
+		}
+		opts = append(opts, httpio.WithHeader(strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:])))
+	}
+
+	username, password, token := viper.GetString("username"), viper.GetString("password"), viper.GetString("bearer-token")
+	switch {
+	case username != "" && token != "":
+		return nil, errors.New("use either --username or --bearer-token, not both")
+	case username != "":
+		opts = append(opts, httpio.WithBasicAuth(username, password))
+	case token != "":
+		opts = append(opts, httpio.WithBearerToken(token))
+	}
+
+	if socket := viper.GetString("unix-socket"); socket != "" {
+		opts = append(opts, httpio.WithUnixSocket(socket))
+	}
+	if dialPolicy != nil {
+		opts = append(opts, httpio.WithDialer(httpio.RestrictedDialer(*dialPolicy)))
+	}
+	if proxy := viper.GetString("proxy"); proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid --proxy, expected a URL such as socks5://127.0.0.1:1080: %s", proxy)
+		}
+		opts = append(opts, httpio.WithProxy(u))
+	}
+
+	if rate := viper.GetInt64("expected-rate"); rate > 0 {
+		opts = append(opts, httpio.WithExpectedRate(rate))
+	}
+	if command := viper.GetString("url-refresh-command"); command != "" {
+		opts = append(opts, httpio.WithURLRefresh(commandURLRefresh(command)))
+	}
+
+	return opts, nil
+}
+
+// commandURLRefresh returns a RefreshFunc running the shell command with the expiring URL as $1, taking the first line
+// it prints as the new URL.
+func commandURLRefresh(command string) httpio.RefreshFunc {
+	return func(ctx context.Context, u string) (string, error) {
+		out, err := exec.CommandContext(ctx, "sh", "-c", command, "sh", u).Output()
+		if err != nil {
+			return "", fmt.Errorf("--url-refresh-command: %w", err)
+		}
+
+		line := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+		if !isURL(line) {
+			return "", fmt.Errorf("--url-refresh-command printed %q, not a URL", line)
+		}
+
+		return line, nil
+	}
+}
+
+func isURL(input string) bool {
+	return strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")
+}
+
+// hasReader reports whether input is a URL read with the reader registered for its scheme, such as an http(s) or
+// file URL, rather than a local path.
+func hasReader(input string) bool {
+	return strings.Contains(input, "://") && manifestgo.HasReader(input)
+}
+
+// isDMG reports whether the local path or URL input names a disk image, read with ReadDMG rather than as a package.
+func isDMG(input string) bool {
+	return strings.EqualFold(path.Ext(inputName(input)), ".dmg")
+}
+
+// isZip reports whether the local path or URL input names a zipped app bundle, read with ReadZip.
+func isZip(input string) bool {
+	return strings.EqualFold(path.Ext(inputName(input)), ".zip")
+}
+
+// inputName returns the file name of a local path or URL input.
+func inputName(input string) string {
+	if input == "-" {
+		return "stdin"
+	}
+	if hasReader(input) {
+		if u, err := url.Parse(input); err == nil {
+			return path.Base(u.Path)
+		}
+	}
+
+	return filepath.Base(input)
+}
+
+// outputStems returns the name the manifest of each input is written under in --output-dir, without its extension: the
+// file name of the input, with a short hash of the input added when other inputs have the same file name, whatever its
+// case, so their manifests do not overwrite one another.
+func outputStems(inputs []string) map[string]string {
+	stem := func(input string) string {
+		name := inputName(input)
+		return strings.TrimSuffix(name, path.Ext(name))
+	}
+
+	inputsOf := make(map[string]map[string]bool)
+	for _, input := range inputs {
+		key := strings.ToLower(stem(input))
+		if inputsOf[key] == nil {
+			inputsOf[key] = make(map[string]bool)
+		}
+		inputsOf[key][input] = true
+	}
+
+	stems := make(map[string]string, len(inputs))
+	for _, input := range inputs {
+		s := stem(input)
+		if len(inputsOf[strings.ToLower(s)]) > 1 {
+			sum := sha256.Sum256([]byte(input))
+			s += "-" + hex.EncodeToString(sum[:4])
+		}
+		stems[input] = s
+	}
+
+	return stems
+}
+
+// writeManifest writes the manifest of input in the --format, returning the file it was written to in outDir, named
+// stem and the extension of the format, and the URL it will be served from when --manifest-base-url is set, whose link
+// is written as a QR code beside it with --qr.
+func writeManifest(p *manifestgo.Package, m *manifestgo.Manifest, input, outDir, stem string) (string, string, error) {
+	var (
+		b   []byte
+		err error
+	)
+
+	format := viper.GetString("format")
+	ext := format
+	indent := viper.GetInt("indent")
+	switch format {
+	case "json":
+		if !viper.GetBool("canonical") {
+			b, err = manifestJSON(m, indent)
+			break
+		}
+		if m, err = jsonDigests(m); err == nil {
+			b, err = m.Canonical()
+		}
+	case "plist":
+		b, err = m.AsPlist(indent)
+	case "ascii-plist":
+		b, err = m.AsASCIIPlist(indent)
+		ext = "plist"
+	case "munki":
+		var info *manifestgo.MunkiPkgInfo
+		if info, err = p.BuildMunkiPkgInfo(); err != nil {
+			return "", "", err
+		}
+		if info.InstallerItemLocation == "" {
+			info.InstallerItemLocation = inputName(input)
+		}
+		b, err = info.AsPlist(indent)
+		ext = "pkginfo"
+	case "mobileconfig":
+		b, err = buildProfile(p, m, indent)
+	case "cyclonedx", "spdx":
+		if b, err = p.AsSBOM(manifestgo.SBOMFormat(format)); err == nil && indent > 0 {
+			var buf bytes.Buffer
+			err = json.Indent(&buf, b, "", strings.Repeat(" ", indent))
+			b = buf.Bytes()
+		}
+		ext = map[string]string{"cyclonedx": "cdx.json", "spdx": "spdx.json"}[format]
+	default:
+		return "", "", fmt.Errorf("unsupported format: %s", format)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	if outDir == "" {
+		_, err = fmt.Println(string(b))
+		return "", "", err
+	}
+
+	name := stem + "." + ext
+	file := filepath.Join(outDir, name)
+	if err := ioutil.WriteFile(file, b, 0644); err != nil {
+		return "", "", err
+	}
+
+	base := viper.GetString("manifest-base-url")
+	if base == "" {
+		return file, "", nil
+	}
+
+	manifestURL := strings.TrimSuffix(base, "/") + "/" + url.PathEscape(name)
+	link, err := manifestgo.ITMSServicesURL(manifestURL)
+	if err != nil {
+		return "", "", err
+	}
+	fmt.Println(link)
+	if viper.GetBool("qr") {
+		if err := writeQRCode(strings.TrimSuffix(file, "."+ext)+".png", link, viper.GetInt("qr-scale")); err != nil {
+			return "", "", err
+		}
+	}
+
+	return file, manifestURL, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOutputStems(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs []string
+		want   map[string]string
+	}{
+		{
+			"distinct",
+			[]string{"https://a.example.com/App.pkg", "https://a.example.com/Other.pkg", "/pkgs/Tool.pkg"},
+			map[string]string{"https://a.example.com/App.pkg": "App", "https://a.example.com/Other.pkg": "Other", "/pkgs/Tool.pkg": "Tool"},
+		},
+		{
+			"same file name",
+			[]string{"https://a.example.com/App.pkg", "https://b.example.com/App.pkg", "https://a.example.com/Other.pkg"},
+			map[string]string{"https://a.example.com/App.pkg": "App-a95524fa", "https://b.example.com/App.pkg": "App-4f453b3f", "https://a.example.com/Other.pkg": "Other"},
+		},
+		{
+			"same file name in another case or extension",
+			[]string{"https://a.example.com/App.pkg", "/pkgs/app.dmg"},
+			map[string]string{"https://a.example.com/App.pkg": "App-a95524fa", "/pkgs/app.dmg": "app-dd88df60"},
+		},
+		{
+			"same input twice",
+			[]string{"https://a.example.com/App.pkg", "https://a.example.com/App.pkg"},
+			map[string]string{"https://a.example.com/App.pkg": "App"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := outputStems(tt.inputs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
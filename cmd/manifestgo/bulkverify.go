@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dbyington/manifestgo"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var bulkVerifyCmd = &cobra.Command{
+	Use:   "bulk-verify",
+	Short: "Check the packages of a directory of manifests still match their hashes",
+	Long: `Bulk-verify reads every .json and .plist manifest under --manifest-dir, downloads the package of
+each asset and hashes it again, --parallel at a time. Assets whose package changed are reported
+as drifted, and those that could not be checked, such as a URL that no longer answers, as broken.
+It exits non-zero if any asset is drifted or broken.`,
+	Args: cobra.NoArgs,
+	RunE: runBulkVerify,
+}
+
+func init() {
+	rootCmd.AddCommand(bulkVerifyCmd)
+
+	addAuthFlags(bulkVerifyCmd)
+	bulkVerifyCmd.Flags().String("manifest-dir", "", "directory of manifests to verify, searched recursively")
+	bulkVerifyCmd.Flags().Int("parallel", 4, "number of packages downloaded at once")
+	bulkVerifyCmd.Flags().Bool("verbose", false, "also print the assets that verified")
+}
+
+// verifyResult is the outcome of verifying one asset.
+type verifyResult struct {
+	file   string
+	url    string
+	status string
+	err    error
+}
+
+// Verify statuses.
+const (
+	verifyOK      = "ok"
+	verifyDrifted = "drifted"
+	verifyBroken  = "broken"
+)
+
+type verifyTask struct {
+	file  string
+	asset *manifestgo.Asset
+}
+
+func runBulkVerify(cmd *cobra.Command, args []string) error {
+	dir := viper.GetString("manifest-dir")
+	if dir == "" {
+		return errors.New("--manifest-dir is required")
+	}
+	parallel := viper.GetInt("parallel")
+	if parallel < 1 {
+		return errors.New("--parallel must be at least 1")
+	}
+
+	authOpts, err := httpAuthOptions()
+	if err != nil {
+		return err
+	}
+
+	var (
+		tasks   []verifyTask
+		results []verifyResult
+	)
+	err = filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ext := strings.ToLower(filepath.Ext(name)); info.IsDir() || (ext != ".json" && ext != ".plist") {
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		m, err := manifestgo.ParseManifest(b)
+		if err != nil {
+			results = append(results, verifyResult{file: name, status: verifyBroken, err: err})
+			return nil
+		}
+
+		for _, item := range m.ManifestItems {
+			for _, a := range item.Assets {
+				if a.Kind != manifestgo.AssetKindSoftwarePackage {
+					continue
+				}
+				tasks = append(tasks, verifyTask{file: name, asset: a})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	queue := make(chan verifyTask)
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range queue {
+				r := verifyResult{file: t.file, url: t.asset.URL, status: verifyOK}
+				if r.err = manifestgo.VerifyAsset(cmd.Context(), t.asset, authOpts...); r.err != nil {
+					r.status = verifyBroken
+					if errors.Is(r.err, manifestgo.ErrHashMismatch) {
+						r.status = verifyDrifted
+					}
+				}
+
+				mu.Lock()
+				results = append(results, r)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, t := range tasks {
+		queue <- t
+	}
+	close(queue)
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].file != results[j].file {
+			return results[i].file < results[j].file
+		}
+		return results[i].url < results[j].url
+	})
+
+	counts := make(map[string]int)
+	for _, r := range results {
+		counts[r.status]++
+		if r.status == verifyOK && !viper.GetBool("verbose") {
+			continue
+		}
+
+		line := fmt.Sprintf("%s\t%s\t%s", r.status, r.file, r.url)
+		if r.err != nil {
+			line += "\t" + r.err.Error()
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), line)
+	}
+
+	fmt.Fprintf(os.Stderr, "%d ok, %d drifted, %d broken\n", counts[verifyOK], counts[verifyDrifted], counts[verifyBroken])
+	if counts[verifyDrifted]+counts[verifyBroken] > 0 {
+		return fmt.Errorf("%d of %d entries drifted or broken", counts[verifyDrifted]+counts[verifyBroken], len(results))
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/dbyington/manifestgo"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare pkg",
+	Short: "Tell whether a pkg upgrades, downgrades or matches what a device has installed",
+	Long: `Compare reads the receipts of a device from --receipts, the output of pkgutil --pkg-info for its
+packages, or lines of a package identifier and version, and compares each component package of
+pkg with them. The pkg is an upgrade if any component is newer or not installed while others
+are, a downgrade if any is older, and the same version if all are installed at their version.
+
+--receipts - reads the receipts from stdin, such as from ssh mac 'for p in $(pkgutil --pkgs); do
+pkgutil --pkg-info $p; done'.
+
+With --pkg and --url and no pkg argument, compare instead checks that a local package and its
+hosted copy are byte-identical, hashing both at once in chunks of --chunksize, and fails listing
+the chunks that differ, such as those an upload truncated, before its manifest is published.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runCompare,
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+
+	addReadFlags(compareCmd)
+	compareCmd.Flags().String("receipts", "", "file of the receipts of the device, - for stdin")
+	compareCmd.Flags().Bool("json", false, "print the comparison as JSON")
+	compareCmd.Flags().String("pkg", "", "local package to compare byte for byte with --url")
+	compareCmd.Flags().String("url", "", "URL of the hosted copy of --pkg")
+}
+
+func runCompare(cmd *cobra.Command, args []string) error {
+	if viper.GetString("pkg") != "" || viper.GetString("url") != "" {
+		if len(args) > 0 {
+			return errors.New("--pkg and --url compare two copies of a package, they take no pkg argument")
+		}
+		return runCompareCopies(cmd)
+	}
+	if len(args) != 1 {
+		return errors.New("compare needs a pkg to compare with --receipts")
+	}
+
+	name := viper.GetString("receipts")
+	if name == "" {
+		return errors.New("--receipts is required")
+	}
+	if name == "-" && args[0] == "-" {
+		return errors.New("the pkg and --receipts cannot both be read from stdin")
+	}
+
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	installed, err := manifestgo.ParseInstalledPackages(r)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := buildContext(cmd.Context())
+	defer cancel()
+	p, err := readInput(ctx, args[0])
+	if err != nil {
+		return timeoutError(ctx, err)
+	}
+	c := p.CompareInstalled(installed)
+
+	if viper.GetBool("json") {
+		b, err := json.MarshalIndent(c, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), string(b))
+		return nil
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "%s: %s\n", args[0], c.Comparison)
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	for _, cc := range c.Components {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", cc.ID, orDash(cc.Version), orDash(cc.InstalledVersion), cc.Comparison)
+	}
+
+	return w.Flush()
+}
+
+// orDash returns s, or - if it is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+// copyComparison is the --json output of comparing --pkg with --url.
+type copyComparison struct {
+	Identical bool                    `json:"identical"`
+	PkgSize   int64                   `json:"pkg_size"`
+	URLSize   int64                   `json:"url_size"`
+	Chunks    int                     `json:"chunks"`
+	Differing []manifestgo.ChunkRange `json:"differing,omitempty"`
+}
+
+// runCompareCopies hashes the --pkg file and the --url in chunks at the same time and compares them.
+func runCompareCopies(cmd *cobra.Command) error {
+	local, remote := viper.GetString("pkg"), viper.GetString("url")
+	if local == "" || remote == "" {
+		return errors.New("--pkg and --url must be used together")
+	}
+	ctx, cancel := buildContext(cmd.Context())
+	defer cancel()
+
+	abs, err := filepath.Abs(local)
+	if err != nil {
+		return err
+	}
+	localURL := (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String()
+
+	var (
+		wg    sync.WaitGroup
+		pkgs  [2]*manifestgo.Package
+		errs  [2]error
+		names = [2]string{local, remote}
+	)
+	for i, u := range []string{localURL, remote} {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			pkgs[i], errs[i] = hashURL(ctx, u)
+		}(i, u)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("%s: %w", names[i], timeoutError(ctx, err))
+		}
+	}
+
+	ranges, err := pkgs[0].CompareChunks(pkgs[1])
+	if err != nil {
+		return err
+	}
+	c := copyComparison{
+		PkgSize:   pkgs[0].ContentLength,
+		URLSize:   pkgs[1].ContentLength,
+		Chunks:    len(pkgs[0].Hashes),
+		Differing: ranges,
+	}
+	c.Identical = len(ranges) == 0 && c.PkgSize == c.URLSize
+
+	if viper.GetBool("json") {
+		b, err := json.MarshalIndent(c, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	} else if c.Identical {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s and %s are identical: %d bytes in %d chunks\n", local, remote, c.PkgSize, c.Chunks)
+	} else {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s is %d bytes, %s is %d bytes\n", local, c.PkgSize, remote, c.URLSize)
+		for _, r := range ranges {
+			fmt.Fprintf(cmd.OutOrStdout(), "  %s differs\n", r)
+		}
+	}
+
+	if !c.Identical {
+		return fmt.Errorf("%s and %s differ", local, remote)
+	}
+	return nil
+}
+
+// hashURL hashes the package at u in chunks, with the --hash and --chunksize flags, without parsing it.
+func hashURL(ctx context.Context, u string) (*manifestgo.Package, error) {
+	hashScheme, chunkSize, err := hashFlags()
+	if err != nil {
+		return nil, err
+	}
+	r, _, err := openURL(ctx, u, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	p := manifestgo.New(r, manifestgo.WithHashScheme(hashScheme), manifestgo.WithChunkSize(chunkSize))
+	if err := p.HashOnly(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dbyington/manifestgo"
+)
+
+// storeContent keeps the manifest of the package of input in the --content-store, reporting when the same package
+// was built from other URLs before.
+func storeContent(store *manifestgo.ContentStore, input string, p *manifestgo.Package, m *manifestgo.Manifest) error {
+	rec, duplicate, err := store.Put(p, m)
+	if errors.Is(err, manifestgo.ErrNoFileDigest) {
+		fmt.Fprintf(os.Stderr, "%s: warning: not in the content store, the package was only hashed in chunks\n", input)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if duplicate {
+		var others []string
+		for _, u := range rec.URLs {
+			if u != p.URL {
+				others = append(others, u)
+			}
+		}
+		if len(others) > 0 {
+			fmt.Fprintf(os.Stderr, "%s: same package as %s, sha256 %s\n", input, strings.Join(others, ", "), rec.SHA256)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dbyington/manifestgo"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Convert a manifest between formats",
+	Long: `Convert reads a JSON, XML plist or binary plist manifest and writes it in another format, without
+reading the package again. The input format is detected from its content and the output format
+from the --out extension, .json or .plist, unless --format is given. Items can be kept or dropped
+by bundle identifier with --include and --exclude, sorted with --order, and one put first with --primary.`,
+	Args: cobra.NoArgs,
+	RunE: runConvert,
+}
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+
+	convertCmd.Flags().String("in", "", "manifest to convert, - for stdin")
+	convertCmd.Flags().String("out", "", "file to write the converted manifest to, stdout by default")
+	convertCmd.Flags().String("format", "", "output format: json, plist or ascii-plist, from the --out extension by default")
+	convertCmd.Flags().Int("indent", 2, "number of spaces to indent the output with, 0 for compact")
+	addJSONFlags(convertCmd)
+	addSelectFlags(convertCmd, true)
+}
+
+func runConvert(cmd *cobra.Command, args []string) error {
+	m, _, err := readManifestFile(viper.GetString("in"))
+	if err != nil {
+		return err
+	}
+	if err := selectItems(m); err != nil {
+		return err
+	}
+
+	return writeManifestFile(cmd, m, viper.GetString("out"), viper.GetString("format"), "json", viper.GetInt("indent"))
+}
+
+// readManifestFile parses the manifest in the file name, or stdin for -, returning it and its format, json or plist.
+func readManifestFile(name string) (*manifestgo.Manifest, string, error) {
+	if name == "" {
+		return nil, "", errors.New("--in is required")
+	}
+
+	var (
+		b   []byte
+		err error
+	)
+	if name == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(name)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	m, err := manifestgo.ParseManifest(b)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", name, err)
+	}
+
+	format := "json"
+	if b := bytes.TrimSpace(b); bytes.HasPrefix(b, []byte("<")) || bytes.HasPrefix(b, []byte("bplist")) {
+		format = "plist"
+	}
+
+	return m, format, nil
+}
+
+// writeManifestFile writes m to out, or stdout if out is empty, in the format. Without one the format is told from the
+// extension of out, falling back to def.
+func writeManifestFile(cmd *cobra.Command, m *manifestgo.Manifest, out, format, def string, indent int) error {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(out)) {
+		case ".plist":
+			format = "plist"
+		case ".json":
+			format = "json"
+		case "":
+			format = def
+		default:
+			return fmt.Errorf("cannot tell the format of %s, use --format", out)
+		}
+	}
+
+	var (
+		b   []byte
+		err error
+	)
+	switch format {
+	case "json":
+		b, err = manifestJSON(m, indent)
+	case "plist":
+		b, err = m.AsPlist(indent)
+	case "ascii-plist":
+		b, err = m.AsASCIIPlist(indent)
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+		return err
+	}
+
+	return ioutil.WriteFile(out, b, 0644)
+}
+
+// addJSONFlags adds the flags of commands writing json manifests to cmd.
+func addJSONFlags(cmd *cobra.Command) {
+	cmd.Flags().String("digest-encoding", "hex", "encoding of the digests in json manifests: hex, upper-hex or base64; plists are always hex")
+	cmd.Flags().String("json-naming", "default", "field names of json manifests: default, snake, camel or kebab")
+}
+
+// manifestJSON returns m as JSON indented by indent spaces, with the --digest-encoding and --json-naming.
+func manifestJSON(m *manifestgo.Manifest, indent int) ([]byte, error) {
+	m, err := jsonDigests(m)
+	if err != nil {
+		return nil, err
+	}
+	naming, err := manifestgo.ParseFieldNaming(viper.GetString("json-naming"))
+	if err != nil {
+		return nil, err
+	}
+
+	return m.AsJSONNamed(indent, naming)
+}
+
+// jsonDigests returns m with its digests in the --digest-encoding.
+func jsonDigests(m *manifestgo.Manifest) (*manifestgo.Manifest, error) {
+	enc, err := manifestgo.ParseDigestEncoding(viper.GetString("digest-encoding"))
+	if err != nil || enc == manifestgo.DigestHex {
+		return m, err
+	}
+
+	return m.WithDigestEncoding(enc)
+}
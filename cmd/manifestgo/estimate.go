@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/dbyington/manifestgo"
+)
+
+// estimateInputs prints the estimate of building each input, for --estimate.
+func estimateInputs(ctx context.Context, inputs []string) error {
+	var failed int
+	for _, input := range inputs {
+		e, err := estimateInput(ctx, input)
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s: %s\n", input, err)
+			continue
+		}
+		fmt.Printf("%s: %s\n", input, e)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d packages failed", failed, len(inputs))
+	}
+
+	return nil
+}
+
+// estimateInput opens input, a file or a URL, with the package flags and estimates reading it.
+func estimateInput(ctx context.Context, input string) (*manifestgo.BuildEstimate, error) {
+	u := input
+	switch {
+	case input == "-":
+		return nil, errors.New("stdin cannot be estimated")
+	case !hasReader(input):
+		name, err := filepath.Abs(input)
+		if err != nil {
+			return nil, err
+		}
+		u = (&url.URL{Scheme: "file", Path: filepath.ToSlash(name)}).String()
+	}
+
+	hashScheme, chunkSize, err := hashFlags()
+	if err != nil {
+		return nil, err
+	}
+	r, _, err := openURL(ctx, u, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	p, _, err := newPackage(r, hashScheme, chunkSize, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.EstimateBuild()
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/dbyington/manifestgo"
+)
+
+// runExec runs the --exec shell command after the manifest of input is written to file. {} in the command is passed
+// as $1 rather than substituted, so a path with spaces or quotes cannot break the command, and the package is
+// described by MANIFESTGO_* environment variables. The output of the command goes to stderr, keeping stdout for the
+// install links.
+func runExec(ctx context.Context, command, input, file, manifestURL string, p *manifestgo.Package) error {
+	c := exec.CommandContext(ctx, "sh", "-c", strings.ReplaceAll(command, "{}", `"$1"`), "sh", file)
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+	c.Env = append(os.Environ(),
+		"MANIFESTGO_INPUT="+input,
+		"MANIFESTGO_MANIFEST="+file,
+		"MANIFESTGO_MANIFEST_URL="+manifestURL,
+		"MANIFESTGO_PACKAGE_URL="+p.URL,
+		"MANIFESTGO_BUNDLE_ID="+p.GetBundleIdentifier(),
+		"MANIFESTGO_VERSION="+p.GetVersion(),
+	)
+
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("--exec: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+)
+
+// readyCheckTimeout bounds each readiness check, so /readyz answers before a probe gives up on it.
+const readyCheckTimeout = 3 * time.Second
+
+// checkResult is the outcome of one readiness check.
+type checkResult struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// addHealthHandlers adds /healthz, answering while the process serves requests, and /readyz, checking the workers,
+// that the cache directory is writable when there is one, and that checkURL can be reached when it is set.
+func addHealthHandlers(mux *http.ServeMux, store *jobStore, cacheDir, checkURL string) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		checks := map[string]checkResult{
+			"workers": result(store.checkWorkers()),
+		}
+		if cacheDir != "" {
+			checks["cache"] = result("", checkCacheDir(cacheDir))
+		}
+		if checkURL != "" {
+			checks["outbound"] = result("", checkOutbound(r.Context(), checkURL))
+		}
+
+		status, code := "ok", http.StatusOK
+		for _, c := range checks {
+			if !c.OK {
+				status, code = "unavailable", http.StatusServiceUnavailable
+			}
+		}
+
+		writeJSON(w, code, map[string]interface{}{"status": status, "checks": checks})
+	})
+}
+
+func result(detail string, err error) checkResult {
+	if err != nil {
+		return checkResult{Detail: detail, Error: err.Error()}
+	}
+
+	return checkResult{OK: true, Detail: detail}
+}
+
+// checkWorkers reports how busy the workers are, failing while the queue is full.
+func (s *jobStore) checkWorkers() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	detail := fmt.Sprintf("%d of %d workers busy, %d of %d jobs queued", s.running, s.workers, len(s.queue), cap(s.queue))
+	if s.workers == 0 {
+		return detail, errors.New("no workers")
+	}
+	if len(s.queue) == cap(s.queue) {
+		return detail, errQueueFull
+	}
+
+	return detail, nil
+}
+
+// checkCacheDir checks a file can be created in dir.
+func checkCacheDir(dir string) error {
+	f, err := ioutil.TempFile(dir, "readyz.*.tmp")
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	return os.Remove(f.Name())
+}
+
+// checkOutbound checks a HEAD request to u gets a response, whatever its status.
+func checkOutbound(ctx context.Context, u string) error {
+	ctx, cancel := context.WithTimeout(ctx, readyCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/dbyington/manifestgo"
+	"github.com/spf13/viper"
+)
+
+// iconOptions returns the options reading the icon of an app when --icon-dest is set.
+func iconOptions() []manifestgo.Option {
+	if viper.GetString("icon-dest") == "" {
+		return nil
+	}
+
+	return []manifestgo.Option{manifestgo.WithIcon()}
+}
+
+// publishIcon uploads the icon of the app of p to --icon-dest, named after the bundle identifier of m, and makes it
+// the display image of m. A package without an icon, which has been warned about, is left as it is.
+func publishIcon(ctx context.Context, input string, p *manifestgo.Package, m *manifestgo.Manifest) error {
+	icon := p.Icon()
+	if icon == nil || len(m.ManifestItems) == 0 || m.ManifestItems[0].Metadata == nil {
+		return nil
+	}
+
+	dest := uploadDest(viper.GetString("icon-dest"), m.ManifestItems[0].Metadata.BundleIdentifier+".png")
+	u, err := uploadedURL(dest, viper.GetString("icon-url"))
+	if err != nil {
+		return fmt.Errorf("%w, give --icon-url", err)
+	}
+
+	f, err := ioutil.TempFile(viper.GetString("spool-dir"), "manifestgo-icon-*.png")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(icon); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: uploading the icon to %s\n", input, dest)
+	sum := sha256.Sum256(icon)
+	if err := upload(ctx, f.Name(), dest, sum[:]); err != nil {
+		return fmt.Errorf("uploading the icon: %w", err)
+	}
+	m.SetDisplayImage(u)
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dbyington/manifestgo"
+)
+
+// newInventoryFile creates the --inventory file name, returning it and a writer of JSON lines when its extension is
+// .jsonl or .ndjson, of CSV otherwise.
+func newInventoryFile(name string) (*os.File, *manifestgo.InventoryWriter, error) {
+	format := manifestgo.InventoryCSV
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jsonl", ".ndjson":
+		format = manifestgo.InventoryJSONLines
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	w, err := manifestgo.NewInventoryWriter(f, format)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return f, w, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/dbyington/manifestgo"
+	"github.com/dbyington/manifestgo/internal/qr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var linkCmd = &cobra.Command{
+	Use:   "link",
+	Short: "Print the itms-services link that installs a hosted manifest",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manifestURL := viper.GetString("manifest-url")
+		if manifestURL == "" {
+			return errors.New("--manifest-url is required")
+		}
+
+		link, err := manifestgo.ITMSServicesURL(manifestURL)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), link)
+
+		if name := viper.GetString("qr"); name != "" {
+			return writeQRCode(name, link, viper.GetInt("qr-scale"))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(linkCmd)
+
+	linkCmd.Flags().String("manifest-url", "", "https URL the manifest is served from")
+	linkCmd.Flags().String("qr", "", "also write the link as a QR code PNG to this file")
+	linkCmd.Flags().Int("qr-scale", 8, "pixels per QR code module")
+}
+
+func writeQRCode(name, link string, scale int) error {
+	c, err := qr.Encode([]byte(link), qr.Medium)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.PNG(scale)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(name, b, 0644)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	// Cancel any build in progress on the first interrupt, a second one kills the process as usual.
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		signal.Stop(sig)
+		cancel()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	cancel()
+	if err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dbyington/manifestgo"
+	"github.com/dbyington/manifestgo/httpio"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror",
+	Short: "Copy a pkg to your own server and build its manifest",
+	Long: `Mirror downloads the pkg at --url, uploads it to --dest and writes a manifest pointing at the
+mirrored copy, for self-hosted distribution. The download uses parallel range requests and resumes
+from where an interrupted run stopped.
+
+--dest may be an s3:// or gs:// URL, uploaded with the aws or gsutil command, an http(s) URL the
+pkg is PUT to, or a local directory. A --dest ending in /, or naming a directory, gets the file
+name of --url appended. The manifest points at the public https URL of an s3:// or gs:// object,
+the PUT URL without its query, or --public-url with the file name appended, which a local
+directory needs.
+
+The download is checked against --sha256 when it is given. The upload is checked too: the ETag
+the server returns for a PUT against the downloaded pkg, and a copy in a local directory against
+its SHA-256, while the aws and gsutil commands check the checksums of what they upload themselves.`,
+	Args: cobra.NoArgs,
+	RunE: runMirror,
+}
+
+// destHeaders holds the --dest-header flags, not read through viper for the same reason as httpHeaders.
+var destHeaders []string
+
+func init() {
+	rootCmd.AddCommand(mirrorCmd)
+
+	addPackageFlags(mirrorCmd)
+	mirrorCmd.Flags().String("url", "", "http(s) URL of the pkg to mirror")
+	mirrorCmd.Flags().String("sha256", "", "hex SHA-256 the pkg at --url must have, such as one published by its vendor")
+	mirrorCmd.Flags().String("dest", "", "where to upload the pkg: an s3:// or gs:// URL, an http(s) URL to PUT it to, or a local directory")
+	mirrorCmd.Flags().String("public-url", "", "URL the mirrored pkgs are served from, the file name is appended to it")
+	mirrorCmd.Flags().StringArrayVar(&destHeaders, "dest-header", nil, "extra header for the PUT to an http(s) --dest as \"Name: value\", may be repeated")
+	mirrorCmd.Flags().String("out", "", "file to write the manifest to, stdout by default")
+	mirrorCmd.Flags().String("format", "", "manifest output format: json, plist or ascii-plist, from the --out extension by default")
+	mirrorCmd.Flags().Int("indent", 2, "number of spaces to indent the output with, 0 for compact")
+	addJSONFlags(mirrorCmd)
+}
+
+func runMirror(cmd *cobra.Command, args []string) error {
+	src, dest := viper.GetString("url"), viper.GetString("dest")
+	if !isURL(src) {
+		return errors.New("--url must be an http(s) URL")
+	}
+	if dest == "" {
+		return errors.New("--dest is required")
+	}
+
+	name := inputName(src)
+	dest = uploadDest(dest, name)
+	publicURL, err := uploadedURL(dest, viper.GetString("public-url"))
+	if err != nil {
+		return fmt.Errorf("%w, give --public-url", err)
+	}
+
+	ctx, cancel := buildContext(cmd.Context())
+	defer cancel()
+	file, sum, err := downloadMirror(ctx, src, name)
+	if err != nil {
+		return timeoutError(ctx, err)
+	}
+	if want := viper.GetString("sha256"); want != "" && !strings.EqualFold(hex.EncodeToString(sum), want) {
+		os.Remove(file)
+		return fmt.Errorf("%s: the downloaded pkg has the SHA-256 %x, not %s", src, sum, want)
+	}
+
+	hashScheme, chunkSize, err := hashFlags()
+	if err != nil {
+		os.Remove(file)
+		return err
+	}
+	// The spool removes the downloaded file once the manifest is built.
+	s, err := manifestgo.OpenSpool(ctx, file, manifestgo.SpoolOptions{URL: publicURL, HashChunkSize: chunkSize})
+	if err != nil {
+		os.Remove(file)
+		return err
+	}
+	defer s.Close()
+
+	// The package is read before it is uploaded, so a file that is not a package is not mirrored.
+	p, err := readPackage(s, hashScheme, chunkSize, nil)
+	if err != nil {
+		return err
+	}
+	m, err := packageManifest(src, p)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: uploading to %s\n", src, dest)
+	if err := upload(ctx, file, dest, sum); err != nil {
+		return timeoutError(ctx, err)
+	}
+
+	return writeManifestFile(cmd, m, viper.GetString("out"), viper.GetString("format"), "json", viper.GetInt("indent"))
+}
+
+// downloadMirror downloads src to a file in the --spool-dir named after it, so a rerun resumes an interrupted download,
+// and returns the file and its SHA-256.
+func downloadMirror(ctx context.Context, src, name string) (string, []byte, error) {
+	_, chunkSize, err := hashFlags()
+	if err != nil {
+		return "", nil, err
+	}
+	opts, err := httpAuthOptions()
+	if err != nil {
+		return "", nil, err
+	}
+	opts = append(opts, httpio.WithHashChunkSize(chunkSize))
+
+	dir := viper.GetString("spool-dir")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	file := filepath.Join(dir, "manifestgo-mirror-"+name)
+
+	fmt.Fprintf(os.Stderr, "%s: downloading to %s\n", src, file)
+	sum, err := httpio.Download(ctx, src, file, opts...)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return file, sum, nil
+}
+
+// uploadDest appends name to a dest URL whose path is empty or ends in /, or to a local dest ending in / or naming a
+// directory.
+func uploadDest(dest, name string) string {
+	if u, err := url.Parse(dest); err == nil && u.Scheme != "" && u.Scheme != "file" {
+		if u.Path == "" || strings.HasSuffix(u.Path, "/") {
+			u.Path = strings.TrimSuffix(u.Path, "/") + "/" + name
+		}
+		return u.String()
+	}
+
+	if fi, err := os.Stat(dest); strings.HasSuffix(dest, "/") || (err == nil && fi.IsDir()) {
+		return strings.TrimSuffix(dest, "/") + "/" + name
+	}
+
+	return dest
+}
+
+// uploadedURL returns the URL the file uploaded to dest is served from: base with the file name appended if it is set,
+// or the public URL of dest.
+func uploadedURL(dest, base string) (string, error) {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return "", err
+	}
+	if base != "" {
+		return strings.TrimSuffix(base, "/") + "/" + url.PathEscape(path.Base(u.Path)), nil
+	}
+	switch u.Scheme {
+	case "s3":
+		return (&url.URL{Scheme: "https", Host: u.Host + ".s3.amazonaws.com", Path: u.Path}).String(), nil
+	case "gs":
+		return (&url.URL{Scheme: "https", Host: "storage.googleapis.com", Path: "/" + u.Host + u.Path}).String(), nil
+	case "http", "https":
+		u.RawQuery = ""
+		return u.String(), nil
+	}
+
+	return "", errors.New("a local directory has no public URL")
+}
+
+// upload copies file, whose SHA-256 is sum, to dest and checks the copy. The aws and gsutil commands check what they
+// upload against its MD5 or CRC32C themselves.
+func upload(ctx context.Context, file, dest string, sum []byte) error {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return err
+	}
+
+	switch u.Scheme {
+	case "s3":
+		return runUploadCommand(ctx, "aws", "s3", "cp", "--only-show-errors", file, dest)
+	case "gs":
+		return runUploadCommand(ctx, "gsutil", "-q", "cp", file, dest)
+	case "http", "https":
+		etag, err := putFile(ctx, file, dest)
+		if err != nil {
+			return err
+		}
+		return checkPutETag(file, dest, etag)
+	case "", "file":
+		if u.Scheme == "file" {
+			dest = u.Path
+		}
+		if err := copyFile(file, dest); err != nil {
+			return err
+		}
+		return checkCopy(dest, sum)
+	}
+
+	return fmt.Errorf("unsupported --dest: %s", dest)
+}
+
+func runUploadCommand(ctx context.Context, name string, args ...string) error {
+	c := exec.CommandContext(ctx, name, args...)
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return nil
+}
+
+// putFile uploads file to dest with a PUT request, with the --dest-header headers, returning the ETag of the reply.
+func putFile(ctx context.Context, file, dest string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, dest, f)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = fi.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	for _, h := range destHeaders {
+		i := strings.Index(h, ":")
+		if i < 1 {
+			return "", fmt.Errorf("invalid --dest-header, expected \"Name: value\": %s", h)
+		}
+		req.Header.Add(strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:]))
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<20))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return "", fmt.Errorf("PUT %s: %s", dest, res.Status)
+	}
+
+	return res.Header.Get("Etag"), nil
+}
+
+// checkPutETag checks the ETag a server returned for the PUT of file is that of its content. A server that returns no
+// ETag, or one not derived from the MD5 of the content, only gets a warning as the upload cannot be checked.
+func checkPutETag(file, dest, etag string) error {
+	if etag == "" {
+		fmt.Fprintf(os.Stderr, "%s: warning: no ETag returned, the upload was not checked\n", dest)
+		return nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	ok, _, err := manifestgo.MatchETag(etag, f, fi.Size(), 0)
+	if errors.Is(err, manifestgo.ErrETagNotComparable) {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s, the upload was not checked\n", dest, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("PUT %s: the ETag %s of the upload does not match the downloaded pkg", dest, etag)
+	}
+
+	return nil
+}
+
+// checkCopy checks the SHA-256 of the copy at dest is sum.
+func checkCopy(dest string, sum []byte) error {
+	f, err := os.Open(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, sum) {
+		return fmt.Errorf("%s: the copy has the SHA-256 %x, not %x", dest, got, sum)
+	}
+
+	return nil
+}
+
+// copyFile copies file to dest, making its directory if needed.
+func copyFile(file, dest string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/dbyington/manifestgo"
+)
+
+// plugins holds the --plugin flags, not read through viper for the same reason as httpHeaders.
+var plugins []string
+
+// pluginRequest is the JSON written to the stdin of a --plugin.
+type pluginRequest struct {
+	Input    string                     `json:"input"`
+	Package  manifestgo.InventoryRecord `json:"package"`
+	Manifest *manifestgo.Manifest       `json:"manifest"`
+}
+
+// pluginResponse is the JSON a --plugin may write to its stdout. A plugin writing nothing leaves the manifest as it is.
+type pluginResponse struct {
+	// Manifest replaces the manifest when it is given.
+	Manifest json.RawMessage `json:"manifest"`
+}
+
+// runPlugins runs each --plugin in turn on the manifest m of input before it is written, returning the manifest as the
+// last of them left it. A plugin is a shell command reading a pluginRequest on stdin; a transformer writes a
+// pluginResponse with the changed manifest to stdout, a publisher sends the manifest elsewhere and writes nothing.
+// Its stderr goes to stderr, and a plugin exiting non-zero fails the package.
+func runPlugins(ctx context.Context, input string, p *manifestgo.Package, m *manifestgo.Manifest) (*manifestgo.Manifest, error) {
+	for _, plugin := range plugins {
+		req, err := json.Marshal(pluginRequest{Input: input, Package: manifestgo.NewInventoryRecord(p), Manifest: m})
+		if err != nil {
+			return nil, err
+		}
+
+		var out bytes.Buffer
+		c := exec.CommandContext(ctx, "sh", "-c", plugin)
+		c.Stdin = bytes.NewReader(req)
+		c.Stdout = &out
+		c.Stderr = os.Stderr
+		if err := c.Run(); err != nil {
+			return nil, fmt.Errorf("--plugin %s: %w", plugin, err)
+		}
+		if len(bytes.TrimSpace(out.Bytes())) == 0 {
+			continue
+		}
+
+		var res pluginResponse
+		if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+			return nil, fmt.Errorf("--plugin %s: invalid response: %w", plugin, err)
+		}
+		if len(res.Manifest) == 0 || string(res.Manifest) == "null" {
+			continue
+		}
+		if m, err = manifestgo.ParseManifest(res.Manifest); err != nil {
+			return nil, fmt.Errorf("--plugin %s: invalid manifest: %w", plugin, err)
+		}
+	}
+
+	return m, nil
+}
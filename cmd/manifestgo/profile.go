@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/viper"
+
+	"github.com/dbyington/manifestgo"
+)
+
+// buildProfile returns the mobileconfig of m as configured by the --profile flags, signed when a certificate and key
+// are given.
+func buildProfile(p *manifestgo.Package, m *manifestgo.Manifest, indent int) ([]byte, error) {
+	id := viper.GetString("profile-identifier")
+	if id == "" {
+		id = p.GetBundleIdentifier() + ".manifest"
+	}
+
+	manifestURL := viper.GetString("profile-manifest-url")
+	cp, err := manifestgo.NewConfigProfile(m, manifestgo.ProfileOptions{
+		Identifier:   id,
+		Organization: viper.GetString("profile-organization"),
+		ManifestURL:  manifestURL,
+		WebClip:      manifestURL != "",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	certFile, keyFile := viper.GetString("profile-sign-cert"), viper.GetString("profile-sign-key")
+	if certFile == "" && keyFile == "" {
+		return cp.AsPlist(indent)
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("--profile-sign-cert and --profile-sign-key must be used together")
+	}
+
+	certs, key, err := loadSigner(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return cp.Sign(key, certs)
+}
+
+// loadSigner reads the PEM certificates, leaf first, and PEM private key of a signer.
+func loadSigner(certFile, keyFile string) ([]*x509.Certificate, crypto.Signer, error) {
+	certs, err := loadCertificates(certFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, nil, fmt.Errorf("no private key in %s", keyFile)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported private key in %s", keyFile)
+	}
+
+	return certs, signer, nil
+}
+
+// loadCertificates reads the PEM certificates in certFile, failing if there are none.
+func loadCertificates(certFile string) ([]*x509.Certificate, error) {
+	b, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(b); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates in %s", certFile)
+	}
+
+	return certs, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/dbyington/manifestgo"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var pushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "Send an install command for a package to an MDM server",
+	Long: `Push queues an install command on an MDM server for one or more devices.
+
+With --manifest-url an InstallApplication command pointing at the hosted manifest is sent. Otherwise
+the manifest is built from the pkg argument and embedded in an InstallEnterpriseApplication command.`,
+}
+
+var pushMicroMDMCmd = &cobra.Command{
+	Use:   "micromdm [pkg]",
+	Short: "Send the command to a MicroMDM server",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runPushMicroMDM,
+}
+
+var pushNanoMDMCmd = &cobra.Command{
+	Use:   "nanomdm [pkg]",
+	Short: "Send the command to a NanoMDM server",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runPushNanoMDM,
+}
+
+func init() {
+	rootCmd.AddCommand(pushCmd)
+	pushCmd.AddCommand(pushMicroMDMCmd, pushNanoMDMCmd)
+
+	pushCmd.PersistentFlags().String("server", "", "URL of the MDM server")
+	pushCmd.PersistentFlags().String("api-key", "", "API key of the MDM server")
+	pushCmd.PersistentFlags().StringSlice("device", nil, "UDID or enrollment ID of the device, repeat for a group of devices")
+	pushCmd.PersistentFlags().String("manifest-url", "", "URL of an already hosted manifest")
+	pushCmd.PersistentFlags().Int("management-flags", 1, "ManagementFlags of the command, 1 removes the app when the MDM profile is removed")
+
+	addPackageFlags(pushMicroMDMCmd)
+	addPackageFlags(pushNanoMDMCmd)
+}
+
+// micromdmCommand is the JSON body of the MicroMDM commands API.
+type micromdmCommand struct {
+	UDID            string `json:"udid"`
+	RequestType     string `json:"request_type"`
+	ManifestURL     string `json:"manifest_url"`
+	ManagementFlags int    `json:"management_flags,omitempty"`
+}
+
+func runPushMicroMDM(cmd *cobra.Command, args []string) error {
+	server, apiKey, devices, err := pushTarget()
+	if err != nil {
+		return err
+	}
+
+	manifestURL := viper.GetString("manifest-url")
+	if manifestURL == "" {
+		return errors.New("micromdm requires --manifest-url, its API cannot embed a manifest")
+	}
+	if len(args) > 0 {
+		return errors.New("give either a pkg or --manifest-url, not both")
+	}
+
+	for _, udid := range devices {
+		body, err := json.Marshal(micromdmCommand{
+			UDID:            udid,
+			RequestType:     "InstallApplication",
+			ManifestURL:     manifestURL,
+			ManagementFlags: viper.GetInt("management-flags"),
+		})
+		if err != nil {
+			return err
+		}
+
+		res, err := sendMDMCommand(http.MethodPost, server+"/v1/commands", "micromdm", apiKey, "application/json", body)
+		if err != nil {
+			return fmt.Errorf("%s: %w", udid, err)
+		}
+
+		var r struct {
+			Payload struct {
+				CommandUUID string `json:"command_uuid"`
+			} `json:"payload"`
+		}
+		if err := json.Unmarshal(res, &r); err != nil {
+			return fmt.Errorf("%s: reading response: %w", udid, err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "queued %s for %s\n", r.Payload.CommandUUID, udid)
+	}
+
+	return nil
+}
+
+func runPushNanoMDM(cmd *cobra.Command, args []string) error {
+	server, apiKey, devices, err := pushTarget()
+	if err != nil {
+		return err
+	}
+
+	c, err := newInstallCommand(cmd.Context(), args)
+	if err != nil {
+		return err
+	}
+
+	body, err := c.AsPlist(0)
+	if err != nil {
+		return err
+	}
+
+	// NanoMDM queues a single command for every id in a comma separated list.
+	if _, err := sendMDMCommand(http.MethodPut, server+"/v1/enqueue/"+strings.Join(devices, ","), "nanomdm", apiKey, "application/xml", body); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "queued %s for %s\n", c.CommandUUID, strings.Join(devices, ", "))
+	return nil
+}
+
+func pushTarget() (server, apiKey string, devices []string, err error) {
+	server = strings.TrimSuffix(viper.GetString("server"), "/")
+	if server == "" {
+		return "", "", nil, errors.New("--server is required")
+	}
+
+	apiKey = viper.GetString("api-key")
+	if apiKey == "" {
+		return "", "", nil, errors.New("--api-key is required")
+	}
+
+	devices = viper.GetStringSlice("device")
+	if len(devices) == 0 {
+		return "", "", nil, errors.New("at least one --device is required")
+	}
+
+	return server, apiKey, devices, nil
+}
+
+// newInstallCommand returns an InstallApplication command for --manifest-url, or an InstallEnterpriseApplication
+// command embedding the manifest of the pkg in args.
+func newInstallCommand(ctx context.Context, args []string) (*manifestgo.InstallCommand, error) {
+	flags := manifestgo.WithManagementFlags(viper.GetInt("management-flags"))
+
+	if u := viper.GetString("manifest-url"); u != "" {
+		if len(args) > 0 {
+			return nil, errors.New("give either a pkg or --manifest-url, not both")
+		}
+		return manifestgo.NewInstallApplicationCommand(nil, manifestgo.WithManifestURL(u), flags)
+	}
+
+	if len(args) == 0 {
+		return nil, errors.New("a pkg or --manifest-url is required")
+	}
+
+	ctx, cancel := buildContext(ctx)
+	defer cancel()
+	_, m, err := buildManifest(ctx, args[0])
+	if err != nil {
+		return nil, timeoutError(ctx, err)
+	}
+
+	return manifestgo.NewInstallApplicationCommand(m, flags)
+}
+
+func sendMDMCommand(method, url, user, apiKey, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(user, apiKey)
+	req.Header.Set("Content-Type", contentType)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, url, res.Status, strings.TrimSpace(string(b)))
+	}
+
+	return b, nil
+}
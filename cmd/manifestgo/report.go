@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dbyington/manifestgo"
+)
+
+var reportHeader = []string{"input", "bundle_id", "version", "size", "sha256_count", "signer", "origin", "architectures", "must_close_apps", "status", "duration", "error"}
+
+// reportRow is the outcome of building a single package.
+type reportRow struct {
+	Input       string
+	BundleID    string
+	Version     string
+	Size        int64
+	SHA256Count int
+	Signer      string
+	Origin      manifestgo.Origin
+	// Architectures are separated by spaces, empty when the package installs on any Mac.
+	Architectures string
+	// MustCloseApps are the bundle ids of the apps the install quits, separated by spaces.
+	MustCloseApps string
+	Status        string
+	Duration      time.Duration
+	Error         string
+}
+
+func newReportRow(input string, p *manifestgo.Package, m *manifestgo.Manifest, err error, d time.Duration) reportRow {
+	r := reportRow{
+		Input:    input,
+		Status:   "ok",
+		Duration: d,
+	}
+
+	if p != nil {
+		r.BundleID = p.GetBundleIdentifier()
+		r.Version = p.GetVersion()
+		r.Size = p.Size
+		if p.ContentLength > 0 {
+			r.Size = p.ContentLength
+		}
+		r.Signer = p.GetSigner()
+		r.Origin = p.Origin()
+		r.Architectures = strings.Join(p.Architectures(), " ")
+		r.MustCloseApps = strings.Join(p.MustCloseApps(), " ")
+	}
+
+	if m != nil {
+		for _, item := range m.ManifestItems {
+			for _, a := range item.Assets {
+				r.SHA256Count += len(a.SHA256s)
+			}
+		}
+	}
+
+	if err != nil {
+		r.Status = "failed"
+		r.Error = err.Error()
+	}
+
+	return r
+}
+
+func (r reportRow) record() []string {
+	return []string{
+		r.Input,
+		r.BundleID,
+		r.Version,
+		strconv.FormatInt(r.Size, 10),
+		strconv.Itoa(r.SHA256Count),
+		r.Signer,
+		string(r.Origin),
+		r.Architectures,
+		r.MustCloseApps,
+		r.Status,
+		strconv.FormatFloat(r.Duration.Seconds(), 'f', 3, 64),
+		r.Error,
+	}
+}
+
+// reportWriter writes one reportRow per line as CSV, or TSV when the file name ends in .tsv.
+type reportWriter struct {
+	f      *os.File
+	w      *csv.Writer
+	closed bool
+}
+
+func newReportWriter(name string) (*reportWriter, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	w := csv.NewWriter(f)
+	if strings.EqualFold(filepath.Ext(name), ".tsv") {
+		w.Comma = '\t'
+	}
+
+	if err := w.Write(reportHeader); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &reportWriter{f: f, w: w}, nil
+}
+
+func (r *reportWriter) Write(row reportRow) error {
+	if err := r.w.Write(row.record()); err != nil {
+		return err
+	}
+
+	// Flush each row so the report is useful even if the batch is interrupted.
+	r.w.Flush()
+	return r.w.Error()
+}
+
+func (r *reportWriter) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	r.w.Flush()
+	if err := r.w.Error(); err != nil {
+		r.f.Close()
+		return err
+	}
+
+	return r.f.Close()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var rewriteURLCmd = &cobra.Command{
+	Use:   "rewrite-url",
+	Short: "Rewrite the package URLs of a manifest",
+	Long: `Rewrite-url changes the URL of every asset in a manifest, for packages moved to another server,
+without reading the packages again. URLs are rewritten by replacing a --from prefix with --to, by
+a --pattern regular expression and its --replace template, or by a --map file listing an old and
+a new URL on each line. The rewritten manifest is validated before it is written, in the format
+it was read in unless --out or --format says otherwise.`,
+	Args: cobra.NoArgs,
+	RunE: runRewriteURL,
+}
+
+func init() {
+	rootCmd.AddCommand(rewriteURLCmd)
+
+	rewriteURLCmd.Flags().String("in", "", "manifest to rewrite, - for stdin")
+	rewriteURLCmd.Flags().String("out", "", "file to write the rewritten manifest to, stdout by default")
+	rewriteURLCmd.Flags().String("format", "", "output format: json, plist or ascii-plist, that of --in by default")
+	rewriteURLCmd.Flags().Int("indent", 2, "number of spaces to indent the output with, 0 for compact")
+	addJSONFlags(rewriteURLCmd)
+	rewriteURLCmd.Flags().String("from", "", "URL prefix to replace with --to")
+	rewriteURLCmd.Flags().String("to", "", "URL prefix replacing --from")
+	rewriteURLCmd.Flags().String("pattern", "", "regular expression matching the part of each URL to replace with --replace")
+	rewriteURLCmd.Flags().String("replace", "", "replacement for --pattern, may refer to its groups as ${1}")
+	rewriteURLCmd.Flags().String("map", "", "file listing an old and a new URL on each line, separated by whitespace")
+}
+
+func runRewriteURL(cmd *cobra.Command, args []string) error {
+	rewrite, err := urlRewriter()
+	if err != nil {
+		return err
+	}
+
+	in := viper.GetString("in")
+	m, format, err := readManifestFile(in)
+	if err != nil {
+		return err
+	}
+
+	n, err := m.RewriteURLs(rewrite)
+	if err != nil {
+		return err
+	}
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s: rewrote %d urls\n", in, n)
+
+	return writeManifestFile(cmd, m, viper.GetString("out"), viper.GetString("format"), format, viper.GetInt("indent"))
+}
+
+// urlRewriter returns the rewrite given by the --from, --pattern or --map flags.
+func urlRewriter() (func(string) (string, error), error) {
+	from, pattern, mapFile := viper.GetString("from"), viper.GetString("pattern"), viper.GetString("map")
+
+	var given int
+	for _, f := range []string{from, pattern, mapFile} {
+		if f != "" {
+			given++
+		}
+	}
+	if given != 1 {
+		return nil, errors.New("give one of --from, --pattern or --map")
+	}
+
+	switch {
+	case from != "":
+		to := viper.GetString("to")
+		return func(u string) (string, error) {
+			if strings.HasPrefix(u, from) {
+				return to + strings.TrimPrefix(u, from), nil
+			}
+			return u, nil
+		}, nil
+	case pattern != "":
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("--pattern: %w", err)
+		}
+		replace := viper.GetString("replace")
+		return func(u string) (string, error) {
+			return re.ReplaceAllString(u, replace), nil
+		}, nil
+	}
+
+	urls, err := readURLMap(mapFile)
+	if err != nil {
+		return nil, err
+	}
+	return func(u string) (string, error) {
+		if to, ok := urls[u]; ok {
+			return to, nil
+		}
+		fmt.Fprintf(os.Stderr, "%s: not in %s, left unchanged\n", u, mapFile)
+		return u, nil
+	}, nil
+}
+
+// readURLMap reads a file listing an old and a new URL on each line. Blank lines and lines starting with # are
+// skipped.
+func readURLMap(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	urls := make(map[string]string)
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected an old and a new url", name, line)
+		}
+		urls[fields[0]] = fields[1]
+	}
+
+	return urls, s.Err()
+}
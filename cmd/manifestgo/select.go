@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dbyington/manifestgo"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// addSelectFlags adds the flags choosing the items of a manifest to cmd, see selectItems. --order and --primary are
+// only added when ordered, for commands whose manifests can have several items.
+func addSelectFlags(cmd *cobra.Command, ordered bool) {
+	cmd.Flags().StringSlice("include", nil, "only keep items whose bundle identifier matches one of these glob patterns, such as com.example.*")
+	cmd.Flags().StringSlice("exclude", nil, "drop items whose bundle identifier matches one of these glob patterns")
+	if ordered {
+		cmd.Flags().String("order", "", "sort the items by bundle-id or title, keeping their order by default")
+		cmd.Flags().String("primary", "", "bundle identifier of the item to put first, the application a device installs")
+	}
+}
+
+// selectItems applies the --include, --exclude, --order and --primary flags to m.
+func selectItems(m *manifestgo.Manifest) error {
+	include, exclude := viper.GetStringSlice("include"), viper.GetStringSlice("exclude")
+	if len(include) > 0 || len(exclude) > 0 {
+		if err := m.SelectItems(include, exclude); err != nil {
+			return err
+		}
+	}
+
+	switch order := viper.GetString("order"); order {
+	case "":
+	case "bundle-id":
+		m.SortItems(manifestgo.ByBundleIdentifier)
+	case "title":
+		m.SortItems(manifestgo.ByTitle)
+	default:
+		return fmt.Errorf("unsupported order: %s", order)
+	}
+
+	if primary := viper.GetString("primary"); primary != "" {
+		return m.SetPrimary(primary)
+	}
+
+	return nil
+}
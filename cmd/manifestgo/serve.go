@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbyington/manifestgo"
+	"github.com/dbyington/manifestgo/httpio"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Build manifests for package URLs over HTTP",
+	Long: `Serve builds manifests for package URLs posted to it.
+
+POST /jobs with {"url": "https://..."} queues a build and returns its id; GET /jobs/{id} returns
+its status, progress and, once done, the manifest. Builds run on --workers workers, and a job is
+kept for --job-ttl after it finishes. Only http(s) URLs are built, never local files.
+
+As clients choose the URLs fetched, --deny-private, on by default, refuses to connect to loopback,
+link-local and private addresses, such as 127.0.0.1 or 169.254.169.254, and --allow-host limits
+the hosts connected to. Both are checked for every connection, following redirects and whatever
+address a host name resolves to, so they cannot be combined with --proxy or --unix-socket.`,
+	Args: cobra.NoArgs,
+	RunE: runServe,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	addPackageFlags(serveCmd)
+	serveCmd.Flags().String("listen", "127.0.0.1:8080", "address to listen on")
+	serveCmd.Flags().Int("workers", 2, "number of packages built at once")
+	serveCmd.Flags().Int("queue-size", 100, "number of jobs that may wait for a worker before new jobs are refused")
+	serveCmd.Flags().Duration("job-ttl", time.Hour, "how long a finished job is kept")
+	serveCmd.Flags().String("webhook", "", "URL to POST a JSON event to after each job finishes")
+	serveCmd.Flags().StringSlice("api-keys", nil, "API keys clients must send as a bearer token or X-API-Key header, prefer MANIFESTGO_API_KEYS")
+	serveCmd.Flags().Float64("rate-limit", 0, "requests per minute allowed for each API key, or client address without keys, 0 for no limit")
+	serveCmd.Flags().Int("rate-burst", 10, "requests a client may make at once before --rate-limit applies")
+	serveCmd.Flags().String("store-dir", "", "directory recording every built manifest, they are only kept in memory otherwise")
+	serveCmd.Flags().String("ready-check-url", "", "URL /readyz sends a HEAD request to, checking outbound connectivity")
+	serveCmd.Flags().StringSlice("allow-host", nil, "host packages may be fetched from, a leading *. matching any subdomain, may be repeated, any host by default")
+	serveCmd.Flags().Bool("deny-private", true, "refuse to fetch packages from loopback, link-local and private addresses")
+	addJSONFlags(serveCmd)
+}
+
+// Job statuses.
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// job is an asynchronous build. Its fields are guarded by the mutex of the jobStore holding it.
+type job struct {
+	ID         string               `json:"id"`
+	URL        string               `json:"url"`
+	Status     string               `json:"status"`
+	Progress   *manifestgo.Progress `json:"progress,omitempty"`
+	Manifest   json.RawMessage      `json:"manifest,omitempty"`
+	Warnings   []manifestgo.Warning `json:"warnings,omitempty"`
+	Error      string               `json:"error,omitempty"`
+	CreatedAt  time.Time            `json:"created_at"`
+	StartedAt  *time.Time           `json:"started_at,omitempty"`
+	FinishedAt *time.Time           `json:"finished_at,omitempty"`
+}
+
+// jobStore holds the jobs and queues them for the workers.
+type jobStore struct {
+	mu    sync.Mutex
+	jobs  map[string]*job
+	queue chan *job
+	ttl   time.Duration
+
+	// webhook is posted an event after each job, see postWebhook.
+	webhook string
+	// manifests records each manifest built.
+	manifests manifestgo.ManifestStore
+
+	// workers is the number of workers started, running how many of them are building a job.
+	workers int
+	running int
+}
+
+var errQueueFull = errors.New("job queue is full")
+
+func newJobStore(queueSize int, ttl time.Duration) *jobStore {
+	return &jobStore{
+		jobs:  make(map[string]*job),
+		queue: make(chan *job, queueSize),
+		ttl:   ttl,
+	}
+}
+
+// add queues a build of u, returning errQueueFull rather than waiting for room.
+func (s *jobStore) add(u string) (*job, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	j := &job{
+		ID:        hex.EncodeToString(id),
+		URL:       u,
+		Status:    jobQueued,
+		CreatedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+
+	select {
+	case s.queue <- j:
+	default:
+		return nil, errQueueFull
+	}
+	s.jobs[j.ID] = j
+
+	return j, nil
+}
+
+// prune drops the jobs that finished more than the ttl ago. s.mu must be held.
+func (s *jobStore) prune() {
+	for id, j := range s.jobs {
+		if j.FinishedAt != nil && time.Since(*j.FinishedAt) > s.ttl {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// get returns a copy of the job, safe to encode while the job runs.
+func (s *jobStore) get(id string) (job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.jobs[id]
+	if !ok {
+		return job{}, false
+	}
+
+	c := *j
+	if j.Progress != nil {
+		pr := *j.Progress
+		c.Progress = &pr
+	}
+
+	return c, true
+}
+
+func (s *jobStore) update(j *job, fn func(*job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(j)
+}
+
+// work builds queued jobs until ctx is done.
+func (s *jobStore) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-s.queue:
+			s.update(j, func(*job) { s.running++ })
+			s.run(ctx, j)
+			s.update(j, func(*job) { s.running-- })
+		}
+	}
+}
+
+func (s *jobStore) run(ctx context.Context, j *job) {
+	s.update(j, func(j *job) {
+		now := time.Now()
+		j.Status = jobRunning
+		j.StartedAt = &now
+	})
+
+	buildCtx, cancel := buildContext(ctx)
+	defer cancel()
+	p, err := readURL(buildCtx, j.URL, func(pr manifestgo.Progress) {
+		s.update(j, func(j *job) {
+			j.Progress = &pr
+		})
+	})
+
+	var (
+		b []byte
+		m *manifestgo.Manifest
+	)
+	if err == nil {
+		err = checkStrict(p)
+	}
+	if err == nil {
+		err = p.CheckPolicy(signaturePolicy())
+	}
+	if err == nil {
+		if m, err = p.BuildManifest(); err == nil {
+			b, err = manifestJSON(m, 0)
+		}
+	}
+	err = timeoutError(buildCtx, err)
+
+	s.update(j, func(j *job) {
+		now := time.Now()
+		j.FinishedAt = &now
+		j.Progress = nil
+		if p != nil {
+			j.Warnings = p.Warnings()
+		}
+		if err != nil {
+			j.Status = jobFailed
+			j.Error = err.Error()
+			return
+		}
+		j.Status = jobDone
+		j.Manifest = b
+	})
+
+	if err == nil && s.manifests != nil {
+		rec, rErr := manifestgo.NewManifestRecord(p, m)
+		if rErr == nil {
+			rErr = s.manifests.Save(rec)
+		}
+		if rErr != nil {
+			fmt.Fprintf(os.Stderr, "%s: storing manifest: %s\n", j.ID, rErr)
+		}
+	}
+
+	if s.webhook != "" {
+		row := newReportRow(j.URL, p, m, err, time.Since(j.CreatedAt))
+		if wErr := postWebhook(ctx, s.webhook, newWebhookEvent(row, "")); wErr != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", j.ID, wErr)
+		}
+	}
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	workers := viper.GetInt("workers")
+	if workers < 1 {
+		return errors.New("--workers must be at least 1")
+	}
+	if _, err := manifestgo.ParseDigestEncoding(viper.GetString("digest-encoding")); err != nil {
+		return err
+	}
+	if _, err := manifestgo.ParseFieldNaming(viper.GetString("json-naming")); err != nil {
+		return err
+	}
+
+	store := newJobStore(viper.GetInt("queue-size"), viper.GetDuration("job-ttl"))
+	store.webhook = viper.GetString("webhook")
+	store.manifests = manifestgo.NewMemoryStore()
+	if dir := viper.GetString("store-dir"); dir != "" {
+		ds, err := manifestgo.NewDirStore(dir)
+		if err != nil {
+			return err
+		}
+		store.manifests = ds
+	}
+
+	policy, err := servePolicy()
+	if err != nil {
+		return err
+	}
+	dialPolicy = policy
+
+	ctx := cmd.Context()
+	store.workers = workers
+	for i := 0; i < workers; i++ {
+		go store.work(ctx)
+	}
+
+	mux := newServeMux(store)
+	addHealthHandlers(mux, store, viper.GetString("cache-dir"), viper.GetString("ready-check-url"))
+
+	srv := &http.Server{
+		Addr:    viper.GetString("listen"),
+		Handler: authMiddleware(mux, apiKeys(), newRateLimiter(viper.GetFloat64("rate-limit")/60, viper.GetInt("rate-burst"))),
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "listening on %s\n", srv.Addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+// servePolicy returns the policy of --allow-host and --deny-private, nil if neither restricts anything.
+func servePolicy() (*httpio.DialPolicy, error) {
+	p := &httpio.DialPolicy{AllowHosts: viper.GetStringSlice("allow-host"), DenyPrivate: viper.GetBool("deny-private")}
+	if len(p.AllowHosts) == 0 && !p.DenyPrivate {
+		return nil, nil
+	}
+	if viper.GetString("proxy") != "" || viper.GetString("unix-socket") != "" {
+		return nil, errors.New("--proxy and --unix-socket would bypass --allow-host and --deny-private, set --deny-private=false without --allow-host to use them")
+	}
+
+	return p, nil
+}
+
+// apiKeys returns the --api-keys, which MANIFESTGO_API_KEYS may give separated by commas.
+func apiKeys() []string {
+	var keys []string
+	for _, k := range viper.GetStringSlice("api-keys") {
+		for _, k := range strings.Split(k, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	return keys
+}
+
+func newServeMux(store *jobStore) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/jobs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		var req struct {
+			URL string `json:"url"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+			return
+		}
+		if !isURL(req.URL) {
+			writeJSONError(w, http.StatusBadRequest, "url must be an http or https URL")
+			return
+		}
+		if u, err := url.Parse(req.URL); err != nil || (dialPolicy != nil && !dialPolicy.AllowsHost(u.Hostname())) {
+			writeJSONError(w, http.StatusForbidden, "url host is not allowed")
+			return
+		}
+
+		j, err := store.add(req.URL)
+		if err == errQueueFull {
+			w.Header().Set("Retry-After", "30")
+			writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c, _ := store.get(j.ID)
+		w.Header().Set("Location", "/jobs/"+j.ID)
+		writeJSON(w, http.StatusAccepted, c)
+	})
+
+	mux.HandleFunc("/manifests", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		q := r.URL.Query()
+		records, err := store.manifests.Find(manifestgo.ManifestQuery{
+			BundleID: q.Get("bundle_id"),
+			Version:  q.Get("version"),
+			URL:      q.Get("url"),
+		})
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if records == nil {
+			records = []manifestgo.ManifestRecord{}
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"manifests": records})
+	})
+
+	mux.HandleFunc("/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+		j, ok := store.get(id)
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "no such job")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, j)
+	})
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
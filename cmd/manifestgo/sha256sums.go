@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"github.com/dbyington/manifestgo"
+	"github.com/spf13/viper"
+)
+
+// packageChecksum returns the SHA256SUMS entry of the package of input, named after the URL it is served from, and
+// false if the package was only hashed in chunks.
+func packageChecksum(input string, p *manifestgo.Package) (manifestgo.Checksum, bool) {
+	sum := p.FullSHA256()
+	if sum == "" {
+		return manifestgo.Checksum{}, false
+	}
+	name := inputName(input)
+	if p.URL != "" {
+		name = inputName(p.URL)
+	}
+
+	return manifestgo.Checksum{Name: name, SHA256: sum}, true
+}
+
+// writeSHA256Sums writes the checksums to name, and a detached ASCII-armored signature of it to name.asc when
+// --sha256sums-sign-key is set.
+func writeSHA256Sums(ctx context.Context, name string, sums []manifestgo.Checksum) error {
+	if err := ioutil.WriteFile(name, manifestgo.SHA256Sums(sums), 0644); err != nil {
+		return err
+	}
+
+	key := viper.GetString("sha256sums-sign-key")
+	if key == "" {
+		return nil
+	}
+	c := exec.CommandContext(ctx, "gpg", "--batch", "--yes", "--local-user", key, "--armor", "--detach-sign", "--output", name+".asc", name)
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("signing %s: gpg: %w", name, err)
+	}
+
+	return nil
+}
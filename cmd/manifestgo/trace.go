@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dbyington/manifestgo"
+)
+
+// logTracer is a manifestgo.Tracer writing each span, with its duration and attributes, to w when it ends.
+type logTracer struct {
+	w      io.Writer
+	prefix string
+}
+
+type logSpan struct {
+	t     *logTracer
+	name  string
+	depth int
+	start time.Time
+	attrs map[string]interface{}
+}
+
+type spanDepthKey struct{}
+
+func (t *logTracer) Start(ctx context.Context, name string) (context.Context, manifestgo.Span) {
+	depth, _ := ctx.Value(spanDepthKey{}).(int)
+	s := &logSpan{t: t, name: name, depth: depth, start: time.Now(), attrs: map[string]interface{}{}}
+
+	return context.WithValue(ctx, spanDepthKey{}, depth+1), s
+}
+
+func (s *logSpan) SetAttribute(key string, value interface{}) {
+	s.attrs[key] = value
+}
+
+func (s *logSpan) End(err error) {
+	keys := make([]string, 0, len(s.attrs))
+	for k := range s.attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: trace: %s%s %s", s.t.prefix, strings.Repeat("  ", s.depth), s.name, time.Since(s.start).Round(time.Microsecond))
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", k, s.attrs[k])
+	}
+	if err != nil {
+		fmt.Fprintf(&b, " error=%q", err)
+	}
+	fmt.Fprintln(s.t.w, b.String())
+}
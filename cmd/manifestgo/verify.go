@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dbyington/manifestgo"
+	"github.com/dbyington/manifestgo/httpio"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check an upload completed by comparing the local package with the ETag of its URL",
+	Long: `Verify compares --pkg with the ETag and length --url answers a HEAD request with, without
+downloading it. A plain ETag is the MD5 of the object. The multipart ETag S3 gives a large
+upload, the MD5 of the MD5s of its parts followed by the number of parts, is computed from
+--pkg in parts of --part-size, or of each common part size giving that number of parts. It
+fails when the package does not match, or the ETag cannot be compared, such as that of an
+object encrypted with SSE-KMS.`,
+	Args: cobra.NoArgs,
+	RunE: runVerify,
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	addAuthFlags(verifyCmd)
+	verifyCmd.Flags().String("pkg", "", "local package the upload was made from")
+	verifyCmd.Flags().String("url", "", "URL of the uploaded copy of --pkg")
+	verifyCmd.Flags().Int64("part-size", 0, "part size --url was uploaded in, guessed from common part sizes when 0")
+	verifyCmd.Flags().Duration("timeout", 0, "how long asking for the ETag may take before it is cancelled; 0 for no limit")
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	local, remote := viper.GetString("pkg"), viper.GetString("url")
+	if local == "" || remote == "" {
+		return errors.New("--pkg and --url are required")
+	}
+	ctx, cancel := buildContext(cmd.Context())
+	defer cancel()
+
+	return verifyETag(ctx, cmd.OutOrStdout(), local, remote)
+}
+
+// verifyETag compares the local package with the ETag and length remote answers with.
+func verifyETag(ctx context.Context, w io.Writer, local, remote string) error {
+	r, _, err := openURL(ctx, remote, httpio.DefaultHashChunkSize)
+	if err != nil {
+		return fmt.Errorf("%s: %w", remote, timeoutError(ctx, err))
+	}
+	etag, length := r.Etag(), r.Length()
+	if c, ok := r.(io.Closer); ok {
+		c.Close()
+	}
+	if etag == "" {
+		return fmt.Errorf("%s: no ETag to compare with", remote)
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != length {
+		return fmt.Errorf("%s is %d bytes, %s is %d bytes", local, info.Size(), remote, length)
+	}
+
+	ok, partSize, err := manifestgo.MatchETag(etag, f, info.Size(), viper.GetInt64("part-size"))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s does not match the ETag %s of %s", local, etag, remote)
+	}
+	if partSize > 0 {
+		fmt.Fprintf(w, "%s matches the ETag %s of %s, uploaded in parts of %d bytes\n", local, etag, remote, partSize)
+	} else {
+		fmt.Fprintf(w, "%s matches the ETag %s of %s\n", local, etag, remote)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// webhookTimeout bounds each webhook request so a slow receiver does not stall a batch.
+const webhookTimeout = 10 * time.Second
+
+// webhookEvent is the JSON body posted to the --webhook URL after each package is built.
+type webhookEvent struct {
+	Input       string `json:"input"`
+	Status      string `json:"status"`
+	ManifestURL string `json:"manifest_url,omitempty"`
+	BundleID    string `json:"bundle_id,omitempty"`
+	Version     string `json:"version,omitempty"`
+	// Architectures are those the package installs on, empty when it installs on any Mac.
+	Architectures []string `json:"architectures,omitempty"`
+	// MustCloseApps are the bundle ids of the apps the install quits.
+	MustCloseApps []string `json:"must_close_apps,omitempty"`
+	Duration      float64  `json:"duration"`
+	Error         string   `json:"error,omitempty"`
+}
+
+func newWebhookEvent(r reportRow, manifestURL string) webhookEvent {
+	return webhookEvent{
+		Input:         r.Input,
+		Status:        r.Status,
+		ManifestURL:   manifestURL,
+		BundleID:      r.BundleID,
+		Version:       r.Version,
+		Architectures: strings.Fields(r.Architectures),
+		MustCloseApps: strings.Fields(r.MustCloseApps),
+		Duration:      r.Duration.Seconds(),
+		Error:         r.Error,
+	}
+}
+
+// postWebhook posts e as JSON to u, failing on any status other than 2xx.
+func postWebhook(ctx context.Context, u string, e webhookEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<20))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook %s: %s", u, res.Status)
+	}
+
+	return nil
+}
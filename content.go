@@ -0,0 +1,156 @@
+package manifestgo
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoFileDigest  = errors.New("manifestgo: the package was not hashed whole, it has no SHA-256")
+	ErrInvalidSHA256 = errors.New("manifestgo: not a hex SHA-256")
+)
+
+// ContentRecord is a manifest kept by a ContentStore under the SHA-256 of its package, with every URL the package was
+// built from.
+type ContentRecord struct {
+	SHA256        string          `json:"sha256"`
+	Length        int64           `json:"length"`
+	URLs          []string        `json:"urls"`
+	HashType      string          `json:"hash_type"`
+	HashChunkSize int64           `json:"hash_chunk_size"`
+	Manifest      json.RawMessage `json:"manifest"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// ContentStore keeps built manifests keyed by the SHA-256 of their package as a file, so a package published under
+// several URLs, or again under a new one, is stored once and its manifest reused rather than read again. It keeps its
+// records in a Cache, such as a DirCache, and is safe for use by several goroutines, but not by several processes
+// sharing the Cache at once.
+type ContentStore struct {
+	mu    sync.Mutex
+	cache Cache
+}
+
+// NewContentStore returns a ContentStore keeping its records in c.
+func NewContentStore(c Cache) *ContentStore {
+	return &ContentStore{cache: c}
+}
+
+// Put stores the manifest m built from p under the SHA-256 of p, which must have been hashed whole, see FullSHA256.
+// When the same content is already stored the record is kept, the URL of p, if it has one, added to it, and duplicate
+// is true: the package was already built, from the other URLs of the record.
+func (s *ContentStore) Put(p *Package, m *Manifest) (rec *ContentRecord, duplicate bool, err error) {
+	sum := p.FullSHA256()
+	if sum == "" {
+		return nil, false, ErrNoFileDigest
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rec, ok, err := s.lookup(sum); err != nil {
+		return nil, false, err
+	} else if ok {
+		for _, u := range rec.URLs {
+			if u == p.URL {
+				return rec, true, nil
+			}
+		}
+		if p.URL == "" {
+			return rec, true, nil
+		}
+		rec.URLs = append(rec.URLs, p.URL)
+		return rec, true, s.put(rec)
+	}
+
+	b, err := m.AsJSON(0)
+	if err != nil {
+		return nil, false, err
+	}
+	urls := []string{}
+	if p.URL != "" {
+		urls = append(urls, p.URL)
+	}
+	rec = &ContentRecord{
+		SHA256:        sum,
+		Length:        p.ContentLength,
+		URLs:          urls,
+		HashType:      p.hashAlgorithm(),
+		HashChunkSize: p.hashChunkSize,
+		Manifest:      b,
+		CreatedAt:     time.Now().UTC(),
+	}
+
+	return rec, false, s.put(rec)
+}
+
+// Lookup returns the record of the package whose hex SHA-256 is sum, and whether there is one.
+func (s *ContentStore) Lookup(sum string) (*ContentRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lookup(sum)
+}
+
+// ManifestFor returns the stored manifest of the package whose hex SHA-256 is sum with url as the URL of its
+// packages, for the same file published under url, and whether one is stored. The chunk hashes are those of the
+// record, whatever hash and chunk size a new build would use.
+func (s *ContentStore) ManifestFor(sum, url string) (*Manifest, bool, error) {
+	rec, ok, err := s.Lookup(sum)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	m, err := ParseManifest(rec.Manifest)
+	if err != nil {
+		return nil, false, fmt.Errorf("manifestgo: content record %s: %w", sum, err)
+	}
+	for _, item := range m.ManifestItems {
+		for _, a := range item.Assets {
+			if !a.isImage() {
+				a.URL = url
+			}
+		}
+	}
+
+	return m, true, nil
+}
+
+func (s *ContentStore) lookup(sum string) (*ContentRecord, bool, error) {
+	// The sum names a file of a DirCache, so it must not be a path.
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != 32 {
+		return nil, false, fmt.Errorf("%w: %q", ErrInvalidSHA256, sum)
+	}
+
+	b, ok := s.cache.Get(contentKey(sum))
+	if !ok {
+		return nil, false, nil
+	}
+
+	var rec ContentRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, false, fmt.Errorf("manifestgo: content record %s: %w", sum, err)
+	}
+
+	return &rec, true, nil
+}
+
+func (s *ContentStore) put(rec *ContentRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	return s.cache.Put(contentKey(rec.SHA256), b)
+}
+
+// contentKey is the Cache key of the record of the content with the hex SHA-256 sum, apart from the keys of packages
+// read by URL.
+func contentKey(sum string) string {
+	return "sha256-" + strings.ToLower(sum)
+}
@@ -0,0 +1,122 @@
+package manifestgo
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+
+	xar "github.com/dbyington/manifestgo/goxar"
+	"github.com/dbyington/manifestgo/httpio"
+	"github.com/dbyington/manifestgo/internal/bundle"
+	"github.com/dbyington/manifestgo/internal/dmg"
+)
+
+// Diagnosis explains an error from reading a package in plain words, with a suggestion of how to fix it.
+type Diagnosis struct {
+	Problem    string
+	Suggestion string
+}
+
+func (d *Diagnosis) String() string {
+	return d.Problem + " " + d.Suggestion
+}
+
+// Diagnose returns a Diagnosis for the common reasons reading a package fails, or nil if err is not one of them.
+func Diagnose(err error) *Diagnosis {
+	if err == nil {
+		return nil
+	}
+
+	var (
+		statusErr   *httpio.StatusError
+		unknownCA   x509.UnknownAuthorityError
+		hostnameErr x509.HostnameError
+		certErr     x509.CertificateInvalidError
+		dnsErr      *net.DNSError
+		opErr       *net.OpError
+	)
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return &Diagnosis{"The build was cancelled.", "Start it again when ready."}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Diagnosis{"The build took longer than allowed.", "Allow more time, or try a faster connection to the server."}
+	case errors.Is(err, httpio.ErrRangeNotSupported):
+		return &Diagnosis{
+			"The server does not support range requests, which are needed to read the package without downloading all of it.",
+			"Host the package on a server or CDN that answers with \"Accept-Ranges: bytes\".",
+		}
+	case errors.Is(err, httpio.ErrNoContentLength):
+		return &Diagnosis{"The server did not say how large the package is.", "Check the URL points at the package itself and not a page or redirect."}
+	case errors.Is(err, httpio.ErrURLExpiresTooSoon):
+		return &Diagnosis{
+			"The presigned URL expires before the package could be downloaded and hashed.",
+			"Presign the URL with a longer expiry, or give a command that presigns it again.",
+		}
+	case errors.As(err, &statusErr):
+		return diagnoseStatus(statusErr.StatusCode)
+	case errors.As(err, &unknownCA):
+		return &Diagnosis{"The server's certificate is not issued by a trusted authority.", "Install the issuing CA in the system trust store, or use a server with a publicly trusted certificate."}
+	case errors.As(err, &hostnameErr):
+		return &Diagnosis{"The server's certificate does not match its host name.", "Check the host name in the URL, or fix the certificate on the server."}
+	case errors.As(err, &certErr):
+		return &Diagnosis{"The server's certificate is not valid, it may have expired.", "Renew the certificate on the server."}
+	case errors.As(err, &dnsErr):
+		return &Diagnosis{"The server's host name could not be found.", "Check the URL for typos and that you are on the right network or VPN."}
+	case errors.As(err, &opErr):
+		return &Diagnosis{"Could not connect to the server.", "Check the URL, your network connection and any proxy settings."}
+	case errors.Is(err, xar.ErrBadMagic), errors.Is(err, xar.ErrBadVersion), errors.Is(err, xar.ErrBadHeaderSize):
+		return &Diagnosis{
+			"The file is not a flat installer package (a xar archive).",
+			"Make sure the URL or file is a .pkg built with pkgbuild or productbuild, not a disk image or a bundle package.",
+		}
+	case errors.Is(err, dmg.ErrNotDMG):
+		return &Diagnosis{"The file is not a UDIF disk image.", "Make sure the URL or file is a .dmg made with hdiutil, or hash it without reading it."}
+	case errors.Is(err, dmg.ErrUnsupported):
+		return &Diagnosis{
+			"The disk image is in a format whose app cannot be read, such as APFS or LZFSE compression.",
+			"Convert it to an HFS+ image compressed with zlib (hdiutil convert -format UDZO), or give its metadata and hash it without reading it.",
+		}
+	case errors.Is(err, zip.ErrFormat):
+		return &Diagnosis{"The file is not a zip archive.", "Make sure the URL or file is a .zip made with ditto or zip, or hash it without reading it."}
+	case errors.Is(err, bundle.ErrNoApp):
+		return &Diagnosis{
+			"There is no app at the top level of the disk image or zip archive.",
+			"Give the metadata of the file, or put the app at its top level (ditto -c -k --keepParent App.app App.zip).",
+		}
+	case errors.Is(err, ErrPolicyViolation):
+		return &Diagnosis{
+			"The package's signature does not meet the signature policy.",
+			"Ask the vendor for a package signed and notarized as required, or relax the --require flags.",
+		}
+	case errors.Is(err, ErrSourceDrift):
+		return &Diagnosis{
+			"The package changed on the server while it was read, so its hashes may mix two versions of it.",
+			"Build it again once the upload has finished, or pass --retry-on-drift.",
+		}
+	case errors.Is(err, xar.ErrChecksumMismatch):
+		return &Diagnosis{"The package's table of contents is corrupt.", "Download or upload the package again, it may have been truncated."}
+	}
+
+	return nil
+}
+
+func diagnoseStatus(code int) *Diagnosis {
+	switch code {
+	case http.StatusUnauthorized:
+		return &Diagnosis{"The server requires authentication.", "Supply a username and password or a bearer token."}
+	case http.StatusForbidden:
+		return &Diagnosis{"The server refused access to the package.", "Check the credentials have access, or that a presigned URL has not expired."}
+	case http.StatusNotFound:
+		return &Diagnosis{"The package was not found on the server.", "Check the URL, including its case."}
+	}
+
+	if code >= 500 {
+		return &Diagnosis{"The server failed to answer the request.", "Try again later, or contact whoever runs the server."}
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package manifestgo
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrUnknownDigestEncoding = errors.New("manifestgo: unknown digest encoding")
+
+// DigestEncoding is how the digests of the assets of a manifest are written in its JSON.
+type DigestEncoding string
+
+const (
+	// DigestHex writes digests as lowercase hex, the encoding of plists and the default.
+	DigestHex DigestEncoding = "hex"
+	// DigestUpperHex writes digests as uppercase hex.
+	DigestUpperHex DigestEncoding = "upper-hex"
+	// DigestBase64 writes digests as standard, padded base64, as Subresource Integrity style checks expect.
+	DigestBase64 DigestEncoding = "base64"
+)
+
+// ParseDigestEncoding returns the DigestEncoding named s, DigestHex if s is empty.
+func ParseDigestEncoding(s string) (DigestEncoding, error) {
+	switch e := DigestEncoding(strings.ToLower(s)); e {
+	case "":
+		return DigestHex, nil
+	case DigestHex, DigestUpperHex, DigestBase64:
+		return e, nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUnknownDigestEncoding, s)
+}
+
+// WithDigestEncoding returns a copy of m whose asset digests, the chunk digests and the full SHA-256, are written in
+// enc, whatever encoding m has them in. Devices only read hex, so it is for JSON output: write plists from m itself.
+func (m *Manifest) WithDigestEncoding(enc DigestEncoding) (*Manifest, error) {
+	enc, err := ParseDigestEncoding(string(enc))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Manifest{ManifestItems: make([]*Item, len(m.ManifestItems))}
+	for i, item := range m.ManifestItems {
+		ic := *item
+		ic.Assets = make([]*Asset, len(item.Assets))
+		for j, a := range item.Assets {
+			ac := *a
+			if ac.MD5s, err = encodeDigests(a.MD5s, md5.Size, enc); err != nil {
+				return nil, fmt.Errorf("manifestgo: item %d asset %d: %w", i, j, err)
+			}
+			if ac.SHA256s, err = encodeDigests(a.SHA256s, sha256.Size, enc); err != nil {
+				return nil, fmt.Errorf("manifestgo: item %d asset %d: %w", i, j, err)
+			}
+			if a.FullSHA256 != "" {
+				if ac.FullSHA256, err = encodeDigest(a.FullSHA256, sha256.Size, enc); err != nil {
+					return nil, fmt.Errorf("manifestgo: item %d asset %d: %w", i, j, err)
+				}
+			}
+			ic.Assets[j] = &ac
+		}
+		c.ManifestItems[i] = &ic
+	}
+
+	return c, nil
+}
+
+// normalizeDigests rewrites the asset digests of m that are in another encoding as lowercase hex, leaving those that
+// cannot be decoded as they are.
+func (m *Manifest) normalizeDigests() {
+	for _, item := range m.ManifestItems {
+		for _, a := range item.Assets {
+			if d, err := encodeDigests(a.MD5s, md5.Size, DigestHex); err == nil {
+				a.MD5s = d
+			}
+			if d, err := encodeDigests(a.SHA256s, sha256.Size, DigestHex); err == nil {
+				a.SHA256s = d
+			}
+			if d, err := encodeDigest(a.FullSHA256, sha256.Size, DigestHex); err == nil {
+				a.FullSHA256 = d
+			}
+		}
+	}
+}
+
+func encodeDigests(digests []string, size int, enc DigestEncoding) ([]string, error) {
+	if digests == nil {
+		return nil, nil
+	}
+
+	out := make([]string, len(digests))
+	for i, d := range digests {
+		var err error
+		if out[i], err = encodeDigest(d, size, enc); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// encodeDigest returns the digest d of a hash whose sum is size bytes, in hex of either case or base64, in enc.
+func encodeDigest(d string, size int, enc DigestEncoding) (string, error) {
+	sum, err := decodeDigest(d, size)
+	if err != nil {
+		return "", err
+	}
+
+	switch enc {
+	case DigestUpperHex:
+		return strings.ToUpper(hex.EncodeToString(sum)), nil
+	case DigestBase64:
+		return base64.StdEncoding.EncodeToString(sum), nil
+	}
+
+	return hex.EncodeToString(sum), nil
+}
+
+// decodeDigest decodes d by its length, which differs between hex and base64 for the same size of sum.
+func decodeDigest(d string, size int) ([]byte, error) {
+	var (
+		sum []byte
+		err error
+	)
+	if len(d) == hex.EncodedLen(size) {
+		sum, err = hex.DecodeString(d)
+	} else {
+		sum, err = base64.StdEncoding.DecodeString(d)
+	}
+	if err == nil && len(sum) != size {
+		err = fmt.Errorf("%d bytes, expected %d", len(sum), size)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid digest %q: %w", d, err)
+	}
+
+	return sum, nil
+}
@@ -0,0 +1,128 @@
+package manifestgo
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// The MD5 and SHA-256 of nothing, in each DigestEncoding.
+var digestVectors = []struct {
+	name    string
+	size    int
+	encoded map[DigestEncoding]string
+}{
+	{"md5", md5.Size, map[DigestEncoding]string{
+		DigestHex:      "d41d8cd98f00b204e9800998ecf8427e",
+		DigestUpperHex: "D41D8CD98F00B204E9800998ECF8427E",
+		DigestBase64:   "1B2M2Y8AsgTpgAmY7PhCfg==",
+	}},
+	{"sha256", sha256.Size, map[DigestEncoding]string{
+		DigestHex:      "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		DigestUpperHex: "E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855",
+		DigestBase64:   "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+	}},
+}
+
+func TestEncodeDigest(t *testing.T) {
+	for _, v := range digestVectors {
+		sum, _ := hex.DecodeString(v.encoded[DigestHex])
+		for from, d := range v.encoded {
+			got, err := decodeDigest(d, v.size)
+			if err != nil || !bytes.Equal(got, sum) {
+				t.Errorf("%s: decodeDigest(%q) = %x, %v, want %x", v.name, d, got, err, sum)
+			}
+			for to, want := range v.encoded {
+				if got, err := encodeDigest(d, v.size, to); err != nil || got != want {
+					t.Errorf("%s: %s to %s: got %q, %v, want %q", v.name, from, to, got, err, want)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeDigestInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		d    string
+		size int
+	}{
+		{"empty", "", md5.Size},
+		{"short hex", "d41d8cd98f00b204e9800998ecf842", md5.Size},
+		{"not hex", "z41d8cd98f00b204e9800998ecf8427e", md5.Size},
+		{"not base64", "1B2M2Y8AsgTpgAmY7PhC!g==", md5.Size},
+		{"base64 of another size", "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=", md5.Size},
+		{"hex of another size", "d41d8cd98f00b204e9800998ecf8427e", sha256.Size},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if sum, err := decodeDigest(tt.d, tt.size); err == nil {
+				t.Errorf("decoded %q to %x", tt.d, sum)
+			}
+		})
+	}
+}
+
+func TestWithDigestEncoding(t *testing.T) {
+	md5Hex, sha256Hex := digestVectors[0].encoded[DigestHex], digestVectors[1].encoded[DigestHex]
+	m := testManifest()
+	a := m.ManifestItems[0].Assets[0]
+	a.MD5s = []string{md5Hex}
+	a.SHA256s = []string{sha256Hex}
+	a.FullSHA256 = sha256Hex
+
+	for _, enc := range []DigestEncoding{DigestHex, DigestUpperHex, DigestBase64} {
+		t.Run(string(enc), func(t *testing.T) {
+			c, err := m.WithDigestEncoding(enc)
+			if err != nil {
+				t.Fatalf("WithDigestEncoding: %v", err)
+			}
+			ca := c.ManifestItems[0].Assets[0]
+			wantMD5, wantSHA256 := digestVectors[0].encoded[enc], digestVectors[1].encoded[enc]
+			if !reflect.DeepEqual(ca.MD5s, []string{wantMD5}) || !reflect.DeepEqual(ca.SHA256s, []string{wantSHA256}) || ca.FullSHA256 != wantSHA256 {
+				t.Errorf("got digests %v, %v and %s, want %s and %s", ca.MD5s, ca.SHA256s, ca.FullSHA256, wantMD5, wantSHA256)
+			}
+			if a.MD5s[0] != md5Hex || a.FullSHA256 != sha256Hex {
+				t.Error("the manifest was changed rather than copied")
+			}
+
+			b, err := c.AsJSON(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ParseManifest(b)
+			if err != nil {
+				t.Fatalf("ParseManifest: %v", err)
+			}
+			if !reflect.DeepEqual(got, m) {
+				t.Errorf("ParseManifest did not turn %s back into hex", b)
+			}
+		})
+	}
+}
+
+func TestWithDigestEncodingInvalid(t *testing.T) {
+	m := testManifest()
+	m.ManifestItems[0].Assets[0].SHA256s = []string{"not a digest"}
+	if _, err := m.WithDigestEncoding(DigestBase64); err == nil {
+		t.Error("encoded an invalid digest")
+	}
+	if _, err := testManifest().WithDigestEncoding("base32"); !errors.Is(err, ErrUnknownDigestEncoding) {
+		t.Errorf("got error %v, want %v", err, ErrUnknownDigestEncoding)
+	}
+
+	// ParseManifest leaves digests it cannot decode as they are.
+	b, _ := m.AsJSON(0)
+	got, err := ParseManifest(b)
+	if err != nil {
+		t.Fatalf("ParseManifest: %v", err)
+	}
+	if d := got.ManifestItems[0].Assets[0].SHA256s; !reflect.DeepEqual(d, []string{"not a digest"}) {
+		t.Errorf("got digests %v, want the invalid one kept", d)
+	}
+}
@@ -0,0 +1,19 @@
+package manifestgo
+
+import (
+	"github.com/dbyington/manifestgo/internal/dmg"
+)
+
+// ReadDMG reads a disk image distributed as-is like ReadFromURL reads a package: it is hashed in chunks while the
+// metadata is taken from the Info.plist of the app at the top level of the image. Only UDIF images of HFS+ file
+// systems, raw or compressed with zlib, bzip2 or ADC, can be read. Metadata given with SetMetadata is kept, and when
+// it includes a bundle identifier an image that cannot be read is only warned about.
+func (p *Package) ReadDMG() error {
+	return p.readApp("disk image", dmg.ReadApp)
+}
+
+// ReadDMGFile reads the disk image name like ReadDMG, hashing it whole like ReadPkgFile. opts configure the Package
+// before it is read, such as WithMetadata giving metadata to keep.
+func ReadDMGFile(name string, opts ...Option) (*Package, error) {
+	return readAppFile(name, "disk image", dmg.ReadApp, opts)
+}
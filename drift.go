@@ -0,0 +1,89 @@
+package manifestgo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dbyington/manifestgo/httpio"
+)
+
+var ErrSourceDrift = errors.New("manifestgo: package changed while it was read")
+
+// SourceDriftError is returned by BuildManifest with WithDriftCheck when the Etag or length of the package at its URL
+// are no longer those it had when reading started, so the hashes may mix two versions of it. It wraps ErrSourceDrift.
+type SourceDriftError struct {
+	URL                  string
+	Etag                 string
+	CurrentEtag          string
+	ContentLength        int64
+	CurrentContentLength int64
+}
+
+func (e *SourceDriftError) Error() string {
+	if e.ContentLength != e.CurrentContentLength {
+		return fmt.Sprintf("%s: %s: length %d is now %d", ErrSourceDrift, e.URL, e.ContentLength, e.CurrentContentLength)
+	}
+	return fmt.Sprintf("%s: %s: Etag %s is now %s", ErrSourceDrift, e.URL, e.Etag, e.CurrentEtag)
+}
+
+func (e *SourceDriftError) Unwrap() error {
+	return ErrSourceDrift
+}
+
+// sourceDriftError returns err as a *SourceDriftError when it is an *httpio.ChangedError, a range of the package read
+// after it changed on the server, so the package fails the same way whether the change is noticed while it is read or
+// by WithDriftCheck afterwards.
+func sourceDriftError(err error) error {
+	var changed *httpio.ChangedError
+	if !errors.As(err, &changed) {
+		return err
+	}
+
+	return &SourceDriftError{
+		URL:                  changed.URL,
+		Etag:                 changed.Etag,
+		CurrentEtag:          changed.CurrentEtag,
+		ContentLength:        changed.ContentLength,
+		CurrentContentLength: changed.CurrentContentLength,
+	}
+}
+
+// headReader is implemented by a PackageReader that can ask again for the Etag and length of the package, as httpio
+// does.
+type headReader interface {
+	Head() (etag string, length int64, err error)
+}
+
+// WithDriftCheck makes BuildManifest ask the server for the Etag and length of the package again before building the
+// manifest, failing with a *SourceDriftError if either changed since reading started. Readers that cannot ask, such as
+// those of local files, are not checked.
+func WithDriftCheck() Option {
+	return func(p *Package) {
+		p.checkDrift = true
+	}
+}
+
+// checkSourceDrift returns a *SourceDriftError if the package at the URL is no longer the one that was read.
+func (p *Package) checkSourceDrift() error {
+	r, ok := p.reader.(headReader)
+	if !p.checkDrift || !ok {
+		return nil
+	}
+
+	etag, length, err := r.Head()
+	if err != nil {
+		return fmt.Errorf("manifestgo: checking the package has not changed: %w", err)
+	}
+	// Servers that send no Etag can only be checked by length.
+	if length != p.ContentLength || (p.Etag != "" && etag != p.Etag) {
+		return &SourceDriftError{
+			URL:                  p.reader.URL(),
+			Etag:                 p.Etag,
+			CurrentEtag:          etag,
+			ContentLength:        p.ContentLength,
+			CurrentContentLength: length,
+		}
+	}
+
+	return nil
+}
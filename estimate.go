@@ -0,0 +1,107 @@
+package manifestgo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// EstimateSampleSize is how many bytes EstimateBuild reads to measure the throughput of the reader.
+const EstimateSampleSize = 4 << 20
+
+// BuildEstimate is what reading a package is expected to transfer, and roughly how long it is expected to take.
+type BuildEstimate struct {
+	// Length is the size of the package.
+	Length int64 `json:"length"`
+	// Bytes is how many bytes reading the package transfers: its length, less the chunks reused from the previous
+	// asset, or none when the Cache has it.
+	Bytes int64 `json:"bytes"`
+	// Cached is true when the package would be read from the Cache.
+	Cached bool `json:"cached"`
+	// ReusedChunks is the number of chunks of the previous asset that would be reused.
+	ReusedChunks int `json:"reused_chunks,omitempty"`
+	// SampleBytes and SampleDuration are the size and duration of the read the throughput was measured with.
+	SampleBytes    int64         `json:"sample_bytes"`
+	SampleDuration time.Duration `json:"sample_duration"`
+	// BytesPerSecond is the throughput of the sample.
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	// Duration is how long reading Bytes is expected to take at that throughput.
+	Duration time.Duration `json:"duration"`
+}
+
+func (e *BuildEstimate) String() string {
+	if e.Cached {
+		return fmt.Sprintf("%s, in the cache, nothing to read", formatBytes(float64(e.Length)))
+	}
+
+	s := fmt.Sprintf("%s to read at %s/s, about %s", formatBytes(float64(e.Bytes)), formatBytes(e.BytesPerSecond), e.Duration.Round(time.Second))
+	if e.ReusedChunks > 0 {
+		s += fmt.Sprintf(" (%s, %d chunks reused)", formatBytes(float64(e.Length)), e.ReusedChunks)
+	}
+
+	return s
+}
+
+// EstimateBuild estimates what reading the package will transfer and how long it will take, from the throughput of a
+// read of the first EstimateSampleSize bytes, without reading it. Reading a package transfers it whole, less the
+// chunks WithPreviousAsset reuses, or nothing when WithCache has it; the TOC read alongside is not counted. The
+// estimate is rough, a single read is slowed by the latency of the first byte and a network may not stay as fast.
+func (p *Package) EstimateBuild() (*BuildEstimate, error) {
+	if p.reader == nil {
+		return nil, errors.New("no hasher")
+	}
+
+	length := p.reader.Length()
+	e := &BuildEstimate{Length: length, Bytes: length}
+	if p.cacheable() {
+		if _, ok := p.cache.Get(p.cacheKey()); ok {
+			e.Cached, e.Bytes = true, 0
+			return e, nil
+		}
+	}
+	if _, ok := p.reader.(rangeHasher); ok {
+		if reused := p.reusableHashes(length); len(reused) > 0 {
+			e.ReusedChunks = len(reused)
+			e.Bytes -= int64(len(reused)) * p.hashChunkSize
+			if e.Bytes < 0 {
+				e.Bytes = 0
+			}
+		}
+	}
+
+	n := int64(EstimateSampleSize)
+	if n > length {
+		n = length
+	}
+	buf := make([]byte, n)
+	start := time.Now()
+	if _, err := p.reader.ReadAt(buf, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	e.SampleBytes, e.SampleDuration = n, time.Since(start)
+
+	if e.SampleDuration > 0 {
+		e.BytesPerSecond = float64(n) / e.SampleDuration.Seconds()
+	}
+	if e.BytesPerSecond > 0 {
+		e.Duration = time.Duration(float64(e.Bytes) / e.BytesPerSecond * float64(time.Second))
+	}
+
+	return e, nil
+}
+
+// formatBytes formats n bytes with a decimal unit, such as 12.4 GB.
+func formatBytes(n float64) string {
+	const units = "kMGTPE"
+	if n < 1000 {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	i := -1
+	for n >= 1000 && i < len(units)-1 {
+		n /= 1000
+		i++
+	}
+
+	return fmt.Sprintf("%.1f %cB", n, units[i])
+}
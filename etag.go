@@ -0,0 +1,119 @@
+package manifestgo
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var ErrETagNotComparable = errors.New("manifestgo: the ETag is not derived from the MD5 of the content")
+
+// commonPartSizes are the part sizes upload tools commonly split a multipart upload into, tried in turn when the part
+// size of an ETag is not known: the defaults of the AWS CLI and SDKs, s3cmd, rclone and others.
+var commonPartSizes = []int64{5 << 20, 8 << 20, 15 << 20, 16 << 20, 32 << 20, 50 << 20, 64 << 20, 100 << 20, 128 << 20, 256 << 20, 512 << 20}
+
+// MultipartETag returns the ETag S3 gives an object uploaded from r in parts of partSize bytes: the hex MD5 of the
+// concatenated MD5s of its parts, then - and the number of parts.
+func MultipartETag(r io.Reader, partSize int64) (string, error) {
+	if partSize <= 0 {
+		return "", ErrInvalidChunkSize
+	}
+
+	sums := md5.New()
+	var parts int
+	for {
+		h := md5.New()
+		n, err := io.CopyN(h, r, partSize)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if n == 0 && parts > 0 {
+			break
+		}
+		sums.Write(h.Sum(nil))
+		parts++
+		if n < partSize {
+			break
+		}
+	}
+
+	return hex.EncodeToString(sums.Sum(nil)) + "-" + strconv.Itoa(parts), nil
+}
+
+// MatchETag reports whether etag, as S3 and compatible stores give it, is that of the content of r, size bytes long, so
+// an upload can be checked without downloading it. A plain ETag is compared with the MD5 of the content. A multipart
+// one, ending in -N, is compared with the MultipartETag of the content in parts of partSize, or when partSize is 0, of
+// each common part size and the even split that give N parts. It returns the part size that matched, 0 for a plain
+// ETag, and ErrETagNotComparable for an ETag that is neither, such as that of an object encrypted with SSE-KMS.
+func MatchETag(etag string, r io.ReaderAt, size, partSize int64) (bool, int64, error) {
+	etag = strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)
+	sum, suffix := etag, ""
+	if i := strings.IndexByte(etag, '-'); i >= 0 {
+		sum, suffix = etag[:i], etag[i+1:]
+	}
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != md5.Size {
+		return false, 0, fmt.Errorf("%w: %q", ErrETagNotComparable, etag)
+	}
+	sum = strings.ToLower(sum)
+
+	if suffix == "" {
+		h := md5.New()
+		if _, err := io.Copy(h, io.NewSectionReader(r, 0, size)); err != nil {
+			return false, 0, err
+		}
+		return hex.EncodeToString(h.Sum(nil)) == sum, 0, nil
+	}
+
+	parts, err := strconv.ParseInt(suffix, 10, 64)
+	if err != nil || parts < 1 {
+		return false, 0, fmt.Errorf("%w: %q", ErrETagNotComparable, etag)
+	}
+
+	sizes := []int64{partSize}
+	if partSize <= 0 {
+		sizes = etagPartSizes(size, parts)
+	}
+	for _, ps := range sizes {
+		got, err := MultipartETag(io.NewSectionReader(r, 0, size), ps)
+		if err != nil {
+			return false, 0, err
+		}
+		if got == sum+"-"+suffix {
+			return true, ps, nil
+		}
+	}
+
+	return false, 0, nil
+}
+
+// etagPartSizes returns the part sizes that split size bytes into parts parts: the common ones, then the size split
+// evenly, both exactly and rounded up to a MiB.
+func etagPartSizes(size, parts int64) []int64 {
+	even := (size + parts - 1) / parts
+	candidates := append(append([]int64(nil), commonPartSizes...), even, (even+1<<20-1)/(1<<20)*(1<<20))
+
+	var sizes []int64
+	seen := make(map[int64]bool)
+	for _, ps := range candidates {
+		if ps <= 0 || seen[ps] || etagParts(size, ps) != parts {
+			continue
+		}
+		seen[ps] = true
+		sizes = append(sizes, ps)
+	}
+
+	return sizes
+}
+
+// etagParts returns the number of parts an upload of size bytes in parts of partSize has, at least one.
+func etagParts(size, partSize int64) int64 {
+	if size == 0 {
+		return 1
+	}
+
+	return (size + partSize - 1) / partSize
+}
@@ -0,0 +1,115 @@
+package manifestgo
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// etagData returns n bytes of content for the ETag tests, whose ETags were computed independently.
+func etagData(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}
+
+func TestMultipartETag(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		partSize int64
+		want     string
+	}{
+		// The ETag S3 gives an empty object uploaded in one part.
+		{"empty", 0, 1024, "59adb24ef3cdbe0297f05b395827453f-1"},
+		{"exact multiple", 2048, 1024, "7d4dbc1718bdfce99e45806e4540b2d0-2"},
+		{"short last part", 3000, 1024, "7fb787073705150ed6ceee55acfb7020-3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MultipartETag(bytes.NewReader(etagData(tt.size)), tt.partSize)
+			if err != nil {
+				t.Fatalf("MultipartETag: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got ETag %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := MultipartETag(bytes.NewReader(nil), 0); !errors.Is(err, ErrInvalidChunkSize) {
+		t.Errorf("got error %v, want %v", err, ErrInvalidChunkSize)
+	}
+}
+
+func TestMatchETag(t *testing.T) {
+	const mib = 1 << 20
+	small, big := etagData(3000), etagData(12*mib+5)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		etag      string
+		partSize  int64
+		want      bool
+		wantParts int64
+		wantErr   error
+	}{
+		{"plain", small, `"a216503cb86d01a23e71e047d4ccf001"`, 0, true, 0, nil},
+		{"plain uppercase", small, "A216503CB86D01A23E71E047D4CCF001", 0, true, 0, nil},
+		{"plain mismatch", small, `"a216503cb86d01a23e71e047d4ccf000"`, 0, false, 0, nil},
+		{"weak", small, `W/"a216503cb86d01a23e71e047d4ccf001"`, 0, true, 0, nil},
+		{"weak multipart", small, `W/"7fb787073705150ed6ceee55acfb7020-3"`, 1024, true, 1024, nil},
+		{"part size given", small, `"7fb787073705150ed6ceee55acfb7020-3"`, 1024, true, 1024, nil},
+		{"other part size given", small, `"7fb787073705150ed6ceee55acfb7020-3"`, 2048, false, 0, nil},
+		{"empty", nil, `"59adb24ef3cdbe0297f05b395827453f-1"`, 0, true, 5 * mib, nil},
+		{"guessed common size", big, `"a4b2dbb31baccb1bf9637292d80f4295-2"`, 0, true, 8 * mib, nil},
+		{"guessed even split", big, `"30c1378ac31aaae921a2635fc0265246-2"`, 0, true, 6*mib + 3, nil},
+		{"guessed even split in MiB", big, `"be363174bc254643374c99cc191052af-2"`, 0, true, 7 * mib, nil},
+		{"guessed three parts", big, `"14a1e722095032d421357c2e3d1088a5-3"`, 0, true, 5 * mib, nil},
+		{"part size not guessed", big, `"678d691f2079e37867cf45e539af64c3-2"`, 0, false, 0, nil},
+		{"sse-kms", small, `"7c5a2f0e8a3b4c7d-kms"`, 0, false, 0, ErrETagNotComparable},
+		{"not an md5", small, `"ad1d7a2b"`, 0, false, 0, ErrETagNotComparable},
+		{"no parts", small, `"7fb787073705150ed6ceee55acfb7020-0"`, 0, false, 0, ErrETagNotComparable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, partSize, err := MatchETag(tt.etag, bytes.NewReader(tt.data), int64(len(tt.data)), tt.partSize)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if ok != tt.want || partSize != tt.wantParts {
+				t.Errorf("got %t with part size %d, want %t with %d", ok, partSize, tt.want, tt.wantParts)
+			}
+		})
+	}
+}
+
+func TestETagPartSizes(t *testing.T) {
+	const mib = 1 << 20
+	tests := []struct {
+		name  string
+		size  int64
+		parts int64
+		want  []int64
+	}{
+		{"empty", 0, 1, []int64{5 * mib, 8 * mib, 15 * mib, 16 * mib, 32 * mib, 50 * mib, 64 * mib, 100 * mib, 128 * mib, 256 * mib, 512 * mib}},
+		{"two parts", 12*mib + 5, 2, []int64{8 * mib, 6*mib + 3, 7 * mib}},
+		{"exact multiple", 16 * mib, 2, []int64{8 * mib, 15 * mib}},
+		{"even split only", 3000 * mib, 7, []int64{3000*mib/7 + 1, 429 * mib}},
+		{"no size gives the parts", 10 * mib, 20000, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagPartSizes(tt.size, tt.parts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got part sizes %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package manifestgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// The keys Item and Metadata write themselves, in the plist and in JSON. Extra keys with the same name, in JSON in any
+// FieldNaming, are dropped when writing and never filled in when parsing.
+var (
+	itemPlistKeys     = []string{"assets", "metadata"}
+	itemJSONKeys      = []string{"assets", "metadata"}
+	metadataPlistKeys = []string{"bundle-identifier", "bundle-version", "kind", "title"}
+	metadataJSONKeys  = []string{"bundle_identifier", "bundle_version", "kind", "title", "minimum_os_version"}
+)
+
+// MarshalPlist writes the Extra keys of i alongside assets and metadata.
+func (i *Item) MarshalPlist() (interface{}, error) {
+	// item has the fields and tags of Item but not this method, which would otherwise call itself.
+	type item Item
+	if len(i.Extra) == 0 {
+		return item(*i), nil
+	}
+
+	d := map[string]interface{}{"assets": i.Assets}
+	if i.Metadata != nil {
+		// The encoder does not follow a pointer held in an interface, so the metadata is marshalled here.
+		md, err := i.Metadata.MarshalPlist()
+		if err != nil {
+			return nil, err
+		}
+		d["metadata"] = md
+	}
+
+	return withExtra(d, i.Extra), nil
+}
+
+// UnmarshalPlist keeps the keys of the item other than assets and metadata in Extra.
+func (i *Item) UnmarshalPlist(f func(interface{}) error) error {
+	type item Item
+	if err := f((*item)(i)); err != nil {
+		return err
+	}
+
+	var all map[string]interface{}
+	if err := f(&all); err != nil {
+		return err
+	}
+	i.Extra = extraKeys(all, itemPlistKeys)
+
+	return nil
+}
+
+// MarshalJSON writes the Extra keys of i after assets and metadata.
+func (i *Item) MarshalJSON() ([]byte, error) {
+	type item Item
+	b, err := json.Marshal((*item)(i))
+	if err != nil || len(i.Extra) == 0 {
+		return b, err
+	}
+
+	return appendJSONExtra(b, i.Extra, itemJSONKeys)
+}
+
+// UnmarshalJSON keeps the keys of the item other than assets and metadata in Extra.
+func (i *Item) UnmarshalJSON(b []byte) error {
+	type item Item
+	if err := json.Unmarshal(b, (*item)(i)); err != nil {
+		return err
+	}
+
+	var all map[string]interface{}
+	if err := json.Unmarshal(b, &all); err != nil {
+		return err
+	}
+	i.Extra = extraKeys(all, itemJSONKeys)
+
+	return nil
+}
+
+// UnmarshalPlist keeps the keys of the metadata this package does not know in Extra. A key MinimumOSVersion was
+// written under is one of them, as parsing cannot tell it from any other.
+func (md *Metadata) UnmarshalPlist(f func(interface{}) error) error {
+	type metadata Metadata
+	if err := f((*metadata)(md)); err != nil {
+		return err
+	}
+
+	var all map[string]interface{}
+	if err := f(&all); err != nil {
+		return err
+	}
+	md.Extra = extraKeys(all, metadataPlistKeys)
+
+	return nil
+}
+
+// MarshalJSON writes the Extra keys of md after the known ones.
+func (md *Metadata) MarshalJSON() ([]byte, error) {
+	type metadata Metadata
+	b, err := json.Marshal((*metadata)(md))
+	if err != nil || len(md.Extra) == 0 {
+		return b, err
+	}
+
+	return appendJSONExtra(b, md.Extra, metadataJSONKeys)
+}
+
+// UnmarshalJSON keeps the keys of the metadata this package does not know in Extra.
+func (md *Metadata) UnmarshalJSON(b []byte) error {
+	type metadata Metadata
+	if err := json.Unmarshal(b, (*metadata)(md)); err != nil {
+		return err
+	}
+
+	var all map[string]interface{}
+	if err := json.Unmarshal(b, &all); err != nil {
+		return err
+	}
+	md.Extra = extraKeys(all, metadataJSONKeys)
+
+	return nil
+}
+
+// withExtra adds the keys of extra not already in d to d and returns it.
+func withExtra(d map[string]interface{}, extra map[string]interface{}) map[string]interface{} {
+	for k, v := range extra {
+		if _, ok := d[k]; !ok {
+			d[k] = v
+		}
+	}
+
+	return d
+}
+
+// extraKeys returns the entries of all whose keys are not known, or nil if there are none.
+func extraKeys(all map[string]interface{}, known []string) map[string]interface{} {
+	for _, k := range known {
+		delete(all, k)
+	}
+	if len(all) == 0 {
+		return nil
+	}
+
+	return all
+}
+
+// appendJSONExtra adds the keys of extra not already in the JSON object b to its end, sorted so the same extras always
+// serialize to the same bytes. Keys naming one of the fields in another FieldNaming are left out too, as the field
+// would be written twice under the same name in that naming.
+func appendJSONExtra(b []byte, extra map[string]interface{}, fields []string) ([]byte, error) {
+	var known map[string]json.RawMessage
+	if err := json.Unmarshal(b, &known); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		names[nameWords(f, "_")] = true
+	}
+
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		if _, ok := known[k]; !ok && !names[nameWords(k, "_")] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	buf := bytes.NewBuffer(bytes.TrimSuffix(bytes.TrimSpace(b), []byte("}")))
+	for n, k := range keys {
+		kb, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		vb, err := json.Marshal(extra[k])
+		if err != nil {
+			return nil, err
+		}
+
+		if len(known) > 0 || n > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(kb)
+		buf.WriteByte(':')
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
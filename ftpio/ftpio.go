@@ -0,0 +1,456 @@
+// Package ftpio provides a PackageReader that reads packages from FTP servers over TLS, ftps:// URLs with implicit TLS
+// as legacy vendor distribution servers offer them. A range of the file is read by restarting a retrieval at its
+// offset and closing the data connection once the range is read.
+package ftpio
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbyington/manifestgo/httpio"
+	"github.com/dbyington/manifestgo/internal/chunkhash"
+)
+
+// DefaultPort is the port of implicit FTPS, used when the URL has none.
+const DefaultPort = "990"
+
+var (
+	ErrNotFTPS  = errors.New("ftpio: not an ftps URL")
+	ErrNoSize   = errors.New("ftpio: server did not return the size of the file")
+	ErrBadReply = errors.New("ftpio: unexpected reply from the server")
+)
+
+// dialTimeout bounds connecting to the server, when the context has no deadline.
+const dialTimeout = 30 * time.Second
+
+// ReadAtCloser reads ranges of a file over FTPS and hashes it in chunks.
+type ReadAtCloser struct {
+	ctx           context.Context
+	url           string
+	tlsConfig     *tls.Config
+	username      string
+	password      string
+	hashChunkSize int64
+	fileSum       []byte
+
+	host string
+	path string
+
+	mu   sync.Mutex
+	conn *textproto.Conn
+	size int64
+	etag string
+
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Option configures a ReadAtCloser.
+type Option func(*ReadAtCloser)
+
+// WithContext sets the context of the connections to the server, cancelling it closes them and fails any read in
+// progress.
+func WithContext(ctx context.Context) Option {
+	return func(r *ReadAtCloser) {
+		r.ctx = ctx
+	}
+}
+
+// WithURL sets the ftps://[user[:password]@]host[:port]/path URL of the file to read. The path is relative to the
+// directory the user logs in to, and absolute when it starts with //.
+func WithURL(url string) Option {
+	return func(r *ReadAtCloser) {
+		r.url = url
+	}
+}
+
+// WithTLSConfig sets the TLS configuration of the connections, such as the roots trusted to sign the certificate of
+// the server. The server name is the host of the URL unless it sets one.
+func WithTLSConfig(c *tls.Config) Option {
+	return func(r *ReadAtCloser) {
+		r.tlsConfig = c
+	}
+}
+
+// WithCredentials sets the user and password to log in with, in place of those of the URL. Without either the login
+// is anonymous.
+func WithCredentials(username, password string) Option {
+	return func(r *ReadAtCloser) {
+		r.username = username
+		r.password = password
+	}
+}
+
+// WithHashChunkSize sets the size of each chunk hashed by HashURL.
+func WithHashChunkSize(size int64) Option {
+	return func(r *ReadAtCloser) {
+		r.hashChunkSize = size
+	}
+}
+
+// NewReadAtCloser connects and logs in to the server of the configured URL, learning the size and modification time
+// of the file. Close logs out.
+func NewReadAtCloser(opts ...Option) (*ReadAtCloser, error) {
+	r := &ReadAtCloser{
+		ctx:           context.Background(),
+		hashChunkSize: httpio.DefaultHashChunkSize,
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(u.Scheme, "ftps") || u.Hostname() == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNotFTPS, r.url)
+	}
+	if r.username == "" && r.password == "" && u.User != nil {
+		r.username = u.User.Username()
+		r.password, _ = u.User.Password()
+	}
+	if _, ok := u.User.Password(); ok {
+		// The password is kept out of the URL of the manifest.
+		u.User = url.User(u.User.Username())
+		r.url = u.String()
+	}
+	if r.username == "" {
+		r.username, r.password = "anonymous", "anonymous@"
+	}
+	port := u.Port()
+	if port == "" {
+		port = DefaultPort
+	}
+	r.host = net.JoinHostPort(u.Hostname(), port)
+	r.path = strings.TrimPrefix(u.Path, "/")
+	if r.path == "" {
+		return nil, fmt.Errorf("%w: no file in %s", ErrNotFTPS, r.url)
+	}
+
+	cfg := &tls.Config{}
+	if r.tlsConfig != nil {
+		cfg = r.tlsConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = u.Hostname()
+	}
+	// Servers commonly require the data connections to resume the TLS session of the control connection.
+	if cfg.ClientSessionCache == nil {
+		cfg.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+	r.tlsConfig = cfg
+
+	if err := r.login(); err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// login connects to the server, logs in, protects the data connections and asks for the size and modification time of
+// the file.
+func (r *ReadAtCloser) login() error {
+	c, err := r.dial(r.host)
+	if err != nil {
+		return err
+	}
+	r.conn = textproto.NewConn(tls.Client(c, r.tlsConfig))
+
+	if _, _, err := r.conn.ReadResponse(220); err != nil {
+		return fmt.Errorf("ftpio: greeting: %w", err)
+	}
+	code, _, err := r.cmd("USER", 0, "USER %s", r.username)
+	if err != nil {
+		return err
+	}
+	switch code {
+	case 230:
+	case 331, 332:
+		if _, _, err := r.cmd("PASS", 2, "PASS %s", r.password); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: %d to USER", ErrBadReply, code)
+	}
+	for _, c := range []string{"PBSZ 0", "PROT P", "TYPE I"} {
+		if _, _, err := r.cmd(c, 2, "%s", c); err != nil {
+			return err
+		}
+	}
+
+	_, msg, err := r.cmd("SIZE", 213, "SIZE %s", r.path)
+	if err != nil {
+		return err
+	}
+	if r.size, err = strconv.ParseInt(strings.TrimSpace(msg), 10, 64); err != nil {
+		return fmt.Errorf("%w: %q", ErrNoSize, msg)
+	}
+	// MDTM is optional, without it packages are not told apart by an Etag.
+	if _, msg, err := r.cmd("MDTM", 213, "MDTM %s", r.path); err == nil {
+		r.etag = fmt.Sprintf("%s-%x", strings.TrimSpace(msg), r.size)
+	}
+
+	return nil
+}
+
+// dial connects to addr, closing the connection when the context is cancelled.
+func (r *ReadAtCloser) dial(addr string) (net.Conn, error) {
+	d := &net.Dialer{Timeout: dialTimeout}
+	c, err := d.DialContext(r.ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("ftpio: %w", err)
+	}
+	wc := &watchedConn{Conn: c, closed: make(chan struct{})}
+	go func() {
+		select {
+		case <-r.ctx.Done():
+			c.Close()
+		case <-wc.closed:
+		case <-r.done:
+		}
+	}()
+
+	return wc, nil
+}
+
+// watchedConn is a connection watched for the cancellation of the context until it is closed.
+type watchedConn struct {
+	net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (c *watchedConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// cmd sends a command, named verb in errors so a password is not, and reads its reply, checking its code as
+// textproto.Conn.ReadResponse does.
+func (r *ReadAtCloser) cmd(verb string, expect int, format string, args ...interface{}) (int, string, error) {
+	id, err := r.conn.Cmd(format, args...)
+	if err != nil {
+		return 0, "", fmt.Errorf("ftpio: %s: %w", verb, err)
+	}
+	r.conn.StartResponse(id)
+	defer r.conn.EndResponse(id)
+
+	code, msg, err := r.conn.ReadResponse(expect)
+	if err != nil {
+		return code, msg, fmt.Errorf("ftpio: %s: %w", verb, err)
+	}
+
+	return code, msg, nil
+}
+
+// retrieve starts retrieving the file from off, returning the data connection.
+func (r *ReadAtCloser) retrieve(off int64) (net.Conn, error) {
+	addr, err := r.passive()
+	if err != nil {
+		return nil, err
+	}
+	c, err := r.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if off > 0 {
+		if _, _, err := r.cmd("REST", 350, "REST %d", off); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if _, _, err := r.cmd("RETR", 1, "RETR %s", r.path); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	// The handshake is made on the first read, once the server has started the transfer and accepts it.
+	return tls.Client(c, r.tlsConfig), nil
+}
+
+// passive asks the server for the address of a data connection, with EPSV or else PASV. The host of a PASV reply is
+// not used, servers behind NAT commonly give their private address, the data connection is made to the host of the
+// control connection.
+func (r *ReadAtCloser) passive() (string, error) {
+	host, _, _ := net.SplitHostPort(r.host)
+
+	_, msg, err := r.cmd("EPSV", 229, "EPSV")
+	if err == nil {
+		// 229 Entering Extended Passive Mode (|||6446|)
+		i := strings.Index(msg, "(")
+		j := strings.LastIndex(msg, ")")
+		if i < 0 || j < i {
+			return "", fmt.Errorf("%w: %q to EPSV", ErrBadReply, msg)
+		}
+		f := strings.Split(msg[i+1:j], msg[i+1:i+2])
+		if len(f) != 5 {
+			return "", fmt.Errorf("%w: %q to EPSV", ErrBadReply, msg)
+		}
+		return net.JoinHostPort(host, f[3]), nil
+	}
+
+	_, msg, err = r.cmd("PASV", 227, "PASV")
+	if err != nil {
+		return "", err
+	}
+	// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+	i := strings.Index(msg, "(")
+	j := strings.LastIndex(msg, ")")
+	if i < 0 || j < i {
+		return "", fmt.Errorf("%w: %q to PASV", ErrBadReply, msg)
+	}
+	f := strings.Split(msg[i+1:j], ",")
+	if len(f) != 6 {
+		return "", fmt.Errorf("%w: %q to PASV", ErrBadReply, msg)
+	}
+	p1, err1 := strconv.Atoi(f[4])
+	p2, err2 := strconv.Atoi(f[5])
+	if err1 != nil || err2 != nil {
+		return "", fmt.Errorf("%w: %q to PASV", ErrBadReply, msg)
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(p1<<8|p2)), nil
+}
+
+// endTransfer closes the data connection c and reads the reply ending the transfer, which reports an aborted transfer
+// when c is closed before the end of the file.
+func (r *ReadAtCloser) endTransfer(c net.Conn) error {
+	c.Close()
+	_, _, err := r.conn.ReadResponse(0)
+
+	return err
+}
+
+// ReadAt reads len(p) bytes of the file starting at off.
+func (r *ReadAtCloser) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	want := p
+	if rest := r.size - off; int64(len(p)) > rest {
+		want = p[:rest]
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.retrieve(off)
+	if err != nil {
+		return 0, err
+	}
+	// The transfer is reported aborted when the range ends before the file does.
+	n, err := io.ReadFull(c, want)
+	if endErr := r.endTransfer(c); err == nil {
+		err = endErr
+	}
+	if err != nil {
+		return n, err
+	}
+	if len(want) < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// HashURL retrieves the whole file and returns a hash for each chunk of it. The size is the size of the hash sum,
+// md5.Size or sha256.Size.
+func (r *ReadAtCloser) HashURL(size uint) ([]hash.Hash, error) {
+	newHash, err := chunkhash.Hasher(size)
+	if err != nil {
+		return nil, err
+	}
+	fileHash := sha256.New()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.retrieve(0)
+	if err != nil {
+		return nil, err
+	}
+	cr := &countingReader{r: c}
+	hashes, err := chunkhash.Hash(cr, newHash, r.hashChunkSize, fileHash)
+	if endErr := r.endTransfer(c); err == nil {
+		err = endErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cr.n != r.size {
+		return nil, fmt.Errorf("ftpio: retrieved %d bytes of %d: %w", cr.n, r.size, io.ErrUnexpectedEOF)
+	}
+	r.fileSum = fileHash.Sum(nil)
+
+	return hashes, nil
+}
+
+// FileDigest returns the SHA-256 of the whole file hashed alongside its chunks by the last HashURL, or nil before it.
+func (r *ReadAtCloser) FileDigest() []byte {
+	return r.fileSum
+}
+
+// SetHashChunkSize sets the size of each chunk hashed by HashURL, for a size chosen once the length is known.
+func (r *ReadAtCloser) SetHashChunkSize(size int64) {
+	r.hashChunkSize = size
+}
+
+// Length returns the size of the file.
+func (r *ReadAtCloser) Length() int64 {
+	return r.size
+}
+
+// Etag returns a tag made of the modification time and size of the file, which changes when the file does, or "" if
+// the server does not support MDTM.
+func (r *ReadAtCloser) Etag() string {
+	return r.etag
+}
+
+// URL returns the URL of the file, without any password it had.
+func (r *ReadAtCloser) URL() string {
+	return r.url
+}
+
+// Close logs out and closes the connection to the server. It is safe to call more than once.
+func (r *ReadAtCloser) Close() error {
+	r.closeOnce.Do(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.conn != nil {
+			r.cmd("QUIT", 0, "QUIT")
+			r.closeErr = r.conn.Close()
+		}
+		close(r.done)
+	})
+
+	return r.closeErr
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,355 @@
+package ftpio
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ftpServer is an FTPS server with implicit TLS serving one file, pkg.bin, to alice with the password secret or to
+// anonymous users.
+type ftpServer struct {
+	t    *testing.T
+	ln   net.Listener
+	cfg  *tls.Config
+	file []byte
+	// noEPSV answers EPSV as unknown, for clients to fall back to PASV.
+	noEPSV bool
+
+	mu       sync.Mutex
+	commands []string
+}
+
+func newFTPServer(t *testing.T, file []byte, noEPSV bool) (*ftpServer, *tls.Config) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	s := &ftpServer{
+		t:      t,
+		cfg:    &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		file:   file,
+		noEPSV: noEPSV,
+	}
+	if s.ln, err = tls.Listen("tcp", "127.0.0.1:0", s.cfg); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			c, err := s.ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+
+	return s, &tls.Config{RootCAs: roots}
+}
+
+func (s *ftpServer) Close() {
+	s.ln.Close()
+}
+
+// url returns the URL of a file of the server, with userinfo before the host when it is not empty.
+func (s *ftpServer) url(userinfo, name string) string {
+	return "ftps://" + userinfo + s.ln.Addr().String() + "/" + name
+}
+
+func (s *ftpServer) log() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *ftpServer) serve(c net.Conn) {
+	tp := textproto.NewConn(c)
+	defer tp.Close()
+
+	var (
+		user string
+		rest int64
+		data net.Listener
+	)
+	defer func() {
+		if data != nil {
+			data.Close()
+		}
+	}()
+
+	tp.PrintfLine("220 test server ready")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			verb, arg = line[:i], line[i+1:]
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+
+		switch verb {
+		case "USER":
+			user = arg
+			if user == "anonymous" {
+				tp.PrintfLine("331 Send your email address as the password.")
+			} else {
+				tp.PrintfLine("331 Password required for %s.", user)
+			}
+		case "PASS":
+			if (user == "alice" && arg == "secret") || user == "anonymous" {
+				tp.PrintfLine("230 Logged in.")
+			} else {
+				tp.PrintfLine("530 Login incorrect.")
+			}
+		case "PBSZ", "PROT", "TYPE":
+			tp.PrintfLine("200 OK.")
+		case "SIZE":
+			if arg != "pkg.bin" {
+				tp.PrintfLine("550 %s: No such file or directory.", arg)
+				continue
+			}
+			tp.PrintfLine("213 %d", len(s.file))
+		case "MDTM":
+			tp.PrintfLine("213 20210501120000")
+		case "EPSV", "PASV":
+			if verb == "EPSV" && s.noEPSV {
+				tp.PrintfLine("500 EPSV not understood.")
+				continue
+			}
+			if data, err = tls.Listen("tcp", "127.0.0.1:0", s.cfg); err != nil {
+				s.t.Error(err)
+				return
+			}
+			port := data.Addr().(*net.TCPAddr).Port
+			if verb == "EPSV" {
+				tp.PrintfLine("229 Entering Extended Passive Mode (|||%d|)", port)
+			} else {
+				// A private address, as a server behind NAT gives, which the client must not use.
+				tp.PrintfLine("227 Entering Passive Mode (10,0,0,1,%d,%d)", port>>8, port&0xff)
+			}
+		case "REST":
+			rest, _ = strconv.ParseInt(arg, 10, 64)
+			tp.PrintfLine("350 Restarting at %d.", rest)
+		case "RETR":
+			if data == nil {
+				tp.PrintfLine("425 Use PASV first.")
+				continue
+			}
+			tp.PrintfLine("150 Opening BINARY mode data connection.")
+			dc, err := data.Accept()
+			data.Close()
+			data = nil
+			if err != nil {
+				tp.PrintfLine("425 Can't open data connection.")
+				continue
+			}
+			_, err = dc.Write(s.file[rest:])
+			dc.Close()
+			rest = 0
+			if err != nil {
+				tp.PrintfLine("426 Transfer aborted.")
+			} else {
+				tp.PrintfLine("226 Transfer complete.")
+			}
+		case "QUIT":
+			tp.PrintfLine("221 Goodbye.")
+			return
+		default:
+			tp.PrintfLine("502 %s not implemented.", verb)
+		}
+	}
+}
+
+// testFile returns size bytes of numbered lines.
+func testFile(size int) []byte {
+	var b bytes.Buffer
+	for i := 0; b.Len() < size; i++ {
+		fmt.Fprintf(&b, "line %06d of the sample package\n", i)
+	}
+	return b.Bytes()[:size]
+}
+
+func TestReadAtCloser(t *testing.T) {
+	for _, noEPSV := range []bool{false, true} {
+		t.Run(fmt.Sprintf("without EPSV %t", noEPSV), func(t *testing.T) {
+			want := testFile(100000)
+			s, cfg := newFTPServer(t, want, noEPSV)
+			defer s.Close()
+
+			r, err := NewReadAtCloser(WithURL(s.url("alice:secret@", "pkg.bin")), WithTLSConfig(cfg), WithHashChunkSize(32768))
+			if err != nil {
+				t.Fatalf("NewReadAtCloser: %v", err)
+			}
+			defer r.Close()
+
+			if r.Length() != int64(len(want)) {
+				t.Errorf("got length %d, want %d", r.Length(), len(want))
+			}
+			if etag := "20210501120000-186a0"; r.Etag() != etag {
+				t.Errorf("got ETag %q, want %q", r.Etag(), etag)
+			}
+			if url := s.url("alice@", "pkg.bin"); r.URL() != url {
+				t.Errorf("got URL %q, want %q", r.URL(), url)
+			}
+
+			tests := []struct {
+				off, n  int64
+				wantN   int
+				wantErr error
+			}{
+				{0, 100, 100, nil},
+				{30000, 10000, 10000, nil},
+				{r.Length() - 50, 100, 50, io.EOF},
+			}
+			for _, tt := range tests {
+				p := make([]byte, tt.n)
+				n, err := r.ReadAt(p, tt.off)
+				if n != tt.wantN || err != tt.wantErr {
+					t.Errorf("ReadAt(%d bytes, %d) = %d, %v, want %d, %v", tt.n, tt.off, n, err, tt.wantN, tt.wantErr)
+				}
+				if !bytes.Equal(p[:n], want[tt.off:tt.off+int64(n)]) {
+					t.Errorf("ReadAt(%d bytes, %d) read the wrong bytes", tt.n, tt.off)
+				}
+			}
+
+			hashes, err := r.HashURL(sha256.Size)
+			if err != nil {
+				t.Fatalf("HashURL: %v", err)
+			}
+			if len(hashes) != 4 {
+				t.Errorf("got %d chunks, want 4", len(hashes))
+			}
+			for i, h := range hashes {
+				end := (i + 1) * 32768
+				if end > len(want) {
+					end = len(want)
+				}
+				if sum := sha256.Sum256(want[i*32768 : end]); !bytes.Equal(h.Sum(nil), sum[:]) {
+					t.Errorf("chunk %d: got %x, want %x", i, h.Sum(nil), sum)
+				}
+			}
+			if sum := sha256.Sum256(want); !bytes.Equal(r.FileDigest(), sum[:]) {
+				t.Errorf("got file digest %x, want %x", r.FileDigest(), sum)
+			}
+
+			if err := r.Close(); err != nil {
+				t.Errorf("Close: %v", err)
+			}
+
+			log := strings.Join(s.log(), "\n")
+			for _, cmd := range []string{"USER alice", "PBSZ 0", "PROT P", "TYPE I", "REST 30000", "RETR pkg.bin", "QUIT"} {
+				if !strings.Contains(log, cmd) {
+					t.Errorf("the server was not sent %q, only\n%s", cmd, log)
+				}
+			}
+		})
+	}
+}
+
+func TestAnonymousLogin(t *testing.T) {
+	s, cfg := newFTPServer(t, testFile(10), false)
+	defer s.Close()
+
+	r, err := NewReadAtCloser(WithURL(s.url("", "pkg.bin")), WithTLSConfig(cfg))
+	if err != nil {
+		t.Fatalf("NewReadAtCloser: %v", err)
+	}
+	r.Close()
+
+	if log := s.log(); len(log) < 2 || log[0] != "USER anonymous" || log[1] != "PASS anonymous@" {
+		t.Errorf("got commands %q, want an anonymous login", log)
+	}
+}
+
+func TestNewReadAtCloserErrors(t *testing.T) {
+	s, cfg := newFTPServer(t, testFile(10), false)
+	defer s.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		want     error
+		wantCode int
+	}{
+		{"not ftps", "ftp://" + s.ln.Addr().String() + "/pkg.bin", ErrNotFTPS, 0},
+		{"no file", s.url("", ""), ErrNotFTPS, 0},
+		{"wrong password", s.url("alice:wrong@", "pkg.bin"), nil, 530},
+		{"missing file", s.url("alice:secret@", "missing.pkg"), nil, 550},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReadAtCloser(WithURL(tt.url), WithTLSConfig(cfg))
+			if err == nil {
+				r.Close()
+				t.Fatal("got no error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+			var perr *textproto.Error
+			if tt.wantCode != 0 && (!errors.As(err, &perr) || perr.Code != tt.wantCode) {
+				t.Errorf("got error %v, want a reply of %d", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestUntrustedCertificate(t *testing.T) {
+	s, _ := newFTPServer(t, testFile(10), false)
+	defer s.Close()
+
+	r, err := NewReadAtCloser(WithURL(s.url("alice:secret@", "pkg.bin")))
+	if err == nil {
+		r.Close()
+		t.Fatal("got no error from a server with an untrusted certificate")
+	}
+	var uerr x509.UnknownAuthorityError
+	if !errors.As(err, &uerr) {
+		t.Errorf("got error %v, want %T", err, uerr)
+	}
+}
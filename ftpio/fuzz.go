@@ -0,0 +1,32 @@
+//go:build gofuzz
+// +build gofuzz
+
+package ftpio
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+)
+
+type fuzzConn struct {
+	io.Reader
+	io.Writer
+}
+
+func (fuzzConn) Close() error { return nil }
+
+// Fuzz is the go-fuzz entry point for the replies of the server, data being what it answers asking for a data
+// connection.
+func Fuzz(data []byte) int {
+	r := &ReadAtCloser{
+		host: "127.0.0.1:990",
+		conn: textproto.NewConn(fuzzConn{bytes.NewReader(data), ioutil.Discard}),
+	}
+	if _, err := r.passive(); err != nil {
+		return 0
+	}
+
+	return 1
+}
@@ -0,0 +1,18 @@
+//go:build gofuzz
+// +build gofuzz
+
+package manifestgo
+
+// Fuzz is the go-fuzz entry point for the package parser.
+func Fuzz(data []byte) int {
+	p, err := ParsePackageBytes(data)
+	if err != nil {
+		return 0
+	}
+
+	if _, err := p.BuildManifest(); err != nil {
+		return 0
+	}
+
+	return 1
+}
@@ -22,7 +22,6 @@ type xmlChecksum struct {
 }
 
 type xmlSignature struct {
-	XMLName      xml.Name `xml:"signature"`
 	Style        string   `xml:"style,attr"`
 	Offset       int64    `xml:"offset"`
 	Size         int64    `xml:"size"`
@@ -33,9 +32,10 @@ type xmlToc struct {
 	XMLName               xml.Name `xml:"toc"`
 	CreationTime          string   `xml:"creation-time"`
 	Checksum              *xmlChecksum
-	SignatureCreationTime int64 `xml:"signature-creation-time"`
-	Signature             *xmlSignature
-	File                  []*xmlFile `xml:"file"`
+	SignatureCreationTime float64       `xml:"signature-creation-time"`
+	Signature             *xmlSignature `xml:"signature"`
+	XSignature            *xmlSignature `xml:"x-signature"`
+	File                  []*xmlFile    `xml:"file"`
 }
 
 type xmlFileChecksum struct {
@@ -65,6 +65,18 @@ type xmlFileData struct {
 	ExtractedChecksum xmlFileChecksum `xml:"extracted-checksum"`
 }
 
+type xmlFileEA struct {
+	XMLName           xml.Name `xml:"ea"`
+	Id                string   `xml:"id,attr"`
+	Name              string   `xml:"name"`
+	Length            int64    `xml:"length"`
+	Offset            int64    `xml:"offset"`
+	Size              int64    `xml:"size"`
+	Encoding          xmlFileEncoding
+	ArchivedChecksum  xmlFileChecksum `xml:"archived-checksum"`
+	ExtractedChecksum xmlFileChecksum `xml:"extracted-checksum"`
+}
+
 type xmlFile struct {
 	XMLName          xml.Name `xml:"file"`
 	Id               string   `xml:"id,attr"`
@@ -75,12 +87,13 @@ type xmlFile struct {
 	Gid              int      `xml:"gid"`
 	User             string   `xml:"user"`
 	Uid              int      `xml:"uid"`
-	Mode             uint32   `xml:"mode"`
+	Mode             string   `xml:"mode"`
 	DeviceNo         uint64   `xml:"deviceno"`
 	Inode            uint64   `xml:"inode"`
 	Type             string   `xml:"type"`
 	Name             string   `xml:"name"`
 	FinderCreateTime *xmlFinderCreateTime
 	Data             *xmlFileData
-	File             []*xmlFile `xml:"file"`
+	EA               []*xmlFileEA `xml:"ea"`
+	File             []*xmlFile   `xml:"file"`
 }
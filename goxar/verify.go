@@ -0,0 +1,314 @@
+package xar
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotSigned         = errors.New("xar: archive is not signed")
+	ErrSignatureMismatch = errors.New("xar: signature does not match the TOC checksum")
+	ErrUntrustedChain    = errors.New("xar: certificate chain is not trusted")
+	ErrMalformedCMS      = errors.New("xar: malformed CMS signature")
+	ErrNoSigner          = errors.New("xar: no certificate for the CMS signer")
+)
+
+// VerifyOptions configures Verify.
+type VerifyOptions struct {
+	// Roots are the trusted root certificates. The system pool is used if nil, which outside of macOS will usually not
+	// include Apple's roots.
+	Roots *x509.CertPool
+	// CurrentTime is the time the certificates must be valid at. If zero the time the archive was signed is used when
+	// it is known, and the current time otherwise.
+	CurrentTime time.Time
+	// Clock returns the current time, time.Now is used if nil.
+	Clock func() time.Time
+}
+
+// VerificationError is returned by Verify, naming the signature that failed and why.
+type VerificationError struct {
+	// Style is "RSA" for the classic signature or "CMS" for the x-signature.
+	Style string
+	Err   error
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("xar: %s signature: %s", e.Style, strings.TrimPrefix(e.Err.Error(), "xar: "))
+}
+
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+// Verify checks the signatures of the archive: that each was made over the TOC checksum by the leaf certificate of
+// its chain, and that the chain leads to one of the trusted roots. Both the classic RSA signature and the CMS
+// x-signature are checked when present. ErrNotSigned is returned for an unsigned archive, and a *VerificationError
+// for a signature that fails.
+func (r *Reader) Verify(opts VerifyOptions) error {
+	if r.signatureStyle == "" && r.cmsSignature == nil {
+		return ErrNotSigned
+	}
+
+	roots := opts.Roots
+	if roots == nil {
+		var err error
+		if roots, err = x509.SystemCertPool(); err != nil {
+			return err
+		}
+	}
+
+	if r.signatureStyle != "" {
+		if r.SignatureError != nil {
+			return &VerificationError{Style: r.signatureStyle, Err: r.SignatureError}
+		}
+
+		at := opts.CurrentTime
+		if at.IsZero() && r.SignatureCreationTime > 0 {
+			at = xarEpoch.Add(time.Duration(r.SignatureCreationTime) * time.Second)
+		}
+		if at.IsZero() && opts.Clock != nil {
+			at = opts.Clock()
+		}
+		if err := verifyChain(r.Certificates, roots, at); err != nil {
+			return &VerificationError{Style: r.signatureStyle, Err: err}
+		}
+	}
+
+	if r.cmsSignature != nil {
+		certs, signingTime, err := verifyCMS(r.cmsSignature, r.tocChecksum)
+		if err != nil {
+			return &VerificationError{Style: "CMS", Err: err}
+		}
+
+		at := opts.CurrentTime
+		if at.IsZero() {
+			at = signingTime
+		}
+		if at.IsZero() && opts.Clock != nil {
+			at = opts.Clock()
+		}
+		if err := verifyChain(certs, roots, at); err != nil {
+			return &VerificationError{Style: "CMS", Err: err}
+		}
+	}
+
+	return nil
+}
+
+// verifyChain verifies the chain, leaf first, leads to one of the roots at the given time, or now if it is zero.
+func verifyChain(chain []*x509.Certificate, roots *x509.CertPool, at time.Time) error {
+	if len(chain) == 0 {
+		return ErrNoCertificates
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		// Installer signing certificates carry Apple specific extended key usages.
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUntrustedChain, err)
+	}
+
+	return nil
+}
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      cmsEncapsulatedContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsEncapsulatedContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type cmsIssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// verifyCMS verifies a detached CMS signature over content. It returns the certificates of the signature, signer
+// first, and the signing time if the signature has one.
+func verifyCMS(der, content []byte) ([]*x509.Certificate, time.Time, error) {
+	var ci cmsContentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, time.Time{}, fmt.Errorf("%w: %v", ErrMalformedCMS, err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, time.Time{}, fmt.Errorf("%w: not signed data", ErrMalformedCMS)
+	}
+
+	var sd cmsSignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, time.Time{}, fmt.Errorf("%w: %v", ErrMalformedCMS, err)
+	}
+	if len(sd.SignerInfos) == 0 {
+		return nil, time.Time{}, fmt.Errorf("%w: no signer", ErrMalformedCMS)
+	}
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	si := sd.SignerInfos[0]
+	signer := cmsSigner(si.SID, certs)
+	if signer == nil {
+		return nil, time.Time{}, ErrNoSigner
+	}
+
+	h, err := cmsDigestHash(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	signed := content
+	var signingTime time.Time
+	if len(si.SignedAttrs.FullBytes) > 0 {
+		// The signature covers the DER of the attributes as a SET, not the implicitly tagged form they are stored in.
+		signed = append([]byte(nil), si.SignedAttrs.FullBytes...)
+		signed[0] = 0x31
+
+		var attrs []cmsAttribute
+		if _, err := asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil {
+			return nil, time.Time{}, fmt.Errorf("%w: %v", ErrMalformedCMS, err)
+		}
+
+		var digest []byte
+		for _, a := range attrs {
+			switch {
+			case a.Type.Equal(oidMessageDigest):
+				if _, err := asn1.Unmarshal(a.Values.Bytes, &digest); err != nil {
+					return nil, time.Time{}, fmt.Errorf("%w: %v", ErrMalformedCMS, err)
+				}
+			case a.Type.Equal(oidSigningTime):
+				asn1.Unmarshal(a.Values.Bytes, &signingTime)
+			}
+		}
+
+		d := h.New()
+		d.Write(content)
+		if !bytes.Equal(d.Sum(nil), digest) {
+			return nil, time.Time{}, ErrSignatureMismatch
+		}
+	}
+
+	d := h.New()
+	d.Write(signed)
+	sum := d.Sum(nil)
+
+	switch pub := signer.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, h, sum, si.Signature); err != nil {
+			return nil, time.Time{}, ErrSignatureMismatch
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, sum, si.Signature) {
+			return nil, time.Time{}, ErrSignatureMismatch
+		}
+	default:
+		return nil, time.Time{}, ErrCertificateTypeUnsupported
+	}
+
+	chain := []*x509.Certificate{signer}
+	for _, c := range certs {
+		if c != signer {
+			chain = append(chain, c)
+		}
+	}
+
+	return chain, signingTime, nil
+}
+
+// cmsSigner returns the certificate identified by the signer identifier, either an issuer and serial number or a
+// [0] tagged subject key identifier.
+func cmsSigner(sid asn1.RawValue, certs []*x509.Certificate) *x509.Certificate {
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, c := range certs {
+			if bytes.Equal(c.SubjectKeyId, sid.Bytes) {
+				return c
+			}
+		}
+		return nil
+	}
+
+	var ias cmsIssuerAndSerial
+	if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+		return nil
+	}
+	for _, c := range certs {
+		if bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) && c.SerialNumber.Cmp(ias.Serial) == 0 {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func cmsDigestHash(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, nil
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	default:
+		return 0, ErrChecksumUnsupported
+	}
+}
@@ -0,0 +1,127 @@
+package xar
+
+import (
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The archives in testdata hold one file, hello.txt, and are signed by a leaf certificate valid through 2021, issued
+// by an intermediate of root.pem, on 2021-06-01 12:00 UTC. rsa.xar has a classic RSA signature, cms-ski.xar a CMS
+// x-signature identifying its signer by subject key identifier and cms-serial.xar both, its CMS signer identified by
+// issuer and serial number. The signatures of rsa-tampered.xar and cms-tampered.xar were made over the TOC checksum of
+// another archive, while the messageDigest attribute of cms-bad-digest.xar does not match the TOC checksum.
+// other-root.pem is a root with the same subject as root.pem and a different key, and unsigned.xar is not signed.
+
+var signingTime = time.Date(2021, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+func readRoots(t *testing.T, name string) *x509.CertPool {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(b) {
+		t.Fatalf("no certificates in %s", name)
+	}
+	return roots
+}
+
+func openTestdata(t *testing.T, name string) *Reader {
+	t.Helper()
+	r, err := OpenReader(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	return r
+}
+
+func TestVerify(t *testing.T) {
+	roots := readRoots(t, "root.pem")
+
+	tests := []struct {
+		name      string
+		file      string
+		opts      VerifyOptions
+		want      error
+		wantStyle string
+	}{
+		{"rsa", "rsa.xar", VerifyOptions{Roots: roots}, nil, ""},
+		{"cms subject key id", "cms-ski.xar", VerifyOptions{Roots: roots}, nil, ""},
+		{"cms issuer and serial", "cms-serial.xar", VerifyOptions{Roots: roots}, nil, ""},
+		{"rsa tampered", "rsa-tampered.xar", VerifyOptions{Roots: roots}, ErrSignatureMismatch, "RSA"},
+		{"cms tampered", "cms-tampered.xar", VerifyOptions{Roots: roots}, ErrSignatureMismatch, "CMS"},
+		{"cms message digest", "cms-bad-digest.xar", VerifyOptions{Roots: roots}, ErrSignatureMismatch, "CMS"},
+		{"rsa untrusted root", "rsa.xar", VerifyOptions{Roots: readRoots(t, "other-root.pem")}, ErrUntrustedChain, "RSA"},
+		{"cms untrusted root", "cms-ski.xar", VerifyOptions{Roots: readRoots(t, "other-root.pem")}, ErrUntrustedChain, "CMS"},
+		{"rsa no roots", "rsa.xar", VerifyOptions{Roots: x509.NewCertPool()}, ErrUntrustedChain, "RSA"},
+		{"unsigned", "unsigned.xar", VerifyOptions{Roots: roots}, ErrNotSigned, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := openTestdata(t, tt.file)
+			defer r.Close()
+
+			err := r.Verify(tt.opts)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got error %v, want %v", err, tt.want)
+			}
+			var verr *VerificationError
+			if errors.As(err, &verr) != (tt.wantStyle != "") || (verr != nil && verr.Style != tt.wantStyle) {
+				t.Errorf("got error %#v, want a %s signature error", err, tt.wantStyle)
+			}
+		})
+	}
+}
+
+// TestVerifyTime checks the chain is validated at the time the archive was signed, the leaf having expired since,
+// unless another time is given.
+func TestVerifyTime(t *testing.T) {
+	roots := readRoots(t, "root.pem")
+	expired := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return expired }
+
+	for _, file := range []string{"rsa.xar", "cms-ski.xar"} {
+		t.Run(file, func(t *testing.T) {
+			r := openTestdata(t, file)
+			defer r.Close()
+
+			if err := r.Verify(VerifyOptions{Roots: roots, Clock: clock}); err != nil {
+				t.Errorf("at the signing time: %v", err)
+			}
+			if err := r.Verify(VerifyOptions{Roots: roots, CurrentTime: expired}); !errors.Is(err, ErrUntrustedChain) {
+				t.Errorf("after the leaf expired: got error %v, want %v", err, ErrUntrustedChain)
+			}
+			if err := r.Verify(VerifyOptions{Roots: roots, CurrentTime: signingTime.AddDate(-1, 0, 0)}); !errors.Is(err, ErrUntrustedChain) {
+				t.Errorf("before the leaf was issued: got error %v, want %v", err, ErrUntrustedChain)
+			}
+		})
+	}
+
+	r := openTestdata(t, "rsa.xar")
+	defer r.Close()
+	if info := r.SignatureInfo(); info == nil || !info.CreationTime.Equal(signingTime) {
+		t.Errorf("got signature %+v, want one created at %v", info, signingTime)
+	}
+}
+
+func TestVerifyCMSSigningTime(t *testing.T) {
+	r := openTestdata(t, "cms-ski.xar")
+	defer r.Close()
+
+	certs, at, err := verifyCMS(r.cmsSignature, r.tocChecksum)
+	if err != nil {
+		t.Fatalf("verifyCMS: %v", err)
+	}
+	if !at.Equal(signingTime) {
+		t.Errorf("got signing time %v, want %v", at, signingTime)
+	}
+	if len(certs) != 3 || certs[0].Subject.CommonName != "Developer ID Installer: manifestgo test" {
+		t.Errorf("got %d certificates, want 3 with the signer first", len(certs))
+	}
+}
@@ -10,6 +10,7 @@
 package xar
 
 import (
+	"bufio"
 	"bytes"
 	"compress/bzip2"
 	"compress/zlib"
@@ -18,12 +19,14 @@ import (
 	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"hash"
 	"io"
 	"io/ioutil"
@@ -32,6 +35,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/dbyington/manifestgo/internal/lzma"
 )
 
 var (
@@ -43,18 +48,33 @@ var (
 	ErrChecksumUnsupported  = errors.New("xar: unsupported checksum type")
 	ErrChecksumTypeMismatch = errors.New("xar: header and toc checksum type mismatch")
 	ErrChecksumMismatch     = errors.New("xar: checksum mismatch")
+	ErrNoFileChecksum       = errors.New("xar: no checksum")
 
 	ErrNoCertificates             = errors.New("xar: no certificates stored in xar")
 	ErrCertificateTypeMismatch    = errors.New("xar: certificate type and public key type mismatch")
 	ErrCertificateTypeUnsupported = errors.New("xar: unsupported certificate type")
 
 	ErrFileEncodingUnsupported = errors.New("xar: unsupported file encoding")
+	ErrBadHeapExtent           = errors.New("xar: heap extent out of range")
+
+	ErrTOCTooLarge   = errors.New("xar: TOC too large")
+	ErrTooManyFiles  = errors.New("xar: too many files in TOC")
+	ErrFileTooLarge  = errors.New("xar: file too large")
+	ErrBadFileLength = errors.New("xar: bad file length")
 )
 
 const xarVersion = 1
 const xarHeaderMagic = 0x78617221 // 'xar!'
 const xarHeaderSize = 28
 
+// xarChecksumNameSize is the size of the checksum name following the header when the checksum kind is
+// xarChecksumKindOther.
+const xarChecksumNameSize = 36
+
+// maxBufferedExtent is the largest heap extent read with a single ReadAt. Larger files are read in pieces of this
+// size, which keeps the number of requests low when the archive is read over HTTP.
+const maxBufferedExtent = 1 << 20
+
 type xarHeader struct {
 	magic         uint32
 	size          uint16
@@ -68,6 +88,7 @@ const (
 	xarChecksumKindNone = iota
 	xarChecksumKindSHA1
 	xarChecksumKindMD5
+	xarChecksumKindOther
 )
 
 type FileType int
@@ -87,6 +108,8 @@ type FileChecksumKind int
 const (
 	FileChecksumKindSHA1 FileChecksumKind = iota
 	FileChecksumKindMD5
+	FileChecksumKindSHA256
+	FileChecksumKindSHA512
 )
 
 type FileInfo struct {
@@ -107,12 +130,37 @@ type FileChecksum struct {
 	Sum  []byte
 }
 
+// newHash returns a hash of the kind of the checksum, ErrNoFileChecksum if there is none and ErrChecksumUnsupported if
+// its kind is not supported.
+func (c FileChecksum) newHash() (hash.Hash, error) {
+	if len(c.Sum) == 0 {
+		return nil, ErrNoFileChecksum
+	}
+
+	switch c.Kind {
+	case FileChecksumKindSHA1:
+		return sha1.New(), nil
+	case FileChecksumKindMD5:
+		return md5.New(), nil
+	case FileChecksumKindSHA256:
+		return sha256.New(), nil
+	case FileChecksumKindSHA512:
+		return sha512.New(), nil
+	}
+
+	return nil, ErrChecksumUnsupported
+}
+
 type File struct {
 	Type FileType
 	Info FileInfo
 	Id   uint64
 	Name string
 
+	// ExtendedAttributes are the extended attributes archived with the file, such as com.apple.quarantine. Only the
+	// files returned by Files have them.
+	ExtendedAttributes []*ExtendedAttribute
+
 	EncodingMimetype   string
 	CompressedChecksum FileChecksum
 	ExtractedChecksum  FileChecksum
@@ -122,6 +170,37 @@ type File struct {
 	offset int64
 	length int64
 	heap   io.ReaderAt
+	// maxSize is the most Open decompresses, or 0 for no limit.
+	maxSize int64
+}
+
+// ExtendedAttribute is an extended attribute of a file, its value stored in the heap like the content of a file.
+type ExtendedAttribute struct {
+	Name string
+	// Size is the size of the value once decompressed.
+	Size             int64
+	EncodingMimetype string
+
+	offset int64
+	length int64
+	heap   io.ReaderAt
+}
+
+// Value reads and decompresses the value of the attribute, of at most maxSize bytes, returning ErrFileTooLarge for a
+// larger one.
+func (ea *ExtendedAttribute) Value(maxSize int64) ([]byte, error) {
+	if ea.Size > maxSize {
+		return nil, ErrFileTooLarge
+	}
+
+	f := &File{EncodingMimetype: ea.EncodingMimetype, offset: ea.offset, length: ea.length, heap: ea.heap, maxSize: maxSize}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return ioutil.ReadAll(rc)
 }
 
 type ReaderAtCloser interface {
@@ -129,6 +208,8 @@ type ReaderAtCloser interface {
 	//io.Closer
 }
 
+// Reader reads the TOC of an archive. Only the header, the TOC and the heap extents of its checksum and signature are
+// read by NewReader; the contents of a File are read from the heap, an extent at a time, when it is opened.
 type Reader struct {
 	File map[uint64]*File
 
@@ -136,10 +217,23 @@ type Reader struct {
 	SignatureCreationTime int64
 	SignatureError        error
 
+	signatureStyle     string
+	signatureAlgorithm x509.SignatureAlgorithm
+
+	tocChecksum  []byte
+	tocHash      crypto.Hash
+	cmsSignature []byte
+
+	// Warnings are the irregularities recovered from when reading in lenient mode.
+	Warnings []string
+	lenient  bool
+	limits   Limits
+
 	xar        ReaderAtCloser
 	size       int64
 	heapOffset int64
 	hash       hash.Hash
+	toc        []*xmlFile
 }
 
 // OpenReader will open the XAR file specified by name and return a Reader.
@@ -157,13 +251,68 @@ func OpenReader(name string) (*Reader, error) {
 	return NewReader(f, info.Size())
 }
 
+// Defaults for the fields of Limits.
+const (
+	DefaultMaxTOCSize  = 32 << 20
+	DefaultMaxFiles    = 100000
+	DefaultMaxFileSize = 16 << 20
+
+	DefaultMaxDecompressedSize = 4 << 30
+)
+
+// Limits bound the memory a Reader uses, so an archive from an untrusted source cannot exhaust it. A zero field uses
+// its default.
+type Limits struct {
+	// MaxTOCSize is the largest TOC accepted, both compressed and uncompressed.
+	MaxTOCSize int64
+	// MaxFiles is the largest number of files accepted in the TOC.
+	MaxFiles int
+	// MaxFileSize is the largest uncompressed size accepted for a file the Reader reads, such as the Distribution.
+	// Decompressing one stops with ErrFileTooLarge past it, whatever size the file declares.
+	MaxFileSize int64
+	// MaxDecompressedSize is the most a file listed by Files, such as a payload, decompresses to before reading it
+	// fails with ErrFileTooLarge.
+	MaxDecompressedSize int64
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxTOCSize <= 0 {
+		l.MaxTOCSize = DefaultMaxTOCSize
+	}
+	if l.MaxFiles <= 0 {
+		l.MaxFiles = DefaultMaxFiles
+	}
+	if l.MaxFileSize <= 0 {
+		l.MaxFileSize = DefaultMaxFileSize
+	}
+	if l.MaxDecompressedSize <= 0 {
+		l.MaxDecompressedSize = DefaultMaxDecompressedSize
+	}
+	return l
+}
+
+// ReaderOptions configures NewReaderWithOptions.
+type ReaderOptions struct {
+	// Lenient recovers from irregularities some vendor tools leave in the TOC, such as duplicate file ids, missing
+	// checksums and zero length entries, recording a warning in the Reader's Warnings instead of failing.
+	Lenient bool
+	Limits  Limits
+}
+
 // NewReader returns a new reader reading from r, which is assumed to have the given size in bytes.
 func NewReader(r ReaderAtCloser, size int64) (*Reader, error) {
+	return NewReaderWithOptions(r, size, ReaderOptions{})
+}
+
+// NewReaderWithOptions returns a new reader reading from r, which is assumed to have the given size in bytes.
+func NewReaderWithOptions(r ReaderAtCloser, size int64, opts ReaderOptions) (*Reader, error) {
 	xr := &Reader{
-		File: make(map[uint64]*File),
-		xar:  r,
-		size: size,
-		hash: sha256.New(),
+		File:    make(map[uint64]*File),
+		xar:     r,
+		size:    size,
+		hash:    sha256.New(),
+		lenient: opts.Lenient,
+		limits:  opts.Limits.withDefaults(),
 	}
 
 	hdr := make([]byte, xarHeaderSize)
@@ -188,15 +337,33 @@ func NewReader(r ReaderAtCloser, size int64) (*Reader, error) {
 		return nil, ErrBadVersion
 	}
 
-	if xh.size != xarHeaderSize {
+	if xh.size < xarHeaderSize {
 		return nil, ErrBadHeaderSize
 	}
 
-	ztoc := make([]byte, xh.toc_len_zlib)
-	_, err = xr.xar.ReadAt(ztoc, xarHeaderSize)
-	if err != nil {
+	if xh.toc_len_zlib > uint64(xr.limits.MaxTOCSize) || xh.toc_len_plain > uint64(xr.limits.MaxTOCSize) {
+		return nil, ErrTOCTooLarge
+	}
+	if int64(xh.size)+int64(xh.toc_len_zlib) > size {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	// The rest of the header and the TOC are read together.
+	rest := make([]byte, int64(xh.size)-xarHeaderSize+int64(xh.toc_len_zlib))
+	if err := readFullAt(xr.xar, rest, xarHeaderSize); err != nil {
 		return nil, err
 	}
+	ztoc := rest[int(xh.size)-xarHeaderSize:]
+
+	// Newer archives store the name of the checksum in a larger header when it is not sha1 or md5.
+	var checksumName string
+	if xh.checksum_kind == xarChecksumKindOther && xh.size >= xarHeaderSize+xarChecksumNameSize {
+		name := rest[:xarChecksumNameSize]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		checksumName = string(name)
+	}
 
 	br := bytes.NewBuffer(ztoc)
 	zr, err := zlib.NewReader(br)
@@ -204,89 +371,136 @@ func NewReader(r ReaderAtCloser, size int64) (*Reader, error) {
 		return nil, err
 	}
 
+	// The uncompressed length in the header is not trusted, the TOC is decoded as it is decompressed, up to the limit.
 	root := &xmlXar{}
-	decoder := xml.NewDecoder(zr)
+	decoder := xml.NewDecoder(&cappedReader{r: zr, n: xr.limits.MaxTOCSize, err: ErrTOCTooLarge})
 	decoder.Strict = false
 	err = decoder.Decode(root)
 	if err != nil {
 		return nil, err
 	}
 
-	xr.heapOffset = xarHeaderSize + int64(xh.toc_len_zlib)
+	if countFiles(root.Toc.File) > xr.limits.MaxFiles {
+		return nil, ErrTooManyFiles
+	}
 
-	if root.Toc.Checksum == nil {
+	xr.heapOffset = int64(xh.size) + int64(xh.toc_len_zlib)
+
+	if root.Toc.Checksum != nil {
+		if err := xr.verifyTOC(root, xh, checksumName, ztoc); err != nil {
+			return nil, err
+		}
+	} else if xr.lenient {
+		xr.warn("no TOC checksum, the TOC and any signature were not verified")
+	} else {
 		return nil, ErrNoTOCChecksum
 	}
 
+	xr.toc = root.Toc.File
+
+	// Add files to Reader
+	for _, xmlFile := range root.Toc.File {
+		switch xmlFile.Name {
+		// Grab only the Distribution or PackageInfo files
+		case "Distribution", "PackageInfo":
+			err := xr.readXmlFileTree(xmlFile, "")
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return xr, nil
+}
+
+// countFiles returns the number of files in the tree.
+func countFiles(files []*xmlFile) int {
+	n := len(files)
+	for _, f := range files {
+		n += countFiles(f.File)
+	}
+	return n
+}
+
+func (r *Reader) warn(format string, a ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, a...))
+}
+
+// verifyTOC checks the TOC checksum and reads the signatures over it.
+func (r *Reader) verifyTOC(root *xmlXar, xh *xarHeader, checksumName string, ztoc []byte) error {
 	// Check whether the XAR checksum matches
-	storedsum := make([]byte, root.Toc.Checksum.Size)
-	_, err = io.ReadFull(io.NewSectionReader(xr.xar, xr.heapOffset+root.Toc.Checksum.Offset, root.Toc.Checksum.Size), storedsum)
+	storedsum, signature, xsignature, err := r.readTOCExtents(&root.Toc)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var hasher hash.Hash
 	switch xh.checksum_kind {
-	case xarChecksumKindNone:
-		return nil, ErrChecksumUnsupported
 	case xarChecksumKindSHA1:
-		if root.Toc.Checksum.Style != "sha1" {
-			return nil, ErrChecksumTypeMismatch
-		}
-		hasher = sha1.New()
+		checksumName = "sha1"
 	case xarChecksumKindMD5:
-		if root.Toc.Checksum.Style != "md5" {
-			return nil, ErrChecksumTypeMismatch
+		checksumName = "md5"
+	case xarChecksumKindOther:
+		if checksumName == "" {
+			checksumName = root.Toc.Checksum.Style
 		}
-		hasher = md5.New()
 	default:
-		return nil, ErrChecksumUnsupported
+		return ErrChecksumUnsupported
+	}
+
+	if !strings.EqualFold(root.Toc.Checksum.Style, checksumName) {
+		return ErrChecksumTypeMismatch
 	}
 
+	tocHash, err := checksumHash(checksumName)
+	if err != nil {
+		return err
+	}
+
+	hasher := tocHash.New()
 	hasher.Write(ztoc)
 	calcedsum := hasher.Sum(nil)
 
 	if !bytes.Equal(calcedsum, storedsum) {
-		return nil, ErrChecksumMismatch
+		return ErrChecksumMismatch
 	}
 
-	// Ignore error. The method automatically sets xr.SignatureError with
-	// the returned error.
-	_ = xr.readAndVerifySignature(root, xh.checksum_kind, calcedsum)
+	r.tocChecksum = calcedsum
+	r.tocHash = tocHash
+	r.cmsSignature = xsignature
 
-	// Add files to Reader
-	for _, xmlFile := range root.Toc.File {
-		switch xmlFile.Name {
-		// Grab only the Distribution or PackageInfo files
-		case "Distribution", "PackageInfo":
-			err := xr.readXmlFileTree(xmlFile, "")
-			if err != nil {
-				return nil, err
-			}
-		}
-	}
+	// Ignore error. The method automatically sets r.SignatureError with
+	// the returned error.
+	_ = r.readAndVerifySignature(root, tocHash, calcedsum, signature)
 
-	return xr, nil
+	return nil
 }
 
 // Reads signature information from the xmlXar element into
 // the Reader. Also attempts to verify any signatures found.
-func (r *Reader) readAndVerifySignature(root *xmlXar, checksumKind uint32, checksum []byte) (err error) {
+func (r *Reader) readAndVerifySignature(root *xmlXar, sighash crypto.Hash, checksum, signature []byte) (err error) {
 	defer func() {
 		r.SignatureError = err
 	}()
 
 	// Check if there's a signature ...
-	r.SignatureCreationTime = root.Toc.SignatureCreationTime
+	r.SignatureCreationTime = int64(root.Toc.SignatureCreationTime)
 	if root.Toc.Signature != nil {
-		if len(root.Toc.Signature.Certificates) == 0 {
-			return ErrNoCertificates
+		r.signatureStyle = root.Toc.Signature.Style
+		if root.Toc.Signature.Style == "RSA" {
+			switch sighash {
+			case crypto.SHA1:
+				r.signatureAlgorithm = x509.SHA1WithRSA
+			case crypto.MD5:
+				r.signatureAlgorithm = x509.MD5WithRSA
+			case crypto.SHA256:
+				r.signatureAlgorithm = x509.SHA256WithRSA
+			case crypto.SHA512:
+				r.signatureAlgorithm = x509.SHA512WithRSA
+			}
 		}
 
-		signature := make([]byte, root.Toc.Signature.Size)
-		_, err = r.xar.ReadAt(signature, r.heapOffset+root.Toc.Signature.Offset)
-		if err != nil {
-			return err
+		if len(root.Toc.Signature.Certificates) == 0 {
+			return ErrNoCertificates
 		}
 
 		// Read certificates
@@ -313,24 +527,13 @@ func (r *Reader) readAndVerifySignature(root *xmlXar, checksumKind uint32, check
 			}
 		}
 
-		var sighash crypto.Hash
-		switch checksumKind {
-		case xarChecksumKindNone:
-			return ErrChecksumUnsupported
-		case xarChecksumKindSHA1:
-			sighash = crypto.SHA1
-		case xarChecksumKindMD5:
-			sighash = crypto.MD5
-		}
-
 		if root.Toc.Signature.Style == "RSA" {
 			pubkey, ok := r.Certificates[0].PublicKey.(*rsa.PublicKey)
 			if !ok {
 				return ErrCertificateTypeMismatch
 			}
-			err = rsa.VerifyPKCS1v15(pubkey, sighash, checksum, signature)
-			if err != nil {
-				return err
+			if err := rsa.VerifyPKCS1v15(pubkey, sighash, checksum, signature); err != nil {
+				return ErrSignatureMismatch
 			}
 		} else {
 			return ErrCertificateTypeUnsupported
@@ -340,6 +543,117 @@ func (r *Reader) readAndVerifySignature(root *xmlXar, checksumKind uint32, check
 	return nil
 }
 
+// readTOCExtents reads the heap extents of the TOC checksum and of the signatures, if there are any. They usually sit
+// next to each other at the start of the heap, so they are read with a single ReadAt when they are close. A nil
+// signature is returned for one that is not in the TOC.
+func (r *Reader) readTOCExtents(toc *xmlToc) (checksum, signature, xsignature []byte, err error) {
+	heapSize := r.size - r.heapOffset
+	if !validExtent(toc.Checksum.Offset, toc.Checksum.Size, heapSize) {
+		return nil, nil, nil, ErrBadHeapExtent
+	}
+
+	start, end := toc.Checksum.Offset, toc.Checksum.Offset+toc.Checksum.Size
+	for _, s := range []*xmlSignature{toc.Signature, toc.XSignature} {
+		if s == nil {
+			continue
+		}
+		if !validExtent(s.Offset, s.Size, heapSize) {
+			return nil, nil, nil, ErrBadHeapExtent
+		}
+		if s.Offset < start {
+			start = s.Offset
+		}
+		if s.Offset+s.Size > end {
+			end = s.Offset + s.Size
+		}
+	}
+
+	var span []byte
+	if end-start <= maxBufferedExtent {
+		span = make([]byte, end-start)
+		if err := readFullAt(r.xar, span, r.heapOffset+start); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	extent := func(offset, size int64) ([]byte, error) {
+		if span != nil {
+			return span[offset-start : offset-start+size], nil
+		}
+		b := make([]byte, size)
+		return b, readFullAt(r.xar, b, r.heapOffset+offset)
+	}
+
+	if checksum, err = extent(toc.Checksum.Offset, toc.Checksum.Size); err != nil {
+		return nil, nil, nil, err
+	}
+	if s := toc.Signature; s != nil {
+		if signature, err = extent(s.Offset, s.Size); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if s := toc.XSignature; s != nil {
+		if xsignature, err = extent(s.Offset, s.Size); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return checksum, signature, xsignature, nil
+}
+
+// validExtent reports whether the extent at offset of size bytes lies within a heap of heapSize bytes.
+func validExtent(offset, size, heapSize int64) bool {
+	return offset >= 0 && size >= 0 && offset <= heapSize && size <= heapSize-offset
+}
+
+// readFullAt fills b from r at off. Unlike ReadAt it does not fail when b ends at the end of r.
+func readFullAt(r io.ReaderAt, b []byte, off int64) error {
+	n, err := r.ReadAt(b, off)
+	if n == len(b) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// xarEpoch is the time SignatureCreationTime counts seconds from.
+var xarEpoch = time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// SignatureInfo describes the signature stored in the TOC of an archive.
+type SignatureInfo struct {
+	// Style is the style attribute of the signature element, "RSA" for a classic xar signature.
+	Style string
+	// Algorithm is the algorithm the TOC checksum was signed with, or x509.UnknownSignatureAlgorithm if the
+	// style is not one this package can verify.
+	Algorithm x509.SignatureAlgorithm
+	// Certificates is the certificate chain of the signature, leaf first.
+	Certificates []*x509.Certificate
+	CreationTime time.Time
+	// Error is the reason the signature could not be verified, nil if it was.
+	Error error
+}
+
+// SignatureInfo returns the signature of the archive, or nil if it is not signed.
+func (r *Reader) SignatureInfo() *SignatureInfo {
+	if r.signatureStyle == "" {
+		return nil
+	}
+
+	info := &SignatureInfo{
+		Style:        r.signatureStyle,
+		Algorithm:    r.signatureAlgorithm,
+		Certificates: r.Certificates,
+		Error:        r.SignatureError,
+	}
+	if r.SignatureCreationTime > 0 {
+		info.CreationTime = xarEpoch.Add(time.Duration(r.SignatureCreationTime) * time.Second)
+	}
+
+	return info
+}
+
 // Close closes the opened XAR file.
 func (r *Reader) Close() error {
 	//return r.xar.Close()
@@ -412,7 +726,14 @@ func xmlFileToFileInfo(xmlFile *xmlFile) (fi FileInfo, err error) {
 	fi.User = xmlFile.User
 	fi.Uid = xmlFile.Uid
 
-	fi.Mode = xmlFile.Mode
+	// The mode is written in octal, such as 0644.
+	if xmlFile.Mode != "" {
+		var mode uint64
+		if mode, err = strconv.ParseUint(xmlFile.Mode, 8, 32); err != nil {
+			return
+		}
+		fi.Mode = uint32(mode)
+	}
 
 	fi.Inode = xmlFile.Inode
 	fi.DeviceNo = xmlFile.DeviceNo
@@ -420,8 +741,28 @@ func xmlFileToFileInfo(xmlFile *xmlFile) (fi FileInfo, err error) {
 	return
 }
 
+// checksumHash returns the hash of a TOC checksum style.
+func checksumHash(style string) (crypto.Hash, error) {
+	switch strings.ToLower(style) {
+	case "sha1":
+		return crypto.SHA1, nil
+	case "md5":
+		return crypto.MD5, nil
+	case "sha256":
+		return crypto.SHA256, nil
+	case "sha512":
+		return crypto.SHA512, nil
+	default:
+		return 0, ErrChecksumUnsupported
+	}
+}
+
 // Convert a xmlFileChecksum to a FileChecksum.
 func fileChecksumFromXml(f *FileChecksum, x *xmlFileChecksum) (err error) {
+	if x.Style == "" && x.Digest == "" {
+		return ErrNoFileChecksum
+	}
+
 	f.Sum, err = hex.DecodeString(x.Digest)
 	if err != nil {
 		return
@@ -432,6 +773,10 @@ func fileChecksumFromXml(f *FileChecksum, x *xmlFileChecksum) (err error) {
 		f.Kind = FileChecksumKindMD5
 	case "SHA1":
 		f.Kind = FileChecksumKindSHA1
+	case "SHA256":
+		f.Kind = FileChecksumKindSHA256
+	case "SHA512":
+		f.Kind = FileChecksumKindSHA512
 	default:
 		return ErrChecksumUnsupported
 	}
@@ -446,7 +791,7 @@ func (r *Reader) newHeapReader() *io.SectionReader {
 
 // Reads the file tree from a parse XAR TOC into the Reader.
 func (r *Reader) readXmlFileTree(xmlFile *xmlFile, dir string) (err error) {
-	xf := &File{}
+	xf := &File{maxSize: r.limits.MaxFileSize}
 	xf.heap = r.newHeapReader()
 
 	if xmlFile.Type == "file" {
@@ -457,13 +802,21 @@ func (r *Reader) readXmlFileTree(xmlFile *xmlFile, dir string) (err error) {
 		return
 	}
 
+	xf.Name = path.Join(dir, xmlFile.Name)
+
 	xf.Id, err = strconv.ParseUint(xmlFile.Id, 10, 0)
+	if err == nil && r.File[xf.Id] != nil {
+		err = fmt.Errorf("xar: duplicate file id %d", xf.Id)
+	}
 	if err != nil {
-		return
+		if !r.lenient {
+			return
+		}
+		xf.Id = r.freeFileId()
+		r.warn("%s: %v, using id %d", xf.Name, err, xf.Id)
+		err = nil
 	}
 
-	xf.Name = path.Join(dir, xmlFile.Name)
-
 	xf.Info, err = xmlFileToFileInfo(xmlFile)
 	if err != nil {
 		return
@@ -478,15 +831,39 @@ func (r *Reader) readXmlFileTree(xmlFile *xmlFile, dir string) (err error) {
 		xf.length = xmlFile.Data.Length
 		xf.offset = xmlFile.Data.Offset
 
+		if xf.Size < 0 || xf.length < 0 || !validExtent(xf.offset, xf.length, r.size-r.heapOffset) {
+			return ErrBadFileLength
+		}
+		if xf.Size > r.limits.MaxFileSize {
+			return ErrFileTooLarge
+		}
+
 		err = fileChecksumFromXml(&xf.CompressedChecksum, &xmlFile.Data.ArchivedChecksum)
+		if err != nil && r.lenient {
+			r.warn("%s: archived checksum: %v", xf.Name, err)
+			// A checksum that could not be read is no checksum, so Verify says so and not that it differs.
+			xf.CompressedChecksum = FileChecksum{}
+			err = nil
+		}
 		if err != nil {
 			return
 		}
 
 		err = fileChecksumFromXml(&xf.ExtractedChecksum, &xmlFile.Data.ExtractedChecksum)
+		if err != nil && r.lenient {
+			r.warn("%s: extracted checksum: %v", xf.Name, err)
+			err = nil
+		}
 		if err != nil {
 			return
 		}
+
+		// An empty entry has nothing for a decompressor to read, whatever its encoding says.
+		if xf.length == 0 && r.lenient && xf.EncodingMimetype != "application/octet-stream" {
+			r.warn("%s: zero length entry", xf.Name)
+			xf.EncodingMimetype = "application/octet-stream"
+			xf.Size = 0
+		}
 	}
 
 	r.File[xf.Id] = xf
@@ -503,10 +880,161 @@ func (r *Reader) readXmlFileTree(xmlFile *xmlFile, dir string) (err error) {
 	return
 }
 
+// Files returns every file, directory, link and special file in the TOC, in the order of the TOC, with a directory
+// before the files in it. Unlike the File map, which only has the files needed to build a manifest, it includes the
+// payloads and scripts of the archive, and the extended attributes of each, for inspecting an archive. The content of
+// a file is only read when it is opened.
+func (r *Reader) Files() ([]*File, error) {
+	var files []*File
+	var walk func(xfs []*xmlFile, dir string) error
+	walk = func(xfs []*xmlFile, dir string) error {
+		for _, x := range xfs {
+			f, err := r.tocFile(x, dir)
+			if err != nil {
+				return err
+			}
+			files = append(files, f)
+			if err := walk(x.File, f.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(r.toc, ""); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// tocFile returns the file of the TOC entry x in dir, with its metadata and extended attributes.
+func (r *Reader) tocFile(x *xmlFile, dir string) (*File, error) {
+	f := &File{
+		Type:    tocFileType(x.Type),
+		Name:    path.Join(dir, x.Name),
+		heap:    r.newHeapReader(),
+		maxSize: r.limits.MaxDecompressedSize,
+	}
+	f.Id, _ = strconv.ParseUint(x.Id, 10, 0)
+
+	var err error
+	if f.Info, err = xmlFileToFileInfo(x); err != nil {
+		return nil, fmt.Errorf("xar: %s: %w", f.Name, err)
+	}
+
+	if x.Data != nil {
+		f.EncodingMimetype = x.Data.Encoding.Style
+		f.Size = x.Data.Size
+		f.length = x.Data.Length
+		f.offset = x.Data.Offset
+		// Checksums a reader could not use when the archive was read are left out rather than failing the listing.
+		if fileChecksumFromXml(&f.CompressedChecksum, &x.Data.ArchivedChecksum) != nil {
+			f.CompressedChecksum = FileChecksum{}
+		}
+		if fileChecksumFromXml(&f.ExtractedChecksum, &x.Data.ExtractedChecksum) != nil {
+			f.ExtractedChecksum = FileChecksum{}
+		}
+	}
+
+	for _, ea := range x.EA {
+		f.ExtendedAttributes = append(f.ExtendedAttributes, &ExtendedAttribute{
+			Name:             ea.Name,
+			Size:             ea.Size,
+			EncodingMimetype: ea.Encoding.Style,
+			offset:           ea.Offset,
+			length:           ea.Length,
+			heap:             f.heap,
+		})
+	}
+
+	return f, nil
+}
+
+// tocFileType returns the FileType of the type of a TOC entry, FileTypeFile for a hard link.
+func tocFileType(t string) FileType {
+	switch t {
+	case "directory":
+		return FileTypeDirectory
+	case "symlink":
+		return FileTypeSymlink
+	case "fifo":
+		return FileTypeFifo
+	case "character special":
+		return FileTypeCharDevice
+	case "block special":
+		return FileTypeBlockDevice
+	case "socket":
+		return FileTypeSocket
+	}
+
+	return FileTypeFile
+}
+
+// freeFileId returns an id not used by any file read so far.
+func (r *Reader) freeFileId() uint64 {
+	var id uint64
+	for i := range r.File {
+		if i >= id {
+			id = i + 1
+		}
+	}
+	return id
+}
+
 // Open returns a ReadCloser that provides access to the file's
-// uncompressed content.
+// uncompressed content. Reading more than the limit of the Reader for the file fails with ErrFileTooLarge, so a
+// decompression bomb is never inflated in full.
 func (f *File) Open() (rc io.ReadCloser, err error) {
-	r := io.NewSectionReader(f.heap, f.offset, f.length)
+	r, err := f.extentReader()
+	if err != nil {
+		return nil, err
+	}
+
+	return f.decode(r)
+}
+
+// ReadVerified reads the uncompressed content of the file, bounded like Open, and checks its archived content against
+// its archived checksum like Verify, hashing it as it is decompressed so the file is read only once. It returns
+// ErrNoFileChecksum or ErrChecksumUnsupported without reading the file when the checksum cannot be checked, and
+// ErrChecksumMismatch when the content differs from it.
+func (f *File) ReadVerified() ([]byte, error) {
+	if f.Type != FileTypeFile {
+		return nil, nil
+	}
+	hasher, err := f.CompressedChecksum.newHash()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := f.extentReader()
+	if err != nil {
+		return nil, err
+	}
+	archived := io.TeeReader(r, hasher)
+
+	var b []byte
+	rc, err := f.decode(archived)
+	if err == nil {
+		b, err = ioutil.ReadAll(rc)
+		rc.Close()
+	}
+	// The decompressor may stop short of the end of the archived content, which is hashed all the same. Content that
+	// could not be decompressed is reported as not matching its checksum when it does not.
+	if _, cerr := io.Copy(ioutil.Discard, archived); cerr != nil && err == nil {
+		return nil, cerr
+	}
+	if !bytes.Equal(hasher.Sum(nil), f.CompressedChecksum.Sum) {
+		return nil, ErrChecksumMismatch
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// decode returns a ReadCloser of the uncompressed content of the file from its archived content read from r.
+func (f *File) decode(r io.Reader) (rc io.ReadCloser, err error) {
 	switch f.EncodingMimetype {
 	case "application/octet-stream":
 		rc = ioutil.NopCloser(r)
@@ -514,41 +1042,132 @@ func (f *File) Open() (rc io.ReadCloser, err error) {
 		rc, err = zlib.NewReader(r)
 	case "application/x-bzip2":
 		rc = ioutil.NopCloser(bzip2.NewReader(r))
+	case "application/x-lzma", "application/x-xz":
+		rc, err = newLZMAReader(r)
 	default:
 		err = ErrFileEncodingUnsupported
 	}
+	if err == nil && f.maxSize > 0 {
+		rc = cappedReadCloser{&cappedReader{r: rc, n: f.maxSize, err: ErrFileTooLarge}, rc}
+	}
 
 	return rc, err
 }
 
+// cappedReader reads from r until more than n bytes are read, returning err from then on rather than reading on.
+type cappedReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	if c.n < 0 {
+		return 0, c.err
+	}
+	if int64(len(p)) > c.n+1 {
+		p = p[:c.n+1]
+	}
+
+	n, err := c.r.Read(p)
+	if c.n -= int64(n); c.n < 0 {
+		return n - 1, c.err
+	}
+
+	return n, err
+}
+
+type cappedReadCloser struct {
+	*cappedReader
+	io.Closer
+}
+
+// extentReader returns a reader over the heap extent of the file. Extents up to maxBufferedExtent are read with a
+// single ReadAt, larger ones in pieces of that size.
+func (f *File) extentReader() (io.Reader, error) {
+	if f.length < 0 || f.offset < 0 {
+		return nil, ErrBadHeapExtent
+	}
+
+	if f.length > maxBufferedExtent {
+		return bufio.NewReaderSize(io.NewSectionReader(f.heap, f.offset, f.length), maxBufferedExtent), nil
+	}
+
+	b := make([]byte, f.length)
+	if err := readFullAt(f.heap, b, f.offset); err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(b), nil
+}
+
+// newLZMAReader returns a reader decompressing an lzma encoded file. xar has labelled both the .xz and the older .lzma
+// format application/x-lzma, so the format is told by its magic.
+func newLZMAReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(lzma.XZMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	r = br
+
+	if bytes.Equal(magic, lzma.XZMagic) {
+		xr, err := lzma.NewXZReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(xr), nil
+	}
+
+	lr, err := lzma.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(lr), nil
+}
+
 // OpenRaw returns a ReadCloser that provides access to the file's
 // raw content. The encoding of the raw content is specified in
 // the File's EncodingMimetype field.
 func (f *File) OpenRaw() (rc io.ReadCloser, err error) {
-	rc = ioutil.NopCloser(io.NewSectionReader(f.heap, f.offset, f.length))
-	return
+	r, err := f.extentReader()
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(r), nil
 }
 
 // Verify that the compressed content of the File in the
 // archive matches the stored checksum.
 func (f *File) VerifyChecksum() bool {
+	return f.Verify() == nil
+}
+
+// Verify checks the compressed content of the File in the archive against its archived checksum, returning
+// ErrNoFileChecksum if the TOC records none and ErrChecksumMismatch if the content differs from it.
+func (f *File) Verify() error {
 	// Non-files are implicitly OK, since all metadata
 	// is stored in the TOC.
 	if f.Type != FileTypeFile {
-		return true
+		return nil
+	}
+	hasher, err := f.CompressedChecksum.newHash()
+	if err != nil {
+		return err
 	}
 
-	var hasher hash.Hash
-	switch f.CompressedChecksum.Kind {
-	case FileChecksumKindSHA1:
-		hasher = sha1.New()
-	case FileChecksumKindMD5:
-		hasher = md5.New()
-	default:
-		return false
+	r, err := f.extentReader()
+	if err != nil {
+		return err
 	}
 
-	io.Copy(hasher, io.NewSectionReader(f.heap, f.offset, f.length))
-	sum := hasher.Sum(nil)
-	return bytes.Equal(sum, f.CompressedChecksum.Sum)
+	if _, err := io.Copy(hasher, r); err != nil {
+		return err
+	}
+	if !bytes.Equal(hasher.Sum(nil), f.CompressedChecksum.Sum) {
+		return ErrChecksumMismatch
+	}
+
+	return nil
 }
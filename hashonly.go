@@ -0,0 +1,85 @@
+package manifestgo
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"os"
+)
+
+// HashOnly reads the package like ReadFromURL but only hashes it, without reading its table of contents, for a file
+// that is not a xar archive, such as a disk image distributed as-is. Nothing is learnt about the package but its
+// hashes and length, so its metadata must be given with SetMetadata or WithMetadata. The Cache is not used.
+func (p *Package) HashOnly() (err error) {
+	if p.reader == nil {
+		return errors.New("no hasher")
+	}
+
+	ctx, span := p.startSpan(context.Background(), SpanReadFromURL)
+	span.SetAttribute("url", p.reader.URL())
+	span.SetAttribute("hash_only", true)
+	defer func() {
+		err = sourceDriftError(err)
+		span.End(err)
+	}()
+
+	if r, ok := p.reader.(hashProgressReporter); ok && p.progress != nil {
+		r.SetHashProgress(func(done, total int) {
+			p.reportProgress(Progress{Stage: StageHashing, Chunk: done, Chunks: total})
+		})
+	}
+
+	_, hashSpan := p.startSpan(ctx, SpanHash)
+	hashSpan.SetAttribute("chunk_size", p.hashChunkSize)
+	hashes, lengths, err := p.hashChunks()
+	hashSpan.SetAttribute("chunks", len(hashes))
+	hashSpan.SetAttribute("reused_chunks", p.reusedChunks)
+	hashSpan.End(err)
+	if err != nil {
+		return err
+	}
+	p.checkFileDigest()
+
+	size := p.reader.Length()
+	if p.hashChunkSize < size {
+		size = p.hashChunkSize
+	}
+
+	p.Size = size
+	p.URL = p.reader.URL()
+	p.Etag = p.reader.Etag()
+	p.ContentLength = p.reader.Length()
+	p.Hashes = append(p.Hashes, hashes...)
+	p.chunkLengths = lengths
+
+	return nil
+}
+
+// HashFile hashes the file name like ReadPkgFile but does not parse it, for a file that is not a xar archive. As with
+// HashOnly, its metadata must be given with SetMetadata.
+func HashFile(name string) (*Package, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fstat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	shaSum, err := Sha256SumReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Package{
+		Hashes:        []hash.Hash{shaSum},
+		Size:          fstat.Size(),
+		ContentLength: fstat.Size(),
+		hashType:      sha256.Size,
+	}, nil
+}
@@ -0,0 +1,274 @@
+package httpio
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultParallelism is how many chunks Download fetches at once if WithParallelism is not given.
+	DefaultParallelism = 4
+	// DefaultRetries is how many times Download retries a chunk if WithRetries is not given.
+	DefaultRetries = 3
+)
+
+// retryBackoff is how long Download waits before the first retry of a chunk, doubling for each retry after it.
+var retryBackoff = time.Second
+
+var (
+	ErrDownloadHashMismatch = errors.New("httpio: downloaded file does not match the expected hashes")
+	ErrDownloadChanged      = errors.New("httpio: file changed since the download started")
+)
+
+// WithParallelism sets how many chunks Download fetches at once.
+func WithParallelism(n int) Option {
+	return func(r *ReadAtCloser) {
+		r.parallelism = n
+	}
+}
+
+// WithRetries sets how many times Download retries a chunk that failed to download or did not match its hash.
+func WithRetries(n int) Option {
+	return func(r *ReadAtCloser) {
+		r.retries = n
+	}
+}
+
+// WithExpectedHashes sets the hex digests Download checks the chunks of the file against, with the hash whose sum is
+// size bytes, md5.Size or sha256.Size, such as the hashes of an asset of a manifest. The chunks are those of
+// WithHashChunkSize, which must be the chunk size the digests were made with.
+func WithExpectedHashes(size uint, digests []string) Option {
+	return func(r *ReadAtCloser) {
+		r.expectedHashSize = size
+		r.expectedDigests = digests
+	}
+}
+
+// downloadState records the chunks of a download written to its partial file, so an interrupted download resumes
+// where it stopped while the file is unchanged.
+type downloadState struct {
+	Etag          string `json:"etag"`
+	ContentLength int64  `json:"content_length"`
+	ChunkSize     int64  `json:"chunk_size"`
+	Done          []bool `json:"done"`
+}
+
+// Download fetches the file at url to path with range requests for each chunk, several at once, retrying a chunk that
+// fails, and returns the SHA-256 of the file. The file is written to path with a .part suffix until it is complete,
+// and what was written is recorded beside it, so a download interrupted by an error or a killed process resumes from
+// the chunks it had, as long as the Etag and length of the file are the same. The file is read back from disk and
+// hashed before it is renamed to path. Only its Etag and length are checked against the server, so the content is
+// verified only with WithExpectedHashes, which checks every chunk as it is downloaded and again from disk, or by the
+// caller comparing the returned SHA-256 with a known one. It takes the options of NewReadAtCloser.
+func Download(ctx context.Context, url, path string, opts ...Option) ([]byte, error) {
+	r, err := NewReadAtCloser(append(opts, WithContext(ctx), WithURL(url))...)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if r.parallelism < 1 {
+		r.parallelism = 1
+	}
+
+	chunks := int((r.contentLength + r.hashChunkSize - 1) / r.hashChunkSize)
+	if r.expectedDigests != nil && len(r.expectedDigests) != chunks {
+		return nil, fmt.Errorf("%w: %d expected hashes for %d chunks of %d bytes", ErrDownloadHashMismatch, len(r.expectedDigests), chunks, r.hashChunkSize)
+	}
+
+	part, statePath := path+".part", path+".part.json"
+	state := loadDownloadState(statePath, r.etag, r.contentLength, r.hashChunkSize, chunks)
+
+	f, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := f.Truncate(r.contentLength); err != nil {
+		return nil, err
+	}
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	todo := make(chan int)
+	for w := 0; w < r.parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, r.hashChunkSize)
+			for i := range todo {
+				err := r.downloadChunk(ctx, f, buf, i)
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("chunk %d: %w", i, err)
+				}
+				if err == nil {
+					state.Done[i] = true
+					// The state is only a hint for resuming, so failing to save it does not fail the download.
+					_ = saveDownloadState(statePath, state)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i, done := range state.Done {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		if !done {
+			todo <- i
+		}
+	}
+	close(todo)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if etag, length, err := r.Head(); err != nil {
+		return nil, err
+	} else if length != r.contentLength || etag != r.etag {
+		os.Remove(statePath)
+		return nil, fmt.Errorf("%w: %s", ErrDownloadChanged, url)
+	}
+
+	sum, err := r.hashFile(f)
+	if err != nil {
+		// Start over next time rather than resume from chunks that are wrong.
+		os.Remove(statePath)
+		return nil, err
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(part, path); err != nil {
+		return nil, err
+	}
+	os.Remove(statePath)
+
+	return sum, nil
+}
+
+// downloadChunk fetches chunk i into buf and writes it to f, retrying with a growing backoff.
+func (r *ReadAtCloser) downloadChunk(ctx context.Context, f *os.File, buf []byte, i int) error {
+	off := int64(i) * r.hashChunkSize
+	n := r.hashChunkSize
+	if rest := r.contentLength - off; rest < n {
+		n = rest
+	}
+
+	var err error
+	for attempt := 0; attempt <= r.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryBackoff << (attempt - 1)):
+			}
+		}
+
+		if _, err = r.ReadAt(buf[:n], off); err != nil && err != io.EOF {
+			continue
+		}
+		if err = r.checkChunk(i, buf[:n]); err != nil {
+			continue
+		}
+		_, err = f.WriteAt(buf[:n], off)
+		return err
+	}
+
+	return err
+}
+
+// checkChunk returns ErrDownloadHashMismatch if b, the chunk i, does not match its expected hash.
+func (r *ReadAtCloser) checkChunk(i int, b []byte) error {
+	if r.expectedDigests == nil {
+		return nil
+	}
+
+	newHash, err := hasher(r.expectedHashSize)
+	if err != nil {
+		return err
+	}
+	h := newHash()
+	h.Write(b)
+	if got := hex.EncodeToString(h.Sum(nil)); got != r.expectedDigests[i] {
+		return fmt.Errorf("%w: chunk %d is %s, expected %s", ErrDownloadHashMismatch, i, got, r.expectedDigests[i])
+	}
+
+	return nil
+}
+
+// hashFile returns the SHA-256 of the downloaded file f, checking every chunk against its expected hash if there are
+// any, including chunks kept from an interrupted download.
+func (r *ReadAtCloser) hashFile(f *os.File) ([]byte, error) {
+	h := sha256.New()
+	buf := make([]byte, r.hashChunkSize)
+	for i := 0; int64(i)*r.hashChunkSize < r.contentLength; i++ {
+		n, err := f.ReadAt(buf, int64(i)*r.hashChunkSize)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err := r.checkChunk(i, buf[:n]); err != nil {
+			return nil, err
+		}
+		h.Write(buf[:n])
+	}
+
+	return h.Sum(nil), nil
+}
+
+// loadDownloadState returns the state of the download of a file with the etag and length saved at name, or a new
+// state if there is none or it was for another version of the file. Without an Etag the file cannot be told to be
+// the same, so nothing is resumed.
+func loadDownloadState(name, etag string, length, chunkSize int64, chunks int) *downloadState {
+	fresh := &downloadState{Etag: etag, ContentLength: length, ChunkSize: chunkSize, Done: make([]bool, chunks)}
+	if etag == "" {
+		return fresh
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return fresh
+	}
+	var s downloadState
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fresh
+	}
+	if s.Etag != etag || s.ContentLength != length || s.ChunkSize != chunkSize || len(s.Done) != chunks {
+		return fresh
+	}
+
+	return &s
+}
+
+func saveDownloadState(name string, s *downloadState) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, name)
+}
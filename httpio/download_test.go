@@ -0,0 +1,308 @@
+package httpio
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const downloadChunkSize = 16384
+
+// downloadFile is the file Download tests fetch, of seven chunks, the last one short.
+var downloadFile = testFile(6*downloadChunkSize + 1000)
+
+// chunkDigests returns the hex SHA-256 of each chunk of data.
+func chunkDigests(data []byte) []string {
+	var digests []string
+	for off := 0; off < len(data); off += downloadChunkSize {
+		end := off + downloadChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := sha256.Sum256(data[off:end])
+		digests = append(digests, hex.EncodeToString(sum[:]))
+	}
+	return digests
+}
+
+// chunkRange returns the Range header Download asks for chunk i of downloadFile with.
+func chunkRange(i int) string {
+	end := (i+1)*downloadChunkSize - 1
+	if end >= len(downloadFile) {
+		end = len(downloadFile) - 1
+	}
+	return fmt.Sprintf("bytes=%d-%d", i*downloadChunkSize, end)
+}
+
+// rangeCounts returns how many times each range was asked for.
+func rangeCounts(log []*http.Request) map[string]int {
+	counts := map[string]int{}
+	for _, req := range log {
+		if rng := req.Header.Get("Range"); rng != "" {
+			counts[rng]++
+		}
+	}
+	return counts
+}
+
+// writeRange answers a range request for data as fileServer does.
+func writeRange(w http.ResponseWriter, req *http.Request, data []byte, etag string) {
+	first, last := rangeOf(req.Header.Get("Range"), len(data))
+	w.Header().Set("Etag", etag)
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, len(data)))
+	w.Header().Set("Content-Length", strconv.Itoa(last-first+1))
+	w.WriteHeader(http.StatusPartialContent)
+	w.Write(data[first : last+1])
+}
+
+// fastRetries makes retried chunks wait a millisecond rather than a second for the test.
+func fastRetries(t *testing.T) {
+	retryBackoff = time.Millisecond
+	t.Cleanup(func() { retryBackoff = time.Second })
+}
+
+func testDownload(s *fileServer, path string, opts ...Option) ([]byte, error) {
+	opts = append([]Option{WithHashChunkSize(downloadChunkSize)}, opts...)
+	return Download(context.Background(), s.URL+"/App.pkg", path, opts...)
+}
+
+// checkDownloaded checks the file at path is downloadFile and the partial file and its state are gone.
+func checkDownloaded(t *testing.T, path string, sum []byte) {
+	t.Helper()
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, downloadFile) {
+		t.Errorf("downloaded %d bytes that are not the file", len(got))
+	}
+	if want := sha256.Sum256(downloadFile); !bytes.Equal(sum, want[:]) {
+		t.Errorf("got SHA-256 %x, want %x", sum, want)
+	}
+	for _, name := range []string{path + ".part", path + ".part.json"} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s was left behind", filepath.Base(name))
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"unchecked", nil},
+		{"expected hashes", []Option{WithExpectedHashes(sha256.Size, chunkDigests(downloadFile))}},
+		{"one at a time", []Option{WithParallelism(1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFileServer(downloadFile, `"v1"`)
+			defer s.Close()
+			path := filepath.Join(t.TempDir(), "App.pkg")
+
+			sum, err := testDownload(s, path, tt.opts...)
+			if err != nil {
+				t.Fatalf("Download: %v", err)
+			}
+			checkDownloaded(t, path, sum)
+
+			counts := rangeCounts(s.log())
+			for i := 0; i < 7; i++ {
+				if counts[chunkRange(i)] != 1 {
+					t.Errorf("chunk %d was asked for %d times, want once", i, counts[chunkRange(i)])
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	// A partial file of the first four chunks, the third of them corrupted on disk.
+	corrupted := append([]byte(nil), downloadFile...)
+	corrupted[2*downloadChunkSize+10] ^= 0xff
+	done := []bool{true, true, true, true, false, false, false}
+
+	tests := []struct {
+		name    string
+		part    []byte
+		etag    string
+		opts    []Option
+		fetched []int
+		want    error
+		// wantSum is whether the SHA-256 of the file, rather than the corrupted one, is returned.
+		wantSum bool
+	}{
+		{"resumed", downloadFile, `"v1"`, nil, []int{4, 5, 6}, nil, true},
+		{"file changed", downloadFile, `"v0"`, nil, []int{0, 1, 2, 3, 4, 5, 6}, nil, true},
+		{"corrupted chunk kept", corrupted, `"v1"`, nil, []int{4, 5, 6}, nil, false},
+		{"corrupted chunk checked", corrupted, `"v1"`, []Option{WithExpectedHashes(sha256.Size, chunkDigests(downloadFile))}, []int{4, 5, 6}, ErrDownloadHashMismatch, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFileServer(downloadFile, `"v1"`)
+			defer s.Close()
+			path := filepath.Join(t.TempDir(), "App.pkg")
+
+			part := make([]byte, len(downloadFile))
+			copy(part, tt.part[:4*downloadChunkSize])
+			if err := ioutil.WriteFile(path+".part", part, 0644); err != nil {
+				t.Fatal(err)
+			}
+			state, _ := json.Marshal(downloadState{Etag: tt.etag, ContentLength: int64(len(downloadFile)), ChunkSize: downloadChunkSize, Done: done})
+			if err := ioutil.WriteFile(path+".part.json", state, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			sum, err := testDownload(s, path, tt.opts...)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got error %v, want %v", err, tt.want)
+			}
+
+			counts := rangeCounts(s.log())
+			if len(counts) != len(tt.fetched) {
+				t.Errorf("got requests for %v, want chunks %v", counts, tt.fetched)
+			}
+			for _, i := range tt.fetched {
+				if counts[chunkRange(i)] != 1 {
+					t.Errorf("chunk %d was asked for %d times, want once", i, counts[chunkRange(i)])
+				}
+			}
+
+			switch {
+			case tt.want != nil:
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("the corrupted file was renamed into place")
+				}
+				if _, err := os.Stat(path + ".part.json"); !os.IsNotExist(err) {
+					t.Errorf("the state was kept, to resume from the corrupted chunk")
+				}
+			case tt.wantSum:
+				checkDownloaded(t, path, sum)
+			default:
+				if want := sha256.Sum256(corrupted); !bytes.Equal(sum, want[:]) {
+					t.Errorf("got SHA-256 %x, want that of the corrupted file, %x", sum, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadRetry(t *testing.T) {
+	fastRetries(t)
+
+	tests := []struct {
+		name string
+		// failures is how many requests for the second chunk fail.
+		failures   int
+		corrupt    bool
+		wantTries  int
+		want       error
+		wantStatus int
+	}{
+		{"server error", 1, false, 2, nil, 0},
+		{"server errors", 3, false, 4, nil, 0},
+		{"too many server errors", 4, false, 4, nil, http.StatusInternalServerError},
+		{"hash mismatch", 1, true, 2, nil, 0},
+		{"too many hash mismatches", 4, true, 4, ErrDownloadHashMismatch, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFileServer(downloadFile, `"v1"`)
+			defer s.Close()
+
+			var (
+				mu       sync.Mutex
+				failures = tt.failures
+			)
+			corrupted := append([]byte(nil), downloadFile...)
+			corrupted[downloadChunkSize+10] ^= 0xff
+			s.intercept = func(w http.ResponseWriter, req *http.Request) bool {
+				mu.Lock()
+				defer mu.Unlock()
+				if req.Header.Get("Range") != chunkRange(1) || failures == 0 {
+					return false
+				}
+				failures--
+				if tt.corrupt {
+					writeRange(w, req, corrupted, `"v1"`)
+				} else {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+				return true
+			}
+
+			path := filepath.Join(t.TempDir(), "App.pkg")
+			sum, err := testDownload(s, path, WithRetries(3), WithExpectedHashes(sha256.Size, chunkDigests(downloadFile)))
+
+			var serr *StatusError
+			if tt.wantStatus != 0 {
+				if !errors.As(err, &serr) || serr.StatusCode != tt.wantStatus {
+					t.Errorf("got error %v, want status %d", err, tt.wantStatus)
+				}
+			} else if !errors.Is(err, tt.want) {
+				t.Fatalf("got error %v, want %v", err, tt.want)
+			}
+			if err == nil {
+				checkDownloaded(t, path, sum)
+			} else if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("a failed download was renamed into place")
+			}
+
+			if tries := rangeCounts(s.log())[chunkRange(1)]; tries != tt.wantTries {
+				t.Errorf("the second chunk was asked for %d times, want %d", tries, tt.wantTries)
+			}
+		})
+	}
+}
+
+func TestDownloadChanged(t *testing.T) {
+	s := newFileServer(downloadFile, `"v1"`)
+	defer s.Close()
+
+	// The second HEAD, once every chunk is downloaded, finds a new version of the file.
+	var (
+		mu    sync.Mutex
+		heads int
+	)
+	s.intercept = func(w http.ResponseWriter, req *http.Request) bool {
+		if req.Method != http.MethodHead {
+			return false
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if heads++; heads == 1 {
+			return false
+		}
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Etag", `"v2"`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(downloadFile)))
+		return true
+	}
+
+	path := filepath.Join(t.TempDir(), "App.pkg")
+	if _, err := testDownload(s, path); !errors.Is(err, ErrDownloadChanged) {
+		t.Fatalf("got error %v, want %v", err, ErrDownloadChanged)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the download of a changed file was renamed into place")
+	}
+	if _, err := os.Stat(path + ".part.json"); !os.IsNotExist(err) {
+		t.Errorf("the state was kept, to resume from chunks of the old file")
+	}
+}
@@ -0,0 +1,198 @@
+package httpio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// refreshMargin is how long before a presigned URL expires it is refreshed, so a request is not sent with a URL that
+// expires in flight.
+const refreshMargin = time.Minute
+
+// maxResumes is how many times HashURL resumes a download that failed part way through before giving up.
+const maxResumes = 5
+
+// now returns the current time, which presigned URLs are checked against.
+var now = time.Now
+
+var ErrURLExpiresTooSoon = errors.New("httpio: presigned url expires before the download is expected to finish")
+
+// RefreshFunc returns a new URL for the file at the expiring url, such as a freshly presigned one.
+type RefreshFunc func(ctx context.Context, url string) (string, error)
+
+// WithURLRefresh sets a function giving a new URL when a presigned URL is about to expire, so hashing a large file can
+// outlive the URL it started with. It is called before a request made less than a minute before the URL expires, and
+// once to retry a request the server refused with 400 or 403 after the URL expired. A hash interrupted part way
+// through resumes from where it stopped with a range request to a refreshed URL, sent with If-Range so a file replaced
+// meanwhile fails with a *ChangedError rather than mixing two versions of it.
+func WithURLRefresh(refresh RefreshFunc) Option {
+	return func(r *ReadAtCloser) {
+		r.refresh = refresh
+	}
+}
+
+// WithExpectedRate makes NewReadAtCloser fail with ErrURLExpiresTooSoon when the URL is presigned and expires before
+// the whole file could be read at bytesPerSecond, rather than part way through hashing it. The check is skipped with
+// WithURLRefresh.
+func WithExpectedRate(bytesPerSecond int64) Option {
+	return func(r *ReadAtCloser) {
+		r.expectedRate = bytesPerSecond
+	}
+}
+
+// URLExpiry returns when the presigned URL u expires, read from the query of AWS S3 and Google Cloud Storage (V2 and
+// V4 signatures), Azure shared access signature and CloudFront canned policy URLs. ok is false for any other URL.
+func URLExpiry(u string) (expiry time.Time, ok bool) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return time.Time{}, false
+	}
+	q := parsed.Query()
+
+	for _, prefix := range []string{"X-Amz-", "X-Goog-"} {
+		date, expires := q.Get(prefix+"Date"), q.Get(prefix+"Expires")
+		if date == "" || expires == "" {
+			continue
+		}
+		t, err := time.Parse("20060102T150405Z", date)
+		if err != nil {
+			return time.Time{}, false
+		}
+		secs, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return t.Add(time.Duration(secs) * time.Second), true
+	}
+
+	if expires := q.Get("Expires"); expires != "" {
+		secs, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(secs, 0), true
+	}
+
+	if se := q.Get("se"); se != "" && q.Get("sig") != "" {
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z", "2006-01-02"} {
+			if t, err := time.Parse(layout, se); err == nil {
+				return t, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// checkExpiry fails with ErrURLExpiresTooSoon when the URL expires before the file can be read at the expected rate.
+func (r *ReadAtCloser) checkExpiry() error {
+	if r.expectedRate <= 0 || r.refresh != nil {
+		return nil
+	}
+
+	expiry, ok := URLExpiry(r.url)
+	if !ok {
+		return nil
+	}
+
+	took := time.Duration(float64(r.contentLength) / float64(r.expectedRate) * float64(time.Second))
+	if done := now().Add(took); done.After(expiry) {
+		return fmt.Errorf("%w: it expires at %s, reading %d bytes at %d bytes/s takes until %s",
+			ErrURLExpiresTooSoon, expiry.Format(time.RFC3339), r.contentLength, r.expectedRate, done.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// refreshIfExpiring refreshes the URL when it is presigned and expires within refreshMargin.
+func (r *ReadAtCloser) refreshIfExpiring() error {
+	if r.refresh == nil {
+		return nil
+	}
+
+	u := r.URL()
+	if expiry, ok := URLExpiry(u); ok && expiry.Sub(now()) < refreshMargin {
+		return r.refreshURL(u)
+	}
+
+	return nil
+}
+
+// refreshURL replaces the stale URL with the one the RefreshFunc returns, unless a concurrent request has already.
+func (r *ReadAtCloser) refreshURL(stale string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.url != stale {
+		return nil
+	}
+
+	u, err := r.refresh(r.ctx, stale)
+	if err != nil {
+		return fmt.Errorf("httpio: refreshing url: %w", err)
+	}
+	if u == "" {
+		return errors.New("httpio: refreshing url: no url returned")
+	}
+	r.url = u
+
+	return nil
+}
+
+// isExpired reports whether code is how a storage service refuses an expired presigned URL, 403 from S3, CloudFront and
+// Azure, 400 from Google Cloud Storage, and the presigned URL u has indeed expired. A refusal of a URL that has not
+// expired, or is not presigned, is left to the caller.
+func isExpired(u string, code int) bool {
+	if code != http.StatusForbidden && code != http.StatusBadRequest {
+		return false
+	}
+	expiry, ok := URLExpiry(u)
+
+	return ok && !now().Before(expiry)
+}
+
+// resumingBody reads the body of a GET of the whole file. When reading fails part way through and a RefreshFunc is
+// set, it continues from the offset reached with a range request to a refreshed URL, failing with a *ChangedError if
+// the file is no longer the one it started reading.
+type resumingBody struct {
+	r       *ReadAtCloser
+	body    io.ReadCloser
+	off     int64
+	resumes int
+}
+
+func (b *resumingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.off += int64(n)
+	if err == nil || err == io.EOF || b.r.refresh == nil || b.r.ctx.Err() != nil || b.resumes >= maxResumes {
+		return n, err
+	}
+	b.resumes++
+
+	b.body.Close()
+	if rerr := b.r.refreshURL(b.r.URL()); rerr != nil {
+		return n, rerr
+	}
+
+	res, rerr := b.r.do(http.MethodGet, fmt.Sprintf("bytes=%d-", b.off))
+	if rerr != nil {
+		return n, rerr
+	}
+	if rerr := b.r.checkRange(res, b.off); rerr != nil {
+		res.Body.Close()
+		return n, rerr
+	}
+	b.body = res.Body
+
+	return n, nil
+}
+
+func (b *resumingBody) Close() error {
+	return b.body.Close()
+}
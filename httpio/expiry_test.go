@@ -0,0 +1,378 @@
+package httpio
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testFile returns size bytes of numbered lines.
+func testFile(size int) []byte {
+	var b bytes.Buffer
+	for i := 0; b.Len() < size; i++ {
+		fmt.Fprintf(&b, "line %06d of the sample package\n", i)
+	}
+	return b.Bytes()[:size]
+}
+
+// fileServer serves one file with range requests, answering If-Range like S3 does. The first cuts GETs are cut off
+// after cutAfter bytes of their body, and the Etag becomes changedEtag after the first of them. intercept, if set, may
+// answer a request itself, returning true when it has.
+type fileServer struct {
+	*httptest.Server
+	data      []byte
+	intercept func(w http.ResponseWriter, req *http.Request) bool
+
+	mu          sync.Mutex
+	etag        string
+	changedEtag string
+	cuts        int
+	cutAfter    int
+	requests    []*http.Request
+}
+
+func newFileServer(data []byte, etag string) *fileServer {
+	s := &fileServer{data: data, etag: etag}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *fileServer) log() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*http.Request(nil), s.requests...)
+}
+
+func (s *fileServer) serve(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	etag := s.etag
+	cut := req.Method == http.MethodGet && s.cuts > 0
+	if cut {
+		s.cuts--
+		if s.changedEtag != "" {
+			s.etag = s.changedEtag
+		}
+	}
+	s.mu.Unlock()
+
+	if s.intercept != nil && s.intercept(w, req) {
+		return
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Etag", etag)
+	body, status := s.data, http.StatusOK
+	if rng := req.Header.Get("Range"); rng != "" {
+		if ifRange := req.Header.Get("If-Range"); ifRange == "" || ifRange == etag {
+			first, last := rangeOf(rng, len(s.data))
+			body, status = s.data[first:last+1], http.StatusPartialContent
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, len(s.data)))
+		}
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	if req.Method == http.MethodHead {
+		return
+	}
+
+	if cut {
+		w.Write(body[:s.cutAfter])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	w.Write(body)
+}
+
+// rangeOf returns the first and last byte of the Range header rng, "bytes=first-last" or "bytes=first-", of a file of
+// length bytes.
+func rangeOf(rng string, length int) (first, last int) {
+	spec := strings.TrimPrefix(rng, "bytes=")
+	i := strings.IndexByte(spec, '-')
+	first, _ = strconv.Atoi(spec[:i])
+	last = length - 1
+	if spec[i+1:] != "" {
+		last, _ = strconv.Atoi(spec[i+1:])
+	}
+	return first, last
+}
+
+// fakeClock replaces now for the test, returning start until it is advanced.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func setClock(t *testing.T, start time.Time) *fakeClock {
+	c := &fakeClock{t: start}
+	now = c.now
+	t.Cleanup(func() { now = time.Now })
+	return c
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = t
+}
+
+func TestURLExpiry(t *testing.T) {
+	tests := []struct {
+		url    string
+		want   time.Time
+		wantOK bool
+	}{
+		{"https://b.s3.amazonaws.com/App.pkg?X-Amz-Date=20210501T120000Z&X-Amz-Expires=900&X-Amz-Signature=x", time.Date(2021, 5, 1, 12, 15, 0, 0, time.UTC), true},
+		{"https://storage.googleapis.com/b/App.pkg?X-Goog-Date=20210501T120000Z&X-Goog-Expires=60", time.Date(2021, 5, 1, 12, 1, 0, 0, time.UTC), true},
+		{"https://d.cloudfront.net/App.pkg?Expires=1619870400&Signature=x&Key-Pair-Id=k", time.Unix(1619870400, 0), true},
+		{"https://a.blob.core.windows.net/c/App.pkg?se=2021-05-01T12:00:00Z&sig=x", time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC), true},
+		{"https://a.blob.core.windows.net/c/App.pkg?se=2021-05-01&sig=x", time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC), true},
+		{"https://b.s3.amazonaws.com/App.pkg?X-Amz-Date=yesterday&X-Amz-Expires=900", time.Time{}, false},
+		{"https://example.com/App.pkg", time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := URLExpiry(tt.url)
+		if ok != tt.wantOK || !got.Equal(tt.want) {
+			t.Errorf("URLExpiry(%q) = %v, %t, want %v, %t", tt.url, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// TestExpiredURLRefresh checks a URL refused once it expired is refreshed and the request retried once, and a URL
+// about to expire is refreshed before it is used.
+func TestExpiredURLRefresh(t *testing.T) {
+	const (
+		stale = "X-Amz-Date=20300101T000000Z&X-Amz-Expires=300"
+		fresh = "X-Amz-Date=20300101T010000Z&X-Amz-Expires=300"
+	)
+	signed := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		// start is the time the URL is first used, expire whether it expires as the server receives it.
+		start  time.Time
+		expire bool
+		// code is how the server refuses the stale URL, and every URL when refuseAll is set.
+		code      int
+		refuseAll bool
+
+		wantRefreshes int
+		wantQueries   []string
+		wantStatus    int
+	}{
+		{"refused once expired", signed, true, http.StatusForbidden, false, 1, []string{stale, fresh}, 0},
+		{"refused with 400 once expired", signed, true, http.StatusBadRequest, false, 1, []string{stale, fresh}, 0},
+		{"refreshed url refused", signed, true, http.StatusForbidden, true, 1, []string{stale, fresh}, http.StatusForbidden},
+		{"refused before expiry", signed, false, http.StatusForbidden, false, 0, []string{stale}, http.StatusForbidden},
+		{"refused with 401", signed, true, http.StatusUnauthorized, false, 0, []string{stale}, http.StatusUnauthorized},
+		{"about to expire", signed.Add(4*time.Minute + 30*time.Second), false, http.StatusForbidden, false, 1, []string{fresh}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := setClock(t, tt.start)
+
+			var (
+				mu      sync.Mutex
+				queries []string
+			)
+			data := testFile(1000)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				mu.Lock()
+				queries = append(queries, req.URL.RawQuery)
+				mu.Unlock()
+
+				if req.URL.RawQuery == stale || tt.refuseAll {
+					if tt.expire {
+						clock.set(signed.Add(10 * time.Minute))
+					}
+					w.WriteHeader(tt.code)
+					return
+				}
+				w.Header().Set("Accept-Ranges", "bytes")
+				w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			}))
+			defer srv.Close()
+
+			refreshes := 0
+			refresh := func(ctx context.Context, u string) (string, error) {
+				refreshes++
+				if want := srv.URL + "/App.pkg?" + stale; u != want {
+					t.Errorf("refreshing %q, want %q", u, want)
+				}
+				return srv.URL + "/App.pkg?" + fresh, nil
+			}
+
+			r, err := NewReadAtCloser(WithURL(srv.URL+"/App.pkg?"+stale), WithURLRefresh(refresh))
+			var serr *StatusError
+			switch {
+			case tt.wantStatus == 0 && err != nil:
+				t.Fatalf("NewReadAtCloser: %v", err)
+			case tt.wantStatus != 0 && (!errors.As(err, &serr) || serr.StatusCode != tt.wantStatus):
+				t.Fatalf("got error %v, want status %d", err, tt.wantStatus)
+			case err == nil:
+				if want := srv.URL + "/App.pkg?" + fresh; r.URL() != want {
+					t.Errorf("got URL %q, want %q", r.URL(), want)
+				}
+				if r.Length() != int64(len(data)) {
+					t.Errorf("got length %d, want %d", r.Length(), len(data))
+				}
+			}
+
+			if refreshes != tt.wantRefreshes {
+				t.Errorf("refreshed %d times, want %d", refreshes, tt.wantRefreshes)
+			}
+			if strings.Join(queries, "\n") != strings.Join(tt.wantQueries, "\n") {
+				t.Errorf("got requests for %q, want %q", queries, tt.wantQueries)
+			}
+		})
+	}
+}
+
+func TestHashURLResume(t *testing.T) {
+	data := testFile(100000)
+	s := newFileServer(data, `"v1"`)
+	defer s.Close()
+	s.cuts, s.cutAfter = 1, 40000
+
+	refreshes := 0
+	refresh := func(ctx context.Context, u string) (string, error) {
+		refreshes++
+		return u, nil
+	}
+	r, err := NewReadAtCloser(WithURL(s.URL+"/App.pkg"), WithURLRefresh(refresh), WithHashChunkSize(16384))
+	if err != nil {
+		t.Fatalf("NewReadAtCloser: %v", err)
+	}
+	defer r.Close()
+
+	hashes, err := r.HashURL(sha256.Size)
+	if err != nil {
+		t.Fatalf("HashURL: %v", err)
+	}
+	for i, h := range hashes {
+		end := (i + 1) * 16384
+		if end > len(data) {
+			end = len(data)
+		}
+		if sum := sha256.Sum256(data[i*16384 : end]); !bytes.Equal(h.Sum(nil), sum[:]) {
+			t.Errorf("chunk %d: got %x, want %x", i, h.Sum(nil), sum)
+		}
+	}
+	if len(hashes) != 7 {
+		t.Errorf("got %d chunks, want 7", len(hashes))
+	}
+	if sum := sha256.Sum256(data); !bytes.Equal(r.FileDigest(), sum[:]) {
+		t.Errorf("got file digest %x, want %x", r.FileDigest(), sum)
+	}
+	if refreshes != 1 {
+		t.Errorf("refreshed %d times, want 1", refreshes)
+	}
+
+	log := s.log()
+	if len(log) != 3 {
+		t.Fatalf("got %d requests, want a HEAD and two GETs", len(log))
+	}
+	if rng := log[1].Header.Get("Range"); rng != "" {
+		t.Errorf("the first GET asked for range %q, want the whole file", rng)
+	}
+	if rng, ifRange := log[2].Header.Get("Range"), log[2].Header.Get("If-Range"); rng != "bytes=40000-" || ifRange != `"v1"` {
+		t.Errorf("resumed with Range %q and If-Range %q, want bytes=40000- and \"v1\"", rng, ifRange)
+	}
+}
+
+func TestHashURLResumeChanged(t *testing.T) {
+	tests := []struct {
+		name        string
+		etag        string
+		changedEtag string
+		wantIfRange string
+	}{
+		// The server ignores the range as If-Range no longer matches.
+		{"strong etag", `"v1"`, `"v2"`, `"v1"`},
+		// Without If-Range the server sends the range of the new file.
+		{"weak etag", `W/"v1"`, `W/"v2"`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFileServer(testFile(100000), tt.etag)
+			defer s.Close()
+			s.cuts, s.cutAfter, s.changedEtag = 1, 40000, tt.changedEtag
+
+			refresh := func(ctx context.Context, u string) (string, error) { return u, nil }
+			r, err := NewReadAtCloser(WithURL(s.URL+"/App.pkg"), WithURLRefresh(refresh))
+			if err != nil {
+				t.Fatalf("NewReadAtCloser: %v", err)
+			}
+			defer r.Close()
+
+			_, err = r.HashURL(sha256.Size)
+			var cerr *ChangedError
+			if !errors.As(err, &cerr) || !errors.Is(err, ErrFileChanged) {
+				t.Fatalf("got error %v, want a *ChangedError", err)
+			}
+			if cerr.Etag != tt.etag || cerr.CurrentEtag != tt.changedEtag {
+				t.Errorf("got Etag %s now %s, want %s now %s", cerr.Etag, cerr.CurrentEtag, tt.etag, tt.changedEtag)
+			}
+			if log := s.log(); log[len(log)-1].Header.Get("If-Range") != tt.wantIfRange {
+				t.Errorf("resumed with If-Range %q, want %q", log[len(log)-1].Header.Get("If-Range"), tt.wantIfRange)
+			}
+		})
+	}
+}
+
+func TestHashURLMaxResumes(t *testing.T) {
+	s := newFileServer(testFile(100000), `"v1"`)
+	defer s.Close()
+	s.cuts, s.cutAfter = maxResumes+10, 1000
+
+	refresh := func(ctx context.Context, u string) (string, error) { return u, nil }
+	r, err := NewReadAtCloser(WithURL(s.URL+"/App.pkg"), WithURLRefresh(refresh))
+	if err != nil {
+		t.Fatalf("NewReadAtCloser: %v", err)
+	}
+	defer r.Close()
+
+	if _, err := r.HashURL(sha256.Size); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got error %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if gets := len(s.log()) - 1; gets != 1+maxResumes {
+		t.Errorf("got %d GETs, want %d", gets, 1+maxResumes)
+	}
+}
+
+func TestHashURLNoResumeWithoutRefresh(t *testing.T) {
+	s := newFileServer(testFile(100000), `"v1"`)
+	defer s.Close()
+	s.cuts, s.cutAfter = 1, 40000
+
+	r, err := NewReadAtCloser(WithURL(s.URL + "/App.pkg"))
+	if err != nil {
+		t.Fatalf("NewReadAtCloser: %v", err)
+	}
+	defer r.Close()
+
+	if _, err := r.HashURL(sha256.Size); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got error %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if gets := len(s.log()) - 1; gets != 1 {
+		t.Errorf("got %d GETs, want 1", gets)
+	}
+}
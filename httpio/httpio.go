@@ -0,0 +1,572 @@
+// Package httpio provides a PackageReader that reads packages over HTTP using range requests.
+package httpio
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultHashChunkSize is the chunk size used when hashing if none is given.
+const DefaultHashChunkSize = 10 * 1024 * 1024
+
+var (
+	ErrRangeNotSupported = errors.New("httpio: server does not support range requests")
+	ErrNoContentLength   = errors.New("httpio: server did not return a content length")
+	ErrUnsupportedHash   = errors.New("httpio: unsupported hash size")
+	ErrLengthMismatch    = errors.New("httpio: body length does not match the content length")
+	ErrFileChanged       = errors.New("httpio: file changed while it was read")
+)
+
+// ChangedError is returned when a range of the file comes back with another Etag or length than the file had when
+// it was first asked for, or the server ignores the range because the If-Range Etag no longer matches. It wraps
+// ErrFileChanged.
+type ChangedError struct {
+	URL                  string
+	Etag                 string
+	CurrentEtag          string
+	ContentLength        int64
+	CurrentContentLength int64
+}
+
+func (e *ChangedError) Error() string {
+	if e.ContentLength != e.CurrentContentLength {
+		return fmt.Sprintf("%s: %s: length %d is now %d", ErrFileChanged, e.URL, e.ContentLength, e.CurrentContentLength)
+	}
+	return fmt.Sprintf("%s: %s: Etag %s is now %s", ErrFileChanged, e.URL, e.Etag, e.CurrentEtag)
+}
+
+func (e *ChangedError) Unwrap() error {
+	return ErrFileChanged
+}
+
+// StatusError is returned when the server answers a request with an unexpected status.
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("httpio: %s %s: %s", e.Method, e.URL, e.Status)
+}
+
+func newStatusError(res *http.Response) *StatusError {
+	return &StatusError{
+		Method:     res.Request.Method,
+		URL:        res.Request.URL.String(),
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+	}
+}
+
+// ReadAtCloser reads ranges of a remote file and hashes it in chunks.
+type ReadAtCloser struct {
+	client        *http.Client
+	ctx           context.Context
+	mu            sync.Mutex
+	url           string
+	contentLength int64
+	etag          string
+	hashChunkSize int64
+	hashProgress  func(done, total int)
+	header        http.Header
+	exactChunks   bool
+	chunkLengths  []int64
+	refresh       RefreshFunc
+	expectedRate  int64
+	transport     http.RoundTripper
+	dial          DialFunc
+	proxy         *url.URL
+
+	parallelism      int
+	retries          int
+	expectedHashSize uint
+	expectedDigests  []string
+
+	fileSum []byte
+}
+
+// Option configures a ReadAtCloser.
+type Option func(*ReadAtCloser)
+
+// WithClient sets the http.Client used for requests, http.DefaultClient is used otherwise.
+func WithClient(c *http.Client) Option {
+	return func(r *ReadAtCloser) {
+		r.client = c
+	}
+}
+
+// WithContext sets the context of every request, cancelling it aborts any read or hash in progress.
+func WithContext(ctx context.Context) Option {
+	return func(r *ReadAtCloser) {
+		r.ctx = ctx
+	}
+}
+
+// WithHeader adds a header sent with every request.
+func WithHeader(key, value string) Option {
+	return func(r *ReadAtCloser) {
+		r.header.Add(key, value)
+	}
+}
+
+// WithBasicAuth authenticates every request with the username and password.
+func WithBasicAuth(username, password string) Option {
+	return func(r *ReadAtCloser) {
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(username, password)
+		r.header.Set("Authorization", req.Header.Get("Authorization"))
+	}
+}
+
+// WithBearerToken authenticates every request with the token.
+func WithBearerToken(token string) Option {
+	return func(r *ReadAtCloser) {
+		r.header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// WithURL sets the URL of the file to read.
+func WithURL(url string) Option {
+	return func(r *ReadAtCloser) {
+		r.url = url
+	}
+}
+
+// WithHashChunkSize sets the size of each chunk hashed by HashURL.
+func WithHashChunkSize(size int64) Option {
+	return func(r *ReadAtCloser) {
+		r.hashChunkSize = size
+	}
+}
+
+// WithFileDigest made HashURL also hash the whole file with SHA-256.
+//
+// Deprecated: HashURL always hashes the whole file, see FileDigest.
+func WithFileDigest() Option {
+	return func(r *ReadAtCloser) {}
+}
+
+// WithExactChunks makes HashURL hash exactly the content length returned by the HEAD request, failing with
+// ErrLengthMismatch if the body is shorter or longer, so the final chunk covers exactly the remaining bytes.
+func WithExactChunks() Option {
+	return func(r *ReadAtCloser) {
+		r.exactChunks = true
+	}
+}
+
+// NewReadAtCloser returns a ReadAtCloser for the configured URL. A HEAD request is made to learn the
+// length and Etag of the file and to make sure the server accepts range requests.
+func NewReadAtCloser(opts ...Option) (*ReadAtCloser, error) {
+	r := &ReadAtCloser{
+		client:        http.DefaultClient,
+		ctx:           context.Background(),
+		hashChunkSize: DefaultHashChunkSize,
+		header:        http.Header{},
+		parallelism:   DefaultParallelism,
+		retries:       DefaultRetries,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.configureTransport()
+
+	if r.url == "" {
+		return nil, errors.New("httpio: no url")
+	}
+
+	if r.hashChunkSize <= 0 {
+		return nil, fmt.Errorf("httpio: invalid hash chunk size: %d", r.hashChunkSize)
+	}
+
+	if err := r.head(); err != nil {
+		return nil, err
+	}
+
+	if err := r.checkExpiry(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Fetch GETs the whole file at the configured URL, for a server that does not support range requests, taking the same
+// options as NewReadAtCloser. The caller must close the body of the response.
+func Fetch(opts ...Option) (*http.Response, error) {
+	r := &ReadAtCloser{
+		client: http.DefaultClient,
+		ctx:    context.Background(),
+		header: http.Header{},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.configureTransport()
+
+	if r.url == "" {
+		return nil, errors.New("httpio: no url")
+	}
+
+	res, err := r.do(http.MethodGet, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, newStatusError(res)
+	}
+
+	return res, nil
+}
+
+func (r *ReadAtCloser) head() error {
+	res, err := r.do(http.MethodHead, "")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return newStatusError(res)
+	}
+
+	if !strings.EqualFold(res.Header.Get("Accept-Ranges"), "bytes") {
+		return ErrRangeNotSupported
+	}
+
+	if res.ContentLength <= 0 {
+		return ErrNoContentLength
+	}
+
+	r.contentLength = res.ContentLength
+	r.etag = res.Header.Get("Etag")
+
+	return nil
+}
+
+// Head makes a new HEAD request for the file, returning its current Etag and content length without changing those
+// the ReadAtCloser reports, to tell whether the file changed while it was read.
+func (r *ReadAtCloser) Head() (string, int64, error) {
+	res, err := r.do(http.MethodHead, "")
+	if err != nil {
+		return "", 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", 0, newStatusError(res)
+	}
+
+	return res.Header.Get("Etag"), res.ContentLength, nil
+}
+
+// ReadAt reads len(p) bytes from the remote file starting at off.
+func (r *ReadAtCloser) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("httpio: negative offset")
+	}
+	if off >= r.contentLength {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	end := off + int64(len(p)) - 1
+	if end >= r.contentLength {
+		end = r.contentLength - 1
+	}
+
+	res, err := r.do(http.MethodGet, fmt.Sprintf("bytes=%d-%d", off, end))
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if err := r.checkRange(res, off); err != nil {
+		return 0, err
+	}
+
+	n, err := io.ReadFull(res.Body, p[:end-off+1])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+// HashURL reads the whole file and returns a hash for each chunk of it. The size is the size of
+// the hash sum to use, md5.Size or sha256.Size.
+func (r *ReadAtCloser) HashURL(size uint) ([]hash.Hash, error) {
+	return r.HashURLFrom(size, 0)
+}
+
+// HashURLFrom reads the file from the start of the chunk first with a range request and returns a hash for each chunk
+// from there on, for a file whose earlier chunks are known not to have changed. ChunkLengths then covers these chunks
+// only.
+func (r *ReadAtCloser) HashURLFrom(size uint, first int) ([]hash.Hash, error) {
+	newHash, err := hasher(size)
+	if err != nil {
+		return nil, err
+	}
+
+	start := int64(first) * r.hashChunkSize
+	if first < 0 || start > r.contentLength {
+		return nil, fmt.Errorf("httpio: chunk %d is past the end of %d bytes", first, r.contentLength)
+	}
+	if start > 0 && start == r.contentLength {
+		r.chunkLengths = nil
+		return nil, nil
+	}
+
+	var (
+		res  *http.Response
+		want = http.StatusOK
+	)
+	if start > 0 {
+		want = http.StatusPartialContent
+		res, err = r.do(http.MethodGet, fmt.Sprintf("bytes=%d-", start))
+	} else {
+		res, err = r.do(http.MethodGet, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if start > 0 {
+		err = r.checkRange(res, start)
+	} else if res.StatusCode != want {
+		err = newStatusError(res)
+	}
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	resBody := &resumingBody{r: r, body: res.Body, off: start}
+	defer resBody.Close()
+
+	total := int((r.contentLength - start + r.hashChunkSize - 1) / r.hashChunkSize)
+
+	var body io.Reader = resBody
+	if r.exactChunks {
+		body = io.LimitReader(resBody, r.contentLength-start)
+	}
+	var fileHash hash.Hash
+	r.fileSum = nil
+	if start == 0 {
+		fileHash = sha256.New()
+		body = io.TeeReader(body, fileHash)
+	}
+
+	var (
+		hashes  []hash.Hash
+		lengths []int64
+		read    = start
+	)
+	for read < r.contentLength {
+		h := newHash()
+		n, err := io.CopyN(h, body, r.hashChunkSize)
+		read += n
+		if n > 0 {
+			hashes = append(hashes, h)
+			lengths = append(lengths, n)
+			if r.hashProgress != nil {
+				r.hashProgress(len(hashes), total)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.exactChunks {
+		if read != r.contentLength {
+			return nil, fmt.Errorf("%w: read %d of %d bytes", ErrLengthMismatch, read, r.contentLength)
+		}
+		// Anything after the content length means the file is not the one the HEAD request described.
+		if n, _ := resBody.Read(make([]byte, 1)); n > 0 {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrLengthMismatch, r.contentLength)
+		}
+	}
+	r.chunkLengths = lengths
+	if fileHash != nil {
+		r.fileSum = fileHash.Sum(nil)
+	}
+
+	return hashes, nil
+}
+
+// FileDigest returns the SHA-256 of the whole file hashed alongside its chunks by the last HashURL, or nil if it was
+// not hashed whole, by HashURLFrom a chunk other than the first.
+func (r *ReadAtCloser) FileDigest() []byte {
+	return r.fileSum
+}
+
+// ChunkLengths returns the number of bytes in each chunk hashed by the last HashURL, the chunk size for every chunk
+// but the last.
+func (r *ReadAtCloser) ChunkLengths() []int64 {
+	return r.chunkLengths
+}
+
+// SetHashChunkSize sets the size of each chunk hashed by HashURL, for a size chosen once the length is known.
+func (r *ReadAtCloser) SetHashChunkSize(size int64) {
+	r.hashChunkSize = size
+}
+
+// SetHashProgress sets a function HashURL calls after hashing each chunk, with the number of chunks hashed so far and
+// the total number of chunks.
+func (r *ReadAtCloser) SetHashProgress(f func(done, total int)) {
+	r.hashProgress = f
+}
+
+// Length returns the content length of the remote file.
+func (r *ReadAtCloser) Length() int64 {
+	return r.contentLength
+}
+
+// Etag returns the Etag of the remote file, if the server sent one.
+func (r *ReadAtCloser) Etag() string {
+	return r.etag
+}
+
+// URL returns the URL of the remote file, the latest one when it was refreshed by WithURLRefresh.
+func (r *ReadAtCloser) URL() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.url
+}
+
+// Close releases idle connections held by the client.
+func (r *ReadAtCloser) Close() error {
+	r.client.CloseIdleConnections()
+	return nil
+}
+
+// do sends a request for the byte range rng of the file, or all of it if rng is empty. The URL is refreshed first when
+// it is about to expire, and once more to retry a request refused as an expired URL would be.
+func (r *ReadAtCloser) do(method, rng string) (*http.Response, error) {
+	if err := r.refreshIfExpiring(); err != nil {
+		return nil, err
+	}
+
+	u := r.URL()
+	res, err := r.send(method, u, rng)
+	if err != nil || r.refresh == nil || !isExpired(u, res.StatusCode) {
+		return res, err
+	}
+	res.Body.Close()
+
+	if err := r.refreshURL(u); err != nil {
+		return nil, err
+	}
+
+	return r.send(method, r.URL(), rng)
+}
+
+func (r *ReadAtCloser) send(method, u, rng string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range r.header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	if rng != "" {
+		req.Header.Set("Range", rng)
+		// A weak Etag cannot be used with If-Range, the range is then only checked against the Etag of the reply.
+		if r.etag != "" && !strings.HasPrefix(r.etag, "W/") {
+			req.Header.Set("If-Range", r.etag)
+		}
+	}
+
+	return r.client.Do(req)
+}
+
+// checkRange returns an error unless res is the range of the file from off asked for by a range request: a
+// *ChangedError when the server sent the whole file because the If-Range Etag no longer matched, or the range has
+// another Etag or total length than the file had, and a *StatusError for any other status.
+func (r *ReadAtCloser) checkRange(res *http.Response, off int64) error {
+	changed := &ChangedError{
+		URL:                  res.Request.URL.String(),
+		Etag:                 r.etag,
+		CurrentEtag:          res.Header.Get("Etag"),
+		ContentLength:        r.contentLength,
+		CurrentContentLength: r.contentLength,
+	}
+
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		if r.etag != "" && changed.CurrentEtag != r.etag {
+			changed.CurrentContentLength = res.ContentLength
+			return changed
+		}
+		return newStatusError(res)
+	default:
+		return newStatusError(res)
+	}
+
+	if r.etag != "" && changed.CurrentEtag != "" && changed.CurrentEtag != r.etag {
+		return changed
+	}
+	first, total, ok := parseContentRange(res.Header.Get("Content-Range"))
+	if !ok || first != off {
+		return fmt.Errorf("httpio: %s: asked for bytes from %d, got %q", changed.URL, off, res.Header.Get("Content-Range"))
+	}
+	if total >= 0 && total != r.contentLength {
+		changed.CurrentContentLength = total
+		return changed
+	}
+
+	return nil
+}
+
+// parseContentRange returns the first byte and the total length of the Content-Range header s, as in
+// "bytes 100-199/3000", the total -1 when it is unknown ("*").
+func parseContentRange(s string) (first, total int64, ok bool) {
+	s = strings.TrimPrefix(s, "bytes ")
+	i, j := strings.IndexByte(s, '-'), strings.IndexByte(s, '/')
+	if i < 0 || j < i {
+		return 0, 0, false
+	}
+	first, err := strconv.ParseInt(s[:i], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if s[j+1:] == "*" {
+		return first, -1, true
+	}
+	if total, err = strconv.ParseInt(s[j+1:], 10, 64); err != nil {
+		return 0, 0, false
+	}
+
+	return first, total, true
+}
+
+func hasher(size uint) (func() hash.Hash, error) {
+	switch size {
+	case md5.Size:
+		return md5.New, nil
+	case sha256.Size:
+		return sha256.New, nil
+	default:
+		return nil, ErrUnsupportedHash
+	}
+}
@@ -0,0 +1,191 @@
+package httpio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var ErrAddressDenied = errors.New("httpio: address not allowed")
+
+// DialFunc opens the connection of a request to addr, like net.Dialer.DialContext.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// WithTransport sets the RoundTripper requests are sent with, in place of the Transport of the http.Client, such as
+// one reaching the server through a proxy the environment does not describe.
+func WithTransport(t http.RoundTripper) Option {
+	return func(r *ReadAtCloser) {
+		r.transport = t
+	}
+}
+
+// WithDialer sets how the connections of requests are opened, such as over a Unix socket or through a SOCKS5 proxy
+// dialer, keeping the rest of http.DefaultTransport. It is ignored with WithTransport.
+func WithDialer(dial DialFunc) Option {
+	return func(r *ReadAtCloser) {
+		r.dial = dial
+	}
+}
+
+// WithUnixSocket sends every request over the Unix socket at path, for an artifact service listening on one. The host
+// of the URL is only sent as the Host header.
+func WithUnixSocket(path string) Option {
+	return WithDialer(UnixSocketDialer(path))
+}
+
+// WithProxy sends every request through the proxy at proxyURL, an http, https or socks5 URL, in place of any proxy
+// set in the environment. It is ignored with WithTransport.
+func WithProxy(proxyURL *url.URL) Option {
+	return func(r *ReadAtCloser) {
+		r.proxy = proxyURL
+	}
+}
+
+// UnixSocketDialer returns a DialFunc connecting to the Unix socket at path whatever the address asked for.
+func UnixSocketDialer(path string) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	}
+}
+
+// DialPolicy restricts the hosts and addresses RestrictedDialer connects to, such as for a service fetching URLs its
+// clients give it, which must not reach internal services through them.
+type DialPolicy struct {
+	// AllowHosts, if not empty, are the only hosts connected to, as the host of a URL gives them: names, matched
+	// ignoring case, where a leading "*." matches any subdomain, or IP addresses.
+	AllowHosts []string
+	// DenyPrivate refuses loopback, link-local, private, shared, unspecified, multicast and reserved addresses, such as
+	// 127.0.0.1, 169.254.169.254, 10.0.0.1 or fd00::1, whatever host name resolved to them.
+	DenyPrivate bool
+}
+
+// deniedNetworks are the networks DenyPrivate refuses.
+var deniedNetworks = parseCIDRs(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12", "192.0.0.0/24",
+	"192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/4", "240.0.0.0/4",
+	"::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
+
+// lookupIPAddr resolves the host names RestrictedDialer connects to.
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// AllowsHost reports whether host, a name or IP address, is one of AllowHosts, or AllowHosts is empty.
+func (p DialPolicy) AllowsHost(host string) bool {
+	if len(p.AllowHosts) == 0 {
+		return true
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+	for _, h := range p.AllowHosts {
+		h = strings.ToLower(strings.Trim(h, "[]"))
+		if h == host || (strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:])) {
+			return true
+		}
+		if ip := net.ParseIP(h); ip != nil && ip.Equal(net.ParseIP(host)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsIP reports whether the policy lets ip be connected to.
+func (p DialPolicy) AllowsIP(ip net.IP) bool {
+	if !p.DenyPrivate {
+		return true
+	}
+	for _, n := range deniedNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RestrictedDialer returns a DialFunc connecting only to the hosts and addresses the policy allows, failing with
+// ErrAddressDenied otherwise. The host is resolved once and the address checked is the one connected to, so neither a
+// redirect nor a host name that resolves to another address when it is looked up again gets around the policy.
+func RestrictedDialer(p DialPolicy) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if !p.AllowsHost(host) {
+			return nil, fmt.Errorf("%w: %s is not an allowed host", ErrAddressDenied, host)
+		}
+
+		var ips []net.IP
+		if ip := net.ParseIP(host); ip != nil {
+			ips = []net.IP{ip}
+		} else {
+			addrs, err := lookupIPAddr(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+			for _, a := range addrs {
+				ips = append(ips, a.IP)
+			}
+		}
+
+		err = fmt.Errorf("%w: %s has no allowed address", ErrAddressDenied, host)
+		var d net.Dialer
+		for _, ip := range ips {
+			if !p.AllowsIP(ip) {
+				continue
+			}
+			c, dErr := d.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if dErr == nil {
+				return c, nil
+			}
+			err = dErr
+		}
+
+		return nil, err
+	}
+}
+
+// configureTransport gives the client the transport set by WithTransport, WithDialer or WithProxy. The client is copied
+// rather than changed, as it may be shared, such as http.DefaultClient.
+func (r *ReadAtCloser) configureTransport() {
+	t := r.transport
+	if t == nil && (r.dial != nil || r.proxy != nil) {
+		base, ok := http.DefaultTransport.(*http.Transport)
+		if !ok {
+			return
+		}
+		tr := base.Clone()
+		if r.dial != nil {
+			tr.DialContext = r.dial
+		}
+		if r.proxy != nil {
+			tr.Proxy = http.ProxyURL(r.proxy)
+		}
+		t = tr
+	}
+	if t == nil {
+		return
+	}
+
+	c := *r.client
+	c.Transport = t
+	r.client = &c
+}
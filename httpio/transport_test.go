@@ -0,0 +1,130 @@
+package httpio
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDialPolicyAllowsIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"2606:4700::6810:84e5", true},
+		{"127.0.0.1", false},
+		{"127.1.2.3", false},
+		{"169.254.169.254", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"172.31.255.255", false},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"::1", false},
+		{"::", false},
+		{"fe80::1", false},
+		{"fd00:ec2::254", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+	}
+
+	p := DialPolicy{DenyPrivate: true}
+	for _, tt := range tests {
+		if got := p.AllowsIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("AllowsIP(%s) = %t, want %t", tt.ip, got, tt.want)
+		}
+	}
+	if !(DialPolicy{}).AllowsIP(net.ParseIP("127.0.0.1")) {
+		t.Error("a policy without DenyPrivate refused 127.0.0.1")
+	}
+}
+
+func TestDialPolicyAllowsHost(t *testing.T) {
+	p := DialPolicy{AllowHosts: []string{"pkgs.example.com", "*.cdn.example.net", "203.0.113.7", "[2001:db8::1]"}}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"pkgs.example.com", true},
+		{"PKGS.Example.com.", true},
+		{"a.cdn.example.net", true},
+		{"a.b.cdn.example.net", true},
+		{"cdn.example.net", false},
+		{"evilcdn.example.net", false},
+		{"example.com", false},
+		{"pkgs.example.com.evil.test", false},
+		{"203.0.113.7", true},
+		{"2001:db8::1", true},
+		{"[2001:db8:0::1]", true},
+		{"203.0.113.8", false},
+	}
+
+	for _, tt := range tests {
+		if got := p.AllowsHost(tt.host); got != tt.want {
+			t.Errorf("AllowsHost(%q) = %t, want %t", tt.host, got, tt.want)
+		}
+	}
+	if !(DialPolicy{}).AllowsHost("anything.test") {
+		t.Error("a policy without AllowHosts refused a host")
+	}
+}
+
+// fakeResolver makes RestrictedDialer resolve the host names to the addresses for the test.
+func fakeResolver(t *testing.T, hosts map[string]string) {
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		addr, ok := hosts[host]
+		if !ok {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		return []net.IPAddr{{IP: net.ParseIP(addr)}}, nil
+	}
+	t.Cleanup(func() { lookupIPAddr = net.DefaultResolver.LookupIPAddr })
+}
+
+func TestRestrictedDialer(t *testing.T) {
+	s := newFileServer(testFile(1000), `"v1"`)
+	defer s.Close()
+	_, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+
+	// internal.test redirects to the server by its address, which only an allowed host may be connected to.
+	redirect := httptest.NewServer(http.RedirectHandler(s.URL+"/App.pkg", http.StatusFound))
+	defer redirect.Close()
+	_, redirectPort, _ := net.SplitHostPort(redirect.Listener.Addr().String())
+
+	// rebind.test resolves to the loopback address of the server, as a host name an attacker controls may.
+	fakeResolver(t, map[string]string{"pkgs.test": "127.0.0.1", "rebind.test": "127.0.0.1", "internal.test": "127.0.0.1"})
+
+	tests := []struct {
+		name   string
+		policy DialPolicy
+		url    string
+		want   error
+	}{
+		{"no restrictions", DialPolicy{}, s.URL + "/App.pkg", nil},
+		{"allowed host", DialPolicy{AllowHosts: []string{"pkgs.test"}}, "http://pkgs.test:" + port + "/App.pkg", nil},
+		{"other host", DialPolicy{AllowHosts: []string{"pkgs.test"}}, s.URL + "/App.pkg", ErrAddressDenied},
+		{"loopback", DialPolicy{DenyPrivate: true}, s.URL + "/App.pkg", ErrAddressDenied},
+		{"name resolving to loopback", DialPolicy{DenyPrivate: true}, "http://rebind.test:" + port + "/App.pkg", ErrAddressDenied},
+		{"allowed host resolving to loopback", DialPolicy{AllowHosts: []string{"rebind.test"}, DenyPrivate: true}, "http://rebind.test:" + port + "/App.pkg", ErrAddressDenied},
+		{"redirect to another host", DialPolicy{AllowHosts: []string{"internal.test"}}, "http://internal.test:" + redirectPort + "/", ErrAddressDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReadAtCloser(WithURL(tt.url), WithDialer(RestrictedDialer(tt.policy)))
+			if err == nil {
+				r.Close()
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
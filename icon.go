@@ -0,0 +1,73 @@
+package manifestgo
+
+import (
+	"github.com/dbyington/manifestgo/internal/bundle"
+)
+
+// Kinds of the assets of a manifest item.
+const (
+	// AssetKindSoftwarePackage is the package itself, the asset BuildManifest makes.
+	AssetKindSoftwarePackage = "software-package"
+	// AssetKindDisplayImage is the image shown while the package installs, such as the app icon.
+	AssetKindDisplayImage = "display-image"
+	// AssetKindFullSizeImage is a large image of the app, 512x512 pixels.
+	AssetKindFullSizeImage = "full-size-image"
+)
+
+// WithIcon makes ReadDMG and ReadZip also read the icon of the app, the .icns file named by its CFBundleIconFile, and
+// convert its largest representation to PNG, returned by Icon. An app without one is warned about. The payload of a
+// pkg is not read, so a pkg has no icon.
+func WithIcon() Option {
+	return func(p *Package) {
+		p.readIcon = true
+	}
+}
+
+// Icon returns the icon of the app read with WithIcon as a PNG, or nil.
+func (p *Package) Icon() []byte {
+	return p.icon
+}
+
+// setIcon keeps the icon of app as a PNG, warning when it has none.
+func (p *Package) setIcon(app *bundle.App) {
+	switch {
+	case app.IconPath() == "":
+		p.warn(WarningNoIcon, "%s names no .icns icon in its Info.plist", app.Name)
+		return
+	case app.IconErr != nil:
+		p.warn(WarningNoIcon, "%s: reading %s: %s", app.Name, app.IconPath(), app.IconErr)
+		return
+	case app.Icon == nil:
+		p.warn(WarningNoIcon, "%s has no %s", app.Name, app.IconPath())
+		return
+	}
+
+	icon, err := bundle.IconPNG(app.Icon)
+	if err != nil {
+		p.warn(WarningNoIcon, "%s: %s: %s", app.Name, app.IconPath(), err)
+		return
+	}
+	p.icon = icon
+}
+
+// SetDisplayImage sets the display-image asset of the first item of m, the application a device installs, to the
+// image at url, replacing any it had. Devices show it while the package installs.
+func (m *Manifest) SetDisplayImage(url string) {
+	if len(m.ManifestItems) == 0 {
+		return
+	}
+
+	item := m.ManifestItems[0]
+	for _, a := range item.Assets {
+		if a.Kind == AssetKindDisplayImage {
+			a.URL = url
+			return
+		}
+	}
+	item.Assets = append(item.Assets, &Asset{Kind: AssetKindDisplayImage, URL: url})
+}
+
+// isImage reports whether the asset is an image rather than the package, and so has no hashes.
+func (a *Asset) isImage() bool {
+	return a.Kind == AssetKindDisplayImage || a.Kind == AssetKindFullSizeImage
+}
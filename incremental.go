@@ -0,0 +1,298 @@
+package manifestgo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+var ErrChunksNotComparable = errors.New("manifestgo: chunks hashed differently cannot be compared")
+
+// PartialOverwriteFunc tells from the Etags and lengths of the previous and current versions of a package that only
+// its bytes from unchangedBefore on may differ, such as for a package a build system rewrites by appending. ok is
+// false when it cannot tell, and every chunk is hashed.
+type PartialOverwriteFunc func(prevEtag, etag string, prevLength, length int64) (unchangedBefore int64, ok bool)
+
+// UnchangedBefore returns a PartialOverwriteFunc for a package known to be unchanged before offset whatever its Etag,
+// such as one whose previous version was offset bytes long and has only been appended to since.
+func UnchangedBefore(offset int64) PartialOverwriteFunc {
+	return func(prevEtag, etag string, prevLength, length int64) (int64, bool) {
+		return offset, true
+	}
+}
+
+// ChunkRange is a run of consecutive chunks of a package, and the bytes they cover.
+type ChunkRange struct {
+	First  int   `json:"first"`
+	Last   int   `json:"last"`
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+func (r ChunkRange) String() string {
+	chunks := fmt.Sprintf("chunk %d", r.First)
+	if r.Last > r.First {
+		chunks = fmt.Sprintf("chunks %d-%d", r.First, r.Last)
+	}
+	return fmt.Sprintf("%s (bytes %d-%d)", chunks, r.Offset, r.Offset+r.Length-1)
+}
+
+// rangeHasher is implemented by a PackageReader that can hash the chunks from one on, as httpio does.
+type rangeHasher interface {
+	HashURLFrom(size uint, first int) ([]hash.Hash, error)
+}
+
+// WithPreviousAsset sets the asset of the manifest of a previous version of the package, and the Etag it had, whose
+// chunk digests ReadFromURL reuses where the package is unchanged rather than reading those chunks again. All of them
+// are reused when the Etag and length are the same, and those before the offset a PartialOverwriteFunc returns
+// otherwise. The previous asset must have been hashed with the same hash and chunk size. An asset of a plist manifest
+// has no TotalSize, so only its number of chunks is compared with the length of the package.
+func WithPreviousAsset(prev *Asset, etag string) Option {
+	return func(p *Package) {
+		p.previous = prev
+		p.previousEtag = etag
+	}
+}
+
+// WithPartialOverwrite sets the PartialOverwriteFunc telling which chunks of the previous asset are unchanged when the
+// Etag has changed, see WithPreviousAsset.
+func WithPartialOverwrite(f PartialOverwriteFunc) Option {
+	return func(p *Package) {
+		p.partialOverwrite = f
+	}
+}
+
+// ReusedChunks returns the number of chunk digests the last read took from the previous asset instead of hashing.
+func (p *Package) ReusedChunks() int {
+	return p.reusedChunks
+}
+
+// DiffChunks compares the chunks of the package with those of prev, an asset of a previous manifest of it, returning
+// the runs of chunks whose digest differs, or that are past the end of prev. Chunks of prev past the end of the
+// package are not reported. It returns ErrChunksNotComparable if prev was hashed with another hash or chunk size.
+func (p *Package) DiffChunks(prev *Asset) ([]ChunkRange, error) {
+	digests, err := p.previousDigests(prev)
+	if err != nil {
+		return nil, err
+	}
+
+	var ranges []ChunkRange
+	for _, c := range p.ChunkHashes() {
+		if c.Index < len(digests) && digests[c.Index] == c.Digest {
+			continue
+		}
+
+		if n := len(ranges); n > 0 && ranges[n-1].Last == c.Index-1 {
+			ranges[n-1].Last = c.Index
+			ranges[n-1].Length += c.Length
+			continue
+		}
+		ranges = append(ranges, ChunkRange{First: c.Index, Last: c.Index, Offset: c.Offset, Length: c.Length})
+	}
+
+	return ranges, nil
+}
+
+// CompareChunks compares the chunks of the package with those of other, such as a local build and the copy uploaded to
+// a CDN, returning the runs of chunks that differ, in digest or length, or that only one of them has. Both must have
+// been hashed with the same hash and chunk size, or it returns ErrChunksNotComparable. No ranges and packages of the
+// same ContentLength mean they are byte-identical, to the strength of the hash.
+func (p *Package) CompareChunks(other *Package) ([]ChunkRange, error) {
+	if other == nil {
+		return nil, fmt.Errorf("%w: no package to compare with", ErrChunksNotComparable)
+	}
+	if p.hashType != other.hashType {
+		return nil, fmt.Errorf("%w: %s chunks, the other package has %s", ErrChunksNotComparable, p.hashAlgorithm(), other.hashAlgorithm())
+	}
+	if p.hashChunkSize != other.hashChunkSize {
+		return nil, fmt.Errorf("%w: chunks of %d bytes, the other package has %d", ErrChunksNotComparable, p.hashChunkSize, other.hashChunkSize)
+	}
+
+	ours, theirs := p.ChunkHashes(), other.ChunkHashes()
+	var ranges []ChunkRange
+	for i := 0; i < len(ours) || i < len(theirs); i++ {
+		var c ChunkHash
+		switch {
+		case i >= len(ours):
+			c = theirs[i]
+		case i >= len(theirs):
+			c = ours[i]
+		case ours[i].Digest == theirs[i].Digest && ours[i].Length == theirs[i].Length:
+			continue
+		default:
+			c = ours[i]
+		}
+
+		if n := len(ranges); n > 0 && ranges[n-1].Last == i-1 {
+			ranges[n-1].Last = i
+			ranges[n-1].Length += c.Length
+			continue
+		}
+		ranges = append(ranges, ChunkRange{First: i, Last: i, Offset: c.Offset, Length: c.Length})
+	}
+
+	return ranges, nil
+}
+
+// previousDigests returns the chunk digests of prev hashed the way the package is.
+func (p *Package) previousDigests(prev *Asset) ([]string, error) {
+	if prev == nil {
+		return nil, fmt.Errorf("%w: no previous asset", ErrChunksNotComparable)
+	}
+
+	digests, size := prev.SHA256s, prev.SHA256Size
+	if HashScheme(p.hashType) == HashMD5 {
+		digests, size = prev.MD5s, prev.MD5Size
+	}
+	if len(digests) == 0 {
+		return nil, fmt.Errorf("%w: the previous asset has no %s digests", ErrChunksNotComparable, p.hashAlgorithm())
+	}
+	if size != p.chunkSize() {
+		return nil, fmt.Errorf("%w: chunks of %d bytes, previously %d", ErrChunksNotComparable, p.chunkSize(), size)
+	}
+
+	return digests, nil
+}
+
+// reusableHashes returns the digests of the leading chunks of the previous asset that are unchanged in the package of
+// length bytes, as cached hashes.
+func (p *Package) reusableHashes(length int64) []hash.Hash {
+	if p.previous == nil || p.hashChunkSize <= 0 {
+		return nil
+	}
+	digests, err := p.previousDigests(p.previous)
+	if err != nil {
+		p.logf("%s: not reusing the previous chunks: %s", p.reader.URL(), err)
+		return nil
+	}
+
+	// A plist manifest has no TotalSize, its length is then only known to within a chunk by the number of digests.
+	etag, prevLength := p.reader.Etag(), p.previous.TotalSize
+	var n int
+	switch {
+	case etag != "" && etag == p.previousEtag && (prevLength == length || prevLength == 0):
+		if int64(len(digests)) == (length+p.hashChunkSize-1)/p.hashChunkSize {
+			n = len(digests)
+		}
+	case p.partialOverwrite != nil:
+		unchanged, ok := p.partialOverwrite(p.previousEtag, etag, prevLength, length)
+		if !ok {
+			return nil
+		}
+		if unchanged > length {
+			unchanged = length
+		}
+		// Only chunks that were whole in the previous version, and are whole in this one, can be reused.
+		n = int(unchanged / p.hashChunkSize)
+		if prevLength > 0 && int64(n)*p.hashChunkSize > prevLength {
+			n = int(prevLength / p.hashChunkSize)
+		} else if prevLength <= 0 && n >= len(digests) {
+			n = len(digests) - 1
+		}
+	}
+	if n > len(digests) {
+		n = len(digests)
+	}
+
+	hashes := make([]hash.Hash, 0, n)
+	for _, d := range digests[:n] {
+		sum, err := hex.DecodeString(d)
+		if err != nil {
+			return nil
+		}
+		hashes = append(hashes, cachedHash(sum))
+	}
+
+	return hashes
+}
+
+// previousFileSum returns the SHA-256 of the previous asset when all n chunks of the package of length bytes are
+// reused from it, so it is the same package, or nil.
+func (p *Package) previousFileSum(length int64, n int) []byte {
+	if n == 0 || p.hashChunkSize <= 0 || int64(n) != (length+p.hashChunkSize-1)/p.hashChunkSize {
+		return nil
+	}
+	sum, err := hex.DecodeString(p.previous.FullSHA256)
+	if err != nil || len(sum) != sha256.Size {
+		return nil
+	}
+
+	return sum
+}
+
+// checkFileDigest warns when chunks reused from the previous asset left the package without a SHA-256. It is called
+// once hashing is done, as the warnings are not safe to add to while the metadata is read.
+func (p *Package) checkFileDigest() {
+	if p.reusedChunks > 0 && p.fileSum == nil {
+		p.warn(WarningNoFileDigest, "%d chunks of the previous asset were reused without its SHA-256, so the package has none", p.reusedChunks)
+	}
+}
+
+// WithFileDigest makes ReadFromURL hash the whole package, rather than reuse chunks of WithPreviousAsset, when reusing
+// them would leave it without a FullSHA256, for checksums and content stores that need one. Chunks are still reused
+// when the package is unchanged and the previous asset has its SHA-256.
+func WithFileDigest() Option {
+	return func(p *Package) {
+		p.requireFileDigest = true
+	}
+}
+
+// hashChunks hashes the package with its reader, reusing the digests of the previous asset where it is unchanged when
+// the reader can hash from a chunk on. It returns the hashes and their lengths, if the reader records them.
+func (p *Package) hashChunks() ([]hash.Hash, []int64, error) {
+	length := p.reader.Length()
+	reused := p.reusableHashes(length)
+	rh, ok := p.reader.(rangeHasher)
+	// Only a package reused whole can take its SHA-256 from the previous asset, any other reuse leaves it unhashed.
+	fileSum := p.previousFileSum(length, len(reused))
+	if len(reused) > 0 && ok && fileSum == nil && p.requireFileDigest {
+		p.logf("%s: not reusing the previous chunks: the whole package must be hashed for its SHA-256", p.reader.URL())
+		reused = nil
+	}
+	if len(reused) == 0 || !ok {
+		p.reusedChunks = 0
+		hashes, err := p.reader.HashURL(p.hashType)
+		if err != nil {
+			return nil, nil, err
+		}
+		var lengths []int64
+		if r, ok := p.reader.(chunkLengthReporter); ok {
+			lengths = r.ChunkLengths()
+		}
+		if r, ok := p.reader.(fileDigester); ok {
+			p.fileSum = r.FileDigest()
+		}
+		return hashes, lengths, nil
+	}
+
+	p.reusedChunks = len(reused)
+	p.fileSum = fileSum
+	p.logf("%s: reusing %d chunks of the previous asset", p.reader.URL(), len(reused))
+
+	var hashes []hash.Hash
+	if chunks := int((length + p.hashChunkSize - 1) / p.hashChunkSize); len(reused) < chunks {
+		var err error
+		if hashes, err = rh.HashURLFrom(p.hashType, len(reused)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var lengths []int64
+	if r, ok := p.reader.(chunkLengthReporter); ok {
+		lengths = make([]int64, len(reused), len(reused)+len(hashes))
+		for i := range reused {
+			lengths[i] = p.hashChunkSize
+		}
+		// The last reused chunk may be short when every chunk was reused.
+		if rest := length - int64(len(reused)-1)*p.hashChunkSize; rest < p.hashChunkSize {
+			lengths[len(reused)-1] = rest
+		}
+		if len(hashes) > 0 {
+			lengths = append(lengths, r.ChunkLengths()...)
+		}
+	}
+
+	return append(reused, hashes...), lengths, nil
+}
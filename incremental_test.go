@@ -0,0 +1,204 @@
+package manifestgo
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"reflect"
+	"testing"
+)
+
+const testChunkSize = 4
+
+// testPackage returns a package of data hashed with SHA-256 in chunks of testChunkSize.
+func testPackage(data string) *Package {
+	p := &Package{ContentLength: int64(len(data)), hashChunkSize: testChunkSize, hashType: uint(HashSHA256)}
+	for _, d := range testDigests(data) {
+		sum, _ := hex.DecodeString(d)
+		p.Hashes = append(p.Hashes, cachedHash(sum))
+	}
+	return p
+}
+
+// testDigests returns the SHA-256 of each chunk of data.
+func testDigests(data string) []string {
+	var digests []string
+	for off := 0; off < len(data); off += testChunkSize {
+		end := off + testChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := sha256.Sum256([]byte(data[off:end]))
+		digests = append(digests, hex.EncodeToString(sum[:]))
+	}
+	return digests
+}
+
+// testAsset returns the asset of a JSON manifest of data.
+func testAsset(data string) *Asset {
+	return &Asset{SHA256Size: testChunkSize, SHA256s: testDigests(data), TotalSize: int64(len(data))}
+}
+
+// plistAsset returns the asset of a plist manifest of data, which has no TotalSize.
+func plistAsset(data string) *Asset {
+	a := testAsset(data)
+	a.TotalSize = 0
+	return a
+}
+
+// etagReader is a package of length bytes with an Etag, that cannot be read.
+type etagReader struct {
+	length int64
+	etag   string
+}
+
+func (r etagReader) HashURL(uint) ([]hash.Hash, error)       { return nil, errors.New("not readable") }
+func (r etagReader) Length() int64                           { return r.length }
+func (r etagReader) Etag() string                            { return r.etag }
+func (r etagReader) URL() string                             { return "https://cdn.example.com/pkgs/App.pkg" }
+func (r etagReader) ReadAt(p []byte, off int64) (int, error) { return 0, io.EOF }
+
+const testData = "aaaabbbbccccdddd"
+
+func TestDiffChunks(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []ChunkRange
+	}{
+		{"unchanged", testData, nil},
+		{"one chunk", "aaaaXbbbccccdddd", []ChunkRange{{First: 1, Last: 1, Offset: 4, Length: 4}}},
+		{"consecutive chunks", "aaaaXbbbYcccdddd", []ChunkRange{{First: 1, Last: 2, Offset: 4, Length: 8}}},
+		{"first chunk", "Xaaabbbbccccdddd", []ChunkRange{{First: 0, Last: 0, Offset: 0, Length: 4}}},
+		{"two runs", "aaaaXbbbccccYddd", []ChunkRange{{First: 1, Last: 1, Offset: 4, Length: 4}, {First: 3, Last: 3, Offset: 12, Length: 4}}},
+		{"appended", testData + "eeeeff", []ChunkRange{{First: 4, Last: 5, Offset: 16, Length: 6}}},
+		{"truncated", "aaaabbbbcc", []ChunkRange{{First: 2, Last: 2, Offset: 8, Length: 2}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testPackage(tt.data).DiffChunks(testAsset(testData))
+			if err != nil {
+				t.Fatalf("DiffChunks: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffChunksNotComparable(t *testing.T) {
+	md5Only := &Asset{MD5Size: testChunkSize, MD5s: []string{hex.EncodeToString(make([]byte, md5.Size))}}
+	otherSize := testAsset(testData)
+	otherSize.SHA256Size = 2 * testChunkSize
+
+	for name, prev := range map[string]*Asset{"no asset": nil, "other hash": md5Only, "other chunk size": otherSize} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := testPackage(testData).DiffChunks(prev); !errors.Is(err, ErrChunksNotComparable) {
+				t.Errorf("got error %v, want %v", err, ErrChunksNotComparable)
+			}
+		})
+	}
+}
+
+func TestCompareChunks(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		other string
+		want  []ChunkRange
+	}{
+		{"identical", testData, testData, nil},
+		{"changed", testData, "aaaabbbbXcccYddd", []ChunkRange{{First: 2, Last: 3, Offset: 8, Length: 8}}},
+		{"other longer", testData, testData + "eeeeff", []ChunkRange{{First: 4, Last: 5, Offset: 16, Length: 6}}},
+		{"other shorter", testData + "ee", testData, []ChunkRange{{First: 4, Last: 4, Offset: 16, Length: 2}}},
+		{"short last chunk", "aaaabbbbcc", testData, []ChunkRange{{First: 2, Last: 3, Offset: 8, Length: 6}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testPackage(tt.data).CompareChunks(testPackage(tt.other))
+			if err != nil {
+				t.Fatalf("CompareChunks: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareChunksNotComparable(t *testing.T) {
+	md5Package := testPackage(testData)
+	md5Package.hashType = uint(HashMD5)
+	otherSize := testPackage(testData)
+	otherSize.hashChunkSize = 2 * testChunkSize
+
+	for name, other := range map[string]*Package{"no package": nil, "other hash": md5Package, "other chunk size": otherSize} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := testPackage(testData).CompareChunks(other); !errors.Is(err, ErrChunksNotComparable) {
+				t.Errorf("got error %v, want %v", err, ErrChunksNotComparable)
+			}
+		})
+	}
+}
+
+func TestReusableHashes(t *testing.T) {
+	// The previous version of the package is testData, or short when its last chunk was two bytes.
+	const short = "aaaabbbbccccdd"
+	otherSize := testAsset(testData)
+	otherSize.SHA256Size = 2 * testChunkSize
+
+	tests := []struct {
+		name    string
+		prev    *Asset
+		etag    string
+		length  int64
+		partial PartialOverwriteFunc
+		want    int
+	}{
+		{"unchanged", testAsset(testData), `"v1"`, 16, nil, 4},
+		{"unchanged plist", plistAsset(testData), `"v1"`, 16, nil, 4},
+		{"unchanged short plist", plistAsset(short), `"v1"`, 14, nil, 4},
+		{"plist of another length", plistAsset(testData), `"v1"`, 20, nil, 0},
+		{"other length", testAsset(testData), `"v1"`, 15, nil, 0},
+		{"etag changed", testAsset(testData), `"v2"`, 16, nil, 0},
+		{"no etag", testAsset(testData), "", 16, nil, 0},
+		{"other chunk size", otherSize, `"v1"`, 16, nil, 0},
+		{"appended", testAsset(testData), `"v2"`, 22, UnchangedBefore(16), 4},
+		{"unchanged within a chunk", testAsset(testData), `"v2"`, 22, UnchangedBefore(14), 3},
+		{"unknown", testAsset(testData), `"v2"`, 22, func(string, string, int64, int64) (int64, bool) { return 0, false }, 0},
+		// Chunks past the end of either version are not reused, nor the last, short, chunk of the previous one.
+		{"past the package", testAsset(testData), `"v2"`, 10, UnchangedBefore(16), 2},
+		{"past the previous version", testAsset(testData), `"v2"`, 22, UnchangedBefore(100), 4},
+		{"short previous chunk", testAsset(short), `"v2"`, 22, UnchangedBefore(16), 3},
+		{"previous plist", plistAsset(testData), `"v2"`, 22, UnchangedBefore(100), 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Package{
+				hashChunkSize:    testChunkSize,
+				hashType:         uint(HashSHA256),
+				reader:           etagReader{length: tt.length, etag: tt.etag},
+				previous:         tt.prev,
+				previousEtag:     `"v1"`,
+				partialOverwrite: tt.partial,
+			}
+
+			hashes := p.reusableHashes(tt.length)
+			if len(hashes) != tt.want {
+				t.Fatalf("got %d chunks, want %d", len(hashes), tt.want)
+			}
+			for i, h := range hashes {
+				if got := hex.EncodeToString(h.Sum(nil)); got != tt.prev.SHA256s[i] {
+					t.Errorf("chunk %d: got digest %s, want %s", i, got, tt.prev.SHA256s[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package manifestgo
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// InstalledPackage is the receipt of a package installed on a device, its identifier and version as pkgutil reports
+// them.
+type InstalledPackage struct {
+	ID      string `json:"id"`
+	Version string `json:"version,omitempty"`
+}
+
+// Comparison is how a package compares to what a device has installed.
+type Comparison string
+
+const (
+	// ComparisonNotInstalled is a package none of whose component packages are installed.
+	ComparisonNotInstalled Comparison = "not-installed"
+	// ComparisonUpgrade is a package newer than what is installed, or adding component packages to it.
+	ComparisonUpgrade Comparison = "upgrade"
+	// ComparisonDowngrade is a package older than what is installed.
+	ComparisonDowngrade Comparison = "downgrade"
+	// ComparisonSame is a package of the version installed.
+	ComparisonSame Comparison = "same"
+	// ComparisonUnknown is a package whose version, or the installed version, is not known.
+	ComparisonUnknown Comparison = "unknown"
+)
+
+// ComponentComparison compares a component package with its receipt.
+type ComponentComparison struct {
+	ID               string     `json:"id"`
+	Version          string     `json:"version"`
+	InstalledVersion string     `json:"installed_version,omitempty"`
+	Comparison       Comparison `json:"comparison"`
+}
+
+// InstallComparison compares a package with the receipts of a device.
+type InstallComparison struct {
+	// Comparison is that of the package as a whole: a downgrade if any component package is older than installed, an
+	// upgrade if any is newer or not installed while others are, and the same version if all are installed at their
+	// version.
+	Comparison Comparison            `json:"comparison"`
+	Components []ComponentComparison `json:"components"`
+}
+
+// ParseInstalledPackages reads the receipts of a device from the output of pkgutil --pkg-info for one or more
+// packages, or from lines of an identifier and a version separated by spaces, tabs or a comma, as an inventory export
+// might list them. A line of only an identifier, as pkgutil --pkgs prints, is a receipt of an unknown version. Blank
+// lines and # comments are skipped.
+func ParseInstalledPackages(r io.Reader) ([]InstalledPackage, error) {
+	var (
+		installed []InstalledPackage
+		pkgInfo   bool
+	)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// pkgutil --pkg-info prints a package-id line first, then version, volume, location and install-time.
+		if key, value, ok := pkgInfoField(line); ok {
+			pkgInfo = true
+			switch key {
+			case "package-id":
+				installed = append(installed, InstalledPackage{ID: value})
+			case "version":
+				if n := len(installed); n > 0 {
+					installed[n-1].Version = value
+				}
+			}
+			continue
+		}
+		if pkgInfo {
+			continue
+		}
+
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		p := InstalledPackage{ID: fields[0]}
+		if len(fields) > 1 {
+			p.Version = fields[1]
+		}
+		installed = append(installed, p)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return installed, nil
+}
+
+func pkgInfoField(line string) (string, string, bool) {
+	i := strings.Index(line, ": ")
+	if i < 0 {
+		return "", "", false
+	}
+	switch key := line[:i]; key {
+	case "package-id", "version", "volume", "location", "install-time":
+		return key, strings.TrimSpace(line[i+2:]), true
+	}
+
+	return "", "", false
+}
+
+// CompareInstalled compares the component packages of the package with the receipts of a device, telling whether
+// installing it is an upgrade, a downgrade or the same version, for targeting a deployment at the devices it changes.
+func (p *Package) CompareInstalled(installed []InstalledPackage) *InstallComparison {
+	versions := make(map[string]string, len(installed))
+	for _, i := range installed {
+		versions[i.ID] = i.Version
+	}
+
+	c := &InstallComparison{Comparison: ComparisonNotInstalled}
+	var anyInstalled, newer, older, unknown bool
+	for _, ref := range p.componentPackages() {
+		cc := ComponentComparison{ID: ref.ID, Version: ref.Version}
+		v, ok := versions[ref.ID]
+		switch {
+		case !ok:
+			cc.Comparison = ComparisonNotInstalled
+			newer = true
+		case v == "" || ref.Version == "":
+			cc.InstalledVersion = v
+			cc.Comparison = ComparisonUnknown
+			unknown = true
+		default:
+			cc.InstalledVersion = v
+			switch compareVersions(ref.Version, v) {
+			case 1:
+				cc.Comparison = ComparisonUpgrade
+				newer = true
+			case -1:
+				cc.Comparison = ComparisonDowngrade
+				older = true
+			default:
+				cc.Comparison = ComparisonSame
+			}
+		}
+		anyInstalled = anyInstalled || ok
+		c.Components = append(c.Components, cc)
+	}
+
+	switch {
+	case !anyInstalled:
+	case older:
+		c.Comparison = ComparisonDowngrade
+	case newer:
+		c.Comparison = ComparisonUpgrade
+	case unknown:
+		c.Comparison = ComparisonUnknown
+	default:
+		c.Comparison = ComparisonSame
+	}
+
+	return c
+}
+
+// componentPackages returns the identifier and version of each component package, once, taking the version from the
+// pkg-ref giving one.
+func (p *Package) componentPackages() []PkgRef {
+	if p.source == sourcePackageInfo {
+		return []PkgRef{{ID: p.PkgInfo.Identifier, Version: p.PkgInfo.Version}}
+	}
+
+	var refs []PkgRef
+	index := make(map[string]int)
+	for _, ref := range p.PkgRef {
+		if ref.ID == "" {
+			continue
+		}
+		if i, ok := index[ref.ID]; ok {
+			if refs[i].Version == "" {
+				refs[i].Version = ref.Version
+			}
+			continue
+		}
+		index[ref.ID] = len(refs)
+		refs = append(refs, PkgRef{ID: ref.ID, Version: ref.Version})
+	}
+
+	return refs
+}
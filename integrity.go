@@ -0,0 +1,61 @@
+package manifestgo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	xar "github.com/dbyington/manifestgo/goxar"
+)
+
+var ErrMetadataChecksum = errors.New("manifestgo: metadata file does not match its checksum")
+
+// MetadataChecksum is whether a metadata file of a package, its Distribution or PackageInfo, matches the checksum the
+// TOC records for it.
+type MetadataChecksum struct {
+	Name     string `json:"name"`
+	Verified bool   `json:"verified"`
+	// Error says why the file was not verified, such as that a leniently read TOC records no checksum for it.
+	Error string `json:"error,omitempty"`
+}
+
+// MetadataChecksums returns whether each metadata file read matched its checksum. A file that did not fails the read
+// with ErrMetadataChecksum, so a file is only unverified when it has no checksum to check, and the package was read
+// leniently.
+func (p *Package) MetadataChecksums() []MetadataChecksum {
+	if p == nil {
+		return nil
+	}
+
+	return p.metadataChecksums
+}
+
+// readMetadata returns the content of f, checked against its archived checksum before it is unmarshalled, so a
+// corrupted Distribution fails the read rather than giving a wrong manifest. The file is hashed as it is read, so it is
+// read only once. A lenient read has already warned about a missing checksum, and opens the file unchecked; ok is false
+// when it skips a file it cannot decode.
+func (p *Package) readMetadata(f *xar.File) (r io.Reader, ok bool, err error) {
+	b, err := f.ReadVerified()
+	c := MetadataChecksum{Name: f.Name, Verified: err == nil}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	p.metadataChecksums = append(p.metadataChecksums, c)
+
+	switch {
+	case err == nil:
+		return bytes.NewReader(b), true, nil
+	case errors.Is(err, xar.ErrChecksumMismatch):
+		return nil, false, fmt.Errorf("%w: %s", ErrMetadataChecksum, f.Name)
+	case p.lenient && (errors.Is(err, xar.ErrNoFileChecksum) || errors.Is(err, xar.ErrChecksumUnsupported)):
+		// Nothing was read, there being no checksum to check it against.
+		return p.openMetadata(f)
+	case p.lenient && errors.Is(err, xar.ErrFileEncodingUnsupported):
+		p.warn(WarningUnsupportedEncoding, "skipping %s: %s", f.Name, err)
+		p.recovered = true
+		return nil, false, nil
+	}
+
+	return nil, false, fmt.Errorf("manifestgo: %s: %w", f.Name, err)
+}
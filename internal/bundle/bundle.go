@@ -0,0 +1,91 @@
+// Package bundle reads the metadata of a macOS app bundle from its Info.plist, finds the app in a zip archive, and
+// converts its icon to PNG.
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/groob/plist"
+)
+
+var ErrNoApp = errors.New("bundle: no app at the top level")
+
+const (
+	// MaxInfoPlistSize is the largest Info.plist read, well above that of any app.
+	MaxInfoPlistSize = 8 << 20
+	// MaxIconSize is the largest .icns file read, above that of an icon with every representation up to 1024x1024.
+	MaxIconSize = 32 << 20
+)
+
+// ReadOptions say what is read of an app besides its Info.plist.
+type ReadOptions struct {
+	// Icon reads the .icns file named by CFBundleIconFile into App.Icon.
+	Icon bool
+}
+
+// App is the metadata of an app, read from its Info.plist.
+type App struct {
+	// Name is the name of the app bundle, such as "Example.app".
+	Name                 string
+	BundleIdentifier     string `plist:"CFBundleIdentifier"`
+	BundleName           string `plist:"CFBundleName"`
+	DisplayName          string `plist:"CFBundleDisplayName"`
+	ShortVersion         string `plist:"CFBundleShortVersionString"`
+	Version              string `plist:"CFBundleVersion"`
+	MinimumSystemVersion string `plist:"LSMinimumSystemVersion"`
+	IconFile             string `plist:"CFBundleIconFile"`
+
+	// Icon is the .icns file of the app when ReadOptions.Icon is set, nil if it has none.
+	Icon []byte `plist:"-"`
+	// IconErr is why the icon could not be read, which does not fail reading the app.
+	IconErr error `plist:"-"`
+}
+
+// ParseInfoPlist returns the metadata in b, the XML or binary Info.plist of the app bundle name.
+func ParseInfoPlist(name string, b []byte) (*App, error) {
+	a := &App{Name: name}
+	if err := plist.Unmarshal(b, a); err != nil {
+		return nil, fmt.Errorf("%s: Info.plist: %w", name, err)
+	}
+
+	return a, nil
+}
+
+// Title returns the name of the app shown to the user: its display name, bundle name or bundle file name.
+func (a *App) Title() string {
+	switch {
+	case a.DisplayName != "":
+		return a.DisplayName
+	case a.BundleName != "":
+		return a.BundleName
+	}
+
+	return strings.TrimSuffix(a.Name, ".app")
+}
+
+// BundleVersion returns the version of the app shown to the user, its short version string, or its build version if
+// it has none.
+func (a *App) BundleVersion() string {
+	if a.ShortVersion != "" {
+		return a.ShortVersion
+	}
+
+	return a.Version
+}
+
+// IconPath returns the path of the .icns file of the app in the bundle, such as "Contents/Resources/AppIcon.icns", or
+// "" if it names none. An app with only an asset catalog icon names none.
+func (a *App) IconPath() string {
+	if a.IconFile == "" {
+		return ""
+	}
+	name := a.IconFile
+	if path.Ext(name) == "" {
+		name += ".icns"
+	}
+
+	return "Contents/Resources/" + name
+}
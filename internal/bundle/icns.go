@@ -0,0 +1,131 @@
+package bundle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+var ErrNoIcon = errors.New("bundle: no PNG or RLE representation in the icon")
+
+var pngMagic = []byte("\x89PNG\r\n\x1a\n")
+
+// rleIcons are the sizes of the 24-bit RLE representations of an .icns file, and the type of the 8-bit mask of each.
+var rleIcons = map[string]struct {
+	size int
+	mask string
+}{
+	"is32": {16, "s8mk"},
+	"il32": {32, "l8mk"},
+	"ih32": {48, "h8mk"},
+	"it32": {128, "t8mk"},
+}
+
+// IconPNG returns the largest representation of the .icns file b as a PNG. PNG representations, which icons of 256x256
+// and larger are, are returned as they are, and RLE ones up to 128x128 converted. JPEG 2000 representations are not
+// read.
+func IconPNG(b []byte) ([]byte, error) {
+	if len(b) < 8 || string(b[:4]) != "icns" {
+		return nil, errors.New("bundle: not an icns file")
+	}
+	length := int(binary.BigEndian.Uint32(b[4:8]))
+	if length > len(b) || length < 8 {
+		return nil, fmt.Errorf("bundle: icns file of %d bytes claims %d", len(b), length)
+	}
+
+	entries := make(map[string][]byte)
+	var order []string
+	for off := 8; off+8 <= length; {
+		typ := string(b[off : off+4])
+		n := int(binary.BigEndian.Uint32(b[off+4 : off+8]))
+		if n < 8 || off+n > length {
+			return nil, fmt.Errorf("bundle: icns entry %q of %d bytes at %d", typ, n, off)
+		}
+		entries[typ] = b[off+8 : off+n]
+		order = append(order, typ)
+		off += n
+	}
+
+	var (
+		best     []byte
+		bestSize int
+	)
+	for _, typ := range order {
+		data := entries[typ]
+		if bytes.HasPrefix(data, pngMagic) {
+			c, err := png.DecodeConfig(bytes.NewReader(data))
+			if err == nil && c.Width > bestSize {
+				best, bestSize = data, c.Width
+			}
+			continue
+		}
+		if rle, ok := rleIcons[typ]; ok && rle.size > bestSize {
+			img, err := decodeRLEIcon(typ, data, entries[rle.mask], rle.size)
+			if err != nil {
+				continue
+			}
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, img); err != nil {
+				return nil, err
+			}
+			best, bestSize = buf.Bytes(), rle.size
+		}
+	}
+	if best == nil {
+		return nil, ErrNoIcon
+	}
+
+	return best, nil
+}
+
+// decodeRLEIcon decodes the 24-bit RLE representation data of type typ, size pixels square, with its 8-bit mask,
+// opaque if it has none.
+func decodeRLEIcon(typ string, data, mask []byte, size int) (image.Image, error) {
+	// it32 data starts with four zero bytes.
+	if typ == "it32" && len(data) >= 4 {
+		data = data[4:]
+	}
+
+	pixels := size * size
+	channels := make([]byte, 0, 3*pixels)
+	for i := 0; i < len(data) && len(channels) < 3*pixels; {
+		c := int(data[i])
+		i++
+		if c&0x80 != 0 {
+			if i >= len(data) {
+				break
+			}
+			for n := c - 125; n > 0; n-- {
+				channels = append(channels, data[i])
+			}
+			i++
+			continue
+		}
+		if i+c+1 > len(data) {
+			break
+		}
+		channels = append(channels, data[i:i+c+1]...)
+		i += c + 1
+	}
+	if len(channels) < 3*pixels {
+		return nil, fmt.Errorf("bundle: %s decodes to %d of %d bytes", typ, len(channels), 3*pixels)
+	}
+	if len(mask) != pixels {
+		mask = nil
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for p := 0; p < pixels; p++ {
+		a := byte(0xff)
+		if mask != nil {
+			a = mask[p]
+		}
+		img.SetNRGBA(p%size, p/size, color.NRGBA{R: channels[p], G: channels[pixels+p], B: channels[2*pixels+p], A: a})
+	}
+
+	return img, nil
+}
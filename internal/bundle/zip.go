@@ -0,0 +1,68 @@
+package bundle
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// ReadZip returns the metadata of the first app at the top level of the zip archive read from r, which is size bytes,
+// as made by ditto -c -k --keepParent or zip -r. Only the central directory, the Info.plist and, with opts.Icon, the
+// icon are read.
+func ReadZip(r io.ReaderAt, size int64, opts ReadOptions) (*App, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range zr.File {
+		parts := strings.Split(f.Name, "/")
+		if len(parts) != 3 || !strings.HasSuffix(strings.ToLower(parts[0]), ".app") ||
+			!strings.EqualFold(parts[1], "Contents") || !strings.EqualFold(parts[2], "Info.plist") {
+			continue
+		}
+
+		b, err := readZipFile(f, MaxInfoPlistSize)
+		if err != nil {
+			return nil, fmt.Errorf("%s: Info.plist: %w", parts[0], err)
+		}
+		a, err := ParseInfoPlist(parts[0], b)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Icon && a.IconPath() != "" {
+			a.Icon, a.IconErr = readZipIcon(zr, parts[0]+"/"+a.IconPath())
+		}
+
+		return a, nil
+	}
+
+	return nil, ErrNoApp
+}
+
+// readZipIcon returns the file name in the archive, matched case-insensitively as on a Mac, or nil if there is none.
+func readZipIcon(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if strings.EqualFold(f.Name, name) {
+			return readZipFile(f, MaxIconSize)
+		}
+	}
+
+	return nil, nil
+}
+
+// readZipFile returns the contents of f, failing if it has more than max bytes.
+func readZipFile(f *zip.File, max int64) ([]byte, error) {
+	if f.UncompressedSize64 > uint64(max) {
+		return nil, fmt.Errorf("file of %d bytes", f.UncompressedSize64)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return ioutil.ReadAll(io.LimitReader(rc, max))
+}
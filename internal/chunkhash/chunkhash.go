@@ -0,0 +1,43 @@
+// Package chunkhash hashes a stream in chunks, for the readers that read a package whole from the start to hash it.
+package chunkhash
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"hash"
+	"io"
+
+	"github.com/dbyington/manifestgo/httpio"
+)
+
+// Hasher returns the constructor of the hash whose sum is size bytes, md5.Size or sha256.Size, failing with
+// httpio.ErrUnsupportedHash like the readers of httpio.
+func Hasher(size uint) (func() hash.Hash, error) {
+	switch size {
+	case md5.Size:
+		return md5.New, nil
+	case sha256.Size:
+		return sha256.New, nil
+	}
+
+	return nil, httpio.ErrUnsupportedHash
+}
+
+// Hash reads r to its end, returning a hash made by newHash of each chunkSize bytes of it. fileHash is written the
+// whole stream too.
+func Hash(r io.Reader, newHash func() hash.Hash, chunkSize int64, fileHash hash.Hash) ([]hash.Hash, error) {
+	var hashes []hash.Hash
+	for {
+		h := newHash()
+		n, err := io.CopyN(io.MultiWriter(h, fileHash), r, chunkSize)
+		if n > 0 {
+			hashes = append(hashes, h)
+		}
+		if err == io.EOF {
+			return hashes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Package dmg reads the Info.plist of the app in an Apple disk image, a UDIF image holding an HFS+ file system, for
+// the metadata of a disk image distributed as-is.
+package dmg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dbyington/manifestgo/internal/bundle"
+)
+
+var (
+	ErrNotDMG      = errors.New("dmg: not a UDIF disk image")
+	ErrCorrupt     = errors.New("dmg: corrupt disk image")
+	ErrUnsupported = errors.New("dmg: unsupported disk image")
+	ErrNoApp       = bundle.ErrNoApp
+)
+
+// ReadApp returns the metadata of the first app at the top level of the disk image read from r, which is size bytes,
+// and its icon with opts.Icon. Only images of HFS+ file systems, raw or compressed with zlib, bzip2 or ADC, can be
+// read.
+func ReadApp(r io.ReaderAt, size int64, opts bundle.ReadOptions) (*bundle.App, error) {
+	d, err := openDisk(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	part, err := d.hfsPartition()
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := openVolume(part)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := v.children(rootFolderID)
+	if err != nil {
+		return nil, err
+	}
+	var app *catalogRecord
+	for i, rec := range root {
+		if rec.folder && strings.HasSuffix(strings.ToLower(rec.name), ".app") {
+			app = &root[i]
+			break
+		}
+	}
+	if app == nil {
+		return nil, ErrNoApp
+	}
+
+	info, err := v.lookup(app.id, "Contents", "Info.plist")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", app.name, err)
+	}
+
+	b, err := v.readFile(info, bundle.MaxInfoPlistSize)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", app.name, err)
+	}
+
+	a, err := bundle.ParseInfoPlist(app.name, b)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Icon && a.IconPath() != "" {
+		a.Icon, a.IconErr = v.readIcon(app.id, a.IconPath())
+	}
+
+	return a, nil
+}
+
+// readIcon returns the file at the path below the app folder id, or nil if there is none.
+func (v *volume) readIcon(id uint32, path string) ([]byte, error) {
+	rec, err := v.lookup(id, strings.Split(path, "/")...)
+	if errors.Is(err, ErrNoApp) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return v.readFile(rec, bundle.MaxIconSize)
+}
@@ -0,0 +1,111 @@
+package dmg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dbyington/manifestgo/internal/bundle"
+)
+
+// The images in testdata each hold a 1MiB HFS+ volume with Foo.app and Zed.app at its top level, and enough other
+// entries for a catalog B-tree of several levels. Foo.app/Contents/Info.plist is stored plainly in plain.dmg, with
+// decmpfs in an extended attribute in type3.dmg and in the resource fork in type4.dmg. Their chunks are zlib
+// compressed, while those of mixed.dmg.gz, gzipped as its raw chunks are mostly zeroes, cycle through zlib, raw,
+// bzip2, ADC and zero fill. The chunks of lzfse.dmg claim to be LZFSE and noapp.dmg has folders without the .app
+// suffix.
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(name, ".gz") {
+		return b
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err = ioutil.ReadAll(zr); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestReadApp(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"plain", "plain.dmg"},
+		{"decmpfs type 3", "type3.dmg"},
+		{"decmpfs type 4", "type4.dmg"},
+		{"mixed chunks", "mixed.dmg.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := readTestdata(t, tt.file)
+			a, err := ReadApp(bytes.NewReader(b), int64(len(b)), bundle.ReadOptions{})
+			if err != nil {
+				t.Fatalf("ReadApp: %v", err)
+			}
+
+			want := bundle.App{
+				Name:                 "Foo.app",
+				BundleIdentifier:     "com.example.foo",
+				BundleName:           "Foo",
+				ShortVersion:         "1.2.3",
+				Version:              "123",
+				MinimumSystemVersion: "11.0",
+			}
+			if !reflect.DeepEqual(*a, want) {
+				t.Errorf("got %+v, want %+v", *a, want)
+			}
+		})
+	}
+}
+
+func TestReadAppErrors(t *testing.T) {
+	plain := readTestdata(t, "plain.dmg")
+
+	// The first zlib chunk starts the image.
+	corrupt := append([]byte(nil), plain...)
+	corrupt[10] ^= 0xff
+
+	// The length of the property list in the trailer, negative as an int64.
+	negative := append([]byte(nil), plain...)
+	binary.BigEndian.PutUint64(negative[len(negative)-512+224:], 1<<63)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"not an image", bytes.Repeat([]byte("not a disk image "), 64), ErrNotDMG},
+		{"too short", plain[:100], ErrNotDMG},
+		{"no trailer", plain[:len(plain)-512], ErrNotDMG},
+		{"bad chunk", corrupt, ErrCorrupt},
+		{"negative property list length", negative, ErrCorrupt},
+		{"lzfse chunks", readTestdata(t, "lzfse.dmg"), ErrUnsupported},
+		{"no app", readTestdata(t, "noapp.dmg"), ErrNoApp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadApp(bytes.NewReader(tt.data), int64(len(tt.data)), bundle.ReadOptions{})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+//go:build gofuzz
+// +build gofuzz
+
+package dmg
+
+import (
+	"bytes"
+
+	"github.com/dbyington/manifestgo/internal/bundle"
+)
+
+// Fuzz is the go-fuzz entry point for the disk image reader.
+func Fuzz(data []byte) int {
+	if _, err := ReadApp(bytes.NewReader(data), int64(len(data)), bundle.ReadOptions{Icon: true}); err != nil {
+		return 0
+	}
+
+	return 1
+}
@@ -0,0 +1,536 @@
+package dmg
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	volumeHeaderOffset = 1024
+	rootFolderID       = 2
+
+	// The kinds of B-tree nodes.
+	nodeLeaf  = -1
+	nodeIndex = 0
+
+	// The types of catalog records.
+	catalogFolder = 1
+	catalogFile   = 2
+
+	// compressedFlag is UF_COMPRESSED, set in the owner flags of a file compressed with decmpfs.
+	compressedFlag = 0x20
+	// inlineAttribute is the type of an attribute record holding its data.
+	inlineAttribute  = 0x10
+	decmpfsAttribute = "com.apple.decmpfs"
+	decmpfsMagic     = 0x636d7066
+)
+
+// extent is a run of allocation blocks.
+type extent struct {
+	start, count uint32
+}
+
+// fork is the data or resource fork of a file: its size and first eight extents.
+type fork struct {
+	size    uint64
+	extents [8]extent
+}
+
+func parseFork(b []byte) fork {
+	f := fork{size: binary.BigEndian.Uint64(b)}
+	for i := range f.extents {
+		f.extents[i] = extent{binary.BigEndian.Uint32(b[16+i*8:]), binary.BigEndian.Uint32(b[20+i*8:])}
+	}
+
+	return f
+}
+
+// volume reads an HFS+ file system.
+type volume struct {
+	r          io.ReaderAt
+	blockSize  int64
+	catalog    *btree
+	attributes *btree
+}
+
+// catalogRecord is a file or folder of the catalog.
+type catalogRecord struct {
+	name       string
+	folder     bool
+	id         uint32
+	compressed bool
+	data       fork
+	resource   fork
+}
+
+func openVolume(r io.ReaderAt) (*volume, error) {
+	h := make([]byte, 512)
+	if _, err := r.ReadAt(h, volumeHeaderOffset); err != nil {
+		return nil, err
+	}
+
+	switch string(h[:2]) {
+	case "H+", "HX":
+	case "BD":
+		return nil, fmt.Errorf("%w: HFS file system", ErrUnsupported)
+	default:
+		apfs := make([]byte, 4)
+		if _, err := r.ReadAt(apfs, 32); err == nil && string(apfs) == "NXSB" {
+			return nil, fmt.Errorf("%w: APFS file system", ErrUnsupported)
+		}
+		return nil, fmt.Errorf("%w: no HFS+ volume header", ErrUnsupported)
+	}
+
+	v := &volume{r: r, blockSize: int64(binary.BigEndian.Uint32(h[40:]))}
+	if v.blockSize < 512 || v.blockSize&(v.blockSize-1) != 0 {
+		return nil, fmt.Errorf("%w: block size %d", ErrCorrupt, v.blockSize)
+	}
+
+	var err error
+	if v.catalog, err = v.openBTree(parseFork(h[272:])); err != nil {
+		return nil, fmt.Errorf("catalog: %w", err)
+	}
+	if attributes := parseFork(h[352:]); attributes.size > 0 {
+		if v.attributes, err = v.openBTree(attributes); err != nil {
+			return nil, fmt.Errorf("attributes: %w", err)
+		}
+	}
+
+	return v, nil
+}
+
+// forkReader returns a reader of the contents of f. Files with more than eight extents, continued in the extents
+// overflow file, are not supported.
+func (v *volume) forkReader(f fork) (io.ReaderAt, error) {
+	var blocks int64
+	for _, e := range f.extents {
+		blocks += int64(e.count)
+	}
+	if uint64(blocks*v.blockSize) < f.size {
+		return nil, fmt.Errorf("%w: fragmented file", ErrUnsupported)
+	}
+
+	return io.NewSectionReader(&forkReaderAt{v, f}, 0, int64(f.size)), nil
+}
+
+type forkReaderAt struct {
+	v *volume
+	f fork
+}
+
+func (r *forkReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	for _, e := range r.f.extents {
+		length := int64(e.count) * r.v.blockSize
+		if off >= length {
+			off -= length
+			continue
+		}
+
+		m := len(p) - n
+		if int64(m) > length-off {
+			m = int(length - off)
+		}
+		read, err := r.v.r.ReadAt(p[n:n+m], int64(e.start)*r.v.blockSize+off)
+		n += read
+		if err != nil {
+			return n, err
+		}
+		if n == len(p) {
+			return n, nil
+		}
+		off = 0
+	}
+
+	return n, io.EOF
+}
+
+// children returns the files and folders in the folder id, sorted by name.
+func (v *volume) children(id uint32) ([]catalogRecord, error) {
+	var recs []catalogRecord
+	err := v.catalog.scan(id, catalogKeyID, func(key, data []byte) error {
+		if len(key) < 6 || len(data) < 2 {
+			return fmt.Errorf("%w: short catalog record", ErrCorrupt)
+		}
+		name, err := hfsString(key[4:])
+		if err != nil {
+			return err
+		}
+
+		switch int16(binary.BigEndian.Uint16(data)) {
+		case catalogFolder:
+			if len(data) < 12 {
+				return fmt.Errorf("%w: short folder record", ErrCorrupt)
+			}
+			recs = append(recs, catalogRecord{name: name, folder: true, id: binary.BigEndian.Uint32(data[8:])})
+		case catalogFile:
+			if len(data) < 248 {
+				return fmt.Errorf("%w: short file record", ErrCorrupt)
+			}
+			recs = append(recs, catalogRecord{
+				name:       name,
+				id:         binary.BigEndian.Uint32(data[8:]),
+				compressed: data[41]&compressedFlag != 0,
+				data:       parseFork(data[88:]),
+				resource:   parseFork(data[168:]),
+			})
+		}
+		return nil
+	})
+
+	return recs, err
+}
+
+// lookup returns the record at path below the folder id, matching names case-insensitively as HFS+ does.
+func (v *volume) lookup(id uint32, path ...string) (catalogRecord, error) {
+	var rec catalogRecord
+	for i, name := range path {
+		recs, err := v.children(id)
+		if err != nil {
+			return rec, err
+		}
+
+		found := false
+		for _, r := range recs {
+			if strings.EqualFold(r.name, name) && r.folder == (i < len(path)-1) {
+				rec, found = r, true
+				break
+			}
+		}
+		if !found {
+			return rec, fmt.Errorf("%w: no %s", ErrNoApp, strings.Join(path[:i+1], "/"))
+		}
+		id = rec.id
+	}
+
+	return rec, nil
+}
+
+// readFile returns the contents of the file rec, failing if it has more than max bytes.
+func (v *volume) readFile(rec catalogRecord, max int64) ([]byte, error) {
+	if rec.compressed {
+		return v.readCompressedFile(rec, max)
+	}
+
+	if rec.data.size > uint64(max) {
+		return nil, fmt.Errorf("%w: file of %d bytes", ErrCorrupt, rec.data.size)
+	}
+
+	return v.readFork(rec.data)
+}
+
+func (v *volume) readFork(f fork) ([]byte, error) {
+	r, err := v.forkReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, f.size)
+	if _, err := r.ReadAt(b, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// readCompressedFile returns the contents of a file compressed by decmpfs with zlib, held in its com.apple.decmpfs
+// attribute (type 3) or resource fork (type 4).
+func (v *volume) readCompressedFile(rec catalogRecord, max int64) ([]byte, error) {
+	if v.attributes == nil {
+		return nil, fmt.Errorf("%w: compressed file without attributes", ErrCorrupt)
+	}
+
+	var attr []byte
+	err := v.attributes.scan(rec.id, attributeKeyID, func(key, data []byte) error {
+		if len(key) < 12 {
+			return fmt.Errorf("%w: short attribute key", ErrCorrupt)
+		}
+		name, err := hfsString(key[10:])
+		if err != nil || name != decmpfsAttribute {
+			return err
+		}
+		if len(data) < 16 || binary.BigEndian.Uint32(data) != inlineAttribute {
+			return fmt.Errorf("%w: %s is not inline", ErrUnsupported, decmpfsAttribute)
+		}
+		size := binary.BigEndian.Uint32(data[12:])
+		if uint64(size) > uint64(len(data)-16) {
+			return fmt.Errorf("%w: short attribute", ErrCorrupt)
+		}
+		attr = data[16 : 16+size]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(attr) < 16 || binary.LittleEndian.Uint32(attr) != decmpfsMagic {
+		return nil, fmt.Errorf("%w: compressed file without a %s attribute", ErrCorrupt, decmpfsAttribute)
+	}
+
+	typ := binary.LittleEndian.Uint32(attr[4:])
+	size := binary.LittleEndian.Uint64(attr[8:])
+	if size > uint64(max) {
+		return nil, fmt.Errorf("%w: file of %d bytes", ErrCorrupt, size)
+	}
+
+	switch typ {
+	case 3:
+		return inflateBlock(attr[16:], int(size))
+	case 4:
+		return v.readResourceCompressedFile(rec.resource, int(size))
+	default:
+		return nil, fmt.Errorf("%w: decmpfs compression type %d", ErrUnsupported, typ)
+	}
+}
+
+// readResourceCompressedFile returns the contents of a file compressed into its resource fork: a table of zlib
+// compressed blocks of 64 KiB each.
+func (v *volume) readResourceCompressedFile(f fork, size int) ([]byte, error) {
+	rsrc, err := v.readFork(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(rsrc) < 16 {
+		return nil, fmt.Errorf("%w: short resource fork", ErrCorrupt)
+	}
+
+	// The block table is the first resource: its length, then the number of blocks and their offsets and lengths.
+	table := int64(binary.BigEndian.Uint32(rsrc)) + 4
+	if table+4 > int64(len(rsrc)) {
+		return nil, fmt.Errorf("%w: short resource fork", ErrCorrupt)
+	}
+	n := int64(binary.LittleEndian.Uint32(rsrc[table:]))
+	if table+4+n*8 > int64(len(rsrc)) {
+		return nil, fmt.Errorf("%w: short resource fork", ErrCorrupt)
+	}
+
+	out := make([]byte, 0, size)
+	for i := int64(0); i < n; i++ {
+		e := rsrc[table+4+i*8:]
+		off := table + int64(binary.LittleEndian.Uint32(e))
+		length := int64(binary.LittleEndian.Uint32(e[4:]))
+		if off+length > int64(len(rsrc)) {
+			return nil, fmt.Errorf("%w: block %d past the resource fork", ErrCorrupt, i)
+		}
+
+		b, err := inflateBlock(rsrc[off:off+length], size-len(out))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+	}
+	if len(out) != size {
+		return nil, fmt.Errorf("%w: decompressed %d bytes, expected %d", ErrCorrupt, len(out), size)
+	}
+
+	return out, nil
+}
+
+// inflateBlock decompresses a decmpfs zlib block of at most size bytes. A block starting 0xff, or with a low nibble of
+// 0xf for type 3, is stored uncompressed after that byte.
+func inflateBlock(b []byte, size int) ([]byte, error) {
+	if len(b) > 0 && b[0]&0x0f == 0x0f {
+		if len(b)-1 > size {
+			return nil, fmt.Errorf("%w: block of more than %d bytes", ErrCorrupt, size)
+		}
+		return b[1:], nil
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupt, err)
+	}
+	defer zr.Close()
+
+	out, err := readAtMost(zr, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupt, err)
+	}
+
+	return out, nil
+}
+
+// hfsString decodes an HFSUniStr255, a length and that many UTF-16 code units.
+func hfsString(b []byte) (string, error) {
+	if len(b) < 2 {
+		return "", fmt.Errorf("%w: short name", ErrCorrupt)
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+2*n {
+		return "", fmt.Errorf("%w: short name", ErrCorrupt)
+	}
+
+	u := make([]uint16, n)
+	for i := range u {
+		u[i] = binary.BigEndian.Uint16(b[2+2*i:])
+	}
+
+	return string(utf16.Decode(u)), nil
+}
+
+// catalogKeyID returns the parent folder id of a catalog key.
+func catalogKeyID(key []byte) uint32 {
+	if len(key) < 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(key)
+}
+
+// attributeKeyID returns the file id of an attributes key, which follows two bytes of padding.
+func attributeKeyID(key []byte) uint32 {
+	if len(key) < 6 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(key[2:])
+}
+
+// btree reads the records of an HFS+ B-tree.
+type btree struct {
+	r          io.ReaderAt
+	nodeSize   int64
+	root       uint32
+	totalNodes uint32
+}
+
+func (v *volume) openBTree(f fork) (*btree, error) {
+	r, err := v.forkReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	h := make([]byte, 14+106)
+	if _, err := r.ReadAt(h, 0); err != nil {
+		return nil, err
+	}
+
+	t := &btree{
+		r:          r,
+		root:       binary.BigEndian.Uint32(h[16:]),
+		nodeSize:   int64(binary.BigEndian.Uint16(h[32:])),
+		totalNodes: binary.BigEndian.Uint32(h[36:]),
+	}
+	if t.nodeSize < 512 || t.nodeSize&(t.nodeSize-1) != 0 {
+		return nil, fmt.Errorf("%w: node size %d", ErrCorrupt, t.nodeSize)
+	}
+
+	return t, nil
+}
+
+// node reads node n, returning its kind, forward link and records.
+func (t *btree) node(n uint32) (int8, uint32, [][]byte, error) {
+	if n >= t.totalNodes {
+		return 0, 0, nil, fmt.Errorf("%w: node %d of %d", ErrCorrupt, n, t.totalNodes)
+	}
+
+	b := make([]byte, t.nodeSize)
+	if _, err := t.r.ReadAt(b, int64(n)*t.nodeSize); err != nil {
+		return 0, 0, nil, err
+	}
+
+	kind := int8(b[8])
+	numRecords := int(binary.BigEndian.Uint16(b[10:]))
+	if 14+2*(numRecords+1) > len(b) {
+		return 0, 0, nil, fmt.Errorf("%w: node %d has %d records", ErrCorrupt, n, numRecords)
+	}
+
+	// The offsets of the records, and of the free space after them, are at the end of the node, last to first.
+	offset := func(i int) int { return int(binary.BigEndian.Uint16(b[len(b)-2*(i+1):])) }
+	records := make([][]byte, numRecords)
+	for i := range records {
+		start, end := offset(i), offset(i+1)
+		if start < 14 || end < start || end > len(b) {
+			return 0, 0, nil, fmt.Errorf("%w: record %d of node %d", ErrCorrupt, i, n)
+		}
+		records[i] = b[start:end]
+	}
+
+	return kind, binary.BigEndian.Uint32(b), records, nil
+}
+
+// splitRecord returns the key of a record, without its length, and what follows it.
+func splitRecord(rec []byte) ([]byte, []byte, error) {
+	if len(rec) < 2 {
+		return nil, nil, fmt.Errorf("%w: short record", ErrCorrupt)
+	}
+	n := int(binary.BigEndian.Uint16(rec)) + 2
+	if n > len(rec) {
+		return nil, nil, fmt.Errorf("%w: key longer than its record", ErrCorrupt)
+	}
+
+	return rec[2:n], rec[n:], nil
+}
+
+// scan calls fn with the key and data of each leaf record whose keyID is id, in key order. Keys are ordered by their id
+// first, so the records are found by descending to the last child whose first key has a smaller id.
+func (t *btree) scan(id uint32, keyID func([]byte) uint32, fn func(key, data []byte) error) error {
+	n := t.root
+	for depth := 0; ; depth++ {
+		if depth > 16 {
+			return fmt.Errorf("%w: B-tree too deep", ErrCorrupt)
+		}
+
+		kind, _, records, err := t.node(n)
+		if err != nil {
+			return err
+		}
+		if kind == nodeLeaf {
+			break
+		}
+		if kind != nodeIndex {
+			return fmt.Errorf("%w: node %d is of kind %d", ErrCorrupt, n, kind)
+		}
+
+		var child uint32
+		for i, rec := range records {
+			key, data, err := splitRecord(rec)
+			if err != nil {
+				return err
+			}
+			if len(data) < 4 {
+				return fmt.Errorf("%w: short index record", ErrCorrupt)
+			}
+			if i > 0 && keyID(key) >= id {
+				break
+			}
+			child = binary.BigEndian.Uint32(data)
+		}
+		n = child
+	}
+
+	for visited := uint32(0); n != 0; visited++ {
+		if visited > t.totalNodes {
+			return fmt.Errorf("%w: B-tree leaves loop", ErrCorrupt)
+		}
+
+		kind, next, records, err := t.node(n)
+		if err != nil {
+			return err
+		}
+		if kind != nodeLeaf {
+			return fmt.Errorf("%w: node %d is of kind %d", ErrCorrupt, n, kind)
+		}
+
+		for _, rec := range records {
+			key, data, err := splitRecord(rec)
+			if err != nil {
+				return err
+			}
+			switch k := keyID(key); {
+			case k < id:
+				continue
+			case k > id:
+				return nil
+			}
+			if err := fn(key, data); err != nil {
+				return err
+			}
+		}
+		n = next
+	}
+
+	return nil
+}
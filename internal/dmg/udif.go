@@ -0,0 +1,375 @@
+package dmg
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/groob/plist"
+)
+
+const (
+	sectorSize = 512
+	kolySize   = 512
+
+	// maxXMLSize bounds the property list describing the blocks of the image.
+	maxXMLSize = 64 << 20
+	// maxChunkSize bounds the compressed and decompressed size of a chunk, hdiutil writes chunks of 1 MiB.
+	maxChunkSize = 64 << 20
+	// maxSector bounds the sectors of the disk, whose byte offsets must fit an int64.
+	maxSector = math.MaxInt64 / sectorSize
+	// chunkCacheSize is how many decompressed chunks are kept, enough for a B-tree node and the file being read.
+	chunkCacheSize = 4
+)
+
+// The types of the chunks of a block table.
+const (
+	chunkZero       = 0x00000000
+	chunkRaw        = 0x00000001
+	chunkIgnore     = 0x00000002
+	chunkADC        = 0x80000004
+	chunkZlib       = 0x80000005
+	chunkBzip2      = 0x80000006
+	chunkLZFSE      = 0x80000007
+	chunkLZMA       = 0x80000008
+	chunkComment    = 0x7ffffffe
+	chunkTerminator = 0xffffffff
+)
+
+// chunk is a run of sectors of the disk stored, compressed or not, at an offset of the image.
+type chunk struct {
+	typ     uint32
+	sector  uint64
+	sectors uint64
+	offset  int64
+	length  int64
+}
+
+// partition is an entry of the block table, named by its partition type such as "Apple_HFS".
+type partition struct {
+	name    string
+	sector  uint64
+	sectors uint64
+}
+
+// disk reads the sectors of the disk a UDIF image holds.
+type disk struct {
+	r          io.ReaderAt
+	chunks     []chunk
+	partitions []partition
+	cache      []cachedChunk
+}
+
+type cachedChunk struct {
+	index int
+	data  []byte
+}
+
+// udifPlist is the property list of the image, whose blkx entries are the block tables of each partition.
+type udifPlist struct {
+	ResourceFork struct {
+		Blkx []struct {
+			Name string `plist:"Name"`
+			Data []byte `plist:"Data"`
+		} `plist:"blkx"`
+	} `plist:"resource-fork"`
+}
+
+func openDisk(r io.ReaderAt, size int64) (*disk, error) {
+	if size < kolySize {
+		return nil, ErrNotDMG
+	}
+
+	koly := make([]byte, kolySize)
+	if _, err := r.ReadAt(koly, size-kolySize); err != nil {
+		return nil, err
+	}
+	if string(koly[:4]) != "koly" {
+		return nil, ErrNotDMG
+	}
+
+	dataForkOffset := int64(binary.BigEndian.Uint64(koly[24:]))
+	xmlOffset := int64(binary.BigEndian.Uint64(koly[216:]))
+	xmlLength := int64(binary.BigEndian.Uint64(koly[224:]))
+	if xmlLength <= 0 || xmlLength > maxXMLSize || xmlOffset < 0 || xmlOffset+xmlLength > size {
+		return nil, fmt.Errorf("%w: property list of %d bytes at %d", ErrCorrupt, xmlLength, xmlOffset)
+	}
+
+	xml := make([]byte, xmlLength)
+	if _, err := r.ReadAt(xml, xmlOffset); err != nil {
+		return nil, err
+	}
+	var pl udifPlist
+	if err := plist.Unmarshal(xml, &pl); err != nil {
+		return nil, fmt.Errorf("%w: property list: %s", ErrCorrupt, err)
+	}
+
+	d := &disk{r: r}
+	for _, blkx := range pl.ResourceFork.Blkx {
+		p, err := d.addBlockTable(blkx.Name, blkx.Data, dataForkOffset, size)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", blkx.Name, err)
+		}
+		d.partitions = append(d.partitions, p)
+	}
+	if len(d.chunks) == 0 {
+		return nil, fmt.Errorf("%w: no block tables", ErrCorrupt)
+	}
+	sort.Slice(d.chunks, func(i, j int) bool { return d.chunks[i].sector < d.chunks[j].sector })
+	for i := 1; i < len(d.chunks); i++ {
+		if prev := d.chunks[i-1]; d.chunks[i].sector < prev.sector+prev.sectors {
+			return nil, fmt.Errorf("%w: chunks overlap at sector %d", ErrCorrupt, d.chunks[i].sector)
+		}
+	}
+
+	return d, nil
+}
+
+// addBlockTable adds the chunks of a mish block table to d, returning the partition it describes.
+func (d *disk) addBlockTable(name string, b []byte, dataForkOffset, size int64) (partition, error) {
+	const (
+		headerSize = 204
+		entrySize  = 40
+	)
+	if len(b) < headerSize || string(b[:4]) != "mish" {
+		return partition{}, fmt.Errorf("%w: bad block table", ErrCorrupt)
+	}
+
+	p := partition{
+		name:    name,
+		sector:  binary.BigEndian.Uint64(b[8:]),
+		sectors: binary.BigEndian.Uint64(b[16:]),
+	}
+	dataOffset := int64(binary.BigEndian.Uint64(b[24:]))
+
+	n := int(binary.BigEndian.Uint32(b[200:]))
+	if n < 0 || n > (len(b)-headerSize)/entrySize {
+		return partition{}, fmt.Errorf("%w: %d chunks in a block table of %d bytes", ErrCorrupt, n, len(b))
+	}
+
+	for i := 0; i < n; i++ {
+		e := b[headerSize+i*entrySize:]
+		c := chunk{
+			typ:     binary.BigEndian.Uint32(e),
+			sector:  p.sector + binary.BigEndian.Uint64(e[8:]),
+			sectors: binary.BigEndian.Uint64(e[16:]),
+			offset:  dataForkOffset + dataOffset + int64(binary.BigEndian.Uint64(e[24:])),
+			length:  int64(binary.BigEndian.Uint64(e[32:])),
+		}
+		switch c.typ {
+		case chunkComment, chunkTerminator:
+			continue
+		}
+		if c.sectors == 0 {
+			continue
+		}
+		if c.sectors > maxChunkSize/sectorSize || c.sector > maxSector-c.sectors || c.length < 0 || c.length > maxChunkSize || c.offset < 0 || c.offset+c.length > size {
+			return partition{}, fmt.Errorf("%w: chunk %d of %d sectors, %d bytes at %d", ErrCorrupt, i, c.sectors, c.length, c.offset)
+		}
+		d.chunks = append(d.chunks, c)
+	}
+
+	return p, nil
+}
+
+// hfsPartition returns a reader of the HFS+ partition of the disk.
+func (d *disk) hfsPartition() (io.ReaderAt, error) {
+	for _, p := range d.partitions {
+		switch {
+		case strings.Contains(p.name, "Apple_HFS"):
+			return io.NewSectionReader(d, int64(p.sector)*sectorSize, int64(p.sectors)*sectorSize), nil
+		case strings.Contains(p.name, "Apple_APFS"):
+			return nil, fmt.Errorf("%w: APFS file system", ErrUnsupported)
+		}
+	}
+
+	// An image of a single partition may not name its type, so the whole disk is tried.
+	if len(d.partitions) == 1 {
+		p := d.partitions[0]
+		return io.NewSectionReader(d, int64(p.sector)*sectorSize, int64(p.sectors)*sectorSize), nil
+	}
+
+	return nil, fmt.Errorf("%w: no HFS+ partition", ErrUnsupported)
+}
+
+// ReadAt reads the sectors of the disk from off. Sectors in no chunk read as zeros.
+func (d *disk) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	for n < len(p) {
+		pos := off + int64(n)
+		sector := uint64(pos / sectorSize)
+
+		i := sort.Search(len(d.chunks), func(i int) bool { return d.chunks[i].sector+d.chunks[i].sectors > sector })
+		if i == len(d.chunks) {
+			return n, io.EOF
+		}
+		c := d.chunks[i]
+
+		if start := int64(c.sector) * sectorSize; pos < start {
+			// A hole before the chunk.
+			m := int(start - pos)
+			if m > len(p)-n {
+				m = len(p) - n
+			}
+			for j := n; j < n+m; j++ {
+				p[j] = 0
+			}
+			n += m
+			continue
+		}
+
+		data, err := d.chunkData(i)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], data[pos-int64(c.sector)*sectorSize:])
+	}
+
+	return n, nil
+}
+
+// chunkData returns the decompressed sectors of the chunk i.
+func (d *disk) chunkData(i int) ([]byte, error) {
+	for _, c := range d.cache {
+		if c.index == i {
+			return c.data, nil
+		}
+	}
+
+	c := d.chunks[i]
+	size := int(c.sectors) * sectorSize
+
+	var data []byte
+	switch c.typ {
+	case chunkZero, chunkIgnore:
+		data = make([]byte, size)
+	case chunkRaw, chunkADC, chunkZlib, chunkBzip2:
+		b := make([]byte, c.length)
+		if _, err := d.r.ReadAt(b, c.offset); err != nil {
+			return nil, err
+		}
+
+		var err error
+		data, err = decompress(c.typ, b, size)
+		if err != nil {
+			return nil, fmt.Errorf("%w: chunk at sector %d: %s", ErrCorrupt, c.sector, err)
+		}
+	case chunkLZFSE:
+		return nil, fmt.Errorf("%w: LZFSE compressed image, convert it with hdiutil convert -format UDZO", ErrUnsupported)
+	case chunkLZMA:
+		return nil, fmt.Errorf("%w: LZMA compressed image, convert it with hdiutil convert -format UDZO", ErrUnsupported)
+	default:
+		return nil, fmt.Errorf("%w: chunk type %#x", ErrUnsupported, c.typ)
+	}
+
+	if len(d.cache) == chunkCacheSize {
+		d.cache = d.cache[1:]
+	}
+	d.cache = append(d.cache, cachedChunk{i, data})
+
+	return data, nil
+}
+
+// decompress returns the size bytes of a chunk of the type compressed in b.
+func decompress(typ uint32, b []byte, size int) ([]byte, error) {
+	var (
+		out []byte
+		err error
+	)
+	switch typ {
+	case chunkRaw:
+		out = b
+	case chunkADC:
+		out, err = decompressADC(b, size)
+	case chunkZlib:
+		var zr io.ReadCloser
+		if zr, err = zlib.NewReader(bytes.NewReader(b)); err == nil {
+			out, err = readAtMost(zr, size)
+			zr.Close()
+		}
+	case chunkBzip2:
+		out, err = readAtMost(bzip2.NewReader(bytes.NewReader(b)), size)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out) != size {
+		return nil, fmt.Errorf("decompressed %d bytes, expected %d", len(out), size)
+	}
+
+	return out, nil
+}
+
+// readAtMost reads r to the end, failing if it has more than size bytes.
+func readAtMost(r io.Reader, size int) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, int64(size)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > size {
+		return nil, fmt.Errorf("more than %d bytes", size)
+	}
+
+	return b, nil
+}
+
+// decompressADC decompresses Apple Data Compression, a byte oriented LZ77 variant.
+func decompressADC(in []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for i := 0; i < len(in); {
+		b := in[i]
+		switch {
+		case b&0x80 != 0:
+			n := int(b&0x7f) + 1
+			if i+1+n > len(in) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			out = append(out, in[i+1:i+1+n]...)
+			i += 1 + n
+			continue
+		case b&0x40 != 0:
+			if i+3 > len(in) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			n := int(b&0x3f) + 4
+			dist := int(in[i+1])<<8 | int(in[i+2])
+			if err := adcCopy(&out, dist, n, size); err != nil {
+				return nil, err
+			}
+			i += 3
+		default:
+			if i+2 > len(in) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			n := int(b>>2&0x0f) + 3
+			dist := int(b&0x03)<<8 | int(in[i+1])
+			if err := adcCopy(&out, dist, n, size); err != nil {
+				return nil, err
+			}
+			i += 2
+		}
+	}
+
+	return out, nil
+}
+
+// adcCopy appends n bytes copied from dist+1 bytes back, byte by byte as the copy may overlap itself.
+func adcCopy(out *[]byte, dist, n, size int) error {
+	from := len(*out) - dist - 1
+	if from < 0 || len(*out)+n > size {
+		return fmt.Errorf("bad ADC back reference")
+	}
+	for j := 0; j < n; j++ {
+		*out = append(*out, (*out)[from+j])
+	}
+
+	return nil
+}
@@ -0,0 +1,469 @@
+// Package lzma decodes the .lzma (LZMA alone) and .xz formats, which xar uses for application/x-lzma and
+// application/x-xz encoded files.
+package lzma
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	ErrCorrupt     = errors.New("lzma: corrupt input")
+	ErrUnsupported = errors.New("lzma: unsupported input")
+)
+
+const (
+	numBitModelTotalBits = 11
+	bitModelTotal        = 1 << numBitModelTotalBits
+	numMoveBits          = 5
+	probInit             = bitModelTotal / 2
+	topValue             = 1 << 24
+
+	numStates          = 12
+	numPosBitsMax      = 4
+	numLenToPosStates  = 4
+	numAlignBits       = 4
+	endPosModelIndex   = 14
+	numFullDistances   = 1 << (endPosModelIndex >> 1)
+	matchMinLen        = 2
+	endMarkerDistance  = 0xFFFFFFFF
+	maxPropertiesValue = 9 * 5 * 5
+)
+
+type prob uint16
+
+// rangeDecoder decodes bits from the range coded input. Read errors are kept in err rather than returned from each
+// call, and checked once per packet.
+type rangeDecoder struct {
+	r         io.ByteReader
+	rng       uint32
+	code      uint32
+	err       error
+	corrupted bool
+}
+
+func (rd *rangeDecoder) init(r io.ByteReader) error {
+	rd.r = r
+	rd.rng = 0xFFFFFFFF
+	rd.code = 0
+	rd.err = nil
+	rd.corrupted = false
+
+	b, err := r.ReadByte()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if b != 0 {
+		return ErrCorrupt
+	}
+
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		rd.code = rd.code<<8 | uint32(b)
+	}
+
+	if rd.code == rd.rng {
+		return ErrCorrupt
+	}
+
+	return nil
+}
+
+// finishedOK reports whether the range coder ended cleanly.
+func (rd *rangeDecoder) finishedOK() bool {
+	return rd.code == 0
+}
+
+func (rd *rangeDecoder) normalize() {
+	if rd.rng >= topValue {
+		return
+	}
+
+	rd.rng <<= 8
+	b, err := rd.r.ReadByte()
+	if err != nil && rd.err == nil {
+		rd.err = unexpectedEOF(err)
+	}
+	rd.code = rd.code<<8 | uint32(b)
+}
+
+func (rd *rangeDecoder) decodeBit(p *prob) uint32 {
+	v := uint32(*p)
+	bound := (rd.rng >> numBitModelTotalBits) * v
+
+	var bit uint32
+	if rd.code < bound {
+		v += (bitModelTotal - v) >> numMoveBits
+		rd.rng = bound
+	} else {
+		v -= v >> numMoveBits
+		rd.code -= bound
+		rd.rng -= bound
+		bit = 1
+	}
+	*p = prob(v)
+
+	rd.normalize()
+	return bit
+}
+
+func (rd *rangeDecoder) decodeDirectBits(n int) uint32 {
+	var res uint32
+	for ; n > 0; n-- {
+		rd.rng >>= 1
+		rd.code -= rd.rng
+		t := 0 - (rd.code >> 31)
+		rd.code += rd.rng & t
+		if rd.code == rd.rng {
+			rd.corrupted = true
+		}
+		rd.normalize()
+		res = res<<1 + t + 1
+	}
+
+	return res
+}
+
+func bitTreeDecode(rd *rangeDecoder, probs []prob, numBits int) uint32 {
+	m := uint32(1)
+	for i := 0; i < numBits; i++ {
+		m = m<<1 + rd.decodeBit(&probs[m])
+	}
+
+	return m - 1<<uint(numBits)
+}
+
+func bitTreeReverseDecode(rd *rangeDecoder, probs []prob, numBits int) uint32 {
+	m := uint32(1)
+	var symbol uint32
+	for i := 0; i < numBits; i++ {
+		bit := rd.decodeBit(&probs[m])
+		m = m<<1 + bit
+		symbol |= bit << uint(i)
+	}
+
+	return symbol
+}
+
+func initProbs(probs []prob) {
+	for i := range probs {
+		probs[i] = probInit
+	}
+}
+
+type lenDecoder struct {
+	choice  prob
+	choice2 prob
+	low     [1 << numPosBitsMax][1 << 3]prob
+	mid     [1 << numPosBitsMax][1 << 3]prob
+	high    [1 << 8]prob
+}
+
+func (ld *lenDecoder) init() {
+	ld.choice = probInit
+	ld.choice2 = probInit
+	for i := range ld.low {
+		initProbs(ld.low[i][:])
+		initProbs(ld.mid[i][:])
+	}
+	initProbs(ld.high[:])
+}
+
+func (ld *lenDecoder) decode(rd *rangeDecoder, posState uint32) uint32 {
+	if rd.decodeBit(&ld.choice) == 0 {
+		return bitTreeDecode(rd, ld.low[posState][:], 3)
+	}
+	if rd.decodeBit(&ld.choice2) == 0 {
+		return 8 + bitTreeDecode(rd, ld.mid[posState][:], 3)
+	}
+
+	return 16 + bitTreeDecode(rd, ld.high[:], 8)
+}
+
+// window is the dictionary of recently decoded bytes. It grows up to size and is then used as a ring.
+type window struct {
+	buf   []byte
+	size  int
+	pos   int
+	total int64
+}
+
+func (w *window) reset(size int) {
+	w.buf = w.buf[:0]
+	w.size = size
+	w.pos = 0
+	w.total = 0
+}
+
+func (w *window) putByte(b byte) {
+	w.total++
+	if len(w.buf) < w.size {
+		w.buf = append(w.buf, b)
+		return
+	}
+
+	w.buf[w.pos] = b
+	w.pos++
+	if w.pos == w.size {
+		w.pos = 0
+	}
+}
+
+// getByte returns the byte dist bytes back, dist 1 being the last byte written.
+func (w *window) getByte(dist uint32) byte {
+	if len(w.buf) < w.size {
+		return w.buf[len(w.buf)-int(dist)]
+	}
+
+	i := w.pos - int(dist)
+	if i < 0 {
+		i += w.size
+	}
+	return w.buf[i]
+}
+
+func (w *window) hasDistance(dist uint32) bool {
+	return int64(dist) <= w.total && int(dist) <= len(w.buf)
+}
+
+// decoder is the LZMA decoder shared by the alone and LZMA2 formats. Decoded bytes go to the window and are queued in
+// out until read.
+type decoder struct {
+	lc, lp, pb uint
+	dictSize   uint32
+
+	rd  rangeDecoder
+	win window
+	out []byte
+
+	// remaining is the number of bytes left to decode, or -1 if unknown.
+	remaining int64
+
+	litProbs    []prob
+	posSlot     [numLenToPosStates][1 << 6]prob
+	posDecoders [1 + numFullDistances - endPosModelIndex]prob
+	align       [1 << numAlignBits]prob
+	isMatch     [numStates << numPosBitsMax]prob
+	isRep       [numStates]prob
+	isRepG0     [numStates]prob
+	isRepG1     [numStates]prob
+	isRepG2     [numStates]prob
+	isRep0Long  [numStates << numPosBitsMax]prob
+	lenDec      lenDecoder
+	repLenDec   lenDecoder
+
+	state                  uint32
+	rep0, rep1, rep2, rep3 uint32
+}
+
+// setProperties sets lc, lp and pb from the properties byte.
+func (d *decoder) setProperties(b byte) error {
+	if b >= maxPropertiesValue {
+		return ErrCorrupt
+	}
+
+	d.lc = uint(b % 9)
+	b /= 9
+	d.lp = uint(b % 5)
+	d.pb = uint(b / 5)
+
+	return nil
+}
+
+// resetState resets the probabilities and state, keeping the window.
+func (d *decoder) resetState() {
+	n := 0x300 << (d.lc + d.lp)
+	if cap(d.litProbs) >= n {
+		d.litProbs = d.litProbs[:n]
+	} else {
+		d.litProbs = make([]prob, n)
+	}
+	initProbs(d.litProbs)
+
+	for i := range d.posSlot {
+		initProbs(d.posSlot[i][:])
+	}
+	initProbs(d.posDecoders[:])
+	initProbs(d.align[:])
+	initProbs(d.isMatch[:])
+	initProbs(d.isRep[:])
+	initProbs(d.isRepG0[:])
+	initProbs(d.isRepG1[:])
+	initProbs(d.isRepG2[:])
+	initProbs(d.isRep0Long[:])
+	d.lenDec.init()
+	d.repLenDec.init()
+
+	d.state = 0
+	d.rep0, d.rep1, d.rep2, d.rep3 = 0, 0, 0, 0
+}
+
+func (d *decoder) putByte(b byte) {
+	d.win.putByte(b)
+	d.out = append(d.out, b)
+	if d.remaining > 0 {
+		d.remaining--
+	}
+}
+
+func (d *decoder) decodeLiteral() {
+	var prevByte byte
+	if d.win.total > 0 {
+		prevByte = d.win.getByte(1)
+	}
+
+	litState := (uint32(d.win.total)&(1<<d.lp-1))<<d.lc + uint32(prevByte)>>(8-d.lc)
+	probs := d.litProbs[0x300*litState:]
+
+	symbol := uint32(1)
+	if d.state >= 7 {
+		matchByte := uint32(d.win.getByte(d.rep0 + 1))
+		for symbol < 0x100 {
+			matchBit := (matchByte >> 7) & 1
+			matchByte <<= 1
+			bit := d.rd.decodeBit(&probs[(1+matchBit)<<8+symbol])
+			symbol = symbol<<1 | bit
+			if matchBit != bit {
+				break
+			}
+		}
+	}
+	for symbol < 0x100 {
+		symbol = symbol<<1 | d.rd.decodeBit(&probs[symbol])
+	}
+
+	d.putByte(byte(symbol - 0x100))
+}
+
+func (d *decoder) decodeDistance(length uint32) uint32 {
+	lenState := length
+	if lenState > numLenToPosStates-1 {
+		lenState = numLenToPosStates - 1
+	}
+
+	posSlot := bitTreeDecode(&d.rd, d.posSlot[lenState][:], 6)
+	if posSlot < 4 {
+		return posSlot
+	}
+
+	numDirectBits := int(posSlot>>1) - 1
+	dist := (2 | posSlot&1) << uint(numDirectBits)
+	if posSlot < endPosModelIndex {
+		return dist + bitTreeReverseDecode(&d.rd, d.posDecoders[dist-posSlot:], numDirectBits)
+	}
+
+	dist += d.rd.decodeDirectBits(numDirectBits-numAlignBits) << numAlignBits
+	return dist + bitTreeReverseDecode(&d.rd, d.align[:], numAlignBits)
+}
+
+// step decodes a single literal or match. It returns io.EOF when the end marker is found.
+func (d *decoder) step() error {
+	posState := uint32(d.win.total) & (1<<d.pb - 1)
+	state := d.state
+
+	if d.rd.decodeBit(&d.isMatch[state<<numPosBitsMax+posState]) == 0 {
+		d.decodeLiteral()
+		switch {
+		case state < 4:
+			d.state = 0
+		case state < 10:
+			d.state = state - 3
+		default:
+			d.state = state - 6
+		}
+		return d.rd.err
+	}
+
+	var length uint32
+	if d.rd.decodeBit(&d.isRep[state]) != 0 {
+		if d.win.total == 0 {
+			return ErrCorrupt
+		}
+
+		if d.rd.decodeBit(&d.isRepG0[state]) == 0 {
+			if d.rd.decodeBit(&d.isRep0Long[state<<numPosBitsMax+posState]) == 0 {
+				if !d.win.hasDistance(d.rep0 + 1) {
+					return ErrCorrupt
+				}
+				d.state = nextState(state, 9, 11)
+				d.putByte(d.win.getByte(d.rep0 + 1))
+				return d.rd.err
+			}
+		} else {
+			var dist uint32
+			if d.rd.decodeBit(&d.isRepG1[state]) == 0 {
+				dist = d.rep1
+			} else {
+				if d.rd.decodeBit(&d.isRepG2[state]) == 0 {
+					dist = d.rep2
+				} else {
+					dist = d.rep3
+					d.rep3 = d.rep2
+				}
+				d.rep2 = d.rep1
+			}
+			d.rep1 = d.rep0
+			d.rep0 = dist
+		}
+
+		length = d.repLenDec.decode(&d.rd, posState)
+		d.state = nextState(state, 8, 11)
+		if !d.win.hasDistance(d.rep0 + 1) {
+			return ErrCorrupt
+		}
+	} else {
+		d.rep3, d.rep2, d.rep1 = d.rep2, d.rep1, d.rep0
+		length = d.lenDec.decode(&d.rd, posState)
+		d.state = nextState(state, 7, 10)
+
+		d.rep0 = d.decodeDistance(length)
+		if d.rep0 == endMarkerDistance {
+			if d.rd.err != nil {
+				return d.rd.err
+			}
+			if !d.rd.finishedOK() {
+				return ErrCorrupt
+			}
+			return io.EOF
+		}
+		if d.remaining == 0 || d.rep0 >= d.dictSize || !d.win.hasDistance(d.rep0+1) {
+			return ErrCorrupt
+		}
+	}
+
+	length += matchMinLen
+	if d.remaining >= 0 && int64(length) > d.remaining {
+		return ErrCorrupt
+	}
+
+	for i := uint32(0); i < length; i++ {
+		d.putByte(d.win.getByte(d.rep0 + 1))
+	}
+
+	if d.rd.err != nil {
+		return d.rd.err
+	}
+	if d.rd.corrupted {
+		return ErrCorrupt
+	}
+
+	return nil
+}
+
+// nextState returns lit if state is one following a literal, and match otherwise.
+func nextState(state, lit, match uint32) uint32 {
+	if state < 7 {
+		return lit
+	}
+	return match
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,41 @@
+//go:build gofuzz
+// +build gofuzz
+
+package lzma
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// maxFuzzOutput bounds what a fuzzed stream may decompress to, as a few bytes of LZMA can expand to gigabytes.
+const maxFuzzOutput = 1 << 20
+
+// Fuzz is the go-fuzz entry point for the .xz decoder.
+func Fuzz(data []byte) int {
+	xr, err := NewXZReader(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+
+	if _, err := io.Copy(ioutil.Discard, io.LimitReader(xr, maxFuzzOutput)); err != nil {
+		return 0
+	}
+
+	return 1
+}
+
+// FuzzAlone is the go-fuzz entry point for the .lzma decoder.
+func FuzzAlone(data []byte) int {
+	lr, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+
+	if _, err := io.Copy(ioutil.Discard, io.LimitReader(lr, maxFuzzOutput)); err != nil {
+		return 0
+	}
+
+	return 1
+}
@@ -0,0 +1,168 @@
+package lzma
+
+import (
+	"bytes"
+	"io"
+)
+
+// maxLZMA2PackedSize is the largest compressed size of an LZMA2 chunk.
+const maxLZMA2PackedSize = 1 << 16
+
+// lzma2Reader decompresses a raw LZMA2 stream, as found in the blocks of an .xz file.
+type lzma2Reader struct {
+	r   byteReader
+	d   decoder
+	err error
+
+	packed     []byte
+	inChunk    bool
+	compressed bool
+	dictReady  bool
+	propsReady bool
+}
+
+// newLZMA2Reader returns a reader decompressing the LZMA2 stream read from r. The dictionary size is taken from the
+// LZMA2 filter properties byte.
+func newLZMA2Reader(r byteReader, props byte) (*lzma2Reader, error) {
+	if props > 40 {
+		return nil, ErrCorrupt
+	}
+
+	dictSize := uint32(0xFFFFFFFF)
+	if props < 40 {
+		dictSize = (2 | uint32(props)&1) << (props/2 + 11)
+	}
+
+	lr := &lzma2Reader{r: r}
+	lr.d.dictSize = dictSize
+	return lr, nil
+}
+
+func (r *lzma2Reader) Read(p []byte) (int, error) {
+	for len(r.d.out) == 0 && r.err == nil {
+		r.err = r.fill()
+	}
+
+	n := copy(p, r.d.out)
+	r.d.out = r.d.out[n:]
+	if n > 0 {
+		return n, nil
+	}
+
+	return 0, r.err
+}
+
+// fill decodes more of the current chunk, starting the next one when it is done.
+func (r *lzma2Reader) fill() error {
+	if !r.inChunk {
+		return r.nextChunk()
+	}
+
+	if r.d.remaining == 0 {
+		r.inChunk = false
+		if r.compressed && !r.d.rd.finishedOK() {
+			return ErrCorrupt
+		}
+		return nil
+	}
+
+	if !r.compressed {
+		n := r.d.remaining
+		if n > 4096 {
+			n = 4096
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r.r, buf); err != nil {
+			return unexpectedEOF(err)
+		}
+		for _, b := range buf {
+			r.d.putByte(b)
+		}
+		return nil
+	}
+
+	err := r.d.step()
+	if err == io.EOF {
+		// LZMA2 chunks do not use the end marker.
+		err = ErrCorrupt
+	}
+	return err
+}
+
+func (r *lzma2Reader) nextChunk() error {
+	control, err := r.r.ReadByte()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	if control == 0x00 {
+		return io.EOF
+	}
+
+	if control == 0x01 || control >= 0xE0 {
+		r.d.win.reset(int(r.d.dictSize))
+		r.dictReady = true
+		// The state refers to the old dictionary, so the next LZMA chunk must reset it with new properties.
+		r.propsReady = false
+	} else if !r.dictReady {
+		return ErrCorrupt
+	}
+
+	var hdr []byte
+	switch {
+	case control == 0x01 || control == 0x02:
+		hdr = make([]byte, 2)
+	case control >= 0x80:
+		hdr = make([]byte, 4)
+	default:
+		return ErrCorrupt
+	}
+	if _, err := io.ReadFull(r.r, hdr); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	if control < 0x80 {
+		r.compressed = false
+		r.d.remaining = int64(hdr[0])<<8 + int64(hdr[1]) + 1
+		r.inChunk = true
+		return nil
+	}
+
+	r.compressed = true
+	r.d.remaining = int64(control&0x1F)<<16 + int64(hdr[0])<<8 + int64(hdr[1]) + 1
+	packedSize := int(hdr[2])<<8 + int(hdr[3]) + 1
+
+	switch reset := (control >> 5) & 3; {
+	case reset >= 2:
+		props, err := r.r.ReadByte()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		if err := r.d.setProperties(props); err != nil {
+			return err
+		}
+		if r.d.lc+r.d.lp > 4 {
+			return ErrCorrupt
+		}
+		r.propsReady = true
+		r.d.resetState()
+	case !r.propsReady:
+		return ErrCorrupt
+	case reset == 1:
+		r.d.resetState()
+	}
+
+	if cap(r.packed) < maxLZMA2PackedSize {
+		r.packed = make([]byte, maxLZMA2PackedSize)
+	}
+	packed := r.packed[:packedSize]
+	if _, err := io.ReadFull(r.r, packed); err != nil {
+		return unexpectedEOF(err)
+	}
+	if err := r.d.rd.init(bytes.NewReader(packed)); err != nil {
+		return err
+	}
+
+	r.inChunk = true
+	return nil
+}
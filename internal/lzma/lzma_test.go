@@ -0,0 +1,154 @@
+package lzma
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// The streams in testdata were written by liblzma, through Python's lzma module and the xz command, from plain.bin:
+// text with long matches around random bytes that do not compress, so LZMA2 stores some chunks uncompressed.
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestXZReader(t *testing.T) {
+	plain := readTestdata(t, "plain.bin")
+
+	tests := []struct {
+		name string
+		file string
+		want []byte
+	}{
+		{"no check", "plain-none.xz", plain},
+		{"crc32", "plain-crc32.xz", plain},
+		{"crc64", "plain-crc64.xz", plain},
+		{"sha256", "plain-sha256.xz", plain},
+		{"blocks of 4KiB", "plain-blocks.xz", plain},
+		{"empty", "empty.xz", []byte{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xr, err := NewXZReader(bytes.NewReader(readTestdata(t, tt.file)))
+			if err != nil {
+				t.Fatalf("NewXZReader: %v", err)
+			}
+			got, err := ioutil.ReadAll(xr)
+			if err != nil {
+				t.Fatalf("reading: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got %d bytes, want the %d bytes of plain.bin", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestXZReaderErrors(t *testing.T) {
+	stream := readTestdata(t, "plain-crc64.xz")
+
+	// The CRC64 of the only block ends before the index, whose size the stream footer gives.
+	indexSize := (int(binary.LittleEndian.Uint32(stream[len(stream)-8:])) + 1) * 4
+	check := len(stream) - 12 - indexSize - 8
+
+	flip := func(b []byte, i int) []byte {
+		c := append([]byte(nil), b...)
+		c[i] ^= 0x55
+		return c
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"not xz", []byte("plain text, not an xz stream"), ErrCorrupt},
+		{"short header", stream[:8], io.ErrUnexpectedEOF},
+		{"bad header crc", flip(stream, 9), ErrCorrupt},
+		{"bad block header crc", flip(stream, 14), ErrCorrupt},
+		{"bad data", flip(stream, len(stream)/2), ErrCorrupt},
+		{"bad check", flip(stream, check), ErrCorrupt},
+		{"truncated block", stream[:len(stream)/2], io.ErrUnexpectedEOF},
+		{"x86 filter", readTestdata(t, "plain-x86.xz"), ErrUnsupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xr, err := NewXZReader(bytes.NewReader(tt.data))
+			if err == nil {
+				_, err = ioutil.ReadAll(xr)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReader(t *testing.T) {
+	plain := readTestdata(t, "plain.bin")
+
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"end marker", "plain.lzma"},
+		{"size in header", "plain-sized.lzma"},
+		{"lc 0 lp 2 pb 0", "plain-props.lzma"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lr, err := NewReader(bytes.NewReader(readTestdata(t, tt.file)))
+			if err != nil {
+				t.Fatalf("NewReader: %v", err)
+			}
+			got, err := ioutil.ReadAll(lr)
+			if err != nil {
+				t.Fatalf("reading: %v", err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("got %d bytes, want the %d bytes of plain.bin", len(got), len(plain))
+			}
+		})
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	stream := readTestdata(t, "plain.lzma")
+
+	badProps := append([]byte{9 * 5 * 5}, stream[1:]...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"short header", stream[:10], io.ErrUnexpectedEOF},
+		{"bad properties", badProps, ErrCorrupt},
+		{"truncated", stream[:len(stream)/2], io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lr, err := NewReader(bytes.NewReader(tt.data))
+			if err == nil {
+				_, err = ioutil.ReadAll(lr)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
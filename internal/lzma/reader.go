@@ -0,0 +1,92 @@
+package lzma
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// aloneHeaderSize is the size of the header of the .lzma format: the properties byte, the dictionary size and the
+// uncompressed size.
+const aloneHeaderSize = 13
+
+// minDictSize is the smallest dictionary size decoders use, smaller sizes in headers are rounded up to it.
+const minDictSize = 1 << 12
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+func newByteReader(r io.Reader) byteReader {
+	if br, ok := r.(byteReader); ok {
+		return br
+	}
+	return bufio.NewReader(r)
+}
+
+// Reader decompresses the .lzma format.
+type Reader struct {
+	d   decoder
+	err error
+}
+
+// NewReader returns a Reader decompressing the .lzma data read from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := newByteReader(r)
+
+	hdr := make([]byte, aloneHeaderSize)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	lr := &Reader{}
+	if err := lr.d.setProperties(hdr[0]); err != nil {
+		return nil, err
+	}
+
+	lr.d.dictSize = binary.LittleEndian.Uint32(hdr[1:5])
+	if lr.d.dictSize < minDictSize {
+		lr.d.dictSize = minDictSize
+	}
+
+	lr.d.remaining = -1
+	if size := binary.LittleEndian.Uint64(hdr[5:13]); size != 1<<64-1 {
+		if size > 1<<63-1 {
+			return nil, ErrUnsupported
+		}
+		lr.d.remaining = int64(size)
+	}
+
+	lr.d.win.reset(int(lr.d.dictSize))
+	lr.d.resetState()
+	if err := lr.d.rd.init(br); err != nil {
+		return nil, err
+	}
+
+	return lr, nil
+}
+
+// Read reads decompressed data.
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.d.out) == 0 && r.err == nil {
+		if r.d.remaining == 0 {
+			r.err = io.EOF
+			break
+		}
+		if err := r.d.step(); err != nil {
+			if err == io.EOF && r.d.remaining > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			r.err = err
+		}
+	}
+
+	n := copy(p, r.d.out)
+	r.d.out = r.d.out[n:]
+	if n > 0 {
+		return n, nil
+	}
+
+	return 0, r.err
+}
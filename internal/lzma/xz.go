@@ -0,0 +1,234 @@
+package lzma
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+)
+
+// XZMagic is the magic number an .xz file starts with.
+var XZMagic = []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}
+
+const (
+	xzStreamHeaderSize = 12
+	xzFilterLZMA2      = 0x21
+
+	xzCheckNone   = 0x00
+	xzCheckCRC32  = 0x01
+	xzCheckCRC64  = 0x04
+	xzCheckSHA256 = 0x0A
+)
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// countingReader counts the bytes read through it, so a block knows the size of its padding.
+type countingReader struct {
+	r byteReader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// XZReader decompresses the .xz format. Only the LZMA2 filter is supported, and only the first stream of the file
+// is read.
+type XZReader struct {
+	r         *countingReader
+	checkType byte
+	err       error
+
+	block      *lzma2Reader
+	blockStart int64
+	check      hash.Hash
+}
+
+// NewXZReader returns an XZReader decompressing the .xz data read from r.
+func NewXZReader(r io.Reader) (*XZReader, error) {
+	cr := &countingReader{r: newByteReader(r)}
+
+	hdr := make([]byte, xzStreamHeaderSize)
+	if _, err := io.ReadFull(cr, hdr); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	if !bytes.Equal(hdr[:len(XZMagic)], XZMagic) {
+		return nil, ErrCorrupt
+	}
+	if crc32.ChecksumIEEE(hdr[6:8]) != binary.LittleEndian.Uint32(hdr[8:12]) {
+		return nil, ErrCorrupt
+	}
+	if hdr[6] != 0 || hdr[7]&0xF0 != 0 {
+		return nil, ErrUnsupported
+	}
+
+	return &XZReader{r: cr, checkType: hdr[7]}, nil
+}
+
+// Read reads decompressed data.
+func (x *XZReader) Read(p []byte) (int, error) {
+	for x.err == nil {
+		if x.block == nil {
+			x.err = x.nextBlock()
+			continue
+		}
+
+		n, err := x.block.Read(p)
+		if n > 0 {
+			if x.check != nil {
+				x.check.Write(p[:n])
+			}
+			return n, nil
+		}
+
+		if err == io.EOF {
+			x.err = x.endBlock()
+			continue
+		}
+		x.err = err
+	}
+
+	return 0, x.err
+}
+
+func (x *XZReader) nextBlock() error {
+	x.blockStart = x.r.n
+
+	size, err := x.r.ReadByte()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	// A zero header size marks the index, which follows the last block.
+	if size == 0 {
+		return io.EOF
+	}
+
+	hdr := make([]byte, (int(size)+1)*4)
+	hdr[0] = size
+	if _, err := io.ReadFull(x.r, hdr[1:]); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	end := len(hdr) - 4
+	if crc32.ChecksumIEEE(hdr[:end]) != binary.LittleEndian.Uint32(hdr[end:]) {
+		return ErrCorrupt
+	}
+
+	flags := hdr[1]
+	if flags&0x3C != 0 {
+		return ErrUnsupported
+	}
+	if flags&0x03 != 0 {
+		// Filters other than LZMA2, such as the branch converters, are not supported.
+		return ErrUnsupported
+	}
+
+	br := bytes.NewReader(hdr[2:end])
+	if flags&0x40 != 0 {
+		if _, err := binary.ReadUvarint(br); err != nil {
+			return ErrCorrupt
+		}
+	}
+	if flags&0x80 != 0 {
+		if _, err := binary.ReadUvarint(br); err != nil {
+			return ErrCorrupt
+		}
+	}
+
+	id, err := binary.ReadUvarint(br)
+	if err != nil {
+		return ErrCorrupt
+	}
+	propsSize, err := binary.ReadUvarint(br)
+	if err != nil {
+		return ErrCorrupt
+	}
+	if id != xzFilterLZMA2 {
+		return ErrUnsupported
+	}
+	if propsSize != 1 {
+		return ErrCorrupt
+	}
+	props, err := br.ReadByte()
+	if err != nil {
+		return ErrCorrupt
+	}
+
+	x.block, err = newLZMA2Reader(x.r, props)
+	if err != nil {
+		return err
+	}
+	x.blockStart = x.r.n
+
+	switch x.checkType {
+	case xzCheckCRC32:
+		x.check = crc32.NewIEEE()
+	case xzCheckCRC64:
+		x.check = crc64.New(crc64Table)
+	case xzCheckSHA256:
+		x.check = sha256.New()
+	default:
+		x.check = nil
+	}
+
+	return nil
+}
+
+// endBlock skips the padding after the compressed data of a block and verifies its check.
+func (x *XZReader) endBlock() error {
+	x.block = nil
+
+	if pad := (4 - (x.r.n-x.blockStart)%4) % 4; pad > 0 {
+		b := make([]byte, pad)
+		if _, err := io.ReadFull(x.r, b); err != nil {
+			return unexpectedEOF(err)
+		}
+		for _, c := range b {
+			if c != 0 {
+				return ErrCorrupt
+			}
+		}
+	}
+
+	size := 0
+	if x.checkType != xzCheckNone {
+		size = 4 << ((x.checkType - 1) / 3)
+	}
+
+	stored := make([]byte, size)
+	if _, err := io.ReadFull(x.r, stored); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	if x.check == nil {
+		return nil
+	}
+
+	sum := x.check.Sum(nil)
+	if x.checkType != xzCheckSHA256 {
+		// CRC32 and CRC64 are stored little endian.
+		for i, j := 0, len(sum)-1; i < j; i, j = i+1, j-1 {
+			sum[i], sum[j] = sum[j], sum[i]
+		}
+	}
+	if !bytes.Equal(sum, stored) {
+		return ErrCorrupt
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package payload
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+const (
+	// odcHeaderSize is the size of the header of the portable ASCII (odc) cpio format pkgbuild writes.
+	odcHeaderSize = 76
+	// newcHeaderSize is the size of the header of the SVR4 (newc) cpio format, with or without checksums.
+	newcHeaderSize = 110
+
+	// maxNameSize bounds the path of an entry, far above PATH_MAX on macOS.
+	maxNameSize = 4096
+
+	cpioTrailer = "TRAILER!!!"
+
+	modeTypeMask = 0170000
+	modeRegular  = 0100000
+)
+
+type cpioHeader struct {
+	name string
+	mode int64
+	size int64
+}
+
+func (h *cpioHeader) regular() bool {
+	return h.mode&modeTypeMask == modeRegular
+}
+
+// cpioReader reads the entries of a cpio archive in the odc or newc format. After next, it reads the data of the
+// entry returned.
+type cpioReader struct {
+	r    io.Reader
+	data io.LimitedReader
+	pad  int64
+}
+
+func newCPIOReader(r io.Reader) *cpioReader {
+	return &cpioReader{r: r}
+}
+
+func (c *cpioReader) Read(p []byte) (int, error) {
+	return c.data.Read(p)
+}
+
+// next skips the rest of the current entry and returns the header of the next one, or io.EOF after the trailer.
+func (c *cpioReader) next() (*cpioHeader, error) {
+	if c.data.R != nil {
+		if err := skip(&c.data); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := io.CopyN(ioutil.Discard, c.r, c.pad); err != nil {
+		return nil, fmt.Errorf("%w: cpio: %v", ErrCorrupt, unexpectedEOF(err))
+	}
+
+	magic := make([]byte, 6)
+	if _, err := io.ReadFull(c.r, magic); err != nil {
+		return nil, fmt.Errorf("%w: cpio: %v", ErrCorrupt, unexpectedEOF(err))
+	}
+
+	var (
+		hdr      *cpioHeader
+		nameSize int64
+		align    int64 = 1
+		err      error
+	)
+	switch string(magic) {
+	case "070707":
+		hdr, nameSize, err = c.readODC()
+	case "070701", "070702":
+		hdr, nameSize, err = c.readNewc()
+		align = 4
+	default:
+		return nil, fmt.Errorf("%w: cpio: bad magic %q", ErrCorrupt, magic)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if nameSize <= 0 || nameSize > maxNameSize || hdr.size < 0 {
+		return nil, fmt.Errorf("%w: cpio: bad header", ErrCorrupt)
+	}
+
+	name := make([]byte, nameSize)
+	if _, err := io.ReadFull(c.r, name); err != nil {
+		return nil, fmt.Errorf("%w: cpio: %v", ErrCorrupt, unexpectedEOF(err))
+	}
+	hdr.name = strings.TrimRight(string(name), "\x00")
+
+	headerSize := int64(odcHeaderSize)
+	if align > 1 {
+		headerSize = newcHeaderSize
+	}
+	if _, err := io.CopyN(ioutil.Discard, c.r, padding(headerSize+nameSize, align)); err != nil {
+		return nil, fmt.Errorf("%w: cpio: %v", ErrCorrupt, unexpectedEOF(err))
+	}
+	if hdr.name == cpioTrailer {
+		return nil, io.EOF
+	}
+
+	c.data = io.LimitedReader{R: c.r, N: hdr.size}
+	c.pad = padding(hdr.size, align)
+
+	return hdr, nil
+}
+
+// readODC reads the rest of an odc header, of octal fields, returning it and the size of the name following it.
+func (c *cpioReader) readODC() (*cpioHeader, int64, error) {
+	b := make([]byte, odcHeaderSize-6)
+	if _, err := io.ReadFull(c.r, b); err != nil {
+		return nil, 0, fmt.Errorf("%w: cpio: %v", ErrCorrupt, unexpectedEOF(err))
+	}
+
+	// dev, ino, mode, uid, gid, nlink and rdev are 6 digits, mtime 11, namesize 6 and filesize 11.
+	mode, err1 := strconv.ParseInt(string(b[12:18]), 8, 64)
+	nameSize, err2 := strconv.ParseInt(string(b[53:59]), 8, 64)
+	size, err3 := strconv.ParseInt(string(b[59:70]), 8, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, 0, fmt.Errorf("%w: cpio: bad header", ErrCorrupt)
+	}
+
+	return &cpioHeader{mode: mode, size: size}, nameSize, nil
+}
+
+// readNewc reads the rest of a newc header, of 8 digit hex fields, returning it and the size of the name following
+// it.
+func (c *cpioReader) readNewc() (*cpioHeader, int64, error) {
+	b := make([]byte, newcHeaderSize-6)
+	if _, err := io.ReadFull(c.r, b); err != nil {
+		return nil, 0, fmt.Errorf("%w: cpio: %v", ErrCorrupt, unexpectedEOF(err))
+	}
+
+	field := func(i int) (int64, error) {
+		return strconv.ParseInt(string(b[i*8:i*8+8]), 16, 64)
+	}
+	// ino, mode, uid, gid, nlink, mtime, filesize, devmajor, devminor, rdevmajor, rdevminor, namesize and check.
+	mode, err1 := field(1)
+	size, err2 := field(6)
+	nameSize, err3 := field(11)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, 0, fmt.Errorf("%w: cpio: bad header", ErrCorrupt)
+	}
+
+	return &cpioHeader{mode: mode, size: size}, nameSize, nil
+}
+
+// padding returns how many bytes follow n to align it to align bytes.
+func padding(n, align int64) int64 {
+	return (align - n%align) % align
+}
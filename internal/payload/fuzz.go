@@ -0,0 +1,15 @@
+//go:build gofuzz
+// +build gofuzz
+
+package payload
+
+import "bytes"
+
+// Fuzz is the go-fuzz entry point for the payload reader.
+func Fuzz(data []byte) int {
+	if _, err := Executables(bytes.NewReader(data)); err != nil {
+		return 0
+	}
+
+	return 1
+}
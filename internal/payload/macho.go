@@ -0,0 +1,146 @@
+package payload
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+const (
+	machoMagic32 = 0xfeedface
+	machoMagic64 = 0xfeedfacf
+	fatMagic     = 0xcafebabe
+	fatMagic64   = 0xcafebabf
+
+	machoExecute = 2
+
+	// maxFatArchs tells a universal binary from a Java class file, which shares its magic but follows it with a
+	// version of 45 or more.
+	maxFatArchs = 43
+
+	cpuArchABI64   = 0x01000000
+	cpuArchABI6432 = 0x02000000
+	cpuTypeX86     = 7
+	cpuTypeARM     = 12
+	cpuTypePowerPC = 18
+
+	cpuSubtypeMask  = 0x00ffffff
+	cpuSubtypeARM64 = 2
+)
+
+// executableArchitectures reads the start of a file from r and returns the architectures it was built for when it is
+// a Mach-O executable, thin or universal, with ok true.
+func executableArchitectures(r io.Reader) (archs []string, ok bool, err error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(r, hdr); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if magic := binary.BigEndian.Uint32(hdr); magic == fatMagic || magic == fatMagic64 {
+		return fatArchitectures(r, hdr, magic == fatMagic64)
+	}
+
+	cpu, subtype, filetype, ok := thinHeader(hdr)
+	if !ok || filetype != machoExecute {
+		return nil, false, nil
+	}
+
+	return []string{cpuName(cpu, subtype)}, true, nil
+}
+
+// thinHeader returns the cpu type, subtype and file type of the Mach-O header starting hdr, of either byte order.
+func thinHeader(hdr []byte) (cpu, subtype, filetype uint32, ok bool) {
+	var order binary.ByteOrder = binary.LittleEndian
+	switch order.Uint32(hdr) {
+	case machoMagic32, machoMagic64:
+	default:
+		if order = binary.BigEndian; order.Uint32(hdr) != machoMagic32 && order.Uint32(hdr) != machoMagic64 {
+			return 0, 0, 0, false
+		}
+	}
+
+	return order.Uint32(hdr[4:]), order.Uint32(hdr[8:]), order.Uint32(hdr[12:]), true
+}
+
+// fatArchitectures reads the architectures of a universal binary whose first 16 bytes are hdr, from the rest of it in
+// r. It is an executable when its first slice is.
+func fatArchitectures(r io.Reader, hdr []byte, is64 bool) ([]string, bool, error) {
+	n := binary.BigEndian.Uint32(hdr[4:])
+	if n == 0 || n >= maxFatArchs {
+		return nil, false, nil
+	}
+
+	entrySize := 20
+	if is64 {
+		entrySize = 32
+	}
+	table := make([]byte, int(n)*entrySize)
+	copy(table, hdr[8:])
+	if _, err := io.ReadFull(r, table[8:]); err != nil {
+		return nil, false, fmt.Errorf("%w: universal binary: %v", ErrCorrupt, unexpectedEOF(err))
+	}
+
+	var (
+		archs []string
+		first = ^uint64(0)
+	)
+	for i := 0; i < int(n); i++ {
+		e := table[i*entrySize:]
+		archs = append(archs, cpuName(binary.BigEndian.Uint32(e), binary.BigEndian.Uint32(e[4:])))
+		off := uint64(binary.BigEndian.Uint32(e[8:]))
+		if is64 {
+			off = binary.BigEndian.Uint64(e[8:])
+		}
+		if off < first {
+			first = off
+		}
+	}
+
+	// The slices follow the table, so the header of the first is reached by reading on.
+	read := uint64(8 + len(table))
+	if first < read {
+		return nil, false, fmt.Errorf("%w: universal binary: slice at %d inside its header", ErrCorrupt, first)
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, int64(first-read)); err != nil {
+		return nil, false, fmt.Errorf("%w: universal binary: %v", ErrCorrupt, unexpectedEOF(err))
+	}
+	slice := make([]byte, 16)
+	if _, err := io.ReadFull(r, slice); err != nil {
+		return nil, false, fmt.Errorf("%w: universal binary: %v", ErrCorrupt, unexpectedEOF(err))
+	}
+	if _, _, filetype, ok := thinHeader(slice); !ok || filetype != machoExecute {
+		return nil, false, nil
+	}
+	sort.Strings(archs)
+
+	return archs, true, nil
+}
+
+// cpuName returns the name macOS gives the cpu type and subtype, as in hostArchitectures and lipo.
+func cpuName(cpu, subtype uint32) string {
+	switch cpu {
+	case cpuTypeX86:
+		return "i386"
+	case cpuTypeX86 | cpuArchABI64:
+		return "x86_64"
+	case cpuTypeARM:
+		return "arm"
+	case cpuTypeARM | cpuArchABI64:
+		if subtype&cpuSubtypeMask == cpuSubtypeARM64 {
+			return "arm64e"
+		}
+		return "arm64"
+	case cpuTypeARM | cpuArchABI6432:
+		return "arm64_32"
+	case cpuTypePowerPC:
+		return "ppc"
+	case cpuTypePowerPC | cpuArchABI64:
+		return "ppc64"
+	}
+
+	return fmt.Sprintf("cpu%d", cpu)
+}
@@ -0,0 +1,171 @@
+// Package payload reads the Payload of a component package, a cpio archive compressed with gzip or pbzx, for the
+// architectures of the Mach-O executables it installs.
+package payload
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/dbyington/manifestgo/internal/lzma"
+)
+
+var (
+	ErrCorrupt     = errors.New("payload: corrupt payload")
+	ErrUnsupported = errors.New("payload: unsupported payload format")
+)
+
+// pbzxMagic starts a payload compressed in chunks of xz, as macOS installers are.
+var pbzxMagic = []byte("pbzx")
+
+// pbzxMoreChunks is set in the flags of a pbzx chunk followed by another one.
+const pbzxMoreChunks = 1 << 24
+
+// maxPBZXChunk is the largest pbzx chunk read, well above the 16MiB macOS writes.
+const maxPBZXChunk = 64 << 20
+
+// Binary is a Mach-O executable in a payload.
+type Binary struct {
+	// Path is the path the executable installs to, relative to the install location, such as
+	// "./Applications/App.app/Contents/MacOS/App".
+	Path string
+	// Architectures are those it was built for, such as "arm64" and "x86_64" for a universal binary.
+	Architectures []string
+}
+
+// Executables returns the Mach-O executables in the payload read from r, gzip or pbzx compressed or a plain cpio
+// archive. Libraries and plug-ins are not returned, only what runs on its own.
+func Executables(r io.Reader) ([]Binary, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	var archive io.Reader
+	switch {
+	case magic[0] == 0x1f && magic[1] == 0x8b:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		archive = zr
+	case bytes.Equal(magic, pbzxMagic):
+		archive, err = newPBZXReader(br)
+		if err != nil {
+			return nil, err
+		}
+	case bytes.Equal(magic, []byte("0707")):
+		archive = br
+	default:
+		return nil, ErrUnsupported
+	}
+
+	var bins []Binary
+	cr := newCPIOReader(archive)
+	for {
+		hdr, err := cr.next()
+		if err == io.EOF {
+			return bins, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !hdr.regular() {
+			continue
+		}
+
+		archs, ok, err := executableArchitectures(cr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", hdr.name, err)
+		}
+		if ok {
+			bins = append(bins, Binary{Path: hdr.name, Architectures: archs})
+		}
+	}
+}
+
+// pbzxReader decompresses a pbzx stream: a header, then chunks each holding an xz stream, or raw data when it did not
+// compress.
+type pbzxReader struct {
+	r     io.Reader
+	chunk io.Reader
+	more  bool
+}
+
+func newPBZXReader(r io.Reader) (*pbzxReader, error) {
+	hdr := make([]byte, 12)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	return &pbzxReader{r: r, more: binary.BigEndian.Uint64(hdr[4:])&pbzxMoreChunks != 0}, nil
+}
+
+func (p *pbzxReader) Read(b []byte) (int, error) {
+	for {
+		if p.chunk != nil {
+			n, err := p.chunk.Read(b)
+			if err != io.EOF {
+				return n, err
+			}
+			p.chunk = nil
+			if n > 0 {
+				return n, nil
+			}
+		}
+		if !p.more {
+			return 0, io.EOF
+		}
+		if err := p.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (p *pbzxReader) nextChunk() error {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(p.r, hdr); err != nil {
+		return fmt.Errorf("%w: pbzx chunk: %v", ErrCorrupt, unexpectedEOF(err))
+	}
+	p.more = binary.BigEndian.Uint64(hdr)&pbzxMoreChunks != 0
+	length := binary.BigEndian.Uint64(hdr[8:])
+	if length > maxPBZXChunk {
+		return fmt.Errorf("%w: pbzx chunk of %d bytes", ErrCorrupt, length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return fmt.Errorf("%w: pbzx chunk: %v", ErrCorrupt, unexpectedEOF(err))
+	}
+	if !bytes.HasPrefix(data, lzma.XZMagic) {
+		p.chunk = bytes.NewReader(data)
+		return nil
+	}
+
+	xr, err := lzma.NewXZReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: pbzx chunk: %v", ErrCorrupt, err)
+	}
+	p.chunk = xr
+
+	return nil
+}
+
+// skip discards the rest of r.
+func skip(r io.Reader) error {
+	_, err := io.Copy(ioutil.Discard, r)
+	return err
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,197 @@
+package payload
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	cpuX86_64 = cpuTypeX86 | cpuArchABI64
+	cpuARM64  = cpuTypeARM | cpuArchABI64
+
+	machoDylib = 6
+)
+
+// thin returns the header of a 64-bit Mach-O file.
+func thin(cpu, subtype, filetype uint32) []byte {
+	b := make([]byte, 32)
+	binary.LittleEndian.PutUint32(b, machoMagic64)
+	binary.LittleEndian.PutUint32(b[4:], cpu)
+	binary.LittleEndian.PutUint32(b[8:], subtype)
+	binary.LittleEndian.PutUint32(b[12:], filetype)
+	return b
+}
+
+// fat returns a universal binary of the slices, each 64 bytes after the one before.
+func fat(cpus []uint32, slices ...[]byte) []byte {
+	b := make([]byte, 8, 64*(len(slices)+1))
+	binary.BigEndian.PutUint32(b, fatMagic)
+	binary.BigEndian.PutUint32(b[4:], uint32(len(slices)))
+	for i, s := range slices {
+		e := make([]byte, 20)
+		binary.BigEndian.PutUint32(e, cpus[i])
+		binary.BigEndian.PutUint32(e[8:], uint32(64*(i+1)))
+		binary.BigEndian.PutUint32(e[12:], uint32(len(s)))
+		b = append(b, e...)
+	}
+	for i, s := range slices {
+		b = append(b, make([]byte, 64*(i+1)-len(b))...)
+		b = append(b, s...)
+	}
+	return b
+}
+
+type entry struct {
+	name string
+	mode int64
+	data []byte
+}
+
+// testEntries are those of testdata/payload.pbzx, split in a chunk of xz and a raw one.
+var testEntries = []entry{
+	{".", 040755, nil},
+	{"./Applications/A.app/Contents/MacOS/A", 0100755, fat([]uint32{cpuX86_64, cpuARM64}, thin(cpuX86_64, 3, machoExecute), thin(cpuARM64, 0, machoExecute))},
+	{"./Applications/A.app/Contents/Frameworks/L.dylib", 0100755, thin(cpuARM64, 0, machoDylib)},
+	{"./usr/local/bin/tool", 0100755, thin(cpuARM64, 0, machoExecute)},
+	{"./README", 0100644, bytes.Repeat([]byte("hello\n"), 10)},
+}
+
+var testBinaries = []Binary{
+	{Path: "./Applications/A.app/Contents/MacOS/A", Architectures: []string{"arm64", "x86_64"}},
+	{Path: "./usr/local/bin/tool", Architectures: []string{"arm64"}},
+}
+
+func odc(entries []entry) []byte {
+	var b bytes.Buffer
+	for _, e := range append(entries, entry{name: cpioTrailer}) {
+		fmt.Fprintf(&b, "070707%06o%06o%06o%06o%06o%06o%06o%011o%06o%011o", 0, 0, e.mode, 0, 0, 1, 0, 0, len(e.name)+1, len(e.data))
+		b.WriteString(e.name + "\x00")
+		b.Write(e.data)
+	}
+	return b.Bytes()
+}
+
+func newc(entries []entry) []byte {
+	var b bytes.Buffer
+	pad := func() {
+		b.Write(make([]byte, padding(int64(b.Len()), 4)))
+	}
+	for _, e := range append(entries, entry{name: cpioTrailer}) {
+		fmt.Fprintf(&b, "070701%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x", 0, e.mode, 0, 0, 1, 0, len(e.data), 0, 0, 0, 0, len(e.name)+1, 0)
+		b.WriteString(e.name + "\x00")
+		pad()
+		b.Write(e.data)
+		pad()
+	}
+	return b.Bytes()
+}
+
+func gzipped(b []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestExecutables(t *testing.T) {
+	pbzx, err := ioutil.ReadFile(filepath.Join("testdata", "payload.pbzx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	javaClass := []byte{0xca, 0xfe, 0xba, 0xbe, 0, 0, 0, 52, 0, 0, 0, 0, 0, 0, 0, 0}
+	others := []entry{
+		{"./Library/Java/Main.class", 0100644, javaClass},
+		{"./usr/local/lib/universal.dylib", 0100755, fat([]uint32{cpuARM64}, thin(cpuARM64, 0, machoDylib))},
+		{"./usr/local/bin/link", 0120755, thin(cpuARM64, 0, machoExecute)},
+		{"./empty", 0100644, nil},
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want []Binary
+	}{
+		{"odc", odc(testEntries), testBinaries},
+		{"newc", newc(testEntries), testBinaries},
+		{"gzip", gzipped(odc(testEntries)), testBinaries},
+		{"pbzx", pbzx, testBinaries},
+		{"no executables", odc(others), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Executables(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("Executables: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecutablesErrors(t *testing.T) {
+	archive := odc(testEntries)
+	// The mode of the first entry, after the magic, dev and ino.
+	badMode := append([]byte(nil), archive...)
+	copy(badMode[18:], "xxxxxx")
+	badPBZX := append([]byte("pbzx"), make([]byte, 8)...)
+	badPBZX[4+4] = 1 // more chunks
+	badPBZX = append(badPBZX, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"unknown format", []byte("PK\x03\x04 a zip archive"), ErrUnsupported},
+		{"too short", []byte("07"), ErrCorrupt},
+		{"truncated", archive[:len(archive)/2], ErrCorrupt},
+		{"no trailer", archive[:len(archive)-odcHeaderSize-len(cpioTrailer)-1], ErrCorrupt},
+		{"bad header", badMode, ErrCorrupt},
+		{"pbzx chunk too large", badPBZX, ErrCorrupt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Executables(bytes.NewReader(tt.data))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCPUName(t *testing.T) {
+	tests := []struct {
+		cpu, subtype uint32
+		want         string
+	}{
+		{cpuTypeX86, 3, "i386"},
+		{cpuX86_64, 3, "x86_64"},
+		{cpuX86_64, 8, "x86_64"},
+		{cpuTypeARM, 9, "arm"},
+		{cpuARM64, 0, "arm64"},
+		{cpuARM64, 0x80000002, "arm64e"},
+		{cpuTypeARM | cpuArchABI6432, 1, "arm64_32"},
+		{cpuTypePowerPC, 0, "ppc"},
+		{cpuTypePowerPC | cpuArchABI64, 0, "ppc64"},
+		{99, 0, "cpu99"},
+	}
+
+	for _, tt := range tests {
+		if got := cpuName(tt.cpu, tt.subtype); got != tt.want {
+			t.Errorf("cpuName(%#x, %#x) = %q, want %q", tt.cpu, tt.subtype, got, tt.want)
+		}
+	}
+}
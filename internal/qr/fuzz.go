@@ -0,0 +1,19 @@
+//go:build gofuzz
+// +build gofuzz
+
+package qr
+
+// Fuzz is the go-fuzz entry point for the encoder.
+func Fuzz(data []byte) int {
+	for level := Low; level <= High; level++ {
+		c, err := Encode(data, level)
+		if err != nil {
+			return 0
+		}
+		if _, err := c.PNG(1); err != nil {
+			panic(err)
+		}
+	}
+
+	return 1
+}
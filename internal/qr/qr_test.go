@@ -0,0 +1,300 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The symbols in testdata, a row of modules per line with # for dark, were written by another encoder,
+// github.com/skip2/go-qrcode, without its quiet zone.
+
+const itmsURL = "itms-services://?action=download-manifest&url=https://example.com/app/manifest.plist"
+
+func TestEncode(t *testing.T) {
+	fox := strings.Repeat("the quick brown fox jumps over the lazy dog, ", 6)
+
+	tests := []struct {
+		file  string
+		data  string
+		level Level
+	}{
+		{"hello-L.txt", "hello, world", Low},
+		{"manifestgo-Q.txt", "manifestgo", Quartile},
+		{"url-M.txt", "https://example.com/manifest.plist", Medium},
+		{"itms-L.txt", itmsURL, Low},
+		{"itms-H.txt", itmsURL, High},
+		{"fox-M.txt", fox, Medium},
+		{"fox-Q.txt", fox, Quartile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			b, err := ioutil.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+
+			c, err := Encode([]byte(tt.data), tt.level)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if c.Size != len(want) {
+				t.Fatalf("got a symbol of %d modules, want %d", c.Size, len(want))
+			}
+			if got := render(c); got != string(b) {
+				t.Errorf("got\n%swant\n%s", got, b)
+			}
+		})
+	}
+}
+
+// TestEncodeDecode decodes symbols of every version and level.
+func TestEncodeDecode(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	for level := Low; level <= High; level++ {
+		for version := minVersion; version <= maxVersion; version++ {
+			// The most bytes that fit the version, which must not fit the one before.
+			n := (numDataCodewords(version, level)*8 - 4 - charCountBits(version)) / 8
+			data := make([]byte, n)
+			rnd.Read(data)
+
+			t.Run(fmt.Sprintf("level %d version %d", level, version), func(t *testing.T) {
+				c, err := Encode(data, level)
+				if err != nil {
+					t.Fatalf("Encode: %v", err)
+				}
+				if c.version != version {
+					t.Errorf("got version %d, want %d", c.version, version)
+				}
+
+				got, gotLevel, err := decode(c)
+				if err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if gotLevel != level {
+					t.Errorf("got level %d, want %d", gotLevel, level)
+				}
+				if !bytes.Equal(got, data) {
+					t.Errorf("decoded %x, want %x", got, data)
+				}
+			})
+		}
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	// Version 40 at Low holds 2953 bytes.
+	if _, err := Encode(make([]byte, 2953), Low); err != nil {
+		t.Errorf("2953 bytes: %v", err)
+	}
+	if _, err := Encode(make([]byte, 2954), Low); !errors.Is(err, ErrDataTooLong) {
+		t.Errorf("2954 bytes: got error %v, want %v", err, ErrDataTooLong)
+	}
+	if _, err := Encode(make([]byte, 1274), High); !errors.Is(err, ErrDataTooLong) {
+		t.Errorf("1274 bytes at High: got error %v, want %v", err, ErrDataTooLong)
+	}
+}
+
+func TestPNG(t *testing.T) {
+	c, err := Encode([]byte("hello, world"), Low)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.PNG(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size := (c.Size + 2*quietZone) * 3; img.Bounds().Dx() != size || img.Bounds().Dy() != size {
+		t.Fatalf("got a %v image, want %dx%d", img.Bounds(), size, size)
+	}
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			dark := c.Dark(x/3-quietZone, y/3-quietZone)
+			if gray := color.GrayModel.Convert(img.At(x, y)).(color.Gray); (gray.Y == 0) != dark {
+				t.Fatalf("pixel %d,%d is %v, want dark %t", x, y, gray, dark)
+			}
+		}
+	}
+}
+
+func render(c *Code) string {
+	var sb strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Dark(x, y) {
+				sb.WriteByte('#')
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// decode reads the data and level of a byte mode symbol, checking its error correction codewords.
+func decode(c *Code) ([]byte, Level, error) {
+	version := (c.Size - 17) / 4
+
+	var format int
+	for i := 0; i <= 5; i++ {
+		format |= b2i(c.Dark(8, i)) << uint(i)
+	}
+	format |= b2i(c.Dark(8, 7))<<6 | b2i(c.Dark(8, 8))<<7 | b2i(c.Dark(7, 8))<<8
+	for i := 9; i < 15; i++ {
+		format |= b2i(c.Dark(14-i, 8)) << uint(i)
+	}
+	format ^= 0x5412
+	if rem := polyMod(format, 0x537, 10); rem != 0 {
+		return nil, 0, fmt.Errorf("bad format information %015b", format)
+	}
+	level := Level([]int{1, 0, 3, 2}[format>>13])
+	mask := format >> 10 & 7
+
+	// The codewords run up and down two columns at a time from the right, skipping the vertical timing pattern.
+	var bits []bool
+	for right, pair := c.Size-1, 0; right >= 1; right, pair = right-2, pair+1 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if pair%2 == 0 {
+				y = c.Size - 1 - vert
+			}
+			for x := right; x >= right-1; x-- {
+				if !c.isFunction[y][x] {
+					bits = append(bits, c.Dark(x, y) != masked(mask, x, y))
+				}
+			}
+		}
+	}
+
+	raw := make([]byte, len(bits)/8)
+	for i := range raw {
+		for j := 0; j < 8; j++ {
+			raw[i] = raw[i]<<1 | byte(b2i(bits[i*8+j]))
+		}
+	}
+
+	numBlocks := numErrorCorrectionBlocks[level][version]
+	eccLen := eccCodewordsPerBlock[level][version]
+	numShort := numBlocks - len(raw)%numBlocks
+	shortData := len(raw)/numBlocks - eccLen
+
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i <= shortData; i++ {
+		for j := range blocks {
+			if i < shortData || j >= numShort {
+				blocks[j] = append(blocks[j], raw[k])
+				k++
+			}
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for j := range blocks {
+			blocks[j] = append(blocks[j], raw[k])
+			k++
+		}
+	}
+
+	var data []byte
+	for j, block := range blocks {
+		for i := 0; i < eccLen; i++ {
+			if s := syndrome(block, i); s != 0 {
+				return nil, 0, fmt.Errorf("block %d: syndrome %d is %d", j, i, s)
+			}
+		}
+		data = append(data, block[:len(block)-eccLen]...)
+	}
+
+	if data[0]>>4 != 0x4 {
+		return nil, 0, fmt.Errorf("mode %#x, not byte mode", data[0]>>4)
+	}
+	pos := 4
+	read := func(n int) int {
+		v := 0
+		for i := 0; i < n; i++ {
+			v = v<<1 | int(data[pos>>3]>>uint(7-pos&7)&1)
+			pos++
+		}
+		return v
+	}
+	out := make([]byte, read(charCountBits(version)))
+	for i := range out {
+		out[i] = byte(read(8))
+	}
+
+	return out, level, nil
+}
+
+// masked returns whether the mask pattern inverts the module at x, y, from ISO/IEC 18004 table 10, which gives
+// them by row i and column j.
+func masked(mask, j, i int) bool {
+	switch mask {
+	case 0:
+		return (i+j)%2 == 0
+	case 1:
+		return i%2 == 0
+	case 2:
+		return j%3 == 0
+	case 3:
+		return (i+j)%3 == 0
+	case 4:
+		return (i/2+j/3)%2 == 0
+	case 5:
+		return (i*j)%2+(i*j)%3 == 0
+	case 6:
+		return ((i*j)%2+(i*j)%3)%2 == 0
+	default:
+		return ((i*j)%3+(i+j)%2)%2 == 0
+	}
+}
+
+// polyMod returns the remainder of the 15 bits of v divided by the generator polynomial g of degree n, over GF(2).
+func polyMod(v, g, n int) int {
+	for i := 14; i >= n; i-- {
+		if v>>uint(i)&1 != 0 {
+			v ^= g << uint(i-n)
+		}
+	}
+	return v
+}
+
+// syndrome evaluates the codeword polynomial of the block at alpha to the i. It is zero for each i below the number
+// of error correction codewords when the block has no errors.
+func syndrome(block []byte, i int) byte {
+	alpha := byte(1)
+	for k := 0; k < i; k++ {
+		alpha = gfMultiply(alpha, 2)
+	}
+
+	var s byte
+	for _, b := range block {
+		s = gfMultiply(s, alpha) ^ b
+	}
+	return s
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,135 @@
+package manifestgo
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var ErrUnknownInventoryFormat = errors.New("manifestgo: unknown inventory format")
+
+// InventoryFormat is the format of the table an InventoryWriter writes.
+type InventoryFormat string
+
+const (
+	// InventoryCSV writes a CSV table with a header line.
+	InventoryCSV InventoryFormat = "csv"
+	// InventoryJSONLines writes a JSON object per line, as JSON lines and ndjson ingestion expects.
+	InventoryJSONLines InventoryFormat = "jsonl"
+)
+
+// ParseInventoryFormat returns the InventoryFormat named s, accepting ndjson for InventoryJSONLines.
+func ParseInventoryFormat(s string) (InventoryFormat, error) {
+	switch f := InventoryFormat(strings.ToLower(s)); f {
+	case InventoryCSV, InventoryJSONLines:
+		return f, nil
+	case "ndjson":
+		return InventoryJSONLines, nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUnknownInventoryFormat, s)
+}
+
+var inventoryHeader = []string{"bundle_id", "version", "signer", "size", "url", "sha256"}
+
+// InventoryRecord is the row of a package in an inventory table.
+type InventoryRecord struct {
+	BundleIdentifier string `json:"bundle_id"`
+	Version          string `json:"version"`
+	// Signer is the common name of the signing certificate, empty for an unsigned package.
+	Signer string `json:"signer"`
+	// Size is the length of the package in bytes.
+	Size   int64  `json:"size"`
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+// NewInventoryRecord returns the inventory row of p, which must have been read.
+func NewInventoryRecord(p *Package) InventoryRecord {
+	size := p.Size
+	if p.ContentLength > 0 {
+		size = p.ContentLength
+	}
+
+	return InventoryRecord{
+		BundleIdentifier: p.GetBundleIdentifier(),
+		Version:          p.GetVersion(),
+		Signer:           p.GetSigner(),
+		Size:             size,
+		URL:              p.URL,
+		SHA256:           p.FullSHA256(),
+	}
+}
+
+func (r InventoryRecord) record() []string {
+	return []string{r.BundleIdentifier, r.Version, r.Signer, strconv.FormatInt(r.Size, 10), r.URL, r.SHA256}
+}
+
+// InventoryWriter writes a flat table of packages, a row each, for loading into an inventory database.
+type InventoryWriter struct {
+	csv    *csv.Writer
+	json   *json.Encoder
+	header bool
+}
+
+// NewInventoryWriter returns an InventoryWriter writing to w in format.
+func NewInventoryWriter(w io.Writer, format InventoryFormat) (*InventoryWriter, error) {
+	format, err := ParseInventoryFormat(string(format))
+	if err != nil {
+		return nil, err
+	}
+
+	iw := &InventoryWriter{}
+	if format == InventoryCSV {
+		iw.csv = csv.NewWriter(w)
+	} else {
+		iw.json = json.NewEncoder(w)
+		iw.json.SetEscapeHTML(false)
+	}
+
+	return iw, nil
+}
+
+// Write writes the row of p. A CSV table gets its header before the first row.
+func (w *InventoryWriter) Write(p *Package) error {
+	return w.WriteRecord(NewInventoryRecord(p))
+}
+
+// WriteRecord writes r, such as a record of a package read earlier.
+func (w *InventoryWriter) WriteRecord(r InventoryRecord) error {
+	if w.json != nil {
+		return w.json.Encode(r)
+	}
+
+	if !w.header {
+		w.header = true
+		if err := w.csv.Write(inventoryHeader); err != nil {
+			return err
+		}
+	}
+	if err := w.csv.Write(r.record()); err != nil {
+		return err
+	}
+	w.csv.Flush()
+
+	return w.csv.Error()
+}
+
+// WriteInventory writes the inventory table of pkgs to w in format.
+func WriteInventory(w io.Writer, format InventoryFormat, pkgs []*Package) error {
+	iw, err := NewInventoryWriter(w, format)
+	if err != nil {
+		return err
+	}
+	for _, p := range pkgs {
+		if err := iw.Write(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package manifestgo
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var ErrInvalidJWS = errors.New("manifestgo: invalid JWS")
+
+// jwsHeader is the protected header of a signed manifest.
+type jwsHeader struct {
+	Alg string   `json:"alg"`
+	Typ string   `json:"typ,omitempty"`
+	Cty string   `json:"cty,omitempty"`
+	X5c []string `json:"x5c,omitempty"`
+}
+
+// jwsAlgorithm is a JWS signature algorithm this package signs and verifies with.
+type jwsAlgorithm struct {
+	name string
+	hash crypto.Hash
+	// size is the size of each of r and s in an ECDSA signature, 0 for RSA.
+	size int
+}
+
+func jwsAlgorithmFor(pub crypto.PublicKey) (jwsAlgorithm, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return jwsAlgorithm{"RS256", crypto.SHA256, 0}, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return jwsAlgorithm{"ES256", crypto.SHA256, 32}, nil
+		case elliptic.P384():
+			return jwsAlgorithm{"ES384", crypto.SHA384, 48}, nil
+		case elliptic.P521():
+			return jwsAlgorithm{"ES512", crypto.SHA512, 66}, nil
+		}
+	}
+
+	return jwsAlgorithm{}, errors.New("manifestgo: signing key must be RSA or ECDSA on P-256, P-384 or P-521")
+}
+
+// SignJWS returns m as a JWS in compact serialization, for distribution systems requiring signed metadata. The payload
+// is the Canonical JSON of m, signed with RS256 for an RSA key or ES256, ES384 or ES512 for an ECDSA key. certs, the
+// chain of key leaf first, are added to the x5c header when given.
+func (m *Manifest) SignJWS(key crypto.Signer, certs []*x509.Certificate) ([]byte, error) {
+	alg, err := jwsAlgorithmFor(key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := m.Canonical()
+	if err != nil {
+		return nil, err
+	}
+
+	h := jwsHeader{Alg: alg.name, Typ: "JOSE", Cty: "json"}
+	for _, c := range certs {
+		h.X5c = append(h.X5c, base64.StdEncoding.EncodeToString(c.Raw))
+	}
+	header, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := alg.hash.New()
+	digest.Write([]byte(signingInput))
+
+	sig, err := key.Sign(rand.Reader, digest.Sum(nil), alg.hash)
+	if err != nil {
+		return nil, err
+	}
+	if alg.size > 0 {
+		// crypto.Signer returns ECDSA signatures in ASN.1, JWS wants r and s as fixed size big-endian integers.
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+			return nil, err
+		}
+		sig = make([]byte, 2*alg.size)
+		rs.R.FillBytes(sig[:alg.size])
+		rs.S.FillBytes(sig[alg.size:])
+	}
+
+	return []byte(signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)), nil
+}
+
+// VerifyJWS verifies a manifest signed by SignJWS with the public key pub and returns the manifest. The algorithm
+// must be the one SignJWS uses for pub.
+func VerifyJWS(token []byte, pub crypto.PublicKey) (*Manifest, error) {
+	parts := bytes.Split(bytes.TrimSpace(token), []byte("."))
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: expected 3 parts, got %d", ErrInvalidJWS, len(parts))
+	}
+
+	var (
+		h    jwsHeader
+		segs [3][]byte
+	)
+	for i, p := range parts {
+		b, err := base64.RawURLEncoding.DecodeString(string(p))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidJWS, err)
+		}
+		segs[i] = b
+	}
+	if err := json.Unmarshal(segs[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: header: %s", ErrInvalidJWS, err)
+	}
+
+	alg, err := jwsAlgorithmFor(pub)
+	if err != nil {
+		return nil, err
+	}
+	if h.Alg != alg.name {
+		return nil, fmt.Errorf("%w: algorithm %q does not match the %s key", ErrInvalidJWS, h.Alg, alg.name)
+	}
+
+	digest := alg.hash.New()
+	digest.Write(parts[0])
+	digest.Write([]byte("."))
+	digest.Write(parts[1])
+	sum := digest.Sum(nil)
+
+	sig := segs[2]
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, alg.hash, sum, sig); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidJWS, err)
+		}
+	case *ecdsa.PublicKey:
+		if len(sig) != 2*alg.size {
+			return nil, fmt.Errorf("%w: signature is %d bytes, expected %d", ErrInvalidJWS, len(sig), 2*alg.size)
+		}
+		r := new(big.Int).SetBytes(sig[:alg.size])
+		s := new(big.Int).SetBytes(sig[alg.size:])
+		if !ecdsa.Verify(pub, sum, r, s) {
+			return nil, fmt.Errorf("%w: signature does not verify", ErrInvalidJWS)
+		}
+	}
+
+	return ParseManifest(segs[1])
+}
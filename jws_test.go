@@ -0,0 +1,211 @@
+package manifestgo
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testManifest returns a manifest of one package, with MD5 and SHA-256 digests of two chunks.
+func testManifest() *Manifest {
+	return &Manifest{ManifestItems: []*Item{{
+		Assets: []*Asset{{
+			Kind:       "software-package",
+			MD5Size:    10485760,
+			MD5s:       []string{"9e107d9d372bb6826bd81d3542a419d6", "e4d909c290d0fb1ca068ffaddf22cbd0"},
+			SHA256Size: 10485760,
+			SHA256s: []string{
+				"d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592",
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			},
+			URL:       "https://cdn.example.com/pkgs/App.pkg",
+			TotalSize: 15728640,
+		}},
+		Metadata: &Metadata{BundleIdentifier: "com.example.app", BundleVersion: "1.2.3", Kind: "software", Title: "App"},
+	}}}
+}
+
+// jwsParts returns the decoded header and signature of a compact JWS.
+func jwsParts(t *testing.T, token []byte) (jwsHeader, []byte) {
+	t.Helper()
+	parts := bytes.Split(token, []byte("."))
+	if len(parts) != 3 {
+		t.Fatalf("got %d parts, want 3", len(parts))
+	}
+	var h jwsHeader
+	b, _ := base64.RawURLEncoding.DecodeString(string(parts[0]))
+	if err := json.Unmarshal(b, &h); err != nil {
+		t.Fatal(err)
+	}
+	sig, _ := base64.RawURLEncoding.DecodeString(string(parts[2]))
+	return h, sig
+}
+
+// withPart returns token with its part i replaced by b, base64 encoded.
+func withPart(token []byte, i int, b []byte) []byte {
+	parts := bytes.Split(token, []byte("."))
+	parts[i] = []byte(base64.RawURLEncoding.EncodeToString(b))
+	return bytes.Join(parts, []byte("."))
+}
+
+func mustECDSAKey(t *testing.T, c elliptic.Curve) *ecdsa.PrivateKey {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(c, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func mustRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestJWSRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     crypto.Signer
+		alg     string
+		sigSize int
+	}{
+		{"rsa", mustRSAKey(t), "RS256", 256},
+		{"p256", mustECDSAKey(t, elliptic.P256()), "ES256", 64},
+		{"p384", mustECDSAKey(t, elliptic.P384()), "ES384", 96},
+		{"p521", mustECDSAKey(t, elliptic.P521()), "ES512", 132},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := &x509.Certificate{
+				SerialNumber: big.NewInt(1),
+				Subject:      pkix.Name{CommonName: "manifestgo test"},
+				NotBefore:    time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+				NotAfter:     time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC),
+			}
+			der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, tt.key.Public(), tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cert, _ := x509.ParseCertificate(der)
+
+			m := testManifest()
+			token, err := m.SignJWS(tt.key, []*x509.Certificate{cert})
+			if err != nil {
+				t.Fatalf("SignJWS: %v", err)
+			}
+
+			h, sig := jwsParts(t, token)
+			if h.Alg != tt.alg || h.Typ != "JOSE" || h.Cty != "json" {
+				t.Errorf("got header %+v, want alg %s", h, tt.alg)
+			}
+			if len(h.X5c) != 1 || h.X5c[0] != base64.StdEncoding.EncodeToString(der) {
+				t.Errorf("got x5c %v, want the certificate", h.X5c)
+			}
+			if len(sig) != tt.sigSize {
+				t.Errorf("got a signature of %d bytes, want %d", len(sig), tt.sigSize)
+			}
+
+			got, err := VerifyJWS(token, tt.key.Public())
+			if err != nil {
+				t.Fatalf("VerifyJWS: %v", err)
+			}
+			if !reflect.DeepEqual(got, m) {
+				t.Errorf("got manifest %+v, want %+v", got.ManifestItems[0], m.ManifestItems[0])
+			}
+		})
+	}
+}
+
+// TestJWSShortR checks ES256 signatures whose r has a leading zero byte are padded to 32 bytes, as happens to about
+// one in 256 of them.
+func TestJWSShortR(t *testing.T) {
+	key := mustECDSAKey(t, elliptic.P256())
+	m := testManifest()
+	for i := 0; i < 5000; i++ {
+		token, err := m.SignJWS(key, nil)
+		if err != nil {
+			t.Fatalf("SignJWS: %v", err)
+		}
+		if _, sig := jwsParts(t, token); sig[0] != 0 {
+			continue
+		}
+		if _, err := VerifyJWS(token, key.Public()); err != nil {
+			t.Fatalf("VerifyJWS of a signature with a short r: %v", err)
+		}
+		return
+	}
+	t.Fatal("no signature with a short r was made")
+}
+
+func TestVerifyJWSRejects(t *testing.T) {
+	rsaKey := mustRSAKey(t)
+	ecKey := mustECDSAKey(t, elliptic.P256())
+	m := testManifest()
+	rsaToken, err := m.SignJWS(rsaKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecToken, err := m.SignJWS(ecKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := testManifest()
+	other.ManifestItems[0].Assets[0].URL = "https://evil.example.com/App.pkg"
+	otherPayload, _ := other.Canonical()
+	_, ecSig := jwsParts(t, ecToken)
+	// s and r swapped, a well-formed signature that does not verify.
+	swapped := append(append([]byte(nil), ecSig[32:]...), ecSig[:32]...)
+
+	tests := []struct {
+		name  string
+		token []byte
+		pub   crypto.PublicKey
+	}{
+		{"rsa token, ecdsa key", rsaToken, &ecKey.PublicKey},
+		{"ecdsa token, rsa key", ecToken, &rsaKey.PublicKey},
+		{"ecdsa token, other curve", ecToken, &mustECDSAKey(t, elliptic.P384()).PublicKey},
+		{"alg none", withPart(ecToken, 0, []byte(`{"alg":"none"}`)), &ecKey.PublicKey},
+		{"other rsa key", rsaToken, &mustRSAKey(t).PublicKey},
+		{"other ecdsa key", ecToken, &mustECDSAKey(t, elliptic.P256()).PublicKey},
+		{"rsa payload modified", withPart(rsaToken, 1, otherPayload), &rsaKey.PublicKey},
+		{"ecdsa payload modified", withPart(ecToken, 1, otherPayload), &ecKey.PublicKey},
+		{"truncated signature", withPart(ecToken, 2, ecSig[:63]), &ecKey.PublicKey},
+		{"asn1 signature", withPart(ecToken, 2, append([]byte{0x30, 0x44}, ecSig[:62]...)), &ecKey.PublicKey},
+		{"r and s swapped", withPart(ecToken, 2, swapped), &ecKey.PublicKey},
+		{"two parts", bytes.Join(bytes.Split(ecToken, []byte("."))[:2], []byte(".")), &ecKey.PublicKey},
+		{"bad base64", append(append([]byte(nil), ecToken...), '!'), &ecKey.PublicKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := VerifyJWS(tt.token, tt.pub); !errors.Is(err, ErrInvalidJWS) {
+				t.Errorf("got error %v, want %v", err, ErrInvalidJWS)
+			}
+		})
+	}
+}
+
+func TestSignJWSUnsupportedKey(t *testing.T) {
+	key := mustECDSAKey(t, elliptic.P224())
+	if _, err := testManifest().SignJWS(key, nil); err == nil {
+		t.Error("signed with a P-224 key")
+	}
+}
@@ -0,0 +1,21 @@
+package manifestgo
+
+import (
+	"errors"
+	"net/url"
+)
+
+// ITMSServicesURL returns the itms-services URL that installs the manifest hosted at manifestURL when opened on a
+// device. Devices only install over HTTPS, so manifestURL must be an https URL.
+func ITMSServicesURL(manifestURL string) (string, error) {
+	u, err := url.Parse(manifestURL)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Scheme != "https" || u.Host == "" {
+		return "", errors.New("manifest url must be an absolute https url")
+	}
+
+	return "itms-services://?action=download-manifest&url=" + url.QueryEscape(u.String()), nil
+}
@@ -1,6 +1,7 @@
 package manifestgo
 
 import (
+	"bytes"
 	"crypto/md5"
 	"crypto/sha256"
 	"encoding/base64"
@@ -8,6 +9,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"reflect"
 	"strings"
 
 	"github.com/groob/plist"
@@ -22,6 +25,9 @@ type Manifest struct {
 type Item struct {
 	Assets   []*Asset  `plist:"assets" json:"assets"`
 	Metadata *Metadata `plist:"metadata" json:"metadata"`
+	// Extra holds organization-specific keys of the item, such as "pkg-uuid", written alongside assets and metadata in
+	// the plist and JSON. Unknown keys are kept in it when parsing a manifest.
+	Extra map[string]interface{} `plist:"-" json:"-"`
 }
 
 // Asset represents an asset
@@ -32,6 +38,12 @@ type Asset struct {
 	SHA256Size int64    `plist:"sha256-size,omitempty" json:"sha256_size,omitempty"`
 	SHA256s    []string `plist:"sha256s,omitempty" json:"sha256_hash_strings,omitempty"`
 	URL        string   `plist:"url" json:"url"`
+	// NeedsShine has a device add a gloss to a display-image or full-size-image asset.
+	NeedsShine bool `plist:"needs-shine,omitempty" json:"needs_shine,omitempty"`
+	// TotalSize is the size of the whole package. Devices do not read it, so it is left out of the plist.
+	TotalSize int64 `plist:"-" json:"total_size,omitempty"`
+	// FullSHA256 is the SHA-256 of the whole package, see Package.FullSHA256. It is left out of the plist too.
+	FullSHA256 string `plist:"-" json:"full_sha256,omitempty"`
 }
 
 // Metadata stores the command meta-data
@@ -40,8 +52,41 @@ type Metadata struct {
 	BundleVersion    string `plist:"bundle-version" json:"bundle_version"`
 	Kind             string `plist:"kind" json:"kind"`
 	Title            string `plist:"title" json:"title"`
+	// MinimumOSVersion is the lowest macOS version the package installs on. Devices do not read it, so it is left out
+	// of the plist unless MinimumOSPlistKey names a key for it.
+	MinimumOSVersion string `plist:"-" json:"minimum_os_version,omitempty"`
+	// MinimumOSPlistKey is the plist key MinimumOSVersion is written under, such as "minimum-system-version", for
+	// tooling reading it from the plist. It is not written itself.
+	MinimumOSPlistKey string `plist:"-" json:"-"`
+	// Extra holds organization-specific keys of the metadata, such as "category", written alongside the known keys in
+	// the plist and JSON. Unknown keys are kept in it when parsing a manifest.
+	Extra map[string]interface{} `plist:"-" json:"-"`
 }
 
+// MarshalPlist writes MinimumOSVersion under MinimumOSPlistKey when both are set, and the Extra keys.
+func (md *Metadata) MarshalPlist() (interface{}, error) {
+	// metadata has the fields and tags of Metadata but not this method, which would otherwise call itself.
+	type metadata Metadata
+	withMinimumOS := md.MinimumOSPlistKey != "" && md.MinimumOSVersion != ""
+	if !withMinimumOS && len(md.Extra) == 0 {
+		return metadata(*md), nil
+	}
+
+	d := map[string]interface{}{
+		"bundle-identifier": md.BundleIdentifier,
+		"bundle-version":    md.BundleVersion,
+		"kind":              md.Kind,
+		"title":             md.Title,
+	}
+	if withMinimumOS {
+		d[md.MinimumOSPlistKey] = md.MinimumOSVersion
+	}
+
+	return withExtra(d, md.Extra), nil
+}
+
+// AsJSON returns m as JSON, indented by indent spaces or compact if indent is 0. Keys are always written in the same
+// order, that of the struct fields, so the same manifest always serializes to the same bytes.
 func (m *Manifest) AsJSON(indent int) ([]byte, error) {
 	if indent > 0 {
 		ind := strings.Repeat(" ", indent)
@@ -51,6 +96,8 @@ func (m *Manifest) AsJSON(indent int) ([]byte, error) {
 	return json.Marshal(m)
 }
 
+// AsPlist returns m as an XML plist, indented by indent spaces or compact if indent is 0. Dictionary keys are sorted,
+// so the same manifest always serializes to the same bytes.
 func (m *Manifest) AsPlist(indent int) ([]byte, error) {
 	if indent > 0 {
 		ind := strings.Repeat(" ", indent)
@@ -60,6 +107,114 @@ func (m *Manifest) AsPlist(indent int) ([]byte, error) {
 	return plist.Marshal(m)
 }
 
+// Canonical returns m as canonical JSON: compact, with the keys of every object sorted and without HTML escaping, for
+// comparing or signing manifests independently of how they were formatted.
+func (m *Manifest) Canonical() ([]byte, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decoding into interface{} turns every object into a map, which encoding/json writes with sorted keys.
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// RewriteURLs replaces the URL of every asset with what rewrite returns for it, returning the number changed.
+func (m *Manifest) RewriteURLs(rewrite func(string) (string, error)) (int, error) {
+	var n int
+	for _, item := range m.ManifestItems {
+		for _, a := range item.Assets {
+			u, err := rewrite(a.URL)
+			if err != nil {
+				return n, err
+			}
+			if u != a.URL {
+				a.URL = u
+				n++
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// Validate checks m could be sent to a device: it has items, each with metadata and assets that have an absolute http
+// or https URL and, but for images, hashes of a known chunk size.
+func (m *Manifest) Validate() error {
+	if len(m.ManifestItems) == 0 {
+		return errors.New("manifestgo: manifest has no items")
+	}
+
+	for i, item := range m.ManifestItems {
+		if item.Metadata == nil || item.Metadata.BundleIdentifier == "" {
+			return fmt.Errorf("manifestgo: item %d: no bundle identifier", i)
+		}
+		if len(item.Assets) == 0 {
+			return fmt.Errorf("manifestgo: item %d: no assets", i)
+		}
+
+		for j, a := range item.Assets {
+			u, err := url.Parse(a.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("manifestgo: item %d asset %d: url is not an absolute http or https url: %q", i, j, a.URL)
+			}
+			if !a.isImage() && (len(a.MD5s) == 0 || a.MD5Size <= 0) && (len(a.SHA256s) == 0 || a.SHA256Size <= 0) {
+				return fmt.Errorf("manifestgo: item %d asset %d: no hashes", i, j)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ParseManifest parses a manifest written by AsJSON, AsPlist or as a binary plist, telling the format from the first
+// bytes. ASCII plists cannot be parsed. JSON field names may be in any FieldNaming, and digests in any DigestEncoding,
+// which are turned back into lowercase hex.
+func ParseManifest(b []byte) (*Manifest, error) {
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(b, []byte("\xef\xbb\xbf")), " \t\r\n")
+
+	var m Manifest
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		// The field names may have been written in another FieldNaming. An ASCII plist starts with a brace too, and
+		// fails here.
+		if renamed, err := renameJSON(trimmed, reflect.TypeOf(&m), FieldNamingDefault); err == nil {
+			trimmed = renamed
+		}
+		if err := json.Unmarshal(trimmed, &m); err != nil {
+			return nil, fmt.Errorf("manifestgo: parsing JSON manifest: %w", err)
+		}
+	case bytes.HasPrefix(trimmed, []byte("<")), bytes.HasPrefix(trimmed, []byte("bplist")):
+		if err := plist.Unmarshal(trimmed, &m); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("manifestgo: not a JSON or plist manifest")
+	}
+
+	if len(m.ManifestItems) == 0 {
+		return nil, errors.New("manifestgo: manifest has no items")
+	}
+	// A JSON manifest may have been written with another DigestEncoding.
+	m.normalizeDigests()
+
+	return &m, nil
+}
+
 func (m *Manifest) AsEncodedPlistString(indent int) (string, error) {
 	b, err := m.AsPlist(indent)
 	if err != nil {
@@ -70,8 +225,10 @@ func (m *Manifest) AsEncodedPlistString(indent int) (string, error) {
 
 func BuildPackageManifest(p *Package) (*Manifest, error) {
 	a := &Asset{
-		Kind: "software-package",
-		URL:  p.URL,
+		Kind:       AssetKindSoftwarePackage,
+		URL:        p.URL,
+		TotalSize:  p.ContentLength,
+		FullSHA256: p.FullSHA256(),
 	}
 
 	if len(p.Hashes) == 0 {
@@ -84,10 +241,10 @@ func BuildPackageManifest(p *Package) (*Manifest, error) {
 		}
 		switch p.hashType {
 		case md5.Size:
-			a.MD5Size = p.Size
+			a.MD5Size = p.chunkSize()
 			a.MD5s = append(a.MD5s, hex.EncodeToString(h.Sum(nil)))
 		case sha256.Size:
-			a.SHA256Size = p.Size
+			a.SHA256Size = p.chunkSize()
 			a.SHA256s = append(a.SHA256s, hex.EncodeToString(h.Sum(nil)))
 		default:
 			fmt.Printf("unsupported hash size: %d, expected %d or %d\n", h.Size(), md5.Size, sha256.Size)
@@ -100,6 +257,7 @@ func BuildPackageManifest(p *Package) (*Manifest, error) {
 		BundleVersion:    p.GetVersion(),
 		Kind:             p.GetKind(),
 		Title:            p.GetTitle(),
+		MinimumOSVersion: p.GetMinimumOSVersion(),
 	}
 
 	m := &Manifest{
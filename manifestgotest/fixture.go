@@ -0,0 +1,299 @@
+package manifestgotest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha1"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// FixtureOptions describes a package built by BuildFixturePkg. Empty fields get defaults.
+type FixtureOptions struct {
+	// BundleID, Version and Title fill the generated Distribution and PackageInfo. They default to
+	// "com.example.fixture", "1.0" and "Fixture".
+	BundleID string
+	Version  string
+	Title    string
+
+	// Distribution replaces the generated Distribution file.
+	Distribution string
+	// PackageInfo replaces the generated PackageInfo file.
+	PackageInfo string
+	// Component builds a component package, with a PackageInfo instead of a Distribution. A product package gets a
+	// PackageInfo too when one is given.
+	Component bool
+	// Payload adds a file named Payload holding these bytes, archived as they are like pkgbuild does, such as a
+	// gzipped cpio archive.
+	Payload []byte
+
+	// Checksum is the style of the TOC checksum: sha1 (the default), md5, sha256 or sha512.
+	Checksum string
+	// Signer signs the TOC with a classic RSA signature. The package is unsigned if nil.
+	Signer *Signer
+}
+
+// Signer signs fixture packages.
+type Signer struct {
+	Key *rsa.PrivateKey
+	// Certificates is the chain of Key, leaf first.
+	Certificates []*x509.Certificate
+}
+
+// NewSigner returns a Signer with a new key and a leaf certificate for it with the common name, issued by a new root
+// certificate. The root is returned to be trusted when verifying.
+func NewSigner(commonName string) (*Signer, *x509.Certificate, error) {
+	rootKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "manifestgotest root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	root, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, root, &key.PublicKey, rootKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	leaf, err := x509.ParseCertificate(leafDER)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &Signer{Key: key, Certificates: []*x509.Certificate{leaf, root}}, root, nil
+}
+
+// BuildFixturePkg returns a minimal, valid xar archive holding a Distribution, or a PackageInfo for a component
+// package, made from opts.
+func BuildFixturePkg(opts FixtureOptions) ([]byte, error) {
+	bundleID := defaultString(opts.BundleID, "com.example.fixture")
+	version := defaultString(opts.Version, "1.0")
+	title := defaultString(opts.Title, "Fixture")
+
+	type fixtureFile struct {
+		name string
+		data []byte
+		raw  bool
+	}
+	var files []fixtureFile
+	if !opts.Component {
+		dist := opts.Distribution
+		if dist == "" {
+			dist = fmt.Sprintf(fixtureDistribution, escape(title), escape(bundleID), escape(version))
+		}
+		files = append(files, fixtureFile{"Distribution", []byte(dist), false})
+	}
+	if opts.Component || opts.PackageInfo != "" {
+		info := opts.PackageInfo
+		if info == "" {
+			info = fmt.Sprintf(fixturePackageInfo, escape(bundleID), escape(version))
+		}
+		files = append(files, fixtureFile{"PackageInfo", []byte(info), false})
+	}
+	if opts.Payload != nil {
+		files = append(files, fixtureFile{"Payload", opts.Payload, true})
+	}
+
+	style := strings.ToLower(defaultString(opts.Checksum, "sha1"))
+	var (
+		h        crypto.Hash
+		kind     uint32
+		hdrSize  = 28
+		nameSize = 36
+	)
+	switch style {
+	case "sha1":
+		h, kind = crypto.SHA1, 1
+	case "md5":
+		h, kind = crypto.MD5, 2
+	case "sha256":
+		h, kind, hdrSize = crypto.SHA256, 3, 28+nameSize
+	case "sha512":
+		h, kind, hdrSize = crypto.SHA512, 3, 28+nameSize
+	default:
+		return nil, fmt.Errorf("manifestgotest: unsupported checksum: %s", opts.Checksum)
+	}
+
+	var sigSize int
+	if opts.Signer != nil {
+		if opts.Signer.Key == nil || len(opts.Signer.Certificates) == 0 {
+			return nil, errors.New("manifestgotest: signer needs a key and certificates")
+		}
+		sigSize = opts.Signer.Key.Size()
+	}
+
+	// The heap holds the TOC checksum, then the signature, then the files.
+	var (
+		heap bytes.Buffer
+		toc  strings.Builder
+	)
+	heap.Write(make([]byte, h.Size()+sigSize))
+
+	toc.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n<xar>\n<toc>\n")
+	fmt.Fprintf(&toc, "<creation-time>%s</creation-time>\n", time.Now().UTC().Format("2006-01-02T15:04:05"))
+	fmt.Fprintf(&toc, "<checksum style=\"%s\"><offset>0</offset><size>%d</size></checksum>\n", style, h.Size())
+	if opts.Signer != nil {
+		fmt.Fprintf(&toc, "<signature-creation-time>%d</signature-creation-time>\n", time.Now().Unix()-xarEpochUnix)
+		fmt.Fprintf(&toc, "<signature style=\"RSA\"><offset>%d</offset><size>%d</size>", h.Size(), sigSize)
+		toc.WriteString(`<KeyInfo xmlns="http://www.w3.org/2000/09/xmldsig#"><X509Data>`)
+		for _, c := range opts.Signer.Certificates {
+			fmt.Fprintf(&toc, "<X509Certificate>%s</X509Certificate>", base64.StdEncoding.EncodeToString(c.Raw))
+		}
+		toc.WriteString("</X509Data></KeyInfo></signature>\n")
+	}
+
+	for i, f := range files {
+		z, encoding := f.data, "application/octet-stream"
+		if !f.raw {
+			var err error
+			if z, err = compress(f.data); err != nil {
+				return nil, err
+			}
+			encoding = "application/x-gzip"
+		}
+
+		fmt.Fprintf(&toc, "<file id=\"%d\"><name>%s</name><type>file</type><data>", i+1, f.name)
+		fmt.Fprintf(&toc, "<length>%d</length><offset>%d</offset><size>%d</size>", len(z), heap.Len(), len(f.data))
+		fmt.Fprintf(&toc, "<encoding style=\"%s\"/>", encoding)
+		fmt.Fprintf(&toc, "<archived-checksum style=\"%s\">%s</archived-checksum>", style, digest(h, z))
+		fmt.Fprintf(&toc, "<extracted-checksum style=\"%s\">%s</extracted-checksum>", style, digest(h, f.data))
+		toc.WriteString("</data></file>\n")
+
+		heap.Write(z)
+	}
+	toc.WriteString("</toc>\n</xar>\n")
+
+	ztoc, err := compress([]byte(toc.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	d := h.New()
+	d.Write(ztoc)
+	sum := d.Sum(nil)
+
+	b := heap.Bytes()
+	copy(b, sum)
+	if opts.Signer != nil {
+		sig, err := rsa.SignPKCS1v15(rand.Reader, opts.Signer.Key, h, sum)
+		if err != nil {
+			return nil, err
+		}
+		copy(b[h.Size():], sig)
+	}
+
+	hdr := make([]byte, hdrSize)
+	binary.BigEndian.PutUint32(hdr[0:4], 0x78617221)
+	binary.BigEndian.PutUint16(hdr[4:6], uint16(hdrSize))
+	binary.BigEndian.PutUint16(hdr[6:8], 1)
+	binary.BigEndian.PutUint64(hdr[8:16], uint64(len(ztoc)))
+	binary.BigEndian.PutUint64(hdr[16:24], uint64(toc.Len()))
+	binary.BigEndian.PutUint32(hdr[24:28], kind)
+	if kind == 3 {
+		copy(hdr[28:], style)
+	}
+
+	out := make([]byte, 0, len(hdr)+len(ztoc)+len(b))
+	out = append(out, hdr...)
+	out = append(out, ztoc...)
+	return append(out, b...), nil
+}
+
+// xarEpochUnix is 2001-01-01 UTC, which signature creation times count from, as a Unix time.
+const xarEpochUnix = 978307200
+
+const fixtureDistribution = `<?xml version="1.0" encoding="utf-8"?>
+<installer-gui-script minSpecVersion="1">
+    <title>%[1]s</title>
+    <pkg-ref id="%[2]s" version="%[3]s" installKBytes="1">#fixture.pkg</pkg-ref>
+    <choices-outline>
+        <line choice="default">
+            <line choice="%[2]s"/>
+        </line>
+    </choices-outline>
+    <choice id="default"/>
+    <choice id="%[2]s" visible="false">
+        <pkg-ref id="%[2]s"/>
+    </choice>
+    <product id="%[2]s" version="%[3]s"/>
+</installer-gui-script>
+`
+
+const fixturePackageInfo = `<?xml version="1.0" encoding="utf-8"?>
+<pkg-info format-version="2" identifier="%[1]s" version="%[2]s" install-location="/" auth="root">
+    <payload numberOfFiles="1" installKBytes="1"/>
+</pkg-info>
+`
+
+func compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func digest(h crypto.Hash, b []byte) string {
+	d := h.New()
+	d.Write(b)
+	return hex.EncodeToString(d.Sum(nil))
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func defaultString(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,108 @@
+// Package manifestgotest provides test doubles for code using manifestgo: an in-memory PackageReader, and an HTTP
+// server that serves packages the way httpio expects.
+package manifestgotest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+
+	"github.com/dbyington/manifestgo"
+	"github.com/dbyington/manifestgo/httpio"
+)
+
+var ErrUnsupportedHash = errors.New("manifestgotest: unsupported hash size")
+
+// Reader is an in-memory manifestgo.PackageReader.
+type Reader struct {
+	data      []byte
+	url       string
+	etag      string
+	chunkSize int64
+}
+
+// NewReader returns a Reader of data, reporting url as its URL. Its Etag is derived from data and it hashes in chunks
+// of httpio.DefaultHashChunkSize.
+func NewReader(data []byte, url string) *Reader {
+	return &Reader{
+		data:      data,
+		url:       url,
+		etag:      etag(data),
+		chunkSize: httpio.DefaultHashChunkSize,
+	}
+}
+
+// SetChunkSize sets the size of each chunk hashed by HashURL.
+func (r *Reader) SetChunkSize(size int64) {
+	r.chunkSize = size
+}
+
+// SetEtag sets the Etag of the reader, an empty string behaves like a server that sends none.
+func (r *Reader) SetEtag(etag string) {
+	r.etag = etag
+}
+
+// HashURL returns a hash for each chunk of the data. The size is the size of the hash sum to use, md5.Size or
+// sha256.Size.
+func (r *Reader) HashURL(size uint) ([]hash.Hash, error) {
+	var newHash func() hash.Hash
+	switch size {
+	case md5.Size:
+		newHash = md5.New
+	case sha256.Size:
+		newHash = sha256.New
+	default:
+		return nil, ErrUnsupportedHash
+	}
+
+	var hashes []hash.Hash
+	for off := int64(0); off < int64(len(r.data)); off += r.chunkSize {
+		end := off + r.chunkSize
+		if end > int64(len(r.data)) {
+			end = int64(len(r.data))
+		}
+
+		h := newHash()
+		h.Write(r.data[off:end])
+		hashes = append(hashes, h)
+	}
+
+	return hashes, nil
+}
+
+// FileDigest returns the SHA-256 of the whole of the data.
+func (r *Reader) FileDigest() []byte {
+	sum := sha256.Sum256(r.data)
+	return sum[:]
+}
+
+func (r *Reader) Length() int64 {
+	return int64(len(r.data))
+}
+
+func (r *Reader) Etag() string {
+	return r.etag
+}
+
+func (r *Reader) URL() string {
+	return r.url
+}
+
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("manifestgotest: negative offset")
+	}
+
+	return bytes.NewReader(r.data).ReadAt(p, off)
+}
+
+var _ manifestgo.PackageReader = (*Reader)(nil)
+
+// etag returns a strong Etag for data.
+func etag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
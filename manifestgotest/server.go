@@ -0,0 +1,96 @@
+package manifestgotest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request is a request received by a Server.
+type Request struct {
+	Method string
+	Path   string
+	Range  string
+}
+
+// Server is an HTTP server serving files from memory. It answers HEAD requests, honours Range requests with partial
+// content and sends an Etag for each file, unless told otherwise.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	files    map[string][]byte
+	requests []Request
+	noRanges bool
+	noEtag   bool
+}
+
+// NewServer starts and returns a new Server. The caller should call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{files: map[string][]byte{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// AddFile serves data at the path name and returns its URL.
+func (s *Server) AddFile(name string, data []byte) string {
+	name = "/" + strings.TrimPrefix(name, "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[name] = data
+
+	return s.Server.URL + name
+}
+
+// SetRangesSupported sets whether the server accepts range requests, as httpio requires.
+func (s *Server) SetRangesSupported(ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noRanges = !ok
+}
+
+// SetEtagsSent sets whether the server sends an Etag with each file.
+func (s *Server) SetEtagsSent(ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noEtag = !ok
+}
+
+// Requests returns the requests received so far, oldest first.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Range: r.Header.Get("Range")})
+	data, ok := s.files[r.URL.Path]
+	noRanges, noEtag := s.noRanges, s.noEtag
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !noEtag {
+		w.Header().Set("Etag", etag(data))
+	}
+
+	if noRanges {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if r.Method != http.MethodHead {
+			w.Write(data)
+		}
+		return
+	}
+
+	http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+}
@@ -0,0 +1,122 @@
+package manifestgo
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/groob/plist"
+)
+
+// ManagementFlags of an install command.
+const (
+	// ManagementFlagRemoveWithProfile removes the app when the MDM profile is removed.
+	ManagementFlagRemoveWithProfile = 1
+	// ManagementFlagPreventBackup prevents backup of the app data (iOS).
+	ManagementFlagPreventBackup = 4
+)
+
+// InstallCommand is an MDM InstallApplication or InstallEnterpriseApplication command as sent to a device.
+type InstallCommand struct {
+	CommandUUID string
+	Command     InstallCommandPayload
+}
+
+// InstallCommandPayload is the Command dictionary of an InstallCommand.
+type InstallCommandPayload struct {
+	RequestType      string
+	ManifestURL      string                     `plist:",omitempty"`
+	Manifest         *Manifest                  `plist:",omitempty"`
+	InstallAsManaged bool                       `plist:",omitempty"`
+	ManagementFlags  int                        `plist:",omitempty"`
+	Options          *InstallApplicationOptions `plist:",omitempty"`
+}
+
+// InstallApplicationOptions is the Options dictionary of an InstallApplication command.
+type InstallApplicationOptions struct {
+	// NotManaged installs the app without it becoming managed (macOS).
+	NotManaged bool `plist:",omitempty"`
+	// PurchaseMethod is 0 for a legacy VPP assignment or 1 for a VPP app assigned to the device or user.
+	PurchaseMethod int `plist:",omitempty"`
+}
+
+// CommandOption configures an InstallCommand built by NewInstallApplicationCommand.
+type CommandOption func(*InstallCommand)
+
+// WithCommandUUID sets the CommandUUID, a random UUID is used otherwise.
+func WithCommandUUID(id string) CommandOption {
+	return func(c *InstallCommand) {
+		c.CommandUUID = id
+	}
+}
+
+// WithManifestURL makes the command an InstallApplication command installing the manifest hosted at u.
+func WithManifestURL(u string) CommandOption {
+	return func(c *InstallCommand) {
+		c.Command.ManifestURL = u
+	}
+}
+
+// WithManagementFlags sets the ManagementFlags of the command, see ManagementFlagRemoveWithProfile.
+func WithManagementFlags(flags int) CommandOption {
+	return func(c *InstallCommand) {
+		c.Command.ManagementFlags = flags
+	}
+}
+
+// WithInstallOptions sets the Options of an InstallApplication command.
+func WithInstallOptions(opts InstallApplicationOptions) CommandOption {
+	return func(c *InstallCommand) {
+		c.Command.Options = &opts
+	}
+}
+
+// WithInstallAsManaged installs the package of an InstallEnterpriseApplication command as managed (macOS 11+).
+func WithInstallAsManaged() CommandOption {
+	return func(c *InstallCommand) {
+		c.Command.InstallAsManaged = true
+	}
+}
+
+// NewInstallApplicationCommand returns an InstallEnterpriseApplication command embedding m or, when m is nil and
+// WithManifestURL is given, an InstallApplication command for the hosted manifest.
+func NewInstallApplicationCommand(m *Manifest, opts ...CommandOption) (*InstallCommand, error) {
+	c := &InstallCommand{}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	switch {
+	case m != nil && c.Command.ManifestURL != "":
+		return nil, errors.New("manifestgo: give either a manifest or a manifest url, not both")
+	case m != nil:
+		c.Command.RequestType = "InstallEnterpriseApplication"
+		c.Command.Manifest = m
+	case c.Command.ManifestURL != "":
+		c.Command.RequestType = "InstallApplication"
+	default:
+		return nil, errors.New("manifestgo: a manifest or manifest url is required")
+	}
+
+	if c.Command.Options != nil && c.Command.RequestType != "InstallApplication" {
+		return nil, errors.New("manifestgo: options only apply to InstallApplication commands")
+	}
+
+	if c.CommandUUID == "" {
+		id, err := newUUID()
+		if err != nil {
+			return nil, err
+		}
+		c.CommandUUID = id
+	}
+
+	return c, nil
+}
+
+func (c *InstallCommand) AsPlist(indent int) ([]byte, error) {
+	if indent > 0 {
+		ind := strings.Repeat(" ", indent)
+		return plist.MarshalIndent(c, ind)
+	}
+
+	return plist.Marshal(c)
+}
@@ -0,0 +1,316 @@
+package manifestgo
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/groob/plist"
+)
+
+// ProfileOptions configures a ConfigProfile built by NewConfigProfile.
+type ProfileOptions struct {
+	// Identifier is the reverse DNS identifier of the profile, the identifiers of its payloads are derived from it.
+	Identifier   string
+	DisplayName  string
+	Organization string
+	Description  string
+
+	// PreferenceDomain is the domain of the managed preferences payload holding the manifest, Identifier if empty.
+	PreferenceDomain string
+	// ManifestURL is where the manifest is hosted. When set it is added to the preferences and, with WebClip, a web
+	// clip opening its itms-services link is added to the profile.
+	ManifestURL string
+	WebClip     bool
+}
+
+// ConfigProfile is a configuration profile (.mobileconfig) delivering a manifest as managed preferences, and
+// optionally a web clip installing it.
+type ConfigProfile struct {
+	PayloadContent      []map[string]interface{} `plist:"PayloadContent"`
+	PayloadDescription  string                   `plist:"PayloadDescription,omitempty"`
+	PayloadDisplayName  string                   `plist:"PayloadDisplayName"`
+	PayloadIdentifier   string                   `plist:"PayloadIdentifier"`
+	PayloadOrganization string                   `plist:"PayloadOrganization,omitempty"`
+	PayloadType         string                   `plist:"PayloadType"`
+	PayloadUUID         string                   `plist:"PayloadUUID"`
+	PayloadVersion      int                      `plist:"PayloadVersion"`
+}
+
+// NewConfigProfile returns a ConfigProfile wrapping m, with new UUIDs for the profile and each payload.
+func NewConfigProfile(m *Manifest, opts ProfileOptions) (*ConfigProfile, error) {
+	if m == nil || len(m.ManifestItems) == 0 {
+		return nil, errors.New("manifestgo: profile needs a manifest with at least one item")
+	}
+	if opts.Identifier == "" {
+		return nil, errors.New("manifestgo: profile needs an identifier")
+	}
+	if opts.WebClip && opts.ManifestURL == "" {
+		return nil, errors.New("manifestgo: web clip needs the manifest url")
+	}
+
+	title := ""
+	if md := m.ManifestItems[0].Metadata; md != nil {
+		title = md.Title
+	}
+
+	displayName := opts.DisplayName
+	if displayName == "" {
+		displayName = strings.TrimSpace(title + " Manifest")
+	}
+
+	domain := opts.PreferenceDomain
+	if domain == "" {
+		domain = opts.Identifier
+	}
+
+	profileUUID, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	prefsUUID, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	prefs := map[string]interface{}{
+		"PayloadDisplayName": displayName,
+		"PayloadIdentifier":  opts.Identifier + ".preferences",
+		"PayloadType":        domain,
+		"PayloadUUID":        prefsUUID,
+		"PayloadVersion":     1,
+		"manifest":           *m,
+	}
+	if opts.ManifestURL != "" {
+		prefs["manifestURL"] = opts.ManifestURL
+	}
+
+	p := &ConfigProfile{
+		PayloadContent:      []map[string]interface{}{prefs},
+		PayloadDescription:  opts.Description,
+		PayloadDisplayName:  displayName,
+		PayloadIdentifier:   opts.Identifier,
+		PayloadOrganization: opts.Organization,
+		PayloadType:         "Configuration",
+		PayloadUUID:         profileUUID,
+		PayloadVersion:      1,
+	}
+
+	if opts.WebClip {
+		link, err := ITMSServicesURL(opts.ManifestURL)
+		if err != nil {
+			return nil, err
+		}
+		clipUUID, err := newUUID()
+		if err != nil {
+			return nil, err
+		}
+
+		label := title
+		if label == "" {
+			label = displayName
+		}
+		p.PayloadContent = append(p.PayloadContent, map[string]interface{}{
+			"PayloadDisplayName": label,
+			"PayloadIdentifier":  opts.Identifier + ".webclip",
+			"PayloadType":        "com.apple.webClip.managed",
+			"PayloadUUID":        clipUUID,
+			"PayloadVersion":     1,
+			"Label":              label,
+			"URL":                link,
+			"IsRemovable":        true,
+		})
+	}
+
+	return p, nil
+}
+
+func (p *ConfigProfile) AsPlist(indent int) ([]byte, error) {
+	if indent > 0 {
+		ind := strings.Repeat(" ", indent)
+		return plist.MarshalIndent(p, ind)
+	}
+
+	return plist.Marshal(p)
+}
+
+// Sign returns the profile as a CMS signed message, signed by key with certs, leaf first, included for the device to
+// build the chain from. key must be an RSA or ECDSA key.
+func (p *ConfigProfile) Sign(key crypto.Signer, certs []*x509.Certificate) ([]byte, error) {
+	b, err := p.AsPlist(0)
+	if err != nil {
+		return nil, err
+	}
+
+	return signCMS(b, key, certs, time.Now())
+}
+
+// newUUID returns a random (version 4) UUID in the upper case form profiles use.
+func newUUID() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%X-%X-%X-%X-%X", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA2 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	// Content is the explicitly [0] tagged content, built by hand as encoding/asn1 does not tag a RawValue.
+	Content asn1.RawValue
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      cmsEncapsulatedContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsEncapsulatedContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     []byte `asn1:"explicit,tag:0"`
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	SID                cmsIssuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type cmsIssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// signCMS returns content as an attached CMS signed message, signed with SHA-256 by key.
+func signCMS(content []byte, key crypto.Signer, certs []*x509.Certificate, now time.Time) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("manifestgo: signing needs the certificate of the key")
+	}
+
+	var sigAlg asn1.ObjectIdentifier
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		sigAlg = oidRSAEncryption
+	case *ecdsa.PublicKey:
+		sigAlg = oidECDSAWithSHA2
+	default:
+		return nil, errors.New("manifestgo: signing key must be RSA or ECDSA")
+	}
+
+	sum := sha256.Sum256(content)
+	attrs, err := cmsAttributes(
+		cmsAttributeValue{oidContentType, oidData},
+		cmsAttributeValue{oidMessageDigest, sum[:]},
+		cmsAttributeValue{oidSigningTime, now.UTC()},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature covers the attributes as a SET, they are stored implicitly tagged.
+	set, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(set)
+	sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw bytes.Buffer
+	for _, c := range certs {
+		raw.Write(c.Raw)
+	}
+
+	sd := cmsSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		ContentInfo:      cmsEncapsulatedContentInfo{ContentType: oidData, Content: content},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw.Bytes()},
+		SignerInfos: []cmsSignerInfo{{
+			Version:            1,
+			SID:                cmsIssuerAndSerial{Issuer: asn1.RawValue{FullBytes: certs[0].RawIssuer}, Serial: certs[0].SerialNumber},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: sigAlg},
+			Signature:          sig,
+		}},
+	}
+	sdb, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(cmsContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sdb},
+	})
+}
+
+type cmsAttributeValue struct {
+	Type  asn1.ObjectIdentifier
+	Value interface{}
+}
+
+// cmsAttributes returns the DER of the attributes, without the SET header, sorted as DER requires.
+func cmsAttributes(values ...cmsAttributeValue) ([]byte, error) {
+	encoded := make([][]byte, 0, len(values))
+	for _, v := range values {
+		b, err := asn1.Marshal(v.Value)
+		if err != nil {
+			return nil, err
+		}
+		a, err := asn1.Marshal(cmsAttribute{
+			Type:   v.Type,
+			Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: b},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, a)
+	}
+
+	sort.Slice(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	})
+
+	return bytes.Join(encoded, nil), nil
+}
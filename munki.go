@@ -0,0 +1,107 @@
+package manifestgo
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/groob/plist"
+)
+
+// MunkiPkgInfo is a Munki pkginfo for a package.
+type MunkiPkgInfo struct {
+	Name                  string         `plist:"name"`
+	DisplayName           string         `plist:"display_name"`
+	Version               string         `plist:"version"`
+	Catalogs              []string       `plist:"catalogs"`
+	InstallerItemLocation string         `plist:"installer_item_location,omitempty"`
+	InstallerItemSize     int64          `plist:"installer_item_size,omitempty"`
+	InstallerItemHash     string         `plist:"installer_item_hash,omitempty"`
+	InstalledSize         int64          `plist:"installed_size,omitempty"`
+	MinimumOSVersion      string         `plist:"minimum_os_version,omitempty"`
+	Receipts              []MunkiReceipt `plist:"receipts,omitempty"`
+}
+
+// MunkiReceipt is a package receipt Munki uses to decide whether an item is installed.
+type MunkiReceipt struct {
+	PackageID     string `plist:"packageid"`
+	Version       string `plist:"version"`
+	InstalledSize int64  `plist:"installed_size,omitempty"`
+}
+
+// BuildMunkiPkgInfo returns the Munki pkginfo of p. Sizes are in kilobytes, as Munki expects.
+func BuildMunkiPkgInfo(p *Package) (*MunkiPkgInfo, error) {
+	info := &MunkiPkgInfo{
+		Name:              p.GetTitle(),
+		DisplayName:       p.GetTitle(),
+		Version:           p.GetVersion(),
+		Catalogs:          []string{"testing"},
+		InstallerItemSize: p.ContentLength / 1024,
+		InstallerItemHash: p.FullSHA256(),
+		MinimumOSVersion:  p.GetMinimumOSVersion(),
+		Receipts:          munkiReceipts(p),
+	}
+
+	if u, err := url.Parse(p.URL); err == nil && u.Path != "" {
+		info.InstallerItemLocation = path.Base(u.Path)
+	}
+
+	for _, r := range info.Receipts {
+		info.InstalledSize += r.InstalledSize
+	}
+
+	return info, nil
+}
+
+func (p *Package) BuildMunkiPkgInfo() (*MunkiPkgInfo, error) {
+	return BuildMunkiPkgInfo(p)
+}
+
+func (i *MunkiPkgInfo) AsPlist(indent int) ([]byte, error) {
+	if indent > 0 {
+		ind := strings.Repeat(" ", indent)
+		return plist.MarshalIndent(i, ind)
+	}
+
+	return plist.Marshal(i)
+}
+
+// munkiReceipts returns a receipt for each component package. A Distribution can list the same pkg-ref more than once,
+// each time with different attributes, so they are merged by id.
+func munkiReceipts(p *Package) []MunkiReceipt {
+	if p.source == sourcePackageInfo {
+		return []MunkiReceipt{{
+			PackageID:     p.PkgInfo.Identifier,
+			Version:       p.PkgInfo.Version,
+			InstalledSize: p.PkgInfo.Payload.InstallKBytes,
+		}}
+	}
+
+	var receipts []MunkiReceipt
+	index := make(map[string]int)
+	for _, ref := range p.PkgRef {
+		i, ok := index[ref.ID]
+		if !ok {
+			i = len(receipts)
+			index[ref.ID] = i
+			receipts = append(receipts, MunkiReceipt{PackageID: ref.ID})
+		}
+
+		if ref.Version != "" {
+			receipts[i].Version = ref.Version
+		}
+		if ref.InstallKBytes > 0 {
+			receipts[i].InstalledSize = ref.InstallKBytes
+		}
+	}
+
+	// Only refs with a version are installed, the rest are references to other refs.
+	installed := receipts[:0]
+	for _, r := range receipts {
+		if r.Version != "" {
+			installed = append(installed, r)
+		}
+	}
+
+	return installed
+}
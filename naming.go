@@ -0,0 +1,272 @@
+package manifestgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+var ErrUnknownFieldNaming = errors.New("manifestgo: unknown field naming")
+
+// FieldNaming is how the names of the fields of a manifest, and of the other types of the package, are written in JSON.
+type FieldNaming string
+
+const (
+	// FieldNamingDefault writes the names of the JSON format, such as bundle_identifier and manifestItems.
+	FieldNamingDefault FieldNaming = "default"
+	// FieldNamingSnake writes names in snake_case, such as bundle_identifier and manifest_items.
+	FieldNamingSnake FieldNaming = "snake"
+	// FieldNamingCamel writes names in camelCase, such as bundleIdentifier and manifestItems.
+	FieldNamingCamel FieldNaming = "camel"
+	// FieldNamingKebab writes names in kebab-case, such as bundle-identifier and manifest-items.
+	FieldNamingKebab FieldNaming = "kebab"
+)
+
+// ParseFieldNaming returns the FieldNaming named s, FieldNamingDefault if s is empty.
+func ParseFieldNaming(s string) (FieldNaming, error) {
+	switch n := FieldNaming(strings.ToLower(s)); n {
+	case "":
+		return FieldNamingDefault, nil
+	case FieldNamingDefault, FieldNamingSnake, FieldNamingCamel, FieldNamingKebab:
+		return n, nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUnknownFieldNaming, s)
+}
+
+// AsJSONNamed returns m as JSON like AsJSON, with its field names written in naming.
+func (m *Manifest) AsJSONNamed(indent int, naming FieldNaming) ([]byte, error) {
+	return MarshalJSONNamed(m, indent, naming)
+}
+
+// MarshalJSONNamed returns v as JSON, indented by indent spaces or compact if indent is 0, with the names of the fields
+// of its structs written in naming. Keys a struct field does not name, such as those of the Extra of an item, are
+// written as they are, as is everything in them.
+func MarshalJSONNamed(v interface{}, indent int, naming FieldNaming) ([]byte, error) {
+	naming, err := ParseFieldNaming(string(naming))
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil || naming == FieldNamingDefault {
+		if err == nil && indent > 0 {
+			return indentJSON(b, indent)
+		}
+		return b, err
+	}
+
+	if b, err = renameJSON(b, reflect.TypeOf(v), naming); err != nil {
+		return nil, err
+	}
+	if indent > 0 {
+		return indentJSON(b, indent)
+	}
+
+	return b, nil
+}
+
+func indentJSON(b []byte, indent int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, b, "", strings.Repeat(" ", indent)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// renameJSON rewrites the field names of t in the JSON b in naming, keeping the order of the keys. A field may be
+// named in b in any FieldNaming, so FieldNamingDefault turns them back into the names of the struct tags. A field named
+// more than once in an object keeps its first value.
+func renameJSON(b []byte, t reflect.Type, naming FieldNaming) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	var buf bytes.Buffer
+	if err := renameValue(d, &buf, t, naming); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func renameValue(d *json.Decoder, buf *bytes.Buffer, t reflect.Type, naming FieldNaming) error {
+	tok, err := d.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		fields := jsonFields(t)
+		seen := make(map[string]bool)
+		buf.WriteByte('{')
+		for d.More() {
+			tok, err := d.Token()
+			if err != nil {
+				return err
+			}
+			key := tok.(string)
+
+			var ft reflect.Type
+			if f, ok := fields[nameWords(key, "_")]; ok {
+				key, ft = naming.name(f.name), f.typ
+			}
+			if seen[key] {
+				var skip json.RawMessage
+				if err := d.Decode(&skip); err != nil {
+					return err
+				}
+				continue
+			}
+			if len(seen) > 0 {
+				buf.WriteByte(',')
+			}
+			seen[key] = true
+			kb, err := json.Marshal(key)
+			if err != nil {
+				return err
+			}
+			buf.Write(kb)
+			buf.WriteByte(':')
+			if err := renameValue(d, buf, ft, naming); err != nil {
+				return err
+			}
+		}
+		if _, err := d.Token(); err != nil {
+			return err
+		}
+		buf.WriteByte('}')
+	case json.Delim('['):
+		elem := elemType(t)
+		buf.WriteByte('[')
+		for i := 0; d.More(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := renameValue(d, buf, elem, naming); err != nil {
+				return err
+			}
+		}
+		if _, err := d.Token(); err != nil {
+			return err
+		}
+		buf.WriteByte(']')
+	default:
+		vb, err := json.Marshal(tok)
+		if err != nil {
+			return err
+		}
+		buf.Write(vb)
+	}
+
+	return nil
+}
+
+type jsonField struct {
+	name string
+	typ  reflect.Type
+}
+
+// jsonFields returns the fields of the struct t, or a pointer to one, by their JSON name in snake_case, so a name
+// matches whatever FieldNaming it is written in. It returns nil for other types.
+func jsonFields(t reflect.Type) map[string]jsonField {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := make(map[string]jsonField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			for k, v := range jsonFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[nameWords(name, "_")] = jsonField{name: name, typ: f.Type}
+	}
+
+	return fields
+}
+
+// elemType returns the type of the elements of the slice or array t, or nil for other types.
+func elemType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || (t.Kind() != reflect.Slice && t.Kind() != reflect.Array) {
+		return nil
+	}
+
+	return t.Elem()
+}
+
+// name returns the JSON name of the field tagged tag in n.
+func (n FieldNaming) name(tag string) string {
+	switch n {
+	case FieldNamingSnake:
+		return nameWords(tag, "_")
+	case FieldNamingKebab:
+		return nameWords(tag, "-")
+	case FieldNamingCamel:
+		words := strings.Split(nameWords(tag, " "), " ")
+		for i := 1; i < len(words); i++ {
+			words[i] = strings.Title(words[i])
+		}
+		return strings.Join(words, "")
+	}
+
+	return tag
+}
+
+// nameWords splits name into lowercase words at underscores, hyphens and changes of case, joining them with sep, so
+// manifestItems and manifest_items are both manifest<sep>items. A run of capitals is one word, as in the URL of
+// URLPath.
+func nameWords(name, sep string) string {
+	var (
+		words []string
+		word  []rune
+	)
+	runes := []rune(name)
+	for i, r := range runes {
+		if r == '_' || r == '-' || r == ' ' {
+			if len(word) > 0 {
+				words = append(words, string(word))
+			}
+			word = nil
+			continue
+		}
+		if unicode.IsUpper(r) && len(word) > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if !unicode.IsUpper(prev) || nextLower {
+				words = append(words, string(word))
+				word = nil
+			}
+		}
+		word = append(word, unicode.ToLower(r))
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+
+	return strings.Join(words, sep)
+}
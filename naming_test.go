@@ -0,0 +1,118 @@
+package manifestgo
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNameWords(t *testing.T) {
+	tests := []struct {
+		name string
+		sep  string
+		want string
+	}{
+		{"md5_hash_strings", "_", "md5_hash_strings"},
+		{"manifestItems", "_", "manifest_items"},
+		{"URLPath", "_", "url_path"},
+		{"MinimumOSVersion", "_", "minimum_os_version"},
+		{"sha256HashStrings", "_", "sha256_hash_strings"},
+		{"bundle-identifier", "_", "bundle_identifier"},
+		{"ID", "_", "id"},
+		{"url", "_", "url"},
+		{"__total__size_", "_", "total_size"},
+		{"", "_", ""},
+		{"manifestItems", "-", "manifest-items"},
+		{"needs_shine", " ", "needs shine"},
+	}
+
+	for _, tt := range tests {
+		if got := nameWords(tt.name, tt.sep); got != tt.want {
+			t.Errorf("nameWords(%q, %q) = %q, want %q", tt.name, tt.sep, got, tt.want)
+		}
+	}
+}
+
+func TestFieldNamingName(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want map[FieldNaming]string
+	}{
+		{"manifestItems", map[FieldNaming]string{FieldNamingDefault: "manifestItems", FieldNamingSnake: "manifest_items", FieldNamingCamel: "manifestItems", FieldNamingKebab: "manifest-items"}},
+		{"md5_hash_strings", map[FieldNaming]string{FieldNamingDefault: "md5_hash_strings", FieldNamingSnake: "md5_hash_strings", FieldNamingCamel: "md5HashStrings", FieldNamingKebab: "md5-hash-strings"}},
+		{"minimum_os_version", map[FieldNaming]string{FieldNamingDefault: "minimum_os_version", FieldNamingSnake: "minimum_os_version", FieldNamingCamel: "minimumOsVersion", FieldNamingKebab: "minimum-os-version"}},
+	}
+
+	for _, tt := range tests {
+		for naming, want := range tt.want {
+			if got := naming.name(tt.tag); got != want {
+				t.Errorf("%s name of %q = %q, want %q", naming, tt.tag, got, want)
+			}
+		}
+	}
+}
+
+func TestParseFieldNaming(t *testing.T) {
+	for s, want := range map[string]FieldNaming{"": FieldNamingDefault, "Camel": FieldNamingCamel, "kebab": FieldNamingKebab} {
+		if got, err := ParseFieldNaming(s); err != nil || got != want {
+			t.Errorf("ParseFieldNaming(%q) = %q, %v, want %q", s, got, err, want)
+		}
+	}
+	if _, err := ParseFieldNaming("pascal"); !errors.Is(err, ErrUnknownFieldNaming) {
+		t.Errorf("got error %v, want %v", err, ErrUnknownFieldNaming)
+	}
+}
+
+func TestFieldNamingRoundTrip(t *testing.T) {
+	for _, naming := range []FieldNaming{FieldNamingDefault, FieldNamingSnake, FieldNamingCamel, FieldNamingKebab} {
+		t.Run(string(naming), func(t *testing.T) {
+			m := testManifest()
+			m.ManifestItems[0].Metadata.MinimumOSVersion = "11.0"
+			// The colliding keys name fields in some FieldNaming, and are dropped rather than written twice.
+			m.ManifestItems[0].Extra = map[string]interface{}{"pkg-uuid": "5a2a2e8e", "Assets": "colliding"}
+			m.ManifestItems[0].Metadata.Extra = map[string]interface{}{
+				"subtitle":         "Example",
+				"bundleIdentifier": "com.example.colliding",
+				"bundle-version":   "0.0.0",
+			}
+
+			b, err := m.AsJSONNamed(0, naming)
+			if err != nil {
+				t.Fatalf("AsJSONNamed: %v", err)
+			}
+			for _, tag := range []string{"manifestItems", "bundle_identifier", "bundle_version", "md5_hash_strings", "minimum_os_version"} {
+				if n := bytes.Count(b, []byte(`"`+naming.name(tag)+`"`)); n != 1 {
+					t.Errorf("%s is written %d times, want once", naming.name(tag), n)
+				}
+			}
+			if !bytes.Contains(b, []byte(`"pkg-uuid"`)) || !bytes.Contains(b, []byte(`"subtitle"`)) {
+				t.Errorf("the extra keys were renamed or dropped: %s", b)
+			}
+
+			got, err := ParseManifest(b)
+			if err != nil {
+				t.Fatalf("ParseManifest: %v", err)
+			}
+			want := testManifest()
+			want.ManifestItems[0].Metadata.MinimumOSVersion = "11.0"
+			want.ManifestItems[0].Extra = map[string]interface{}{"pkg-uuid": "5a2a2e8e"}
+			want.ManifestItems[0].Metadata.Extra = map[string]interface{}{"subtitle": "Example"}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %s, want the manifest written", b)
+			}
+		})
+	}
+}
+
+func TestParseManifestRepeatedField(t *testing.T) {
+	// Written by a version that did not drop extra keys colliding with fields, the field first.
+	b := []byte(`{"manifestItems":[{"assets":[],"metadata":{"bundle_identifier":"com.example.app","bundleIdentifier":"com.example.colliding"}}]}`)
+	m, err := ParseManifest(b)
+	if err != nil {
+		t.Fatalf("ParseManifest: %v", err)
+	}
+	if got := m.ManifestItems[0].Metadata.BundleIdentifier; got != "com.example.app" {
+		t.Errorf("got bundle identifier %q, want com.example.app", got)
+	}
+}
@@ -0,0 +1,131 @@
+package manifestgo
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"time"
+
+	xar "github.com/dbyington/manifestgo/goxar"
+	"github.com/dbyington/manifestgo/httpio"
+)
+
+// HashScheme is the hash the chunks of a package are hashed with, named by the size of its sum.
+type HashScheme uint
+
+const (
+	HashMD5    HashScheme = md5.Size
+	HashSHA256 HashScheme = sha256.Size
+)
+
+// Logger receives messages about reading a package. A *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Option configures a Package created by New.
+type Option func(*Package)
+
+// WithHashScheme sets the hash the chunks of the package are hashed with, HashSHA256 is used otherwise.
+func WithHashScheme(h HashScheme) Option {
+	return func(p *Package) {
+		p.hashType = uint(h)
+	}
+}
+
+// WithChunkSize sets the size of each hashed chunk, httpio.DefaultHashChunkSize is used otherwise. It should match
+// the chunk size of the PackageReader.
+func WithChunkSize(size int64) Option {
+	return func(p *Package) {
+		p.hashChunkSize = size
+	}
+}
+
+// WithLogger sets a Logger told about cache hits, the stages of reading and any warnings.
+func WithLogger(l Logger) Option {
+	return func(p *Package) {
+		p.logger = l
+	}
+}
+
+// WithCache sets the Cache ReadFromURL uses, see SetCache.
+func WithCache(c Cache) Option {
+	return func(p *Package) {
+		p.cache = c
+	}
+}
+
+// WithClock sets the function returning the current time, used to verify signatures that do not record when they
+// were made. time.Now is used otherwise.
+func WithClock(now func() time.Time) Option {
+	return func(p *Package) {
+		p.clock = now
+	}
+}
+
+// WithXarLimits sets the limits on the TOC and the metadata files of the package, in place of the xar.Limits defaults,
+// such as smaller ones for a service reading packages uploaded by untrusted users.
+func WithXarLimits(l xar.Limits) Option {
+	return func(p *Package) {
+		p.xarLimits = l
+	}
+}
+
+// WithPrimaryPkgRef makes the pkg-ref with id the primary one of a Distribution, whose bundle identifier and version
+// the manifest takes, for installers where the choice and the first pkg-ref are not the main application. Reading a
+// Distribution without a pkg-ref with id fails with ErrPkgRefNotFound. It has no effect on a component package.
+func WithPrimaryPkgRef(id string) Option {
+	return func(p *Package) {
+		p.primaryRef = id
+	}
+}
+
+// WithXMLLimits sets the limits on the XML of the Distribution and PackageInfo, in place of the XMLLimits defaults.
+func WithXMLLimits(l XMLLimits) Option {
+	return func(p *Package) {
+		p.xmlLimits = l
+	}
+}
+
+// xarOptions returns the options the archive of the package is read with.
+func (p *Package) xarOptions() xar.ReaderOptions {
+	return xar.ReaderOptions{Lenient: p.lenient, Limits: p.xarLimits}
+}
+
+// WithMetadata sets metadata used in place of what the package says, see SetMetadata.
+func WithMetadata(md Metadata) Option {
+	return func(p *Package) {
+		p.SetMetadata(md)
+	}
+}
+
+// PostBuildHook is called by BuildManifest with the manifest it built and the package, for publishing or notification
+// steps. An error from it fails BuildManifest.
+type PostBuildHook func(*Manifest, *Package) error
+
+// WithPostBuildHook adds a hook BuildManifest calls after building the manifest, in the order the hooks were added.
+// Hooks may change the manifest before it is returned.
+func WithPostBuildHook(hook PostBuildHook) Option {
+	return func(p *Package) {
+		p.postBuildHooks = append(p.postBuildHooks, hook)
+	}
+}
+
+// New returns a Package read from pr by ReadFromURL.
+func New(pr PackageReader, opts ...Option) *Package {
+	p := &Package{
+		reader:        pr,
+		hashType:      uint(HashSHA256),
+		hashChunkSize: httpio.DefaultHashChunkSize,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+func (p *Package) logf(format string, v ...interface{}) {
+	if p.logger != nil {
+		p.logger.Printf(format, v...)
+	}
+}
@@ -0,0 +1,66 @@
+package manifestgo
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"strings"
+)
+
+// Origin is who signed a package, as told by its signing certificate.
+type Origin string
+
+const (
+	// OriginUnsigned is a package without a signature.
+	OriginUnsigned Origin = "unsigned"
+	// OriginAdHoc is a package signed with a certificate not issued by Apple, such as an in-house CA.
+	OriginAdHoc Origin = "adhoc"
+	// OriginDeveloperID is a package signed with a Developer ID Installer certificate for distribution outside the App
+	// Store.
+	OriginDeveloperID Origin = "developer-id"
+	// OriginAppStore is a package signed by Apple, as Mac App Store and Apple's own software packages are, or with a
+	// Mac Installer Distribution certificate for submission to the App Store.
+	OriginAppStore Origin = "app-store"
+)
+
+// Origin returns who signed the package, judged from the names in its leaf certificate and that of its issuer. Only
+// trust it when HasValidSignature is true, as anyone can make a certificate with those names.
+func (p *Package) Origin() Origin {
+	if p == nil || p.signature == nil || len(p.signature.Certificates) == 0 {
+		return OriginUnsigned
+	}
+
+	return certificateOrigin(p.signature.Certificates[0])
+}
+
+func certificateOrigin(c *x509.Certificate) Origin {
+	// Only Apple issues the certificates named below, any other issuer is an in-house CA using their names.
+	if !isAppleName(c.Issuer) {
+		return OriginAdHoc
+	}
+
+	cn := c.Subject.CommonName
+	switch {
+	case strings.HasPrefix(cn, "Developer ID Installer:"):
+		return OriginDeveloperID
+	case strings.HasPrefix(cn, "3rd Party Mac Developer Installer:"),
+		strings.HasPrefix(cn, "Mac Installer Distribution:"):
+		return OriginAppStore
+	case strings.HasPrefix(c.Issuer.CommonName, "Developer ID"):
+		return OriginDeveloperID
+	case isAppleName(c.Subject):
+		return OriginAppStore
+	}
+
+	return OriginAdHoc
+}
+
+// isAppleName reports whether the name is one of Apple's own.
+func isAppleName(n pkix.Name) bool {
+	for _, o := range n.Organization {
+		if o == "Apple Inc." {
+			return true
+		}
+	}
+
+	return false
+}
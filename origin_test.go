@@ -0,0 +1,48 @@
+package manifestgo
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestCertificateOrigin(t *testing.T) {
+	apple := func(cn string) pkix.Name { return pkix.Name{CommonName: cn, Organization: []string{"Apple Inc."}} }
+	inHouse := func(cn string) pkix.Name { return pkix.Name{CommonName: cn, Organization: []string{"Example Corp"}} }
+
+	tests := []struct {
+		name    string
+		subject pkix.Name
+		issuer  pkix.Name
+		want    Origin
+	}{
+		{"developer id", inHouse("Developer ID Installer: Example Corp (ABCDE12345)"), apple("Developer ID Certification Authority"), OriginDeveloperID},
+		{"app store submission", inHouse("3rd Party Mac Developer Installer: Example Corp (ABCDE12345)"), apple("Apple Worldwide Developer Relations Certification Authority"), OriginAppStore},
+		{"mac installer distribution", inHouse("Mac Installer Distribution: Example Corp (ABCDE12345)"), apple("Apple Worldwide Developer Relations Certification Authority"), OriginAppStore},
+		{"apple", apple("Software Update"), apple("Apple Software Update Certification Authority"), OriginAppStore},
+		{"developer id issuer", inHouse("Example Corp"), apple("Developer ID Certification Authority"), OriginDeveloperID},
+		{"other apple issuer", inHouse("Example Corp"), apple("Apple Worldwide Developer Relations Certification Authority"), OriginAdHoc},
+		{"in-house", inHouse("Example Corp Installer"), inHouse("Example Corp CA"), OriginAdHoc},
+		{"in-house developer id name", inHouse("Developer ID Installer: Example Corp (ABCDE12345)"), inHouse("Example Corp CA"), OriginAdHoc},
+		{"in-house app store name", inHouse("Mac Installer Distribution: Example Corp (ABCDE12345)"), inHouse("Developer ID Certification Authority"), OriginAdHoc},
+		{"in-house apple subject", apple("Software Update"), inHouse("Example Corp CA"), OriginAdHoc},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := certificateOrigin(&x509.Certificate{Subject: tt.subject, Issuer: tt.issuer}); got != tt.want {
+				t.Errorf("got origin %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackageOriginUnsigned(t *testing.T) {
+	var p *Package
+	if got := p.Origin(); got != OriginUnsigned {
+		t.Errorf("got origin %s, want %s", got, OriginUnsigned)
+	}
+	if got := (&Package{}).Origin(); got != OriginUnsigned {
+		t.Errorf("got origin %s, want %s", got, OriginUnsigned)
+	}
+}
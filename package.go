@@ -2,22 +2,29 @@ package manifestgo
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
-	"encoding/xml"
 	"errors"
+	"fmt"
 	"hash"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	xar "github.com/dbyington/manifestgo/goxar"
 )
 
 const ReadSizeLimit = 32768
 
+var ErrPkgRefNotFound = errors.New("manifestgo: no pkg-ref with the id in the Distribution")
+
 type sourceFile string
 
 const (
@@ -31,8 +38,10 @@ type Bundle struct {
 	Version string `xml:"CFBundleVersion,attr"`
 }
 
+// Line is a line of the choices-outline of a Distribution, naming the choice it shows, with the lines nested under it.
 type Line struct {
 	Choice string `xml:"choice,attr"`
+	Lines  []Line `xml:"line"`
 }
 
 type Choice struct {
@@ -40,29 +49,80 @@ type Choice struct {
 	Title       string   `xml:"title,attr"`
 	Description string   `xml:"description,attr"`
 	PkgRef      []PkgRef `xml:"pkg-ref"`
+
+	// Visible, Enabled and Selected, and their start_ counterparts, are as the Distribution writes them: "true",
+	// "false" or a JavaScript expression Installer evaluates. Empty means the attribute is not given.
+	Visible       string `xml:"visible,attr"`
+	Enabled       string `xml:"enabled,attr"`
+	Selected      string `xml:"selected,attr"`
+	StartVisible  string `xml:"start_visible,attr"`
+	StartEnabled  string `xml:"start_enabled,attr"`
+	StartSelected string `xml:"start_selected,attr"`
 }
 
 type PkgInfo struct {
 	Identifier string   `xml:"identifier,attr"`
 	Version    string   `xml:"version,attr"`
 	Bundle     []Bundle `xml:"bundle"`
+	Payload    Payload  `xml:"payload"`
+}
+
+type Payload struct {
+	InstallKBytes int64 `xml:"installKBytes,attr"`
+	NumberOfFiles int64 `xml:"numberOfFiles,attr"`
 }
+
 type PkgRef struct {
 	Bundle            []Bundle `xml:"bundle-version>bundle"`
 	ID                string   `xml:"id,attr"`
 	PackageIdentifier string   `xml:"packageIdentifier,attr"`
 	Version           string   `xml:"version,attr"`
-	Package           string
+	InstallKBytes     int64    `xml:"installKBytes,attr"`
+	Package           string   `xml:",chardata"`
+	// MustClose are the apps Installer quits before installing the package.
+	MustClose []MustCloseApp `xml:"must-close>app"`
+}
+
+// MustCloseApp is an app of the must-close list of a pkg-ref.
+type MustCloseApp struct {
+	ID string `xml:"id,attr"`
+}
+
+type OSVersion struct {
+	Min    string `xml:"min,attr"`
+	Before string `xml:"before,attr"`
+}
+
+// Product is the product element of a Distribution, the identifier and version Installer shows for the whole product.
+type Product struct {
+	ID      string `xml:"id,attr"`
+	Version string `xml:"version,attr"`
+}
+
+// Options are the options element of a Distribution.
+type Options struct {
+	// HostArchitectures lists the architectures the package installs on, separated by commas, such as "x86_64,arm64".
+	HostArchitectures string `xml:"hostArchitectures,attr"`
 }
 
 type Package struct {
-	Choice  Choice   `xml:"choice"`
-	PkgInfo PkgInfo  `xml:"pkg-info"`
-	PkgRef  []PkgRef `xml:"pkg-ref"`
-	Title   string   `xml:"title"`
-	Hashes  []hash.Hash
-	URL     string
-	Size    int64
+	// Choice is every choice of the Distribution merged into one, as when a Distribution had a single choice. Choices
+	// has them apart.
+	Choice         Choice   `xml:"-"`
+	Choices        []Choice `xml:"choice"`
+	ChoicesOutline []Line   `xml:"choices-outline>line"`
+	PkgInfo        PkgInfo  `xml:"pkg-info"`
+	PkgRef         []PkgRef `xml:"pkg-ref"`
+	Title          string   `xml:"title"`
+	Options        Options  `xml:"options"`
+	Product        Product  `xml:"product"`
+
+	AllowedOSVersions       []OSVersion `xml:"allowed-os-versions>os-version"`
+	VolumeAllowedOSVersions []OSVersion `xml:"volume-check>allowed-os-versions>os-version"`
+
+	Hashes []hash.Hash
+	URL    string
+	Size   int64
 
 	id string
 
@@ -70,10 +130,50 @@ type Package struct {
 	ContentLength int64
 	Etag          string
 
-	hashChunkSize int64
-	hashType      uint
-	reader        PackageReader
-	source        sourceFile
+	hashChunkSize   int64
+	hashType        uint
+	reader          PackageReader
+	source          sourceFile
+	cache           Cache
+	progress        ProgressFunc
+	lenient         bool
+	warnings        []Warning
+	recovered       bool
+	titleStrategies []TitleStrategy
+	logger          Logger
+	tracer          Tracer
+	chunkLengths    []int64
+	fileSum         []byte
+	clock           func() time.Time
+	metadata        Metadata
+
+	previous          *Asset
+	previousEtag      string
+	partialOverwrite  PartialOverwriteFunc
+	reusedChunks      int
+	requireFileDigest bool
+
+	postBuildHooks []PostBuildHook
+	checkDrift     bool
+
+	readIcon bool
+	icon     []byte
+
+	readPayload bool
+	executables []Executable
+
+	signature      *xar.SignatureInfo
+	signatureValid bool
+	signatureErr   error
+	stapledTicket  bool
+	roots          *x509.CertPool
+	rootsID        string
+	xarLimits      xar.Limits
+	xmlLimits      XMLLimits
+
+	metadataChecksums []MetadataChecksum
+	scripts           DistributionScripts
+	primaryRef        string
 }
 
 type PackageReader interface {
@@ -84,11 +184,82 @@ type PackageReader interface {
 	ReadAt(p []byte, off int64) (n int, err error)
 }
 
+// Stage is a step of reading a package.
+type Stage string
+
+const (
+	StageReadingTOC Stage = "reading TOC"
+	StageHashing    Stage = "hashing"
+)
+
+// Progress reports how far reading a package has got. Chunk and Chunks are only set while hashing.
+type Progress struct {
+	Stage  Stage `json:"stage"`
+	Chunk  int   `json:"chunk,omitempty"`
+	Chunks int   `json:"chunks,omitempty"`
+}
+
+func (p Progress) String() string {
+	if p.Stage == StageHashing {
+		return fmt.Sprintf("hashing chunk %d/%d", p.Chunk, p.Chunks)
+	}
+	return string(p.Stage)
+}
+
+// ProgressFunc receives Progress while a package is read. As hashing runs alongside reading the TOC it may be called
+// from more than one goroutine.
+type ProgressFunc func(Progress)
+
+// hashProgressReporter is implemented by a PackageReader that can report the chunks hashed by HashURL.
+type hashProgressReporter interface {
+	SetHashProgress(func(done, total int))
+}
+
+// chunkLengthReporter is implemented by a PackageReader that records how many bytes each chunk hashed by HashURL had.
+type chunkLengthReporter interface {
+	ChunkLengths() []int64
+}
+
+// NewPackage returns a Package read from pr by ReadFromURL, hashing chunks of hashChunkSize with the hash whose sum
+// is hashTypeSize bytes.
+//
+// Deprecated: use New with WithHashScheme and WithChunkSize.
 func NewPackage(pr PackageReader, hashTypeSize uint, hashChunkSize int64) *Package {
-	return &Package{
-		reader:        pr,
-		hashChunkSize: hashChunkSize,
-		hashType:      hashTypeSize,
+	return New(pr, WithHashScheme(HashScheme(hashTypeSize)), WithChunkSize(hashChunkSize))
+}
+
+// SetProgress sets the function ReadFromURL reports its progress to.
+func (p *Package) SetProgress(f ProgressFunc) {
+	p.progress = f
+}
+
+// SetLenient sets whether ReadFromURL recovers from irregularities in the package, recording them as Warnings,
+// rather than failing.
+func (p *Package) SetLenient(lenient bool) {
+	p.lenient = lenient
+}
+
+// SetCache sets the Cache ReadFromURL uses to skip reading a package whose URL and Etag it has seen before.
+func (p *Package) SetCache(c Cache) {
+	p.cache = c
+}
+
+// SetMetadata sets metadata returned in place of what the package says, field by field for those set in md; fields
+// left empty keep any value set before. A package read with HashOnly has no metadata but this.
+func (p *Package) SetMetadata(md Metadata) {
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&p.metadata.BundleIdentifier, md.BundleIdentifier},
+		{&p.metadata.BundleVersion, md.BundleVersion},
+		{&p.metadata.Kind, md.Kind},
+		{&p.metadata.Title, md.Title},
+		{&p.metadata.MinimumOSVersion, md.MinimumOSVersion},
+	} {
+		if f.src != "" {
+			*f.dst = f.src
+		}
 	}
 }
 
@@ -96,9 +267,15 @@ func (p *Package) GetBundleIdentifier() string {
 	if p == nil {
 		return ""
 	}
+	if p.metadata.BundleIdentifier != "" {
+		return p.metadata.BundleIdentifier
+	}
 	if p.source == sourcePackageInfo {
 		return p.PkgInfo.Identifier
 	}
+	if id := p.product().ID; id != "" {
+		return id
+	}
 
 	id := p.getPrimaryPkgRefBundle().ID
 
@@ -109,11 +286,46 @@ func (p *Package) GetBundleIdentifier() string {
 	return id
 }
 
+// ProductID returns the id of the product element of the Distribution, empty when it has none.
+func (p *Package) ProductID() string {
+	if p == nil {
+		return ""
+	}
+
+	return p.Product.ID
+}
+
+// ProductVersion returns the version of the product element of the Distribution, the version Installer shows, empty
+// when it has none.
+func (p *Package) ProductVersion() string {
+	if p == nil {
+		return ""
+	}
+
+	return p.Product.Version
+}
+
+// product returns the product element the bundle identifier and version are taken from before the pkg-refs, none when
+// WithPrimaryPkgRef names the pkg-ref to take them from.
+func (p *Package) product() Product {
+	if p.primaryRef != "" {
+		return Product{}
+	}
+
+	return p.Product
+}
+
 func (p *Package) getPrimaryPkgRef() PkgRef {
 	if p == nil {
 		return PkgRef{}
 	}
 
+	if p.primaryRef != "" {
+		if ref, ok := p.pkgRef(p.primaryRef); ok {
+			return ref
+		}
+	}
+
 	if len(p.Choice.PkgRef) > 0 && p.Choice.ID != "" {
 		for _, cPkg := range p.PkgRef {
 			if cPkg.ID == p.Choice.ID {
@@ -131,6 +343,65 @@ func (p *Package) getPrimaryPkgRef() PkgRef {
 	return p.PkgRef[0]
 }
 
+// pkgRef returns the pkg-ref with id, merging those a Distribution splits it over, typically one giving its version
+// and package and another its bundles.
+func (p *Package) pkgRef(id string) (PkgRef, bool) {
+	var (
+		m  PkgRef
+		ok bool
+	)
+	for _, ref := range p.PkgRef {
+		if ref.ID != id {
+			continue
+		}
+		ok = true
+		m.ID = ref.ID
+		mergeAttr(&m.PackageIdentifier, ref.PackageIdentifier)
+		mergeAttr(&m.Version, ref.Version)
+		mergeAttr(&m.Package, strings.TrimSpace(ref.Package))
+		if ref.InstallKBytes != 0 {
+			m.InstallKBytes = ref.InstallKBytes
+		}
+		m.Bundle = append(m.Bundle, ref.Bundle...)
+		m.MustClose = append(m.MustClose, ref.MustClose...)
+	}
+
+	return m, ok
+}
+
+// checkPrimaryPkgRef returns an error if the Distribution has no pkg-ref with the id of WithPrimaryPkgRef.
+func (p *Package) checkPrimaryPkgRef() error {
+	if p.primaryRef == "" || p.source != sourceDistribution {
+		return nil
+	}
+	if _, ok := p.pkgRef(p.primaryRef); !ok {
+		return fmt.Errorf("%w: %q", ErrPkgRefNotFound, p.primaryRef)
+	}
+
+	return nil
+}
+
+// MustCloseApps returns the bundle ids of the apps the pkg-refs of the Distribution must close, which Installer quits
+// before installing, so users can be warned before the package is pushed. Each id is listed once.
+func (p *Package) MustCloseApps() []string {
+	if p == nil {
+		return nil
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, ref := range p.PkgRef {
+		for _, app := range ref.MustClose {
+			if app.ID != "" && !seen[app.ID] {
+				seen[app.ID] = true
+				ids = append(ids, app.ID)
+			}
+		}
+	}
+
+	return ids
+}
+
 func (p *Package) getPrimaryPkgRefBundle() Bundle {
 	if p == nil {
 		return Bundle{}
@@ -155,10 +426,16 @@ func (p *Package) GetVersion() string {
 	if p == nil {
 		return ""
 	}
+	if p.metadata.BundleVersion != "" {
+		return p.metadata.BundleVersion
+	}
 
 	if p.source == sourcePackageInfo {
 		return p.PkgInfo.Version
 	}
+	if v := p.product().Version; v != "" {
+		return v
+	}
 
 	v := p.getPrimaryPkgRef().Version
 
@@ -173,6 +450,9 @@ func (p *Package) GetKind() string {
 	if p == nil {
 		return ""
 	}
+	if p.metadata.Kind != "" {
+		return p.metadata.Kind
+	}
 	return "software"
 }
 
@@ -183,50 +463,106 @@ func (p *Package) GetPath() string {
 	return p.getPrimaryPkgRefBundle().Path
 }
 
+// GetTitle returns the title set by SetMetadata, or else the first title given by the title strategies,
+// DefaultTitleStrategies unless WithTitleStrategy sets others.
 func (p *Package) GetTitle() string {
 	if p == nil {
 		return ""
 	}
+	if p.metadata.Title != "" {
+		return p.metadata.Title
+	}
 
-	if p.source == sourcePackageInfo {
-		primaryPkgID := p.PkgInfo.Identifier
-		if strings.HasSuffix(primaryPkgID, "pkg") {
-			pkgID := strings.Split(p.PkgInfo.Identifier, ".")
-			primaryPkgID = strings.Join(pkgID[:len(pkgID)-1], ".")
+	strategies := p.titleStrategies
+	if strategies == nil {
+		strategies = DefaultTitleStrategies
+	}
+	for _, s := range strategies {
+		if t := s(p); t != "" {
+			return t
 		}
+	}
 
-		for _, bundle := range p.PkgInfo.Bundle {
-			if bundle.ID == primaryPkgID {
-				b := strings.SplitAfter(bundle.Path, "/")
-				t := strings.Split(b[len(b)-1], ".")
-				return t[0]
-			}
-		}
+	return ""
+}
+
+// GetSigner returns the common name of the certificate that signed the package, or an empty string if it is unsigned.
+func (p *Package) GetSigner() string {
+	if p == nil || p.signature == nil || len(p.signature.Certificates) == 0 {
+		return ""
+	}
+
+	return p.signature.Certificates[0].Subject.CommonName
+}
+
+// SignatureInfo returns the signature of the package, or nil if it is not signed.
+func (p *Package) SignatureInfo() *xar.SignatureInfo {
+	if p == nil {
+		return nil
 	}
 
-	if p.Title != "" {
-		return p.Title
+	return p.signature
+}
+
+// HasValidSignature reports whether the package is signed and its signatures verify against the system roots.
+func (p *Package) HasValidSignature() bool {
+	return p != nil && p.signatureValid
+}
+
+// SignatureError returns why HasValidSignature is false: xar.ErrNotSigned for an unsigned package, or a
+// *xar.VerificationError saying which signature failed and why.
+func (p *Package) SignatureError() error {
+	if p == nil || (!p.signatureValid && p.signatureErr == nil) {
+		return xar.ErrNotSigned
 	}
 
-	// TODO: Can this be used if the Title is not available or is obviously not what should be used?
-	// pkgID := strings.Split(p.GetBundleIdentifier(), ".")
-	// primaryPkgID := strings.Join(pkgID[:len(pkgID)-1], ".")
-	// for _, b := range p.getPrimaryPkgRef().Bundle {
-	//     if b.ID == primaryPkgID {
-	//         fmt.Printf("Got Bundle: %+v\n", b)
-	//     }
-	// }
+	return p.signatureErr
+}
+
+// GetMinimumOSVersion returns the lowest macOS version the Distribution allows the package to be installed on, or an
+// empty string if it does not say.
+func (p *Package) GetMinimumOSVersion() string {
+	if p == nil {
+		return ""
+	}
+	if p.metadata.MinimumOSVersion != "" {
+		return p.metadata.MinimumOSVersion
+	}
+
+	var min string
+	for _, v := range append(p.AllowedOSVersions, p.VolumeAllowedOSVersions...) {
+		if v.Min == "" {
+			continue
+		}
+		if min == "" || compareVersions(v.Min, min) < 0 {
+			min = v.Min
+		}
+	}
+
+	return min
+}
+
+// Architectures returns the architectures the Distribution allows the package to be installed on, such as "arm64"
+// and "x86_64". When it does not say, they are the PayloadArchitectures, with WithPayloadArchitectures, or nil, in
+// which case it installs on any Mac.
+func (p *Package) Architectures() []string {
+	if p == nil {
+		return nil
+	}
+	if strings.TrimSpace(p.Options.HostArchitectures) == "" {
+		return p.PayloadArchitectures()
+	}
 
-	if p.GetPath() != "" {
-		path := strings.Split(p.GetPath(), "/")
-		t := strings.Split(path[len(path)-1], ".")
-		p.Title = t[0]
-	} else {
-		sub := strings.Split(p.GetBundleIdentifier(), ".")
-		p.Title = strings.Title(sub[len(sub)-1])
+	var archs []string
+	seen := make(map[string]bool)
+	for _, a := range strings.Split(p.Options.HostArchitectures, ",") {
+		if a = strings.TrimSpace(a); a != "" && !seen[a] {
+			seen[a] = true
+			archs = append(archs, a)
+		}
 	}
 
-	return p.Title
+	return archs
 }
 
 func (p *Package) GetHashStrings() []string {
@@ -238,8 +574,27 @@ func (p *Package) GetHashStrings() []string {
 	return s
 }
 
+// BuildManifest builds the manifest of the package like BuildPackageManifest, then calls the hooks added with
+// WithPostBuildHook. With WithDriftCheck it first makes sure the package has not changed since it was read.
 func (p *Package) BuildManifest() (*Manifest, error) {
-	return BuildPackageManifest(p)
+	_, span := p.startSpan(context.Background(), SpanBuildManifest)
+	err := p.checkSourceDrift()
+	var m *Manifest
+	if err == nil {
+		m, err = BuildPackageManifest(p)
+	}
+	span.End(err)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hook := range p.postBuildHooks {
+		if err := hook(m, p); err != nil {
+			return nil, fmt.Errorf("manifestgo: post-build hook: %w", err)
+		}
+	}
+
+	return m, nil
 }
 
 func (p *Package) AsJSON(indent int) ([]byte, error) {
@@ -251,22 +606,47 @@ func (p *Package) AsJSON(indent int) ([]byte, error) {
 	return json.Marshal(p)
 }
 
-func (p *Package) ReadFromURL() error {
+func (p *Package) ReadFromURL() (err error) {
 	urlHasher := p.reader.HashURL
 	if urlHasher == nil {
 		return errors.New("no hasher")
 	}
 
+	ctx, span := p.startSpan(context.Background(), SpanReadFromURL)
+	span.SetAttribute("url", p.reader.URL())
+	defer func() {
+		err = sourceDriftError(err)
+		span.End(err)
+	}()
+
+	if p.loadFromCache() {
+		span.SetAttribute("cache_hit", true)
+		p.logf("%s: read from cache", p.reader.URL())
+		return p.checkPrimaryPkgRef()
+	}
+
 	// Hasing the file could take a while so we're going to farm that out immediately and inspect the error later.
 	var (
 		hashes  []hash.Hash
+		lengths []int64
 		hashErr error
 	)
+	if r, ok := p.reader.(hashProgressReporter); ok && p.progress != nil {
+		r.SetHashProgress(func(done, total int) {
+			p.reportProgress(Progress{Stage: StageHashing, Chunk: done, Chunks: total})
+		})
+	}
+
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	go func(wg *sync.WaitGroup) {
 		defer wg.Done()
-		hashes, hashErr = p.reader.HashURL(p.hashType)
+		_, span := p.startSpan(ctx, SpanHash)
+		span.SetAttribute("chunk_size", p.hashChunkSize)
+		hashes, lengths, hashErr = p.hashChunks()
+		span.SetAttribute("chunks", len(hashes))
+		span.SetAttribute("reused_chunks", p.reusedChunks)
+		span.End(hashErr)
 	}(wg)
 
 	size := p.reader.Length()
@@ -277,30 +657,61 @@ func (p *Package) ReadFromURL() error {
 	p.Size = size
 	p.URL = p.reader.URL()
 	p.Etag = p.reader.Etag()
+	p.ContentLength = p.reader.Length()
 
-	x, err := xar.NewReader(p.reader, p.reader.Length())
+	p.reportProgress(Progress{Stage: StageReadingTOC})
+	p.logf("%s: %s", p.URL, StageReadingTOC)
+	_, tocSpan := p.startSpan(ctx, SpanReadTOC)
+	x, err := xar.NewReaderWithOptions(p.reader, p.reader.Length(), p.xarOptions())
+	tocSpan.End(err)
 	if err != nil {
 		return err
 	}
 
-	if err = p.fill(x); err != nil {
+	_, parseSpan := p.startSpan(ctx, SpanParseMetadata)
+	err = p.fill(x)
+	parseSpan.End(err)
+	if err != nil {
 		return err
 	}
+	p.stapledTicket = hasStapledTicket(p.reader, p.reader.Length())
 
 	wg.Wait()
 	if hashErr != nil {
 		return hashErr
 	}
 	p.Hashes = append(p.Hashes, hashes...)
+	p.chunkLengths = lengths
+	p.checkFileDigest()
 
-	return nil
+	return p.storeInCache()
+}
+
+func (p *Package) reportProgress(pr Progress) {
+	if p.progress != nil {
+		p.progress(pr)
+	}
 }
 
-func ReadPkgFile(name string) (*Package, error) {
+// ReadPkgFile reads the package in the file name, hashing it whole. opts configure the Package before it is read, such
+// as WithRoots giving the roots its signature is verified against.
+func ReadPkgFile(name string, opts ...Option) (*Package, error) {
+	return readPkgFile(name, false, opts)
+}
+
+// ReadPkgFileLenient reads the package like ReadPkgFile, but recovers from irregularities in it, recording them as
+// Warnings, rather than failing.
+func ReadPkgFileLenient(name string, opts ...Option) (*Package, error) {
+	return readPkgFile(name, true, opts)
+}
+
+func readPkgFile(name string, lenient bool, opts []Option) (*Package, error) {
 	f, err := os.Open(name)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
+
 	fstat, err := f.Stat()
 	if err != nil {
 		return nil, err
@@ -313,11 +724,46 @@ func ReadPkgFile(name string) (*Package, error) {
 	}
 
 	p := &Package{
-		Hashes: []hash.Hash{shaSum},
-		Size:   fstat.Size(),
+		Hashes:        []hash.Hash{shaSum},
+		Size:          fstat.Size(),
+		ContentLength: fstat.Size(),
+		hashType:      sha256.Size,
+		lenient:       lenient,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	r, err := xar.NewReaderWithOptions(f, fstat.Size(), p.xarOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.fill(r); err != nil {
+		return nil, err
+	}
+	p.stapledTicket = hasStapledTicket(f, fstat.Size())
+
+	return p, nil
+}
+
+// ParsePackageBytes reads a package held in memory, as ReadPkgFile reads one from disk, with the opts. Every read
+// enforces the xar.Limits defaults, or those of WithXarLimits, so b may come from an untrusted source.
+func ParsePackageBytes(b []byte, opts ...Option) (*Package, error) {
+	shaSum := sha256.New()
+	shaSum.Write(b)
+
+	p := &Package{
+		Hashes:        []hash.Hash{shaSum},
+		Size:          int64(len(b)),
+		ContentLength: int64(len(b)),
+		hashType:      sha256.Size,
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
 
-	r, err := xar.NewReader(f, fstat.Size())
+	r, err := xar.NewReaderWithOptions(bytes.NewReader(b), int64(len(b)), p.xarOptions())
 	if err != nil {
 		return nil, err
 	}
@@ -325,6 +771,7 @@ func ReadPkgFile(name string) (*Package, error) {
 	if err := p.fill(r); err != nil {
 		return nil, err
 	}
+	p.stapledTicket = hasStapledTicket(bytes.NewReader(b), int64(len(b)))
 
 	return p, nil
 }
@@ -341,33 +788,95 @@ func Sha256SumReader(r io.Reader) (hash.Hash, error) {
 }
 
 func (p *Package) fill(r *xar.Reader) error {
+	p.signature = r.SignatureInfo()
+	p.warnings = nil
+	p.metadataChecksums = nil
+	p.scripts = DistributionScripts{}
+	p.recovered = len(r.Warnings) > 0
+	for _, w := range r.Warnings {
+		p.warn(WarningMalformedArchive, "%s", w)
+	}
+	p.signatureErr = r.Verify(xar.VerifyOptions{Clock: p.clock, Roots: p.roots})
+	p.signatureValid = p.signatureErr == nil
+
 	for _, f := range r.File {
-		distReader, err := f.Open()
-		if err != nil {
-			return err
+		// The reader has already warned about an empty entry, which has nothing to unmarshal.
+		if p.lenient && f.Size == 0 {
+			continue
 		}
 
-		b := make([]byte, f.Size)
-		_, err = io.ReadFull(distReader, b)
+		distReader, ok, err := p.readMetadata(f)
 		if err != nil {
 			return err
 		}
+		if !ok {
+			continue
+		}
+
+		// The file is decoded as it is decompressed, up to the size it declares, which the reader has bounded.
+		distReader = io.LimitReader(distReader, f.Size)
 
 		// Because this could come from one of two sources, which have slightly different layouts we unmarshal into different interfaces depending on the file.
 		switch sourceFile(f.Name) {
 		case sourceDistribution:
-			if err := xml.Unmarshal(b, &p); err != nil {
+			if err := p.unmarshalXML(f.Name, distReader, p); err != nil {
 				return err
 			}
+			p.Choice = mergeChoices(p.Choices)
 		case sourcePackageInfo:
 			var pi PkgInfo
-			if err := xml.Unmarshal(b, &pi); err != nil {
+			if err := p.unmarshalXML(f.Name, distReader, &pi); err != nil {
 				return err
 			}
 			p.PkgInfo = pi
 		}
 		p.source = sourceFile(f.Name)
 	}
+	if err := p.checkPrimaryPkgRef(); err != nil {
+		return err
+	}
+	p.checkMetadata()
+	p.readExecutables(r)
 
 	return nil
 }
+
+// compareVersions compares dotted version strings numerically, returning -1, 0 or 1. Missing components count as 0 and
+// components that are not numbers are compared as strings.
+func compareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y string
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+
+		xn, xErr := strconv.Atoi(defaultString(x, "0"))
+		yn, yErr := strconv.Atoi(defaultString(y, "0"))
+		switch {
+		case xErr == nil && yErr == nil && xn != yn:
+			if xn < yn {
+				return -1
+			}
+			return 1
+		case (xErr != nil || yErr != nil) && x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func defaultString(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
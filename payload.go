@@ -0,0 +1,104 @@
+package manifestgo
+
+import (
+	"path"
+	"sort"
+
+	xar "github.com/dbyington/manifestgo/goxar"
+	"github.com/dbyington/manifestgo/internal/payload"
+)
+
+// Executable is a Mach-O executable a package installs.
+type Executable struct {
+	// Package is the name of the component package installing it, empty for a flat component package.
+	Package string `json:"package,omitempty"`
+	// Path is where it installs, relative to the install location.
+	Path string `json:"path"`
+	// Architectures are those it was built for, such as "arm64" and "x86_64" for a universal binary.
+	Architectures []string `json:"architectures"`
+}
+
+// WithPayloadArchitectures makes ReadFromURL and ReadPkgFile also read the payloads of the package, for the
+// architectures of the Mach-O executables they install, returned by Executables and used by Architectures when the
+// Distribution does not say. Each payload is read and decompressed in full, so this reads the whole package a second
+// time. A payload that cannot be read is warned about.
+func WithPayloadArchitectures() Option {
+	return func(p *Package) {
+		p.readPayload = true
+	}
+}
+
+// Executables returns the Mach-O executables in the payloads of the package read with WithPayloadArchitectures.
+func (p *Package) Executables() []Executable {
+	return p.executables
+}
+
+// PayloadArchitectures returns the architectures every executable in the payloads was built for, those a Mac must have
+// to run all of them natively, or nil when the payloads were not read or have no executables.
+func (p *Package) PayloadArchitectures() []string {
+	if p == nil || len(p.executables) == 0 {
+		return nil
+	}
+
+	common := make(map[string]bool)
+	for _, a := range p.executables[0].Architectures {
+		common[a] = true
+	}
+	for _, e := range p.executables[1:] {
+		has := make(map[string]bool)
+		for _, a := range e.Architectures {
+			has[a] = true
+		}
+		for a := range common {
+			if !has[a] {
+				delete(common, a)
+			}
+		}
+	}
+
+	archs := make([]string, 0, len(common))
+	for a := range common {
+		archs = append(archs, a)
+	}
+	sort.Strings(archs)
+
+	return archs
+}
+
+// readExecutables reads the executables of the payloads of the archive r, with WithPayloadArchitectures.
+func (p *Package) readExecutables(r *xar.Reader) {
+	p.executables = nil
+	if !p.readPayload {
+		return
+	}
+
+	files, err := r.Files()
+	if err != nil {
+		p.warn(WarningUnreadablePayload, "listing the files of the package: %s", err)
+		return
+	}
+	for _, f := range files {
+		if f.Type != xar.FileTypeFile || path.Base(f.Name) != "Payload" {
+			continue
+		}
+		component := path.Dir(f.Name)
+		if component == "." {
+			component = ""
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			p.warn(WarningUnreadablePayload, "%s: %s", f.Name, err)
+			continue
+		}
+		bins, err := payload.Executables(rc)
+		rc.Close()
+		if err != nil {
+			p.warn(WarningUnreadablePayload, "%s: %s", f.Name, err)
+			continue
+		}
+		for _, b := range bins {
+			p.executables = append(p.executables, Executable{Package: component, Path: b.Path, Architectures: b.Architectures})
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package manifestgo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrPolicyViolation = errors.New("manifestgo: package violates the signature policy")
+
+// SignaturePolicy is what an organization requires of the signature of the packages it deploys, checked by
+// CheckPolicy. The zero policy allows any package, signed or not.
+type SignaturePolicy struct {
+	// RequireValidSignature requires a signature that verifies against the system roots, see HasValidSignature.
+	RequireValidSignature bool `json:"require_valid_signature,omitempty"`
+	// RequireDeveloperID requires a valid signature with a Developer ID Installer certificate.
+	RequireDeveloperID bool `json:"require_developer_id,omitempty"`
+	// RequireTeamID requires a valid signature by the Apple developer team with the id, such as "ABCDE12345", the
+	// organizational unit of its certificate.
+	RequireTeamID string `json:"require_team_id,omitempty"`
+	// RequireNotarization requires a notarization ticket stapled to the package, see HasStapledTicket.
+	RequireNotarization bool `json:"require_notarization,omitempty"`
+	// DisallowExpired refuses a package whose signing certificates have expired, although the signature of one signed
+	// with a timestamp while they were valid still verifies.
+	DisallowExpired bool `json:"disallow_expired,omitempty"`
+}
+
+// PolicyError is returned by CheckPolicy with every requirement of the policy the package does not meet. It wraps
+// ErrPolicyViolation.
+type PolicyError struct {
+	Violations []string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrPolicyViolation, strings.Join(e.Violations, ", "))
+}
+
+func (e *PolicyError) Unwrap() error {
+	return ErrPolicyViolation
+}
+
+// CheckPolicy returns a *PolicyError if the package does not meet the policy.
+func (p *Package) CheckPolicy(policy SignaturePolicy) error {
+	var violations []string
+	requireValid := policy.RequireValidSignature || policy.RequireDeveloperID || policy.RequireTeamID != ""
+	if requireValid && !p.HasValidSignature() {
+		violations = append(violations, fmt.Sprintf("no valid signature: %s", p.SignatureError()))
+	}
+	if policy.RequireDeveloperID && p.Origin() != OriginDeveloperID {
+		violations = append(violations, fmt.Sprintf("signed by %s, not a Developer ID", p.Origin()))
+	}
+	if policy.RequireTeamID != "" {
+		if team := p.TeamID(); team != policy.RequireTeamID {
+			violations = append(violations, fmt.Sprintf("team id %q is not %q", team, policy.RequireTeamID))
+		}
+	}
+	if policy.RequireNotarization && !p.HasStapledTicket() {
+		violations = append(violations, "no stapled notarization ticket")
+	}
+	if policy.DisallowExpired && p.signature != nil {
+		now := time.Now()
+		if p.clock != nil {
+			now = p.clock()
+		}
+		for _, c := range p.signature.Certificates {
+			if now.After(c.NotAfter) {
+				violations = append(violations, fmt.Sprintf("certificate %q expired %s", c.Subject.CommonName, c.NotAfter.Format("2006-01-02")))
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// TeamID returns the Apple developer team id of the certificate that signed the package, the organizational unit of
+// a Developer ID or App Store certificate, or the id in parentheses ending its common name, such as "ABCDE12345" of
+// "Developer ID Installer: Example Inc (ABCDE12345)". It returns an empty string if the package is unsigned or the
+// certificate has none.
+func (p *Package) TeamID() string {
+	if p == nil || p.signature == nil || len(p.signature.Certificates) == 0 {
+		return ""
+	}
+	subject := p.signature.Certificates[0].Subject
+	if len(subject.OrganizationalUnit) > 0 {
+		return subject.OrganizationalUnit[0]
+	}
+
+	cn := subject.CommonName
+	if i := strings.LastIndex(cn, " ("); i >= 0 && strings.HasSuffix(cn, ")") {
+		return cn[i+2 : len(cn)-1]
+	}
+
+	return ""
+}
+
+// HasStapledTicket reports whether a notarization ticket is stapled to the package, as stapler staple appends one
+// after the archive. The ticket is only found, not verified: Apple's signature of it is left to Gatekeeper.
+func (p *Package) HasStapledTicket() bool {
+	return p != nil && p.stapledTicket
+}
+
+// ticketTrailerMagic ends a package a notarization ticket is stapled to, after the ticket and its version, type and
+// length.
+const ticketTrailerMagic = "t8lr"
+
+// ticketTrailerSize is the size of the trailer after a stapled ticket.
+const ticketTrailerSize = 12
+
+// hasStapledTicket reports whether the package read from r, which is size bytes, ends with a stapled ticket.
+func hasStapledTicket(r io.ReaderAt, size int64) bool {
+	if size < ticketTrailerSize {
+		return false
+	}
+
+	b := make([]byte, ticketTrailerSize)
+	if _, err := r.ReadAt(b, size-ticketTrailerSize); err != nil && err != io.EOF {
+		return false
+	}
+	length := int64(binary.LittleEndian.Uint32(b[8:]))
+
+	return string(b[:4]) == ticketTrailerMagic && length > 0 && length <= size-ticketTrailerSize
+}
@@ -0,0 +1,48 @@
+package manifestgo
+
+// Receipt is a bundle a package installs, as it is recorded once installed.
+type Receipt struct {
+	// PackageID is the identifier of the component package installing the bundle.
+	PackageID string `json:"package_id"`
+	ID        string `json:"id"`
+	Version   string `json:"version"`
+	Path      string `json:"path"`
+}
+
+// Receipts returns every bundle of every component package, in the order they appear. A bundle listed more than once
+// for a component package is returned once.
+func (p *Package) Receipts() []Receipt {
+	if p == nil {
+		return nil
+	}
+
+	if p.source == sourcePackageInfo {
+		return bundleReceipts(p.PkgInfo.Identifier, p.PkgInfo.Bundle, nil)
+	}
+
+	var receipts []Receipt
+	seen := make(map[Receipt]bool)
+	for _, ref := range p.PkgRef {
+		receipts = append(receipts, bundleReceipts(ref.ID, ref.Bundle, seen)...)
+	}
+
+	return receipts
+}
+
+func bundleReceipts(pkgID string, bundles []Bundle, seen map[Receipt]bool) []Receipt {
+	if seen == nil {
+		seen = make(map[Receipt]bool)
+	}
+
+	var receipts []Receipt
+	for _, b := range bundles {
+		r := Receipt{PackageID: pkgID, ID: b.ID, Version: b.Version, Path: b.Path}
+		if seen[r] {
+			continue
+		}
+		seen[r] = true
+		receipts = append(receipts, r)
+	}
+
+	return receipts
+}
@@ -0,0 +1,147 @@
+package manifestgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dbyington/manifestgo/ftpio"
+	"github.com/dbyington/manifestgo/httpio"
+	"github.com/dbyington/manifestgo/sftpio"
+)
+
+var ErrUnsupportedScheme = errors.New("manifestgo: no reader registered for the URL scheme")
+
+// ReaderOptions are given to a ReaderFactory. A factory ignores the options its transport has no use for.
+type ReaderOptions struct {
+	// HashChunkSize is the size of each chunk the reader hashes, httpio.DefaultHashChunkSize if 0.
+	HashChunkSize int64
+	// HTTPOptions are passed to httpio by the http and https readers, to authenticate for example.
+	HTTPOptions []httpio.Option
+	// Username and Password log in to an ftps server, in place of those of the URL.
+	Username, Password string
+}
+
+// ReaderFactory opens the package at rawURL, a URL of the scheme the factory is registered for. The caller closes the
+// reader it returns if it is an io.Closer. A reader hashing the whole package as it hashes its chunks returns the
+// SHA-256 from a FileDigest() []byte method, for Package.FullSHA256.
+type ReaderFactory func(ctx context.Context, rawURL string, opts ReaderOptions) (PackageReader, error)
+
+var (
+	readersMu sync.RWMutex
+	readers   = map[string]ReaderFactory{
+		"http":  openHTTPReader,
+		"https": openHTTPReader,
+		"file":  openFileReader,
+		"smb":   ShareReader(nil),
+		"nfs":   ShareReader(nil),
+		"sftp":  openSFTPReader,
+		"ftps":  openFTPSReader,
+	}
+)
+
+// RegisterReader makes OpenReader use f for URLs of the scheme, such as "s3" or "smb", replacing any factory it had.
+// http and https URLs are read with httpio, sftp URLs with sftpio, ftps URLs with ftpio, file URLs from the local file,
+// and smb and nfs URLs with ShareReader, unless another factory is registered for them. It is safe to call from
+// several goroutines, typically from an init function.
+func RegisterReader(scheme string, f ReaderFactory) {
+	readersMu.Lock()
+	defer readersMu.Unlock()
+
+	readers[strings.ToLower(scheme)] = f
+}
+
+// OpenReader opens the package at rawURL with the factory registered for its scheme, failing with
+// ErrUnsupportedScheme if there is none.
+func OpenReader(ctx context.Context, rawURL string, opts ReaderOptions) (PackageReader, error) {
+	f, ok := readerFactory(rawURL)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedScheme, rawURL)
+	}
+
+	return f(ctx, rawURL, opts)
+}
+
+// HasReader reports whether a reader is registered for the scheme of rawURL.
+func HasReader(rawURL string) bool {
+	_, ok := readerFactory(rawURL)
+	return ok
+}
+
+// ReaderSchemes returns the schemes readers are registered for, sorted.
+func ReaderSchemes() []string {
+	readersMu.RLock()
+	defer readersMu.RUnlock()
+
+	schemes := make([]string, 0, len(readers))
+	for s := range readers {
+		schemes = append(schemes, s)
+	}
+	sort.Strings(schemes)
+
+	return schemes
+}
+
+func readerFactory(rawURL string) (ReaderFactory, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" {
+		return nil, false
+	}
+
+	readersMu.RLock()
+	defer readersMu.RUnlock()
+	f, ok := readers[strings.ToLower(u.Scheme)]
+
+	return f, ok
+}
+
+func openHTTPReader(ctx context.Context, rawURL string, opts ReaderOptions) (PackageReader, error) {
+	httpOpts := append([]httpio.Option{
+		httpio.WithContext(ctx),
+		httpio.WithURL(rawURL),
+	}, opts.HTTPOptions...)
+	if opts.HashChunkSize > 0 {
+		httpOpts = append(httpOpts, httpio.WithHashChunkSize(opts.HashChunkSize))
+	}
+
+	return httpio.NewReadAtCloser(httpOpts...)
+}
+
+func openSFTPReader(ctx context.Context, rawURL string, opts ReaderOptions) (PackageReader, error) {
+	sftpOpts := []sftpio.Option{sftpio.WithContext(ctx), sftpio.WithURL(rawURL)}
+	if opts.HashChunkSize > 0 {
+		sftpOpts = append(sftpOpts, sftpio.WithHashChunkSize(opts.HashChunkSize))
+	}
+
+	return sftpio.NewReadAtCloser(sftpOpts...)
+}
+
+func openFTPSReader(ctx context.Context, rawURL string, opts ReaderOptions) (PackageReader, error) {
+	ftpOpts := []ftpio.Option{ftpio.WithContext(ctx), ftpio.WithURL(rawURL)}
+	if opts.HashChunkSize > 0 {
+		ftpOpts = append(ftpOpts, ftpio.WithHashChunkSize(opts.HashChunkSize))
+	}
+	if opts.Username != "" {
+		ftpOpts = append(ftpOpts, ftpio.WithCredentials(opts.Username, opts.Password))
+	}
+
+	return ftpio.NewReadAtCloser(ftpOpts...)
+}
+
+// openFileReader reads the local file of a file URL, such as file:///srv/pkgs/App.pkg, as a Spool that leaves the file
+// in place when closed.
+func openFileReader(ctx context.Context, rawURL string, opts ReaderOptions) (PackageReader, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, fmt.Errorf("manifestgo: file URL of another host: %s", rawURL)
+	}
+
+	return openSpool(ctx, u.Path, SpoolOptions{URL: rawURL, HashChunkSize: opts.HashChunkSize}, false)
+}
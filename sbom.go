@@ -0,0 +1,176 @@
+package manifestgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrUnknownSBOMFormat = errors.New("manifestgo: unknown SBOM format")
+
+// SBOMFormat is the SBOM standard AsSBOM writes a package in.
+type SBOMFormat string
+
+const (
+	// SBOMCycloneDX writes a CycloneDX component, for the components of a CycloneDX JSON BOM.
+	SBOMCycloneDX SBOMFormat = "cyclonedx"
+	// SBOMSPDX writes an SPDX 2.3 package, for the packages of an SPDX JSON document.
+	SBOMSPDX SBOMFormat = "spdx"
+)
+
+// ParseSBOMFormat returns the SBOMFormat named s.
+func ParseSBOMFormat(s string) (SBOMFormat, error) {
+	switch f := SBOMFormat(strings.ToLower(s)); f {
+	case SBOMCycloneDX, SBOMSPDX:
+		return f, nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUnknownSBOMFormat, s)
+}
+
+type cycloneDXComponent struct {
+	Type               string                 `json:"type"`
+	BOMRef             string                 `json:"bom-ref,omitempty"`
+	Supplier           *cycloneDXOrganization `json:"supplier,omitempty"`
+	Name               string                 `json:"name"`
+	Version            string                 `json:"version,omitempty"`
+	Hashes             []cycloneDXHash        `json:"hashes,omitempty"`
+	ExternalReferences []cycloneDXExternalRef `json:"externalReferences,omitempty"`
+	Properties         []cycloneDXProperty    `json:"properties,omitempty"`
+}
+
+type cycloneDXOrganization struct {
+	Name string `json:"name"`
+}
+
+type cycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cycloneDXExternalRef struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type spdxPackage struct {
+	SPDXID                string         `json:"SPDXID"`
+	Name                  string         `json:"name"`
+	VersionInfo           string         `json:"versionInfo,omitempty"`
+	Supplier              string         `json:"supplier"`
+	DownloadLocation      string         `json:"downloadLocation"`
+	FilesAnalyzed         bool           `json:"filesAnalyzed"`
+	Checksums             []spdxChecksum `json:"checksums,omitempty"`
+	PrimaryPackagePurpose string         `json:"primaryPackagePurpose"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+// AsSBOM returns the package as a component of a software bill of materials in format, as compact JSON: its title,
+// version and bundle identifier, the organization of the certificate it is signed with as its supplier, its
+// FullSHA256 and its URL as its download location. It is a fragment to add to the components or packages of a BOM
+// made by SBOM tooling, not a BOM itself. The supplier is only who the certificate names, so only trust it when
+// HasValidSignature is true.
+func (p *Package) AsSBOM(format SBOMFormat) ([]byte, error) {
+	format, err := ParseSBOMFormat(string(format))
+	if err != nil {
+		return nil, err
+	}
+
+	name, version, sum, supplier := p.GetTitle(), p.GetVersion(), p.FullSHA256(), p.supplier()
+	if name == "" {
+		name = p.GetBundleIdentifier()
+	}
+
+	if format == SBOMSPDX {
+		c := spdxPackage{
+			SPDXID:                "SPDXRef-Package-" + spdxIDString(p.GetBundleIdentifier()),
+			Name:                  name,
+			VersionInfo:           version,
+			Supplier:              "NOASSERTION",
+			DownloadLocation:      "NOASSERTION",
+			PrimaryPackagePurpose: "INSTALL",
+		}
+		if supplier != "" {
+			c.Supplier = "Organization: " + supplier
+		}
+		if p.URL != "" {
+			c.DownloadLocation = p.URL
+		}
+		if sum != "" {
+			c.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: sum}}
+		}
+		return json.Marshal(c)
+	}
+
+	c := cycloneDXComponent{
+		Type:    "application",
+		BOMRef:  p.GetBundleIdentifier(),
+		Name:    name,
+		Version: version,
+	}
+	if supplier != "" {
+		c.Supplier = &cycloneDXOrganization{Name: supplier}
+	}
+	if sum != "" {
+		c.Hashes = []cycloneDXHash{{Alg: "SHA-256", Content: sum}}
+	}
+	if p.URL != "" {
+		c.ExternalReferences = []cycloneDXExternalRef{{Type: "distribution", URL: p.URL}}
+	}
+	if id := p.GetBundleIdentifier(); id != "" {
+		c.Properties = append(c.Properties, cycloneDXProperty{Name: "manifestgo:bundle-identifier", Value: id})
+	}
+	if team := p.TeamID(); team != "" {
+		c.Properties = append(c.Properties, cycloneDXProperty{Name: "manifestgo:team-id", Value: team})
+	}
+
+	return json.Marshal(c)
+}
+
+// supplier returns the organization of the certificate that signed the package, or the name in its common name, such
+// as "Example Inc" of "Developer ID Installer: Example Inc (ABCDE12345)". It returns an empty string if the package
+// is unsigned.
+func (p *Package) supplier() string {
+	if p == nil || p.signature == nil || len(p.signature.Certificates) == 0 {
+		return ""
+	}
+	subject := p.signature.Certificates[0].Subject
+	if len(subject.Organization) > 0 && subject.Organization[0] != "" {
+		return subject.Organization[0]
+	}
+
+	name := subject.CommonName
+	if i := strings.Index(name, ": "); i >= 0 {
+		name = name[i+2:]
+	}
+	if i := strings.LastIndex(name, " ("); i >= 0 && strings.HasSuffix(name, ")") {
+		name = name[:i]
+	}
+
+	return name
+}
+
+// spdxIDString replaces the characters of s an SPDX identifier cannot have, anything but letters, digits, . and -,
+// with -.
+func spdxIDString(s string) string {
+	if s == "" {
+		return "pkg"
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '-'
+	}, s)
+}
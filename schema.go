@@ -0,0 +1,95 @@
+package manifestgo
+
+// manifestJSONSchema describes the JSON written by Manifest.AsJSON.
+const manifestJSONSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://github.com/dbyington/manifestgo/manifest.schema.json",
+  "title": "manifestgo manifest",
+  "description": "Manifest of a package for the MDM InstallApplication command, as written by manifestgo.",
+  "type": "object",
+  "required": ["manifestItems"],
+  "properties": {
+    "manifestItems": {
+      "type": "array",
+      "minItems": 1,
+      "items": {"$ref": "#/definitions/item"}
+    }
+  },
+  "definitions": {
+    "item": {
+      "type": "object",
+      "required": ["assets", "metadata"],
+      "properties": {
+        "assets": {
+          "type": "array",
+          "minItems": 1,
+          "items": {"$ref": "#/definitions/asset"}
+        },
+        "metadata": {"$ref": "#/definitions/metadata"}
+      }
+    },
+    "asset": {
+      "oneOf": [
+        {"$ref": "#/definitions/package_asset"},
+        {"$ref": "#/definitions/image_asset"}
+      ]
+    },
+    "image_asset": {
+      "type": "object",
+      "required": ["kind", "url"],
+      "properties": {
+        "kind": {"type": "string", "enum": ["display-image", "full-size-image"]},
+        "url": {"type": "string"},
+        "needs_shine": {"type": "boolean"}
+      },
+      "additionalProperties": false
+    },
+    "package_asset": {
+      "type": "object",
+      "required": ["kind", "url"],
+      "properties": {
+        "kind": {"type": "string", "const": "software-package"},
+        "url": {"type": "string"},
+        "total_size": {"type": "integer", "minimum": 0},
+        "full_sha256": {"type": "string", "pattern": "^[0-9a-f]{64}$"},
+        "md5_size": {"type": "integer", "minimum": 1},
+        "md5_hash_strings": {
+          "type": "array",
+          "minItems": 1,
+          "items": {"type": "string", "pattern": "^[0-9a-f]{32}$"}
+        },
+        "sha256_size": {"type": "integer", "minimum": 1},
+        "sha256_hash_strings": {
+          "type": "array",
+          "minItems": 1,
+          "items": {"type": "string", "pattern": "^[0-9a-f]{64}$"}
+        }
+      },
+      "dependencies": {
+        "md5_hash_strings": ["md5_size"],
+        "sha256_hash_strings": ["sha256_size"]
+      },
+      "oneOf": [
+        {"required": ["md5_hash_strings"]},
+        {"required": ["sha256_hash_strings"]}
+      ]
+    },
+    "metadata": {
+      "type": "object",
+      "required": ["bundle_identifier", "bundle_version", "kind", "title"],
+      "properties": {
+        "bundle_identifier": {"type": "string"},
+        "bundle_version": {"type": "string"},
+        "kind": {"type": "string", "const": "software"},
+        "title": {"type": "string"},
+        "minimum_os_version": {"type": "string"}
+      }
+    }
+  }
+}
+`
+
+// ManifestJSONSchema returns a JSON Schema (draft-07) document for the JSON output of a Manifest.
+func ManifestJSONSchema() []byte {
+	return []byte(manifestJSONSchema)
+}
@@ -0,0 +1,22 @@
+package manifestgo
+
+// DistributionScripts is the JavaScript a Distribution runs at install time, for auditing what an installer checks
+// before it installs.
+type DistributionScripts struct {
+	// InstallationCheck is the call the installation-check element makes, such as "InstallationCheck()".
+	InstallationCheck string `json:"installation_check,omitempty"`
+	// VolumeCheck is the call the volume-check element makes, such as "VolumeCheck()".
+	VolumeCheck string `json:"volume_check,omitempty"`
+	// Scripts are the contents of the script elements, in the order of the Distribution.
+	Scripts []string `json:"scripts,omitempty"`
+}
+
+// DistributionScripts returns the install-time JavaScript of the Distribution of the package, which is empty for a
+// component package or a Distribution without scripts.
+func (p *Package) DistributionScripts() DistributionScripts {
+	if p == nil {
+		return DistributionScripts{}
+	}
+
+	return p.scripts
+}
@@ -0,0 +1,108 @@
+package manifestgo
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+)
+
+var (
+	ErrNoItemsSelected = errors.New("manifestgo: no items selected")
+	ErrItemNotFound    = errors.New("manifestgo: no item with the bundle identifier")
+)
+
+// ItemOrder reports whether the item a sorts before b, ordering the items of a manifest.
+type ItemOrder func(a, b *Item) bool
+
+// ByBundleIdentifier orders items by bundle identifier, then by version, the order ManifestBuilder uses by default.
+func ByBundleIdentifier(a, b *Item) bool {
+	ai, av := itemIDVersion(a)
+	bi, bv := itemIDVersion(b)
+	if ai != bi {
+		return ai < bi
+	}
+	if c := compareVersions(av, bv); c != 0 {
+		return c < 0
+	}
+	return av < bv
+}
+
+// ByTitle orders items by title, then by bundle identifier and version.
+func ByTitle(a, b *Item) bool {
+	var at, bt string
+	if a.Metadata != nil {
+		at = a.Metadata.Title
+	}
+	if b.Metadata != nil {
+		bt = b.Metadata.Title
+	}
+	if at != bt {
+		return at < bt
+	}
+	return ByBundleIdentifier(a, b)
+}
+
+// SortItems sorts the items of m by less, keeping the order of items neither sorts before.
+func (m *Manifest) SortItems(less ItemOrder) {
+	sort.SliceStable(m.ManifestItems, func(i, j int) bool {
+		return less(m.ManifestItems[i], m.ManifestItems[j])
+	})
+}
+
+// SelectItems keeps the items of m whose bundle identifier matches one of the include patterns, or any when there are
+// none, and none of the exclude patterns. Patterns are path.Match globs, such as "com.example.*". It returns
+// ErrNoItemsSelected, leaving m as it was, when no item is kept.
+func (m *Manifest) SelectItems(include, exclude []string) error {
+	for _, p := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("manifestgo: bundle identifier pattern %q: %w", p, err)
+		}
+	}
+
+	var items []*Item
+	for _, item := range m.ManifestItems {
+		id, _ := itemIDVersion(item)
+		if (len(include) == 0 || matchAny(include, id)) && !matchAny(exclude, id) {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return ErrNoItemsSelected
+	}
+	m.ManifestItems = items
+
+	return nil
+}
+
+// SetPrimary moves the first item with the bundle identifier to the front of m, the item a device installs as the
+// application, keeping the order of the others.
+func (m *Manifest) SetPrimary(bundleID string) error {
+	for i, item := range m.ManifestItems {
+		if id, _ := itemIDVersion(item); id == bundleID {
+			copy(m.ManifestItems[1:i+1], m.ManifestItems[:i])
+			m.ManifestItems[0] = item
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrItemNotFound, bundleID)
+}
+
+func matchAny(patterns []string, id string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, id); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func itemIDVersion(item *Item) (string, string) {
+	if item.Metadata == nil {
+		return "", ""
+	}
+
+	return item.Metadata.BundleIdentifier, item.Metadata.BundleVersion
+}
@@ -0,0 +1,33 @@
+//go:build gofuzz
+// +build gofuzz
+
+package sftpio
+
+import (
+	"bufio"
+	"bytes"
+)
+
+type discardCloser struct{}
+
+func (discardCloser) Write(p []byte) (int, error) { return len(p), nil }
+func (discardCloser) Close() error                { return nil }
+
+// Fuzz is the go-fuzz entry point for the replies of the server, data being what it answers opening a file and reading
+// its start.
+func Fuzz(data []byte) int {
+	r := &ReadAtCloser{
+		stdin:  discardCloser{},
+		stdout: bufio.NewReader(bytes.NewReader(data)),
+		stderr: &limitedBuffer{max: 4096},
+	}
+	if err := r.open("pkg"); err != nil {
+		return 0
+	}
+
+	if _, err := r.ReadAt(make([]byte, 256*1024), 0); err != nil {
+		return 0
+	}
+
+	return 1
+}
@@ -0,0 +1,642 @@
+// Package sftpio provides a PackageReader that reads packages over SFTP. It speaks the SFTP protocol to the sftp
+// subsystem of the ssh command, so the keys, agent and configuration of the user authenticate to the server, and reads
+// ranges of the file with read requests at their offset.
+package sftpio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/dbyington/manifestgo/httpio"
+	"github.com/dbyington/manifestgo/internal/chunkhash"
+)
+
+var (
+	ErrProtocol = errors.New("sftpio: unexpected reply from the server")
+	ErrNoSize   = errors.New("sftpio: server did not return the size of the file")
+	ErrNotSFTP  = errors.New("sftpio: not an sftp URL")
+)
+
+// The SFTP version 3 packet types and status codes used, see draft-ietf-secsh-filexfer-02.
+const (
+	fxpInit    = 1
+	fxpVersion = 2
+	fxpOpen    = 3
+	fxpClose   = 4
+	fxpRead    = 5
+	fxpFstat   = 8
+	fxpStatus  = 101
+	fxpHandle  = 102
+	fxpData    = 103
+	fxpAttrs   = 105
+
+	fxOK         = 0
+	fxEOF        = 1
+	fxNoSuchFile = 2
+	fxPermission = 3
+
+	fxfRead = 1
+
+	attrSize        = 0x1
+	attrUIDGID      = 0x2
+	attrPermissions = 0x4
+	attrACModTime   = 0x8
+
+	// maxRead is the most each read request asks for, what every server answers in full.
+	maxRead = 32 * 1024
+	// maxInFlight is how many read requests are sent before waiting for their replies.
+	maxInFlight = 64
+	// maxPacket is the largest reply accepted.
+	maxPacket = 1 << 20
+)
+
+// StatusError is returned when the server answers a request with a status other than success.
+type StatusError struct {
+	Code    uint32
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("sftpio: %s (status %d)", e.Message, e.Code)
+}
+
+// Is makes a missing file match os.ErrNotExist, and a refused one os.ErrPermission.
+func (e *StatusError) Is(target error) bool {
+	return (e.Code == fxNoSuchFile && target == os.ErrNotExist) || (e.Code == fxPermission && target == os.ErrPermission)
+}
+
+// ReadAtCloser reads ranges of a file over SFTP and hashes it in chunks.
+type ReadAtCloser struct {
+	ctx           context.Context
+	url           string
+	command       []string
+	hashChunkSize int64
+	fileSum       []byte
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	stderr *limitedBuffer
+
+	mu     sync.Mutex
+	nextID uint32
+	handle []byte
+	size   int64
+	etag   string
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Option configures a ReadAtCloser.
+type Option func(*ReadAtCloser)
+
+// WithContext sets the context of the ssh command, cancelling it kills the command and fails any read in progress.
+func WithContext(ctx context.Context) Option {
+	return func(r *ReadAtCloser) {
+		r.ctx = ctx
+	}
+}
+
+// WithURL sets the sftp://[user@]host[:port]/path URL of the file to read. The path is absolute, or relative to the
+// home directory of the user when it starts with /~/.
+func WithURL(url string) Option {
+	return func(r *ReadAtCloser) {
+		r.url = url
+	}
+}
+
+// WithCommand sets the ssh command and its first arguments, "ssh" otherwise. The port, user, host and "-s sftp" are
+// appended to them, as ssh takes them.
+func WithCommand(name string, args ...string) Option {
+	return func(r *ReadAtCloser) {
+		r.command = append([]string{name}, args...)
+	}
+}
+
+// WithHashChunkSize sets the size of each chunk hashed by HashURL.
+func WithHashChunkSize(size int64) Option {
+	return func(r *ReadAtCloser) {
+		r.hashChunkSize = size
+	}
+}
+
+// NewReadAtCloser starts the ssh command for the configured URL and opens the file, learning its size and
+// modification time. Close stops the command.
+func NewReadAtCloser(opts ...Option) (*ReadAtCloser, error) {
+	r := &ReadAtCloser{
+		ctx:           context.Background(),
+		command:       []string{"ssh"},
+		hashChunkSize: httpio.DefaultHashChunkSize,
+		stderr:        &limitedBuffer{max: 4096},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(u.Scheme, "sftp") || u.Hostname() == "" || strings.HasPrefix(u.Hostname(), "-") {
+		return nil, fmt.Errorf("%w: %s", ErrNotSFTP, r.url)
+	}
+	if _, ok := u.User.Password(); ok {
+		// The password is not used, ssh asks for one itself, and is kept out of the URL of the manifest.
+		u.User = url.User(u.User.Username())
+		r.url = u.String()
+	}
+	name := u.Path
+	if strings.HasPrefix(name, "/~/") {
+		name = name[3:]
+	}
+
+	if err := r.start(u); err != nil {
+		return nil, err
+	}
+	if err := r.open(name); err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// start runs the sftp subsystem over ssh and exchanges versions with the server.
+func (r *ReadAtCloser) start(u *url.URL) error {
+	args := append([]string{}, r.command[1:]...)
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	if user := u.User.Username(); user != "" {
+		args = append(args, "-l", user)
+	}
+	args = append(args, "-s", "--", u.Hostname(), "sftp")
+
+	r.cmd = exec.CommandContext(r.ctx, r.command[0], args...)
+	r.cmd.Stderr = r.stderr
+	stdin, err := r.cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := r.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := r.cmd.Start(); err != nil {
+		return fmt.Errorf("sftpio: %w", err)
+	}
+	r.stdin, r.stdout = stdin, bufio.NewReaderSize(stdout, 64*1024)
+
+	var p packet
+	p.uint32(3)
+	if err := r.send(fxpInit, p); err != nil {
+		return r.startError(err)
+	}
+	typ, _, err := r.recv()
+	if err != nil {
+		return r.startError(err)
+	}
+	if typ != fxpVersion {
+		return r.startError(fmt.Errorf("%w: packet type %d to init", ErrProtocol, typ))
+	}
+
+	return nil
+}
+
+// startError stops the ssh command that failed to start the sftp subsystem, adding what it wrote to stderr to err.
+func (r *ReadAtCloser) startError(err error) error {
+	r.stdin.Close()
+	r.cmd.Wait()
+	if msg := strings.TrimSpace(r.stderr.String()); msg != "" {
+		return fmt.Errorf("%w: %s: %s", err, r.command[0], msg)
+	}
+
+	return err
+}
+
+// open opens the file name for reading and stats it.
+func (r *ReadAtCloser) open(name string) error {
+	var p packet
+	p.string([]byte(name))
+	p.uint32(fxfRead)
+	p.uint32(0)
+	typ, b, err := r.request(fxpOpen, p)
+	if err != nil {
+		return err
+	}
+	if typ != fxpHandle {
+		return fmt.Errorf("%w: packet type %d to open", ErrProtocol, typ)
+	}
+	d := decoder{b: b}
+	r.handle = d.string()
+
+	p = packet{}
+	p.string(r.handle)
+	typ, b, err = r.request(fxpFstat, p)
+	if err != nil {
+		return err
+	}
+	if typ != fxpAttrs {
+		return fmt.Errorf("%w: packet type %d to fstat", ErrProtocol, typ)
+	}
+	d = decoder{b: b}
+	flags := d.uint32()
+	if flags&attrSize == 0 {
+		return ErrNoSize
+	}
+	r.size = int64(d.uint64())
+	if flags&attrUIDGID != 0 {
+		d.uint32()
+		d.uint32()
+	}
+	if flags&attrPermissions != 0 {
+		d.uint32()
+	}
+	if flags&attrACModTime != 0 {
+		d.uint32()
+		r.etag = fmt.Sprintf("%x-%x", d.uint32(), r.size)
+	}
+	if d.err != nil {
+		return d.err
+	}
+
+	return nil
+}
+
+// ReadAt reads len(p) bytes of the file starting at off, with several read requests in flight at once.
+func (r *ReadAtCloser) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	want := p
+	if rest := r.size - off; int64(len(p)) > rest {
+		want = p[:rest]
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for done := 0; done < len(want); {
+		n, err := r.readBatch(want[done:], off+int64(done))
+		done += n
+		if err != nil {
+			return done, err
+		}
+	}
+	if len(want) < len(p) {
+		return len(want), io.EOF
+	}
+
+	return len(p), nil
+}
+
+// readBatch sends up to maxInFlight read requests for the start of p, then fills p from their replies, returning how
+// many bytes at its start were read. A reply short of what was asked is completed with another request.
+func (r *ReadAtCloser) readBatch(p []byte, off int64) (int, error) {
+	type pending struct {
+		start, end int
+		got        int
+	}
+	var reqs []pending
+	first := r.nextID
+	for start := 0; start < len(p) && len(reqs) < maxInFlight; start += maxRead {
+		end := start + maxRead
+		if end > len(p) {
+			end = len(p)
+		}
+		if _, err := r.sendRequest(fxpRead, r.readPacket(off+int64(start), end-start)); err != nil {
+			return 0, err
+		}
+		reqs = append(reqs, pending{start: start, end: end})
+	}
+
+	// Every reply is read, even after an error, so the next request gets its own reply.
+	var firstErr error
+	for range reqs {
+		typ, b, err := r.recv()
+		if err != nil {
+			return 0, err
+		}
+		d := decoder{b: b}
+		i := int(d.uint32() - first)
+		if d.err != nil || i < 0 || i >= len(reqs) {
+			return 0, fmt.Errorf("%w: reply to an unknown read", ErrProtocol)
+		}
+		switch typ {
+		case fxpData:
+			reqs[i].got = copy(p[reqs[i].start:reqs[i].end], d.string())
+		case fxpStatus:
+			// The end of the file is handled below like a short read, the file being shorter than it was.
+			if err := statusError(&d); err != nil && err != io.EOF && firstErr == nil {
+				firstErr = err
+			}
+		default:
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%w: packet type %d to read", ErrProtocol, typ)
+			}
+		}
+	}
+	if firstErr != nil {
+		return 0, firstErr
+	}
+
+	n := 0
+	for _, req := range reqs {
+		if req.got < req.end-req.start {
+			rest, err := r.readFull(p[req.start+req.got:req.end], off+int64(req.start+req.got))
+			if err != nil {
+				return req.start + req.got + rest, err
+			}
+		}
+		n = req.end
+	}
+
+	return n, nil
+}
+
+// readFull reads p from off one request at a time.
+func (r *ReadAtCloser) readFull(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		typ, b, err := r.request(fxpRead, r.readPacket(off+int64(n), len(p)-n))
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return n, io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+		if typ != fxpData {
+			return n, fmt.Errorf("%w: packet type %d to read", ErrProtocol, typ)
+		}
+		d := decoder{b: b}
+		data := d.string()
+		if len(data) == 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+		n += copy(p[n:], data)
+	}
+
+	return n, nil
+}
+
+func (r *ReadAtCloser) readPacket(off int64, n int) packet {
+	if n > maxRead {
+		n = maxRead
+	}
+	var p packet
+	p.string(r.handle)
+	p.uint64(uint64(off))
+	p.uint32(uint32(n))
+
+	return p
+}
+
+// HashURL reads the whole file and returns a hash for each chunk of it. The size is the size of the hash sum,
+// md5.Size or sha256.Size.
+func (r *ReadAtCloser) HashURL(size uint) ([]hash.Hash, error) {
+	newHash, err := chunkhash.Hasher(size)
+	if err != nil {
+		return nil, err
+	}
+
+	fileHash := sha256.New()
+	// Reads of a megabyte keep enough requests in flight to hide the round trips.
+	hashes, err := chunkhash.Hash(bufio.NewReaderSize(io.NewSectionReader(r, 0, r.size), 1<<20), newHash, r.hashChunkSize, fileHash)
+	if err != nil {
+		return nil, err
+	}
+	r.fileSum = fileHash.Sum(nil)
+
+	return hashes, nil
+}
+
+// FileDigest returns the SHA-256 of the whole file hashed alongside its chunks by the last HashURL, or nil before it.
+func (r *ReadAtCloser) FileDigest() []byte {
+	return r.fileSum
+}
+
+// SetHashChunkSize sets the size of each chunk hashed by HashURL, for a size chosen once the length is known.
+func (r *ReadAtCloser) SetHashChunkSize(size int64) {
+	r.hashChunkSize = size
+}
+
+// Length returns the size of the file.
+func (r *ReadAtCloser) Length() int64 {
+	return r.size
+}
+
+// Etag returns a tag made of the modification time and size of the file, which changes when the file does, or "" if
+// the server did not return the time.
+func (r *ReadAtCloser) Etag() string {
+	return r.etag
+}
+
+// URL returns the URL of the file, without any password it had.
+func (r *ReadAtCloser) URL() string {
+	return r.url
+}
+
+// Close closes the file and stops the ssh command. It is safe to call more than once.
+func (r *ReadAtCloser) Close() error {
+	r.closeOnce.Do(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.handle != nil {
+			var p packet
+			p.string(r.handle)
+			r.request(fxpClose, p)
+		}
+		r.closeErr = r.stdin.Close()
+		if err := r.cmd.Wait(); err != nil && r.closeErr == nil && r.ctx.Err() == nil {
+			r.closeErr = fmt.Errorf("sftpio: %s: %w", r.command[0], err)
+		}
+	})
+
+	return r.closeErr
+}
+
+// request sends the request of type typ, whose payload p follows its id, and returns the type and payload after the id
+// of the reply. A status reply other than success is returned as a *StatusError, io.EOF for the end of the file.
+func (r *ReadAtCloser) request(typ byte, p packet) (byte, []byte, error) {
+	id, err := r.sendRequest(typ, p)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	rtyp, b, err := r.recv()
+	if err != nil {
+		return 0, nil, err
+	}
+	d := decoder{b: b}
+	if got := d.uint32(); d.err != nil || got != id {
+		return 0, nil, fmt.Errorf("%w: reply to another request", ErrProtocol)
+	}
+	if rtyp == fxpStatus {
+		return rtyp, nil, statusError(&d)
+	}
+
+	return rtyp, d.b, nil
+}
+
+// sendRequest sends the request of type typ with the next id before its payload p, returning the id.
+func (r *ReadAtCloser) sendRequest(typ byte, p packet) (uint32, error) {
+	id := r.nextID
+	r.nextID++
+	var q packet
+	q.uint32(id)
+	q.b = append(q.b, p.b...)
+
+	return id, r.send(typ, q)
+}
+
+func (r *ReadAtCloser) send(typ byte, p packet) error {
+	b := make([]byte, 5, 5+len(p.b))
+	binary.BigEndian.PutUint32(b, uint32(1+len(p.b)))
+	b[4] = typ
+	_, err := r.stdin.Write(append(b, p.b...))
+
+	return err
+}
+
+func (r *ReadAtCloser) recv() (byte, []byte, error) {
+	var h [5]byte
+	if _, err := io.ReadFull(r.stdout, h[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, fmt.Errorf("sftpio: reading a reply: %w", err)
+	}
+	n := binary.BigEndian.Uint32(h[:4])
+	if n < 1 || n > maxPacket {
+		return 0, nil, fmt.Errorf("%w: packet of %d bytes", ErrProtocol, n)
+	}
+	b := make([]byte, n-1)
+	if _, err := io.ReadFull(r.stdout, b); err != nil {
+		return 0, nil, fmt.Errorf("sftpio: reading a reply: %w", err)
+	}
+
+	return h[4], b, nil
+}
+
+// statusError returns the error of the status reply decoded by d after its id, nil for success and io.EOF for the end
+// of the file.
+func statusError(d *decoder) error {
+	code := d.uint32()
+	msg := string(d.string())
+	if d.err != nil {
+		return d.err
+	}
+	switch code {
+	case fxOK:
+		return nil
+	case fxEOF:
+		return io.EOF
+	}
+	if msg == "" {
+		msg = "request failed"
+	}
+
+	return &StatusError{Code: code, Message: msg}
+}
+
+// packet builds the payload of a request.
+type packet struct {
+	b []byte
+}
+
+func (p *packet) uint32(v uint32) {
+	p.b = append(p.b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (p *packet) uint64(v uint64) {
+	p.uint32(uint32(v >> 32))
+	p.uint32(uint32(v))
+}
+
+func (p *packet) string(s []byte) {
+	p.uint32(uint32(len(s)))
+	p.b = append(p.b, s...)
+}
+
+// decoder reads the fields of a reply, recording the first one that is cut short.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) uint32() uint32 {
+	if len(d.b) < 4 {
+		d.fail()
+		return 0
+	}
+	v := binary.BigEndian.Uint32(d.b)
+	d.b = d.b[4:]
+
+	return v
+}
+
+func (d *decoder) uint64() uint64 {
+	return uint64(d.uint32())<<32 | uint64(d.uint32())
+}
+
+func (d *decoder) string() []byte {
+	n := d.uint32()
+	if uint32(len(d.b)) < n {
+		d.fail()
+		return nil
+	}
+	s := d.b[:n]
+	d.b = d.b[n:]
+
+	return s
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: reply cut short", ErrProtocol)
+	}
+	d.b = nil
+}
+
+// limitedBuffer keeps the first max bytes written to it, for the error messages of the ssh command.
+type limitedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if rest := b.max - b.buf.Len(); rest > 0 {
+		if len(p) > rest {
+			b.buf.Write(p[:rest])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
@@ -0,0 +1,178 @@
+package manifestgo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var ErrShareNotMounted = errors.New("manifestgo: network share is not mounted")
+
+// ShareMount is a network share mounted at a local directory, such as smb://files.example.com/pkgs at /Volumes/pkgs.
+type ShareMount struct {
+	// URL is the smb:// or nfs:// URL of the share, or of a directory of it.
+	URL string
+	// Dir is the directory the share is mounted at.
+	Dir string
+}
+
+// ShareReader returns a ReaderFactory for smb:// and nfs:// URLs that reads packages through the mount of their share,
+// one of mounts or else one the system has mounted, so the manifest keeps the URL of the share. It does not speak SMB
+// or NFS itself, and fails with ErrShareNotMounted when the share is not mounted. smb and nfs URLs are read with
+// ShareReader(nil) unless another factory, such as one using an SMB client library, is registered for them.
+func ShareReader(mounts []ShareMount) ReaderFactory {
+	return func(ctx context.Context, rawURL string, opts ReaderOptions) (PackageReader, error) {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+
+		name, ok := shareFile(mounts, u)
+		if !ok {
+			system, err := SystemShareMounts()
+			if err != nil {
+				return nil, err
+			}
+			if name, ok = shareFile(system, u); !ok {
+				return nil, fmt.Errorf("%w: %s", ErrShareNotMounted, rawURL)
+			}
+		}
+
+		return openSpool(ctx, name, SpoolOptions{URL: rawURL, HashChunkSize: opts.HashChunkSize}, false)
+	}
+}
+
+// shareFile returns the local path of the file at u on the mount of mounts whose share path is its longest prefix.
+// SMB paths are matched ignoring case, as the servers do.
+func shareFile(mounts []ShareMount, u *url.URL) (string, bool) {
+	var best, rest string
+	bestLen := -1
+	for _, m := range mounts {
+		mu, err := url.Parse(m.URL)
+		if err != nil || !strings.EqualFold(mu.Scheme, u.Scheme) || !strings.EqualFold(mu.Hostname(), u.Hostname()) {
+			continue
+		}
+
+		prefix := strings.TrimSuffix(path.Clean("/"+mu.Path), "/")
+		p := path.Clean("/" + u.Path)
+		head := p
+		if len(head) > len(prefix) {
+			head = head[:len(prefix)]
+		}
+		if head != prefix && !(strings.EqualFold(u.Scheme, "smb") && strings.EqualFold(head, prefix)) {
+			continue
+		}
+		if len(p) > len(prefix) && p[len(prefix)] != '/' {
+			continue
+		}
+		if len(prefix) > bestLen {
+			best, rest, bestLen = m.Dir, p[len(prefix):], len(prefix)
+		}
+	}
+	if bestLen < 0 {
+		return "", false
+	}
+
+	return filepath.Join(best, filepath.FromSlash(rest)), true
+}
+
+// SystemShareMounts returns the SMB and NFS shares the system has mounted, from /proc/mounts on Linux and the output
+// of mount elsewhere.
+func SystemShareMounts() ([]ShareMount, error) {
+	if runtime.GOOS == "linux" {
+		f, err := os.Open("/proc/mounts")
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		return parseMounts(f), nil
+	}
+
+	out, err := exec.Command("mount").Output()
+	if err != nil {
+		return nil, fmt.Errorf("manifestgo: listing mounts: %w", err)
+	}
+
+	return parseMounts(bytes.NewReader(out)), nil
+}
+
+// parseMounts reads the SMB and NFS mounts of r, in the format of /proc/mounts:
+//
+//	//server/share /mnt/share cifs rw,relatime 0 0
+//
+// or of the mount command of macOS and the BSDs:
+//
+//	//user@server/share on /Volumes/share (smbfs, nodev, nosuid)
+func parseMounts(r io.Reader) []ShareMount {
+	var mounts []ShareMount
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+
+		var source, dir, fsType string
+		if i, j := strings.Index(line, " on "), strings.LastIndex(line, " ("); i > 0 && j > i {
+			source, dir = line[:i], line[i+4:j]
+			fsType = strings.TrimSuffix(line[j+2:], ")")
+			if k := strings.Index(fsType, ","); k >= 0 {
+				fsType = fsType[:k]
+			}
+			source, _ = url.PathUnescape(source)
+		} else {
+			f := strings.Fields(line)
+			if len(f) < 3 {
+				continue
+			}
+			source, dir, fsType = unescapeMountField(f[0]), unescapeMountField(f[1]), f[2]
+		}
+
+		if u := shareURL(source, fsType); u != "" {
+			mounts = append(mounts, ShareMount{URL: u, Dir: dir})
+		}
+	}
+
+	return mounts
+}
+
+// shareURL returns the URL of the share mounted from source with the file system type, or "" if it is not an SMB or
+// NFS share.
+func shareURL(source, fsType string) string {
+	switch fsType {
+	case "cifs", "smb3", "smbfs":
+		if !strings.HasPrefix(source, "//") {
+			return ""
+		}
+		source = source[2:]
+		if i := strings.LastIndex(source, "@"); i >= 0 {
+			source = source[i+1:]
+		}
+		host, share := source, ""
+		if i := strings.Index(source, "/"); i >= 0 {
+			host, share = source[:i], source[i:]
+		}
+		return (&url.URL{Scheme: "smb", Host: host, Path: share}).String()
+	case "nfs", "nfs4":
+		i := strings.Index(source, ":")
+		if i < 1 {
+			return ""
+		}
+		return (&url.URL{Scheme: "nfs", Host: source[:i], Path: source[i+1:]}).String()
+	}
+
+	return ""
+}
+
+// unescapeMountField undoes the octal escapes of spaces, tabs and backslashes in the fields of /proc/mounts.
+func unescapeMountField(s string) string {
+	return strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`).Replace(s)
+}
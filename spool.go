@@ -0,0 +1,255 @@
+package manifestgo
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/dbyington/manifestgo/httpio"
+)
+
+var ErrSpoolTooLarge = errors.New("manifestgo: package is larger than the spool size limit")
+
+// SpoolOptions configures a Spool.
+type SpoolOptions struct {
+	// Dir is the directory the temporary file is made in, os.TempDir() if empty.
+	Dir string
+	// MaxSize fails spooling with ErrSpoolTooLarge once the package is found to be larger, 0 for no limit.
+	MaxSize int64
+	// Tmpfile makes the file with O_TMPFILE where the system supports it (Linux), so it has no name and is freed by
+	// the kernel even if the process is killed. An ordinary temporary file is used elsewhere.
+	Tmpfile bool
+
+	// URL and Etag are what the Spool reports as the URL and Etag of the package.
+	URL  string
+	Etag string
+	// HashChunkSize is the size of each chunk hashed by HashURL, httpio.DefaultHashChunkSize if 0.
+	HashChunkSize int64
+	// FileDigest made HashURL also hash the whole package with SHA-256.
+	//
+	// Deprecated: HashURL always hashes the whole package, see Spool.FileDigest.
+	FileDigest bool
+}
+
+// Spool is a package copied to a temporary file, for a source that cannot be read at random such as stdin or a server
+// without range requests. It is a PackageReader hashing the file in chunks, as httpio does a URL. The file is removed
+// by Close or once the context given to NewSpool is done.
+type Spool struct {
+	f             *os.File
+	name          string
+	size          int64
+	url           string
+	etag          string
+	hashChunkSize int64
+	fileSum       []byte
+
+	closeOnce sync.Once
+	closeErr  error
+	closed    chan struct{}
+}
+
+// NewSpool copies r to a temporary file. Cancelling ctx stops the copy and removes the file, whether or not Close
+// is called.
+func NewSpool(ctx context.Context, r io.Reader, opts SpoolOptions) (*Spool, error) {
+	f, name, err := createSpoolFile(opts.Dir, opts.Tmpfile)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Spool{
+		f:             f,
+		name:          name,
+		url:           opts.URL,
+		etag:          opts.Etag,
+		hashChunkSize: opts.HashChunkSize,
+		closed:        make(chan struct{}),
+	}
+	if s.hashChunkSize <= 0 {
+		s.hashChunkSize = httpio.DefaultHashChunkSize
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Close()
+		case <-s.closed:
+		}
+	}()
+
+	src := &contextReader{ctx: ctx, r: r}
+	if opts.MaxSize > 0 {
+		// Read one byte more than allowed to tell a package of exactly MaxSize from a larger one.
+		src.r = io.LimitReader(r, opts.MaxSize+1)
+	}
+
+	n, err := io.Copy(f, src)
+	if err == nil && opts.MaxSize > 0 && n > opts.MaxSize {
+		err = fmt.Errorf("%w of %d bytes", ErrSpoolTooLarge, opts.MaxSize)
+	}
+	if err != nil {
+		s.Close()
+		// Cancelling closes the file, failing the copy with a less telling error.
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		return nil, err
+	}
+	s.size = n
+
+	return s, nil
+}
+
+// OpenSpool reads the package already in the file name, such as one fetched with httpio.Download, as a Spool. The
+// Spool takes the file over: Close removes it, as does cancelling ctx. Only the URL, Etag and HashChunkSize of opts
+// are used.
+func OpenSpool(ctx context.Context, name string, opts SpoolOptions) (*Spool, error) {
+	return openSpool(ctx, name, opts, true)
+}
+
+// openSpool opens the file name as a Spool, which removes it on Close if remove is set.
+func openSpool(ctx context.Context, name string, opts SpoolOptions, remove bool) (*Spool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	s := &Spool{
+		f:             f,
+		size:          fi.Size(),
+		url:           opts.URL,
+		etag:          opts.Etag,
+		hashChunkSize: opts.HashChunkSize,
+		closed:        make(chan struct{}),
+	}
+	if remove {
+		s.name = name
+	}
+	if s.hashChunkSize <= 0 {
+		s.hashChunkSize = httpio.DefaultHashChunkSize
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Close()
+		case <-s.closed:
+		}
+	}()
+
+	return s, nil
+}
+
+// createSpoolFile returns a new temporary file in dir and its name, which is empty for an O_TMPFILE file.
+func createSpoolFile(dir string, tmpfile bool) (*os.File, string, error) {
+	if tmpfile {
+		if dir == "" {
+			dir = os.TempDir()
+		}
+		if f, err := openTmpfile(dir); err == nil {
+			return f, "", nil
+		}
+	}
+
+	f, err := ioutil.TempFile(dir, "manifestgo-spool-*.pkg")
+	if err != nil {
+		return nil, "", err
+	}
+
+	return f, f.Name(), nil
+}
+
+// contextReader stops reading once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.r.Read(p)
+}
+
+// ReadAt reads len(p) bytes of the spooled package starting at off.
+func (s *Spool) ReadAt(p []byte, off int64) (int, error) {
+	return s.f.ReadAt(p, off)
+}
+
+// HashURL hashes the spooled package in chunks, like httpio.ReadAtCloser.HashURL.
+func (s *Spool) HashURL(size uint) ([]hash.Hash, error) {
+	var newHash func() hash.Hash
+	switch size {
+	case md5.Size:
+		newHash = md5.New
+	case sha256.Size:
+		newHash = sha256.New
+	default:
+		return nil, httpio.ErrUnsupportedHash
+	}
+
+	var hashes []hash.Hash
+	fileHash := sha256.New()
+	for off := int64(0); off < s.size; off += s.hashChunkSize {
+		h := newHash()
+		if _, err := io.Copy(io.MultiWriter(h, fileHash), io.NewSectionReader(s.f, off, s.hashChunkSize)); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, h)
+	}
+	s.fileSum = fileHash.Sum(nil)
+
+	return hashes, nil
+}
+
+// FileDigest returns the SHA-256 of the whole package hashed alongside its chunks by the last HashURL, or nil before
+// it.
+func (s *Spool) FileDigest() []byte {
+	return s.fileSum
+}
+
+// SetHashChunkSize sets the size of each chunk hashed by HashURL.
+func (s *Spool) SetHashChunkSize(size int64) {
+	s.hashChunkSize = size
+}
+
+// Length returns the size of the spooled package.
+func (s *Spool) Length() int64 {
+	return s.size
+}
+
+func (s *Spool) Etag() string {
+	return s.etag
+}
+
+func (s *Spool) URL() string {
+	return s.url
+}
+
+// Close closes and removes the temporary file. It is safe to call more than once.
+func (s *Spool) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.closeErr = s.f.Close()
+		if s.name != "" {
+			if err := os.Remove(s.name); err != nil && s.closeErr == nil {
+				s.closeErr = err
+			}
+		}
+	})
+
+	return s.closeErr
+}
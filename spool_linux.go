@@ -0,0 +1,15 @@
+package manifestgo
+
+import (
+	"os"
+	"syscall"
+)
+
+// oTmpfile is O_TMPFILE, which the syscall package does not define. Its value includes O_DIRECTORY, which differs
+// between architectures.
+const oTmpfile = 0x400000 | syscall.O_DIRECTORY
+
+// openTmpfile opens an unnamed file in dir, failing on file systems or kernels without O_TMPFILE.
+func openTmpfile(dir string) (*os.File, error) {
+	return os.OpenFile(dir, os.O_RDWR|oTmpfile, 0600)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package manifestgo
+
+import (
+	"errors"
+	"os"
+)
+
+// openTmpfile fails, O_TMPFILE is only supported on Linux.
+func openTmpfile(dir string) (*os.File, error) {
+	return nil, errors.New("manifestgo: O_TMPFILE is not supported")
+}
@@ -0,0 +1,173 @@
+package manifestgo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ManifestRecord is a built manifest as kept by a ManifestStore.
+type ManifestRecord struct {
+	// ID identifies the package by its URL, Etag and hashing, so rebuilding an unchanged package replaces its record.
+	ID            string          `json:"id"`
+	URL           string          `json:"url"`
+	Etag          string          `json:"etag,omitempty"`
+	BundleID      string          `json:"bundle_id"`
+	Version       string          `json:"version"`
+	Title         string          `json:"title"`
+	HashType      string          `json:"hash_type"`
+	HashChunkSize int64           `json:"hash_chunk_size"`
+	Hashes        []string        `json:"hashes"`
+	Manifest      json.RawMessage `json:"manifest"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// NewManifestRecord returns the record of the manifest m built from p.
+func NewManifestRecord(p *Package, m *Manifest) (ManifestRecord, error) {
+	b, err := m.AsJSON(0)
+	if err != nil {
+		return ManifestRecord{}, err
+	}
+
+	return ManifestRecord{
+		ID:            cacheKey(p.URL, p.Etag, p.hashType, p.hashChunkSize),
+		URL:           p.URL,
+		Etag:          p.Etag,
+		BundleID:      p.GetBundleIdentifier(),
+		Version:       p.GetVersion(),
+		Title:         p.GetTitle(),
+		HashType:      p.hashAlgorithm(),
+		HashChunkSize: p.hashChunkSize,
+		Hashes:        p.GetHashStrings(),
+		Manifest:      b,
+		CreatedAt:     time.Now().UTC(),
+	}, nil
+}
+
+// ManifestQuery selects records from a ManifestStore. Empty fields match any record.
+type ManifestQuery struct {
+	BundleID string
+	Version  string
+	URL      string
+}
+
+func (q ManifestQuery) matches(r ManifestRecord) bool {
+	return (q.BundleID == "" || q.BundleID == r.BundleID) &&
+		(q.Version == "" || q.Version == r.Version) &&
+		(q.URL == "" || q.URL == r.URL)
+}
+
+// ManifestStore keeps built manifests so they can be looked up later.
+type ManifestStore interface {
+	// Save stores r, replacing any record with the same ID.
+	Save(r ManifestRecord) error
+	// Find returns the records matching q, newest first.
+	Find(q ManifestQuery) ([]ManifestRecord, error)
+}
+
+// MemoryStore is a ManifestStore holding records in memory.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]ManifestRecord
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]ManifestRecord)}
+}
+
+func (s *MemoryStore) Save(r ManifestRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[r.ID] = r
+	return nil
+}
+
+func (s *MemoryStore) Find(q ManifestQuery) ([]ManifestRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found []ManifestRecord
+	for _, r := range s.records {
+		if q.matches(r) {
+			found = append(found, r)
+		}
+	}
+	sortRecords(found)
+
+	return found, nil
+}
+
+// DirStore is a ManifestStore keeping each record as a JSON file in a directory. Find reads every record, which suits
+// registries of up to a few thousand manifests.
+type DirStore struct {
+	dir   string
+	cache *DirCache
+}
+
+// NewDirStore returns a DirStore using dir, creating it if needed.
+func NewDirStore(dir string) (*DirStore, error) {
+	c, err := NewDirCache(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DirStore{dir: dir, cache: c}, nil
+}
+
+func (s *DirStore) Save(r ManifestRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return s.cache.Put(r.ID, b)
+}
+
+func (s *DirStore) Find(q ManifestQuery) ([]ManifestRecord, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []ManifestRecord
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(s.dir, e.Name()))
+		if err != nil {
+			// Skip a record removed since the directory was read.
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		var r ManifestRecord
+		if err := json.Unmarshal(b, &r); err != nil {
+			return nil, err
+		}
+		if q.matches(r) {
+			found = append(found, r)
+		}
+	}
+	sortRecords(found)
+
+	return found, nil
+}
+
+func sortRecords(records []ManifestRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].CreatedAt.Equal(records[j].CreatedAt) {
+			return records[i].CreatedAt.After(records[j].CreatedAt)
+		}
+		return records[i].ID < records[j].ID
+	})
+}
@@ -0,0 +1,70 @@
+package manifestgo
+
+import (
+	"strings"
+)
+
+// TitleStrategy returns a title for the package, or an empty string to leave it to the next strategy.
+type TitleStrategy func(p *Package) string
+
+// DefaultTitleStrategies are the strategies GetTitle tries, in order, unless WithTitleStrategy sets others.
+var DefaultTitleStrategies = []TitleStrategy{TitleFromDistribution, TitleFromBundlePath, TitleFromIdentifier}
+
+// WithTitleStrategy sets the strategies GetTitle tries, in order, using the first title returned.
+func WithTitleStrategy(strategies ...TitleStrategy) Option {
+	return func(p *Package) {
+		p.titleStrategies = strategies
+	}
+}
+
+// SetTitleStrategy sets the strategies GetTitle tries, see WithTitleStrategy.
+func (p *Package) SetTitleStrategy(strategies ...TitleStrategy) {
+	p.titleStrategies = strategies
+}
+
+// TitleFromDistribution returns the title element of the Distribution.
+func TitleFromDistribution(p *Package) string {
+	return p.Title
+}
+
+// TitleFromBundlePath returns the name, without its extension, of the primary bundle, such as "Foo" for
+// "./Applications/Foo.app".
+func TitleFromBundlePath(p *Package) string {
+	path := p.GetPath()
+	if p.source == sourcePackageInfo {
+		path = ""
+		if b, ok := p.pkgInfoBundle(); ok {
+			path = b.Path
+		}
+	}
+	if path == "" {
+		return ""
+	}
+
+	parts := strings.Split(path, "/")
+	return strings.Split(parts[len(parts)-1], ".")[0]
+}
+
+// TitleFromIdentifier returns the last component of the bundle identifier, capitalized, such as "Foo" for
+// "com.example.foo".
+func TitleFromIdentifier(p *Package) string {
+	sub := strings.Split(p.GetBundleIdentifier(), ".")
+	return strings.Title(sub[len(sub)-1])
+}
+
+// pkgInfoBundle returns the bundle of the PackageInfo matching its identifier, less any "pkg" suffix.
+func (p *Package) pkgInfoBundle() (Bundle, bool) {
+	id := p.PkgInfo.Identifier
+	if strings.HasSuffix(id, "pkg") {
+		parts := strings.Split(id, ".")
+		id = strings.Join(parts[:len(parts)-1], ".")
+	}
+
+	for _, b := range p.PkgInfo.Bundle {
+		if b.ID == id {
+			return b, true
+		}
+	}
+
+	return Bundle{}, false
+}
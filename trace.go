@@ -0,0 +1,46 @@
+package manifestgo
+
+import "context"
+
+// Tracer starts spans around the stages of reading a package and building its manifest, so a slow build can be
+// attributed to fetching the TOC, hashing or parsing. It is shaped so an OpenTelemetry trace.Tracer can be adapted
+// to it in a few lines, without manifestgo depending on OpenTelemetry.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	// End ends the span, recording err if it is not nil.
+	End(err error)
+}
+
+// Span names.
+const (
+	SpanReadFromURL   = "manifestgo.ReadFromURL"
+	SpanHash          = "manifestgo.Hash"
+	SpanReadTOC       = "manifestgo.ReadTOC"
+	SpanParseMetadata = "manifestgo.ParseMetadata"
+	SpanBuildManifest = "manifestgo.BuildManifest"
+)
+
+// WithTracer sets the Tracer spans are started with, none are recorded otherwise.
+func WithTracer(t Tracer) Option {
+	return func(p *Package) {
+		p.tracer = t
+	}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) End(error)                        {}
+
+func (p *Package) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if p == nil || p.tracer == nil {
+		return ctx, noopSpan{}
+	}
+
+	return p.tracer.Start(ctx, name)
+}
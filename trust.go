@@ -0,0 +1,47 @@
+package manifestgo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"sort"
+)
+
+// WithRoots sets the root certificates the signature of the package is verified against in place of the system
+// roots, such as the internal CA of an organization that re-signs vendor packages, for HasValidSignature and
+// CheckPolicy. Add the system roots to the pool to trust both. certs are the certificates added to roots: a cached
+// package is only taken from an entry verified against the same roots, and a pool cannot be told from another with
+// the same subjects and other keys by itself, so without them the package is not cached.
+func WithRoots(roots *x509.CertPool, certs ...*x509.Certificate) Option {
+	return func(p *Package) {
+		p.roots = roots
+		p.rootsID = rootsID(roots, certs)
+	}
+}
+
+// rootsID identifies a pool by its subjects and the certificates added to it, "" for a nil pool, the system roots, or
+// a pool without certs, which cannot be identified.
+func rootsID(roots *x509.CertPool, certs []*x509.Certificate) string {
+	if roots == nil || len(certs) == 0 {
+		return ""
+	}
+
+	// The subjects tell the system roots, or those of another pool certs were added to, apart. Subjects is only
+	// deprecated for the system pool, which a pool given to WithRoots is not.
+	ids := roots.Subjects()
+	for _, c := range certs {
+		sum := sha256.Sum256(c.Raw)
+		ids = append(ids, sum[:])
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return bytes.Compare(ids[i], ids[j]) < 0
+	})
+	h := sha256.New()
+	for _, id := range ids {
+		h.Write(id)
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,93 @@
+package manifestgo
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// readCert reads a certificate from the goxar testdata, where root.pem and other-root.pem have the same subject and
+// different keys.
+func readCert(t *testing.T, name string) *x509.Certificate {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("goxar", "testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		t.Fatalf("no certificate in %s", name)
+	}
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func certPool(certs ...*x509.Certificate) *x509.CertPool {
+	pool := x509.NewCertPool()
+	for _, c := range certs {
+		pool.AddCert(c)
+	}
+	return pool
+}
+
+// withRoots returns a package of a URL with an Etag and a cache, verified against roots.
+func withRoots(roots *x509.CertPool, certs ...*x509.Certificate) *Package {
+	p := &Package{cache: &DirCache{}, reader: etagReader{length: 1, etag: `"v1"`}}
+	WithRoots(roots, certs...)(p)
+	return p
+}
+
+func TestRootsID(t *testing.T) {
+	root, other := readCert(t, "root.pem"), readCert(t, "other-root.pem")
+	if root.Subject.String() != other.Subject.String() {
+		t.Fatal("the roots have different subjects")
+	}
+
+	id := rootsID(certPool(root), []*x509.Certificate{root})
+	if id == "" {
+		t.Fatal("got no ID for a pool with certificates")
+	}
+	if otherID := rootsID(certPool(other), []*x509.Certificate{other}); otherID == id {
+		t.Error("pools of roots with the same subject and different keys have the same ID")
+	}
+	if both := rootsID(certPool(root, other), []*x509.Certificate{root, other}); both == id {
+		t.Error("a pool with another root added has the same ID")
+	}
+	if reordered := rootsID(certPool(other, root), []*x509.Certificate{other, root}); reordered != rootsID(certPool(root, other), []*x509.Certificate{root, other}) {
+		t.Error("the ID depends on the order the roots were added in")
+	}
+	if got := rootsID(nil, nil); got != "" {
+		t.Errorf("got ID %q for the system roots, want none", got)
+	}
+	if got := rootsID(certPool(root), nil); got != "" {
+		t.Errorf("got ID %q for a pool without its certificates, want none", got)
+	}
+}
+
+func TestWithRootsCache(t *testing.T) {
+	root, other := readCert(t, "root.pem"), readCert(t, "other-root.pem")
+
+	system := withRoots(nil)
+	p := withRoots(certPool(root), root)
+	q := withRoots(certPool(other), other)
+	for _, pkg := range []*Package{system, p, q} {
+		if !pkg.cacheable() {
+			t.Fatalf("package verified against roots %q is not cached", pkg.rootsID)
+		}
+	}
+	if p.cacheKey() == q.cacheKey() || p.cacheKey() == system.cacheKey() {
+		t.Error("packages verified against other roots share a cache entry")
+	}
+	if withRoots(certPool(root), root).cacheKey() != p.cacheKey() {
+		t.Error("packages verified against the same roots do not share a cache entry")
+	}
+
+	if withRoots(certPool(root)).cacheable() {
+		t.Error("a package verified against roots without their certificates is cached")
+	}
+}
@@ -0,0 +1,66 @@
+package manifestgo
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/dbyington/manifestgo/httpio"
+)
+
+var ErrHashMismatch = errors.New("manifestgo: package does not match the manifest hashes")
+
+// VerifyAsset downloads the package of a and checks it still hashes to the hashes of a, preferring its sha256s. It
+// returns an error wrapping ErrHashMismatch, saying which chunk differs, if the package has changed. opts are passed
+// to httpio.Fetch, to authenticate for example.
+func VerifyAsset(ctx context.Context, a *Asset, opts ...httpio.Option) error {
+	var (
+		newHash func() hash.Hash
+		want    []string
+		size    int64
+	)
+	switch {
+	case len(a.SHA256s) > 0:
+		newHash, want, size = sha256.New, a.SHA256s, a.SHA256Size
+	case len(a.MD5s) > 0:
+		newHash, want, size = md5.New, a.MD5s, a.MD5Size
+	default:
+		return errors.New("manifestgo: asset has no hashes")
+	}
+	if size <= 0 {
+		return ErrInvalidChunkSize
+	}
+
+	res, err := httpio.Fetch(append([]httpio.Option{httpio.WithContext(ctx), httpio.WithURL(a.URL)}, opts...)...)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	for i := 0; ; i++ {
+		h := newHash()
+		n, err := io.CopyN(h, res.Body, size)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n == 0 {
+			if i != len(want) {
+				return fmt.Errorf("%w: %d chunks, the manifest has %d", ErrHashMismatch, i, len(want))
+			}
+			return nil
+		}
+
+		if i >= len(want) {
+			return fmt.Errorf("%w: more than the %d chunks of the manifest", ErrHashMismatch, len(want))
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want[i]) {
+			return fmt.Errorf("%w: chunk %d is %s, the manifest has %s", ErrHashMismatch, i, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package manifestgo
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	xar "github.com/dbyington/manifestgo/goxar"
+)
+
+// WarningCode says what kind of non-fatal issue a Warning is.
+type WarningCode string
+
+const (
+	// WarningMalformedArchive is an irregularity in the archive recovered from by a lenient read.
+	WarningMalformedArchive WarningCode = "malformed-archive"
+	// WarningMissingTitle is a package without a title, which is left to the other title strategies.
+	WarningMissingTitle WarningCode = "missing-title"
+	// WarningAmbiguousPkgRef is a Distribution with several pkg-refs and no choice saying which is the primary one.
+	WarningAmbiguousPkgRef WarningCode = "ambiguous-pkg-ref"
+	// WarningUnsupportedEncoding is a metadata file in an encoding that could not be decoded as declared.
+	WarningUnsupportedEncoding WarningCode = "unsupported-encoding"
+	// WarningMetadataFallback is a missing value of the metadata which was taken from another value.
+	WarningMetadataFallback WarningCode = "metadata-fallback"
+	// WarningNoIcon is an app whose icon was asked for with WithIcon but could not be read.
+	WarningNoIcon WarningCode = "no-icon"
+	// WarningNoFileDigest is a package whose chunks were partly reused from a previous asset, so it has no FullSHA256.
+	WarningNoFileDigest WarningCode = "no-file-digest"
+	// WarningUnreadablePayload is a payload read with WithPayloadArchitectures whose executables could not be read.
+	WarningUnreadablePayload WarningCode = "unreadable-payload"
+)
+
+// Warning is a non-fatal issue found while reading a package.
+type Warning struct {
+	Code    WarningCode `json:"code"`
+	Message string      `json:"message"`
+}
+
+func (w Warning) String() string {
+	return string(w.Code) + ": " + w.Message
+}
+
+// Warnings returns the non-fatal issues found while reading the package, including the irregularities recovered from
+// when it was read leniently.
+func (p *Package) Warnings() []Warning {
+	if p == nil {
+		return nil
+	}
+
+	return p.warnings
+}
+
+func (p *Package) warn(code WarningCode, format string, a ...interface{}) {
+	w := Warning{Code: code, Message: fmt.Sprintf(format, a...)}
+	p.warnings = append(p.warnings, w)
+	p.logf("warning: %s", w)
+}
+
+// checkMetadata warns about the values of the metadata that had to be guessed.
+func (p *Package) checkMetadata() {
+	switch p.source {
+	case "":
+		p.warn(WarningMetadataFallback, "no Distribution or PackageInfo, the package has no metadata")
+		return
+	case sourcePackageInfo:
+		if _, ok := p.pkgInfoBundle(); !ok {
+			p.warn(WarningMissingTitle, "no bundle matching %q to take the title from", p.PkgInfo.Identifier)
+		}
+		return
+	}
+
+	product := p.product()
+	if p.primaryRef == "" && (product.ID == "" || product.Version == "") && !p.choosesPkgRef() {
+		// A Distribution can list the same pkg-ref more than once, so they are counted by id.
+		candidates := make(map[string]bool)
+		for _, ref := range p.PkgRef {
+			if ref.Version != "" || len(ref.Bundle) != 0 {
+				candidates[ref.ID] = true
+			}
+		}
+		if len(candidates) > 1 {
+			p.warn(WarningAmbiguousPkgRef, "%d pkg-refs and no choice selecting one, using %q", len(candidates), p.getPrimaryPkgRef().ID)
+		}
+	}
+
+	ref := p.getPrimaryPkgRef()
+	bundle := p.getPrimaryPkgRefBundle()
+	if product.ID == "" && bundle.ID == "" && ref.ID != "" {
+		p.warn(WarningMetadataFallback, "no bundle in pkg-ref %q, using its id as the bundle identifier", ref.ID)
+	}
+	if product.Version == "" && ref.Version == "" && bundle.Version != "" {
+		p.warn(WarningMetadataFallback, "no version in pkg-ref %q, using the bundle version %q", ref.ID, bundle.Version)
+	}
+
+	if p.Title == "" {
+		p.warn(WarningMissingTitle, "no title in the Distribution")
+	}
+}
+
+// choosesPkgRef reports whether the choice of the Distribution selects the primary pkg-ref.
+func (p *Package) choosesPkgRef() bool {
+	if len(p.Choice.PkgRef) == 0 || p.Choice.ID == "" {
+		return false
+	}
+
+	for _, ref := range p.PkgRef {
+		if ref.ID == p.Choice.ID && (ref.Version != "" || len(ref.Bundle) != 0) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unmarshalXML decodes the metadata file name into v as it is read, within the XMLLimits of the package, collecting
+// the scripts of a Distribution rather than decoding them. A file declaring an encoding other than UTF-8 or ASCII is
+// decoded as UTF-8 with a warning, which is right for the ASCII content of almost every package.
+func (p *Package) unmarshalXML(name string, r io.Reader, v interface{}) error {
+	d := xml.NewDecoder(r)
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		switch strings.ToLower(charset) {
+		case "utf-8", "utf8", "us-ascii", "ascii":
+		default:
+			p.warn(WarningUnsupportedEncoding, "%s declares encoding %q, reading it as UTF-8", name, charset)
+		}
+		return input, nil
+	}
+
+	l := &xmlLimiter{d: d, name: name, limits: p.xmlLimits.withDefaults()}
+	if sourceFile(name) == sourceDistribution {
+		l.scripts = &p.scripts
+	}
+
+	return xml.NewTokenDecoder(l).Decode(v)
+}
+
+// openMetadata opens f, skipping a file in an unsupported encoding with a warning when reading leniently.
+func (p *Package) openMetadata(f *xar.File) (io.Reader, bool, error) {
+	r, err := f.Open()
+	if err == nil {
+		return r, true, nil
+	}
+	if p.lenient && errors.Is(err, xar.ErrFileEncodingUnsupported) {
+		p.warn(WarningUnsupportedEncoding, "skipping %s: %s", f.Name, err)
+		p.recovered = true
+		return nil, false, nil
+	}
+
+	return nil, false, err
+}
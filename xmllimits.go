@@ -0,0 +1,151 @@
+package manifestgo
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrXMLLimit = errors.New("manifestgo: metadata XML over limit")
+
+// Defaults for the fields of XMLLimits.
+const (
+	DefaultXMLMaxDepth     = 64
+	DefaultXMLMaxTokenSize = 1 << 20
+)
+
+// XMLLimits bound the XML of the Distribution and PackageInfo of a package, so a hostile one cannot make decoding it
+// recurse or copy without bound. A zero field uses its default.
+type XMLLimits struct {
+	// MaxDepth is the deepest elements may nest.
+	MaxDepth int
+	// MaxTokenSize is the largest text, comment or element, counting its attributes, accepted.
+	MaxTokenSize int
+}
+
+func (l XMLLimits) withDefaults() XMLLimits {
+	if l.MaxDepth <= 0 {
+		l.MaxDepth = DefaultXMLMaxDepth
+	}
+	if l.MaxTokenSize <= 0 {
+		l.MaxTokenSize = DefaultXMLMaxTokenSize
+	}
+	return l
+}
+
+// skippedXMLElements are the sections of a Distribution that are not decoded and can be large, such as the JavaScript
+// of its installation and volume checks and its embedded localizations, which are passed over rather than decoded.
+var skippedXMLElements = map[string]bool{
+	"script":       true,
+	"localization": true,
+}
+
+// xmlLimiter is an xml.TokenReader passing on the tokens of d within limits, less the skipped elements. The scripts
+// of a Distribution are collected into scripts when it is not nil.
+type xmlLimiter struct {
+	d       *xml.Decoder
+	name    string
+	limits  XMLLimits
+	depth   int
+	scripts *DistributionScripts
+}
+
+func (l *xmlLimiter) Token() (xml.Token, error) {
+	for {
+		tok, err := l.d.Token()
+		if err != nil {
+			return tok, err
+		}
+		if size := xmlTokenSize(tok); size > l.limits.MaxTokenSize {
+			return nil, fmt.Errorf("%w: %s has a token of %d bytes, the limit is %d", ErrXMLLimit, l.name, size, l.limits.MaxTokenSize)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if l.scripts != nil {
+				switch t.Name.Local {
+				case "installation-check":
+					l.scripts.InstallationCheck = xmlAttr(t, "script")
+				case "volume-check":
+					l.scripts.VolumeCheck = xmlAttr(t, "script")
+				case "script":
+					if err := l.readScript(); err != nil {
+						return nil, err
+					}
+					continue
+				}
+			}
+			if skippedXMLElements[t.Name.Local] {
+				if err := l.d.Skip(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if l.depth++; l.depth > l.limits.MaxDepth {
+				return nil, fmt.Errorf("%w: %s nests elements deeper than %d", ErrXMLLimit, l.name, l.limits.MaxDepth)
+			}
+		case xml.EndElement:
+			l.depth--
+		}
+
+		return tok, nil
+	}
+}
+
+// xmlTokenSize returns the length of the text of tok.
+func xmlTokenSize(tok xml.Token) int {
+	switch t := tok.(type) {
+	case xml.StartElement:
+		n := len(t.Name.Local)
+		for _, a := range t.Attr {
+			n += len(a.Name.Local) + len(a.Value)
+		}
+		return n
+	case xml.CharData:
+		return len(t)
+	case xml.Comment:
+		return len(t)
+	case xml.ProcInst:
+		return len(t.Inst)
+	case xml.Directive:
+		return len(t)
+	}
+
+	return 0
+}
+
+// readScript reads the JavaScript of a script element up to its end, which counts as a single token.
+func (l *xmlLimiter) readScript() error {
+	var src []byte
+	for depth := 1; depth > 0; {
+		tok, err := l.d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if len(src)+len(t) > l.limits.MaxTokenSize {
+				return fmt.Errorf("%w: %s has a script of over %d bytes", ErrXMLLimit, l.name, l.limits.MaxTokenSize)
+			}
+			src = append(src, t...)
+		}
+	}
+	l.scripts.Scripts = append(l.scripts.Scripts, strings.TrimSpace(string(src)))
+
+	return nil
+}
+
+func xmlAttr(start xml.StartElement, name string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+
+	return ""
+}
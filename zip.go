@@ -0,0 +1,18 @@
+package manifestgo
+
+import (
+	"github.com/dbyington/manifestgo/internal/bundle"
+)
+
+// ReadZip reads a zipped app bundle, which InstallEnterpriseApplication installs like a package when it is signed,
+// as ReadDMG reads a disk image: it is hashed in chunks while the metadata is taken from the Info.plist of the app at
+// the top level of the archive. Only the central directory and the Info.plist are read besides the hash.
+func (p *Package) ReadZip() error {
+	return p.readApp("zip archive", bundle.ReadZip)
+}
+
+// ReadZipFile reads the zipped app bundle name like ReadZip, hashing it whole like ReadPkgFile. opts configure the
+// Package before it is read, such as WithMetadata giving metadata to keep.
+func ReadZipFile(name string, opts ...Option) (*Package, error) {
+	return readAppFile(name, "zip archive", bundle.ReadZip, opts)
+}